@@ -3,8 +3,11 @@ package data
 import (
 	"easydarwin/internal/data/model"
 	"log/slog"
+	"strings"
 	"sync"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // CreateAlert 创建告警记录
@@ -15,8 +18,12 @@ func CreateAlert(alert *model.Alert) error {
 // CreateAlertWithLimit 创建告警记录，并限制数据库中的记录数
 // maxAlerts: 最大告警记录数，超过此数量会删除最旧的记录，0表示不限制
 func CreateAlertWithLimit(alert *model.Alert, maxAlerts int) error {
-	db := GetDatabase()
-	
+	return GetDatabase().Transaction(func(db *gorm.DB) error {
+		return createAlertWithLimit(db, alert, maxAlerts)
+	})
+}
+
+func createAlertWithLimit(db *gorm.DB, alert *model.Alert, maxAlerts int) error {
 	// 如果设置了限制，先检查并删除旧记录
 	if maxAlerts > 0 {
 		var count int64
@@ -40,7 +47,7 @@ func CreateAlertWithLimit(alert *model.Alert, maxAlerts int) error {
 				}
 				
 				if len(oldIDs) > 0 {
-					if err := db.Delete(&model.Alert{}, oldIDs).Error; err != nil {
+					if _, err := deleteAlerts(db, oldIDs); err != nil {
 						return err
 					}
 				}
@@ -72,6 +79,16 @@ func ListAlerts(filter model.AlertFilter) ([]model.Alert, int64, error) {
 	if filter.MaxDetections > 0 {
 		db = db.Where("detection_count <= ?", filter.MaxDetections)
 	}
+	if filter.Status != "" {
+		db = db.Where("status IN ?", strings.Split(filter.Status, ","))
+	}
+	if filter.AssigneeID > 0 {
+		db = db.Where("assignee_id = ?", filter.AssigneeID)
+	}
+	// 检测目标条件作用于同一个检测目标（如：置信度大于0.8的某类别目标）
+	if detections := detectionFilter(filter); detections != nil {
+		db = db.Where("id IN (?)", detections)
+	}
 	if !filter.StartTime.IsZero() {
 		db = db.Where("created_at >= ?", filter.StartTime)
 	}
@@ -106,18 +123,60 @@ func ListAlerts(filter model.AlertFilter) ([]model.Alert, int64, error) {
 	return alerts, total, nil
 }
 
-// GetAlertByID 根据ID获取告警
+// detectionFilter 根据检测目标条件构建告警ID子查询，没有检测目标条件时返回nil
+func detectionFilter(filter model.AlertFilter) *gorm.DB {
+	if filter.Class == "" && filter.MinConfidence <= 0 && filter.MinBBoxArea <= 0 && filter.MaxBBoxArea <= 0 && filter.TrackID == "" {
+		return nil
+	}
+
+	db := GetDatabase().Model(&model.AlertDetection{}).Select("alert_id")
+	if filter.Class != "" {
+		db = db.Where("class = ?", filter.Class)
+	}
+	if filter.MinConfidence > 0 {
+		db = db.Where("confidence >= ?", filter.MinConfidence)
+	}
+	if filter.MinBBoxArea > 0 {
+		db = db.Where("area >= ?", filter.MinBBoxArea)
+	}
+	if filter.MaxBBoxArea > 0 {
+		db = db.Where("area <= ?", filter.MaxBBoxArea)
+	}
+	if filter.TrackID != "" {
+		db = db.Where("track_id = ?", filter.TrackID)
+	}
+	return db
+}
+
+// GetAlertByID 根据ID获取告警（包含检测目标和复核结果）
 func GetAlertByID(id uint) (*model.Alert, error) {
 	var alert model.Alert
-	if err := GetDatabase().First(&alert, id).Error; err != nil {
+	if err := GetDatabase().Preload("Detections").Preload("Feedback").First(&alert, id).Error; err != nil {
 		return nil, err
 	}
 	return &alert, nil
 }
 
+// alertChildren 随告警一起删除的关联记录（按 alert_id 关联）
+var alertChildren = []interface{}{&model.AlertDetection{}, &model.AlertFeedback{}, &model.AlertComment{}, &model.AlertHistory{}}
+
+// deleteAlerts 删除告警及其检测目标、复核结果和备注/处理记录，返回删除的告警数（应在事务中调用）
+func deleteAlerts(tx *gorm.DB, ids []uint) (int64, error) {
+	for _, child := range alertChildren {
+		if err := tx.Where("alert_id IN ?", ids).Delete(child).Error; err != nil {
+			return 0, err
+		}
+	}
+	result := tx.Delete(&model.Alert{}, ids)
+	return result.RowsAffected, result.Error
+}
+
 // DeleteAlert 删除告警
 func DeleteAlert(id uint) error {
-	return GetDatabase().Delete(&model.Alert{}, id).Error
+	return GetDatabase().Transaction(func(tx *gorm.DB) error {
+		_, err := deleteAlerts(tx, []uint{id})
+		return err
+	})
 }
 
 // BatchDeleteAlerts 批量删除告警
@@ -127,12 +186,17 @@ func BatchDeleteAlerts(ids []uint) (int, error) {
 	}
 	
 	// 使用事务批量删除
-	result := GetDatabase().Delete(&model.Alert{}, ids)
-	if result.Error != nil {
-		return 0, result.Error
+	var deleted int64
+	err := GetDatabase().Transaction(func(tx *gorm.DB) error {
+		var err error
+		deleted, err = deleteAlerts(tx, ids)
+		return err
+	})
+	if err != nil {
+		return 0, err
 	}
 	
-	return int(result.RowsAffected), nil
+	return int(deleted), nil
 }
 
 // GetDistinctTaskIDs 获取所有不重复的任务ID列表
@@ -151,9 +215,53 @@ func GetDistinctTaskIDs() ([]string, error) {
 	return taskIDs, nil
 }
 
-// AutoMigrate 自动迁移alert表
+// UpdateAlertRollup 将被抑制的重复告警合并到保留的告警（按 dedup_key 定位）
+// 返回更新后的告警（包含检测目标），未找到时返回nil（告警可能仍在批量写入缓冲区中尚未落库）
+func UpdateAlertRollup(dedupKey string, hitCount int, lastSeenAt time.Time) (*model.Alert, error) {
+	result := GetDatabase().Model(&model.Alert{}).
+		Where("dedup_key = ?", dedupKey).
+		Updates(map[string]interface{}{
+			"hit_count":    hitCount,
+			"last_seen_at": lastSeenAt,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	var alert model.Alert
+	if err := GetDatabase().Preload("Detections").Where("dedup_key = ?", dedupKey).First(&alert).Error; err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// UpdateAlertClip 告警视频片段上传后写入片段路径，返回更新后的告警（告警已被删除时返回nil）
+func UpdateAlertClip(id uint, clipPath string) (*model.Alert, error) {
+	result := GetDatabase().Model(&model.Alert{}).Where("id = ?", id).Update("clip_path", clipPath)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	var alert model.Alert
+	if err := GetDatabase().Preload("Detections").First(&alert, id).Error; err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// AutoMigrate 自动迁移alert表、检测目标表、告警发件箱表、告警规则表、告警备注/处理记录表、复核结果表、告警回调表、算法应用任务类型/注册审计表、灰度发布表及影子推理对比表
 func MigrateAlertTable() error {
-	return GetDatabase().AutoMigrate(&model.Alert{})
+	return GetDatabase().AutoMigrate(&model.Alert{}, &model.AlertDetection{}, &model.AlertOutbox{}, &model.AlertRule{},
+		&model.AlertComment{}, &model.AlertHistory{}, &model.AlertFeedback{},
+		&model.Webhook{}, &model.WebhookDelivery{},
+		&model.AlgorithmAppScope{}, &model.AlgorithmAudit{}, &model.AlgorithmCanary{},
+		&model.ShadowComparison{})
 }
 
 // AlertBatchWriter 批量写入告警记录
@@ -167,6 +275,7 @@ type AlertBatchWriter struct {
 	log         *slog.Logger
 	enabled     bool
 	maxAlertsInDB int // 数据库中最多保存的告警记录数，0表示不限制
+	onCreated   func([]*model.Alert) // 告警落库后回调（用于实时推送）
 }
 
 // NewAlertBatchWriter 创建批量写入器
@@ -189,6 +298,18 @@ func NewAlertBatchWriter(batchSize int, intervalSec int, enabled bool, maxAlerts
 	}
 }
 
+// SetOnCreatedCallback 设置告警落库后的回调（回调中不能阻塞）
+func (w *AlertBatchWriter) SetOnCreatedCallback(callback func([]*model.Alert)) {
+	w.onCreated = callback
+}
+
+// notifyCreated 通知已落库的告警
+func (w *AlertBatchWriter) notifyCreated(alerts []*model.Alert) {
+	if w.onCreated != nil && len(alerts) > 0 {
+		w.onCreated(alerts)
+	}
+}
+
 // Start 启动批量写入器
 func (w *AlertBatchWriter) Start() {
 	if !w.enabled {
@@ -221,7 +342,11 @@ func (w *AlertBatchWriter) Stop() {
 func (w *AlertBatchWriter) Add(alert *model.Alert) error {
 	if !w.enabled {
 		// 批量写入未启用，直接写入
-		return CreateAlertWithLimit(alert, w.maxAlertsInDB)
+		if err := CreateAlertWithLimit(alert, w.maxAlertsInDB); err != nil {
+			return err
+		}
+		w.notifyCreated([]*model.Alert{alert})
+		return nil
 	}
 	
 	w.mu.Lock()
@@ -290,7 +415,10 @@ func (w *AlertBatchWriter) flush() {
 						w.log.Error("failed to find old alerts to delete",
 							slog.String("err", err.Error()))
 					} else if len(oldIDs) > 0 {
-						if err := db.Delete(&model.Alert{}, oldIDs).Error; err != nil {
+						if err := db.Transaction(func(tx *gorm.DB) error {
+							_, err := deleteAlerts(tx, oldIDs)
+							return err
+						}); err != nil {
 							w.log.Error("failed to delete old alerts",
 								slog.Int("count", len(oldIDs)),
 								slog.String("err", err.Error()))
@@ -319,11 +447,14 @@ func (w *AlertBatchWriter) flush() {
 		// 失败时尝试逐条插入（降级处理）
 		w.log.Info("trying to insert alerts one by one as fallback")
 		successCount := 0
+		created := make([]*model.Alert, 0, len(toFlush))
 		for _, alert := range toFlush {
 			if err := CreateAlertWithLimit(alert, w.maxAlertsInDB); err == nil {
 				successCount++
+				created = append(created, alert)
 			}
 		}
+		w.notifyCreated(created)
 		w.log.Info("fallback insert completed",
 			slog.Int("success", successCount),
 			slog.Int("failed", len(toFlush)-successCount))
@@ -332,6 +463,7 @@ func (w *AlertBatchWriter) flush() {
 			slog.Int("count", len(toFlush)),
 			slog.Duration("duration", duration),
 			slog.Float64("avg_ms_per_alert", float64(duration.Milliseconds())/float64(len(toFlush))))
+		w.notifyCreated(toFlush)
 	}
 }
 
@@ -0,0 +1,110 @@
+package data
+
+import (
+	"easydarwin/internal/data/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SaveAlertFeedback 保存告警复核结果（同一告警重复复核时覆盖），算法与版本取自告警
+func SaveAlertFeedback(feedback *model.AlertFeedback) error {
+	return GetDatabase().Transaction(func(tx *gorm.DB) error {
+		if err := checkUser(tx, feedback.UserID); err != nil {
+			return err
+		}
+		var alert model.Alert
+		if err := tx.Select("id", "task_type", "algorithm_id", "algorithm_version").First(&alert, feedback.AlertID).Error; err != nil {
+			return err
+		}
+		feedback.ID = 0
+		feedback.TaskType = alert.TaskType
+		feedback.AlgorithmID = alert.AlgorithmID
+		feedback.AlgorithmVersion = alert.AlgorithmVersion
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "alert_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"correct", "labels", "user_id", "note", "updated_at"}),
+		}).Create(feedback).Error
+	})
+}
+
+// GetAlertFeedback 获取告警复核结果
+func GetAlertFeedback(alertID uint) (*model.AlertFeedback, error) {
+	var feedback model.AlertFeedback
+	if err := GetDatabase().Where("alert_id = ?", alertID).First(&feedback).Error; err != nil {
+		return nil, err
+	}
+	return &feedback, nil
+}
+
+// FeedbackStats 按算法及版本统计的复核结果
+type FeedbackStats struct {
+	AlgorithmID      string  `json:"algorithm_id"`
+	AlgorithmVersion string  `json:"algorithm_version"`
+	TaskType         string  `json:"task_type"`
+	Correct          int64   `json:"correct"`
+	Incorrect        int64   `json:"incorrect"`
+	Precision        float64 `json:"precision"` // 复核为正确的比例
+}
+
+// GetFeedbackStats 按算法、版本和任务类型统计复核结果，taskType 为空时统计全部
+func GetFeedbackStats(taskType string) ([]FeedbackStats, error) {
+	var stats []FeedbackStats
+	db := GetDatabase().Model(&model.AlertFeedback{}).
+		Select("algorithm_id, algorithm_version, task_type, " +
+			"SUM(CASE WHEN correct THEN 1 ELSE 0 END) AS correct, " +
+			"SUM(CASE WHEN correct THEN 0 ELSE 1 END) AS incorrect")
+	if taskType != "" {
+		db = db.Where("task_type = ?", taskType)
+	}
+	if err := db.Group("algorithm_id, algorithm_version, task_type").
+		Order("algorithm_id, algorithm_version, task_type").
+		Scan(&stats).Error; err != nil {
+		return nil, err
+	}
+	for i := range stats {
+		if total := stats[i].Correct + stats[i].Incorrect; total > 0 {
+			stats[i].Precision = float64(stats[i].Correct) / float64(total)
+		}
+	}
+	return stats, nil
+}
+
+// ListAlertsForExport 查询待导出为训练数据的告警（包含检测目标和复核结果，只返回有图片的告警）
+func ListAlertsForExport(filter model.AlertExportFilter) ([]model.Alert, error) {
+	db := GetDatabase().Model(&model.Alert{}).Where("image_path != ''")
+	if filter.TaskType != "" {
+		db = db.Where("task_type = ?", filter.TaskType)
+	}
+	if filter.AlgorithmID != "" {
+		db = db.Where("algorithm_id = ?", filter.AlgorithmID)
+	}
+	if filter.AlgorithmVersion != "" {
+		db = db.Where("algorithm_version = ?", filter.AlgorithmVersion)
+	}
+	if !filter.StartTime.IsZero() {
+		db = db.Where("created_at >= ?", filter.StartTime)
+	}
+	if !filter.EndTime.IsZero() {
+		db = db.Where("created_at <= ?", filter.EndTime)
+	}
+
+	reviewed := GetDatabase().Model(&model.AlertFeedback{}).Select("alert_id")
+	switch filter.Feedback {
+	case model.FeedbackStateCorrect:
+		db = db.Where("id IN (?)", reviewed.Where("correct = ?", true))
+	case model.FeedbackStateIncorrect:
+		db = db.Where("id IN (?)", reviewed.Where("correct = ?", false))
+	case model.FeedbackStateReviewed:
+		db = db.Where("id IN (?)", reviewed)
+	case model.FeedbackStateUnreviewed:
+		db = db.Where("id NOT IN (?)", reviewed)
+	}
+	if filter.Limit > 0 {
+		db = db.Limit(filter.Limit)
+	}
+
+	var alerts []model.Alert
+	err := db.Preload("Detections").Preload("Feedback").Order("id ASC").Find(&alerts).Error
+	return alerts, err
+}
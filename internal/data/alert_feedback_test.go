@@ -0,0 +1,89 @@
+package data
+
+import (
+	"easydarwin/internal/data/model"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestAlertFeedback(t *testing.T) {
+	setupLifecycleDB(t)
+
+	alerts := []model.Alert{
+		{TaskID: "cam1", TaskType: "helmet", AlgorithmID: "algo", AlgorithmVersion: "v1", ImagePath: "a/1.jpg"},
+		{TaskID: "cam1", TaskType: "helmet", AlgorithmID: "algo", AlgorithmVersion: "v2", ImagePath: "a/2.jpg"},
+		{TaskID: "cam2", TaskType: "helmet", AlgorithmID: "algo", AlgorithmVersion: "v2", ImagePath: "a/3.jpg"},
+		{TaskID: "cam2", TaskType: "helmet", AlgorithmID: "algo", AlgorithmVersion: "v2"},
+	}
+	if err := GetDatabase().Create(&alerts).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SaveAlertFeedback(&model.AlertFeedback{AlertID: 999, Correct: true}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("feedback on missing alert should fail, got %v", err)
+	}
+	if err := SaveAlertFeedback(&model.AlertFeedback{AlertID: alerts[0].ID, Correct: true, UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveAlertFeedback(&model.AlertFeedback{AlertID: alerts[1].ID, Correct: true, UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// 重复复核覆盖上一次结果
+	labels := []model.FeedbackLabel{{Class: "person", BBox: [4]float64{10, 10, 50, 80}}}
+	if err := SaveAlertFeedback(&model.AlertFeedback{AlertID: alerts[1].ID, Correct: false, Labels: labels, UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	feedback, err := GetAlertFeedback(alerts[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feedback.Correct || len(feedback.Labels) != 1 || feedback.AlgorithmVersion != "v2" {
+		t.Fatalf("unexpected feedback: %+v", feedback)
+	}
+
+	stats, err := GetFeedbackStats("helmet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[0].AlgorithmVersion != "v1" || stats[0].Correct != 1 || stats[1].Incorrect != 1 || stats[1].Precision != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	cases := []struct {
+		filter model.AlertExportFilter
+		want   []uint
+	}{
+		{model.AlertExportFilter{}, []uint{alerts[0].ID, alerts[1].ID, alerts[2].ID}},
+		{model.AlertExportFilter{AlgorithmVersion: "v2"}, []uint{alerts[1].ID, alerts[2].ID}},
+		{model.AlertExportFilter{Feedback: model.FeedbackStateCorrect}, []uint{alerts[0].ID}},
+		{model.AlertExportFilter{Feedback: model.FeedbackStateIncorrect}, []uint{alerts[1].ID}},
+		{model.AlertExportFilter{Feedback: model.FeedbackStateUnreviewed}, []uint{alerts[2].ID}},
+		{model.AlertExportFilter{Feedback: model.FeedbackStateReviewed, Limit: 1}, []uint{alerts[0].ID}},
+	}
+	for _, tc := range cases {
+		list, err := ListAlertsForExport(tc.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []uint
+		for _, a := range list {
+			got = append(got, a.ID)
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("filter %+v: got %v, want %v", tc.filter, got, tc.want)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Fatalf("filter %+v: got %v, want %v", tc.filter, got, tc.want)
+			}
+		}
+	}
+
+	list, _ := ListAlertsForExport(model.AlertExportFilter{Feedback: model.FeedbackStateIncorrect})
+	if list[0].Feedback == nil || len(list[0].Feedback.Labels) != 1 {
+		t.Fatal("export should preload feedback")
+	}
+}
@@ -0,0 +1,173 @@
+package data
+
+import (
+	"easydarwin/internal/data/model"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAlertStatus = errors.New("invalid alert status")
+	ErrInvalidTransition  = errors.New("invalid alert status transition")
+	ErrUserNotFound       = errors.New("user not found")
+)
+
+// SkippedAlert 批量处理时未处理的告警及原因
+type SkippedAlert struct {
+	ID     uint   `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// checkUser 校验用户存在（0表示不指定用户，不校验）
+func checkUser(tx *gorm.DB, userID int) error {
+	if userID == 0 {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&User{}).Scopes(ExcludeDevelopers).Where("id = ?", userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: %d", ErrUserNotFound, userID)
+	}
+	return nil
+}
+
+// TransitionAlert 变更告警状态并记录处理记录
+func TransitionAlert(id uint, status string, userID int, note string) error {
+	if !model.ValidAlertStatus(status) {
+		return fmt.Errorf("%w: %s", ErrInvalidAlertStatus, status)
+	}
+	return GetDatabase().Transaction(func(tx *gorm.DB) error {
+		if err := checkUser(tx, userID); err != nil {
+			return err
+		}
+		return transitionAlert(tx, id, status, userID, note)
+	})
+}
+
+// TransitionAlerts 批量变更告警状态，不存在或不允许流转的告警跳过
+// 返回变更的告警数和跳过的告警
+func TransitionAlerts(ids []uint, status string, userID int, note string) (int, []SkippedAlert, error) {
+	if !model.ValidAlertStatus(status) {
+		return 0, nil, fmt.Errorf("%w: %s", ErrInvalidAlertStatus, status)
+	}
+
+	updated := 0
+	var skipped []SkippedAlert
+	err := GetDatabase().Transaction(func(tx *gorm.DB) error {
+		if err := checkUser(tx, userID); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			err := transitionAlert(tx, id, status, userID, note)
+			switch {
+			case err == nil:
+				updated++
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				skipped = append(skipped, SkippedAlert{ID: id, Reason: "alert not found"})
+			case errors.Is(err, ErrInvalidTransition):
+				skipped = append(skipped, SkippedAlert{ID: id, Reason: err.Error()})
+			default:
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return updated, skipped, nil
+}
+
+func transitionAlert(tx *gorm.DB, id uint, status string, userID int, note string) error {
+	var alert model.Alert
+	if err := tx.Select("id", "status").First(&alert, id).Error; err != nil {
+		return err
+	}
+	if !model.CanTransitAlertStatus(alert.Status, status) {
+		return fmt.Errorf("%w: from %s to %s", ErrInvalidTransition, alert.Status, status)
+	}
+
+	var resolvedAt *time.Time
+	if model.IsAlertClosed(status) {
+		now := time.Now()
+		resolvedAt = &now
+	}
+	if err := tx.Model(&model.Alert{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      status,
+		"resolved_at": resolvedAt,
+	}).Error; err != nil {
+		return err
+	}
+	return tx.Create(&model.AlertHistory{
+		AlertID:    id,
+		UserID:     userID,
+		Action:     model.AlertActionStatus,
+		FromStatus: alert.Status,
+		ToStatus:   status,
+		Note:       note,
+	}).Error
+}
+
+// AssignAlert 指派告警处理人（assigneeID 为0时取消指派）并记录处理记录
+func AssignAlert(id uint, assigneeID, userID int, note string) error {
+	return GetDatabase().Transaction(func(tx *gorm.DB) error {
+		if err := checkUser(tx, assigneeID); err != nil {
+			return err
+		}
+		if err := checkUser(tx, userID); err != nil {
+			return err
+		}
+
+		var alert model.Alert
+		if err := tx.Select("id", "assignee_id").First(&alert, id).Error; err != nil {
+			return err
+		}
+		if alert.AssigneeID == assigneeID {
+			return nil
+		}
+
+		if err := tx.Model(&model.Alert{}).Where("id = ?", id).Update("assignee_id", assigneeID).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.AlertHistory{
+			AlertID:      id,
+			UserID:       userID,
+			Action:       model.AlertActionAssign,
+			FromAssignee: alert.AssigneeID,
+			ToAssignee:   assigneeID,
+			Note:         note,
+		}).Error
+	})
+}
+
+// AddAlertComment 添加告警备注
+func AddAlertComment(comment *model.AlertComment) error {
+	return GetDatabase().Transaction(func(tx *gorm.DB) error {
+		if err := checkUser(tx, comment.UserID); err != nil {
+			return err
+		}
+		if err := tx.Select("id").First(&model.Alert{}, comment.AlertID).Error; err != nil {
+			return err
+		}
+		return tx.Create(comment).Error
+	})
+}
+
+// ListAlertComments 获取告警备注（按时间正序）
+func ListAlertComments(alertID uint) ([]model.AlertComment, error) {
+	var comments []model.AlertComment
+	err := GetDatabase().Where("alert_id = ?", alertID).Order("created_at ASC, id ASC").Find(&comments).Error
+	return comments, err
+}
+
+// ListAlertHistory 获取告警处理记录（按时间正序）
+func ListAlertHistory(alertID uint) ([]model.AlertHistory, error) {
+	var history []model.AlertHistory
+	err := GetDatabase().Where("alert_id = ?", alertID).Order("created_at ASC, id ASC").Find(&history).Error
+	return history, err
+}
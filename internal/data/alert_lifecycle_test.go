@@ -0,0 +1,123 @@
+package data
+
+import (
+	"easydarwin/internal/data/model"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupLifecycleDB(t *testing.T) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := DB
+	DB = db
+	t.Cleanup(func() { DB = prev })
+
+	if err := MigrateAlertTable(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&User{ID: 1, Username: "operator"}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAlertStatusTransitions(t *testing.T) {
+	setupLifecycleDB(t)
+
+	alerts := []model.Alert{{TaskID: "cam1"}, {TaskID: "cam2"}}
+	if err := GetDatabase().Create(&alerts).Error; err != nil {
+		t.Fatal(err)
+	}
+	var created model.Alert
+	GetDatabase().First(&created, alerts[0].ID)
+	if created.Status != model.AlertStatusNew {
+		t.Fatalf("default status = %q, want new", created.Status)
+	}
+
+	if err := TransitionAlert(alerts[0].ID, model.AlertStatusResolved, 1, "handled"); err != nil {
+		t.Fatal(err)
+	}
+	if err := TransitionAlert(alerts[0].ID, model.AlertStatusInProgress, 1, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("resolved alert must be reopened first, got %v", err)
+	}
+	if err := TransitionAlert(alerts[0].ID, "closed", 1, ""); !errors.Is(err, ErrInvalidAlertStatus) {
+		t.Fatalf("unknown status should be rejected, got %v", err)
+	}
+	if err := TransitionAlert(alerts[0].ID, model.AlertStatusNew, 42, ""); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("unknown user should be rejected, got %v", err)
+	}
+
+	updated, skipped, err := TransitionAlerts([]uint{alerts[0].ID, alerts[1].ID, 999}, model.AlertStatusAcknowledged, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 1 || len(skipped) != 2 {
+		t.Fatalf("updated = %d, skipped = %+v; want 1 updated and 2 skipped", updated, skipped)
+	}
+
+	list, total, err := ListAlerts(model.AlertFilter{Status: "acknowledged,in_progress"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || list[0].ID != alerts[1].ID {
+		t.Fatalf("status filter returned %d alerts", total)
+	}
+
+	var resolved model.Alert
+	GetDatabase().First(&resolved, alerts[0].ID)
+	if resolved.ResolvedAt == nil {
+		t.Fatal("resolved_at should be set when alert is resolved")
+	}
+}
+
+func TestAlertAssignAndComments(t *testing.T) {
+	setupLifecycleDB(t)
+
+	alert := model.Alert{TaskID: "cam1"}
+	if err := GetDatabase().Create(&alert).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AssignAlert(alert.ID, 2, 1, ""); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("unknown assignee should be rejected, got %v", err)
+	}
+	if err := AssignAlert(alert.ID, 1, 1, "on duty"); err != nil {
+		t.Fatal(err)
+	}
+	if err := TransitionAlert(alert.ID, model.AlertStatusInProgress, 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAlertComment(&model.AlertComment{AlertID: alert.ID, UserID: 1, Content: "checking camera"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAlertComment(&model.AlertComment{AlertID: 999, Content: "x"}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("comment on missing alert should fail, got %v", err)
+	}
+
+	if list, total, _ := ListAlerts(model.AlertFilter{AssigneeID: 1}); total != 1 || list[0].AssigneeID != 1 {
+		t.Fatal("assignee filter should return the assigned alert")
+	}
+
+	history, err := ListAlertHistory(alert.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Action != model.AlertActionAssign || history[1].ToStatus != model.AlertStatusInProgress {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+	comments, err := ListAlertComments(alert.ID)
+	if err != nil || len(comments) != 1 {
+		t.Fatalf("comments = %+v, err = %v", comments, err)
+	}
+}
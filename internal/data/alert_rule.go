@@ -0,0 +1,38 @@
+package data
+
+import "easydarwin/internal/data/model"
+
+// ListAlertRules 获取告警规则，taskType 为空时返回全部
+func ListAlertRules(taskType string) ([]model.AlertRule, error) {
+	var rules []model.AlertRule
+	db := GetDatabase().Model(&model.AlertRule{})
+	if taskType != "" {
+		db = db.Where("task_type = ?", taskType)
+	}
+	err := db.Order("id ASC").Find(&rules).Error
+	return rules, err
+}
+
+// GetAlertRule 根据ID获取告警规则
+func GetAlertRule(id uint) (*model.AlertRule, error) {
+	var rule model.AlertRule
+	if err := GetDatabase().First(&rule, id).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// CreateAlertRule 创建告警规则
+func CreateAlertRule(rule *model.AlertRule) error {
+	return GetDatabase().Create(rule).Error
+}
+
+// UpdateAlertRule 更新告警规则（整条覆盖）
+func UpdateAlertRule(rule *model.AlertRule) error {
+	return GetDatabase().Save(rule).Error
+}
+
+// DeleteAlertRule 删除告警规则
+func DeleteAlertRule(id uint) error {
+	return GetDatabase().Delete(&model.AlertRule{}, id).Error
+}
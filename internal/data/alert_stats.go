@@ -0,0 +1,201 @@
+package data
+
+import (
+	"easydarwin/internal/data/model"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidStatsParam = errors.New("invalid stats parameter")
+
+const (
+	maxStatsTimeBuckets   = 5000 // 按时间统计最多返回的时间段数
+	defaultStatsGroupSize = 20
+	maxStatsGroupSize     = 1000
+	defaultHistogramMax   = 10
+	maxHistogramMax       = 100
+)
+
+var statsIntervals = map[string]int64{
+	model.StatsIntervalHour: 3600,
+	model.StatsIntervalDay:  86400,
+	model.StatsIntervalWeek: 7 * 86400,
+}
+
+// statsFilter 按统计筛选条件构建告警查询
+func statsFilter(filter model.AlertStatsFilter) *gorm.DB {
+	db := GetDatabase().Model(&model.Alert{})
+	if filter.TaskID != "" {
+		db = db.Where("task_id = ?", filter.TaskID)
+	}
+	if filter.TaskType != "" {
+		db = db.Where("task_type = ?", filter.TaskType)
+	}
+	if filter.AlgorithmID != "" {
+		db = db.Where("algorithm_id = ?", filter.AlgorithmID)
+	}
+	if filter.Status != "" {
+		db = db.Where("status IN ?", strings.Split(filter.Status, ","))
+	}
+	if !filter.StartTime.IsZero() {
+		db = db.Where("created_at >= ?", filter.StartTime)
+	}
+	if !filter.EndTime.IsZero() {
+		db = db.Where("created_at <= ?", filter.EndTime)
+	}
+	return db
+}
+
+// epochExpr 告警创建时间的Unix时间戳（秒），按数据库方言生成（SQLite / Postgres）
+func epochExpr(db *gorm.DB) string {
+	if db.Dialector.Name() == "postgres" {
+		return "CAST(EXTRACT(EPOCH FROM created_at) AS BIGINT)"
+	}
+	return "CAST(strftime('%s', created_at) AS INTEGER)"
+}
+
+// GetAlertStatsSummary 告警总体统计
+func GetAlertStatsSummary(filter model.AlertStatsFilter) (*model.AlertStatsSummary, error) {
+	var summary model.AlertStatsSummary
+	err := statsFilter(filter).Select("COUNT(*) AS total, " +
+		"COUNT(DISTINCT task_id) AS task_count, " +
+		"COALESCE(AVG(confidence), 0) AS avg_confidence, " +
+		"COALESCE(MAX(confidence), 0) AS max_confidence, " +
+		"COALESCE(AVG(detection_count), 0) AS avg_detections").
+		Scan(&summary).Error
+	if err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// CountAlertsByTime 按小时/天/周统计告警数，时间段按 loc 所在时区划分（使用当前的UTC偏移），没有告警的时间段计数为0
+func CountAlertsByTime(filter model.AlertStatsFilter, interval string, loc *time.Location) ([]model.AlertTimeBucket, error) {
+	size, ok := statsIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("%w: interval must be hour, day or week", ErrInvalidStatsParam)
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	_, offset := time.Now().In(loc).Zone()
+	shift := int64(offset)
+	if interval == model.StatsIntervalWeek {
+		shift += 3 * 86400 // 1970-01-01 是周四，偏移到周一
+	}
+
+	db := statsFilter(filter)
+	var rows []struct {
+		Bucket int64
+		Count  int64
+	}
+	// 分桶表达式中只拼接内部计算的整数，不包含用户输入
+	bucket := fmt.Sprintf("(%s + %d) / %d", epochExpr(db), shift, size)
+	if err := db.Select(bucket + " AS bucket, COUNT(*) AS count").
+		Group("bucket").Order("bucket").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	bucketOf := func(t time.Time) int64 { return (t.Unix() + shift) / size }
+	var first, last int64
+	switch {
+	case !filter.StartTime.IsZero():
+		first = bucketOf(filter.StartTime)
+	case len(rows) > 0:
+		first = rows[0].Bucket
+	default:
+		return []model.AlertTimeBucket{}, nil
+	}
+	switch {
+	case !filter.EndTime.IsZero():
+		last = bucketOf(filter.EndTime)
+	case len(rows) > 0:
+		last = rows[len(rows)-1].Bucket
+	default:
+		last = bucketOf(time.Now())
+	}
+	if last < first {
+		return []model.AlertTimeBucket{}, nil
+	}
+	if last-first >= maxStatsTimeBuckets {
+		return nil, fmt.Errorf("%w: time range too large for interval %s", ErrInvalidStatsParam, interval)
+	}
+
+	counts := make(map[int64]int64, len(rows))
+	for _, r := range rows {
+		counts[r.Bucket] = r.Count
+	}
+	buckets := make([]model.AlertTimeBucket, 0, last-first+1)
+	for b := first; b <= last; b++ {
+		buckets = append(buckets, model.AlertTimeBucket{
+			Time:  time.Unix(b*size-shift, 0).In(loc),
+			Count: counts[b],
+		})
+	}
+	return buckets, nil
+}
+
+// CountAlertsByGroup 按任务/任务类型/算法/检测类别/状态分组统计告警数（按数量倒序，取前 limit 个）
+func CountAlertsByGroup(filter model.AlertStatsFilter, groupBy string, limit int) ([]model.AlertGroupCount, error) {
+	if limit <= 0 {
+		limit = defaultStatsGroupSize
+	}
+	limit = min(limit, maxStatsGroupSize)
+
+	var db *gorm.DB
+	switch groupBy {
+	case model.StatsGroupTask, model.StatsGroupTaskType, model.StatsGroupAlgorithm, model.StatsGroupStatus:
+		db = statsFilter(filter).
+			Select(groupBy + " AS key, COUNT(*) AS count, COALESCE(AVG(confidence), 0) AS avg_confidence").
+			Group(groupBy)
+	case model.StatsGroupClass:
+		db = GetDatabase().Model(&model.AlertDetection{}).
+			Select("class AS key, COUNT(DISTINCT alert_id) AS count, COALESCE(AVG(confidence), 0) AS avg_confidence").
+			Where("alert_id IN (?)", statsFilter(filter).Select("id")).
+			Group("class")
+	default:
+		return nil, fmt.Errorf("%w: unsupported group: %s", ErrInvalidStatsParam, groupBy)
+	}
+
+	groups := []model.AlertGroupCount{}
+	err := db.Order("count DESC, key ASC").Limit(limit).Scan(&groups).Error
+	return groups, err
+}
+
+// DetectionHistogram 按检测个数统计告警数，检测个数不少于 maxCount 的告警合并为最后一档
+func DetectionHistogram(filter model.AlertStatsFilter, maxCount int) ([]model.DetectionHistogramBucket, error) {
+	if maxCount <= 0 {
+		maxCount = defaultHistogramMax
+	}
+	maxCount = min(maxCount, maxHistogramMax)
+
+	var rows []struct {
+		Bin   int
+		Count int64
+	}
+	if err := statsFilter(filter).
+		Select("CASE WHEN detection_count >= ? THEN ? ELSE detection_count END AS bin, COUNT(*) AS count", maxCount, maxCount).
+		Group("bin").Order("bin").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int]int64, len(rows))
+	for _, r := range rows {
+		counts[r.Bin] = r.Count
+	}
+	buckets := make([]model.DetectionHistogramBucket, 0, maxCount+1)
+	for n := 0; n <= maxCount; n++ {
+		buckets = append(buckets, model.DetectionHistogramBucket{
+			DetectionCount: n,
+			OrMore:         n == maxCount,
+			Count:          counts[n],
+		})
+	}
+	return buckets, nil
+}
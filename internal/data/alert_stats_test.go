@@ -0,0 +1,93 @@
+package data
+
+import (
+	"easydarwin/internal/data/model"
+	"testing"
+	"time"
+)
+
+func TestAlertStats(t *testing.T) {
+	setupLifecycleDB(t)
+
+	loc := time.FixedZone("UTC+8", 8*3600)
+	base := time.Date(2026, 3, 4, 10, 15, 0, 0, loc) // 周三
+	alerts := []model.Alert{
+		{TaskID: "cam1", TaskType: "helmet", AlgorithmID: "a1", Confidence: 0.9, DetectionCount: 1, CreatedAt: base},
+		{TaskID: "cam1", TaskType: "helmet", AlgorithmID: "a1", Confidence: 0.7, DetectionCount: 3, CreatedAt: base.Add(20 * time.Minute)},
+		{TaskID: "cam1", TaskType: "helmet", AlgorithmID: "a2", Confidence: 0.5, DetectionCount: 12, CreatedAt: base.Add(2 * time.Hour)},
+		{TaskID: "cam2", TaskType: "fire", AlgorithmID: "a2", Confidence: 0.3, DetectionCount: 0, CreatedAt: base.Add(15 * time.Hour)},
+	}
+	if err := GetDatabase().Create(&alerts).Error; err != nil {
+		t.Fatal(err)
+	}
+	detections := []model.AlertDetection{
+		{AlertID: alerts[0].ID, Class: "person", Confidence: 0.9},
+		{AlertID: alerts[1].ID, Class: "person", Confidence: 0.7},
+		{AlertID: alerts[1].ID, Class: "person", Confidence: 0.5},
+		{AlertID: alerts[1].ID, Class: "helmet", Confidence: 0.6},
+	}
+	if err := GetDatabase().Create(&detections).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := GetAlertStatsSummary(model.AlertStatsFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Total != 4 || summary.TaskCount != 2 || summary.MaxConfidence != 0.9 || summary.AvgDetections != 4 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	hours, err := CountAlertsByTime(model.AlertStatsFilter{TaskID: "cam1"}, model.StatsIntervalHour, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hours) != 3 || !hours[0].Time.Equal(base.Truncate(time.Hour)) || hours[0].Count != 2 || hours[1].Count != 0 || hours[2].Count != 1 {
+		t.Fatalf("unexpected hourly buckets: %+v", hours)
+	}
+
+	// 2026-03-05 01:15 +08:00 属于次日
+	days, err := CountAlertsByTime(model.AlertStatsFilter{}, model.StatsIntervalDay, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 2 || days[0].Count != 3 || days[1].Count != 1 || days[0].Time.Hour() != 0 {
+		t.Fatalf("unexpected daily buckets: %+v", days)
+	}
+
+	weeks, err := CountAlertsByTime(model.AlertStatsFilter{}, model.StatsIntervalWeek, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(weeks) != 1 || weeks[0].Count != 4 || weeks[0].Time.Weekday() != time.Monday || weeks[0].Time.Day() != 2 {
+		t.Fatalf("unexpected weekly buckets: %+v", weeks)
+	}
+
+	if _, err := CountAlertsByTime(model.AlertStatsFilter{}, "month", loc); err == nil {
+		t.Fatal("unsupported interval should be rejected")
+	}
+
+	tasks, err := CountAlertsByGroup(model.AlertStatsFilter{}, model.StatsGroupTask, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Key != "cam1" || tasks[0].Count != 3 {
+		t.Fatalf("unexpected top tasks: %+v", tasks)
+	}
+
+	classes, err := CountAlertsByGroup(model.AlertStatsFilter{TaskType: "helmet"}, model.StatsGroupClass, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(classes) != 2 || classes[0].Key != "person" || classes[0].Count != 2 || classes[1].Count != 1 {
+		t.Fatalf("unexpected class counts: %+v", classes)
+	}
+
+	histogram, err := DetectionHistogram(model.AlertStatsFilter{}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(histogram) != 4 || histogram[0].Count != 1 || histogram[1].Count != 1 || histogram[3].Count != 2 || !histogram[3].OrMore {
+		t.Fatalf("unexpected histogram: %+v", histogram)
+	}
+}
@@ -0,0 +1,107 @@
+package data
+
+import (
+	"easydarwin/internal/data/model"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func newDetectedAlert(taskID string, createdAt time.Time) *model.Alert {
+	return &model.Alert{
+		TaskID:    taskID,
+		CreatedAt: createdAt,
+		Detections: []model.AlertDetection{
+			{Class: "person", Confidence: 0.9},
+			{Class: "car", Confidence: 0.8},
+		},
+	}
+}
+
+func countRows(t *testing.T, value interface{}) int64 {
+	t.Helper()
+	var n int64
+	if err := GetDatabase().Model(value).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestDeleteAlertsRemovesDetections(t *testing.T) {
+	setupLifecycleDB(t)
+	now := time.Now()
+
+	var alerts []*model.Alert
+	for i, taskID := range []string{"cam1", "cam2", "cam3"} {
+		alert := newDetectedAlert(taskID, now.Add(time.Duration(i)*time.Second))
+		if err := CreateAlert(alert); err != nil {
+			t.Fatal(err)
+		}
+		if err := GetDatabase().Create(&model.AlertComment{AlertID: alert.ID, UserID: 1, Content: "checked"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		alerts = append(alerts, alert)
+	}
+
+	if err := DeleteAlert(alerts[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, &model.AlertDetection{}); n != 4 {
+		t.Fatalf("detections after delete = %d, want 4", n)
+	}
+	if n := countRows(t, &model.AlertComment{}); n != 2 {
+		t.Fatalf("comments after delete = %d, want 2", n)
+	}
+
+	if deleted, err := BatchDeleteAlerts([]uint{alerts[1].ID}); err != nil || deleted != 1 {
+		t.Fatalf("batch delete = %d, %v", deleted, err)
+	}
+	if n := countRows(t, &model.AlertDetection{}); n != 2 {
+		t.Fatalf("detections after batch delete = %d, want 2", n)
+	}
+
+	// 超过 max_alerts_in_db 时删除最旧的告警及其检测目标
+	if err := CreateAlertWithLimit(newDetectedAlert("cam4", now.Add(time.Minute)), 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, &model.Alert{}); n != 1 {
+		t.Fatalf("alerts after trim = %d, want 1", n)
+	}
+	var orphans int64
+	if err := GetDatabase().Model(&model.AlertDetection{}).Where("alert_id = ?", alerts[2].ID).Count(&orphans).Error; err != nil {
+		t.Fatal(err)
+	}
+	if orphans != 0 || countRows(t, &model.AlertDetection{}) != 2 {
+		t.Fatalf("trimmed alert left %d detections", orphans)
+	}
+}
+
+func TestAlertBatchWriterTrimRemovesDetections(t *testing.T) {
+	setupLifecycleDB(t)
+	now := time.Now()
+
+	old := newDetectedAlert("cam1", now)
+	if err := CreateAlert(old); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewAlertBatchWriter(10, 60, true, 2, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for i := 1; i <= 2; i++ {
+		if err := w.Add(newDetectedAlert("cam2", now.Add(time.Duration(i)*time.Second))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.flush()
+
+	if n := countRows(t, &model.Alert{}); n != 2 {
+		t.Fatalf("alerts after flush = %d, want 2", n)
+	}
+	var orphans int64
+	if err := GetDatabase().Model(&model.AlertDetection{}).Where("alert_id = ?", old.ID).Count(&orphans).Error; err != nil {
+		t.Fatal(err)
+	}
+	if orphans != 0 || countRows(t, &model.AlertDetection{}) != 4 {
+		t.Fatalf("trimmed alert left %d detections", orphans)
+	}
+}
@@ -0,0 +1,122 @@
+package data
+
+import (
+	"easydarwin/internal/data/model"
+	"easydarwin/utils/plugin/core/user"
+	"easydarwin/utils/plugin/core/user/store/userdb"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MigrateDeveloperAccounts 补齐开发者账户（算法厂商应用）所需的 users 表字段及用户组表
+// 开发者账户由 user.Core 管理，与登录用户共用 users 表；password 列类型与 User 不同，只补充缺少的列，不修改已有列
+// 登录用户及告警处理人查询需通过 ExcludeDevelopers 排除开发者账户
+func MigrateDeveloperAccounts() error {
+	db := GetDatabase()
+	if err := db.AutoMigrate(&User{}, &user.UserGroup{}); err != nil {
+		return err
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&user.User{}); err != nil {
+		return err
+	}
+	migrator := db.Migrator()
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName == "" || migrator.HasColumn(&user.User{}, field.DBName) {
+			continue
+		}
+		// jsonb、int8[] 仅 postgres 支持，其它数据库按文本存储
+		if db.Dialector.Name() != "postgres" && (field.DataType == "jsonb" || field.DataType == "int8[]") {
+			sql := "ALTER TABLE ? ADD COLUMN ? text"
+			if field.HasDefaultValue && field.DefaultValue != "" {
+				sql += " DEFAULT '" + strings.Trim(field.DefaultValue, "'") + "'"
+			}
+			if err := db.Exec(sql, clause.Table{Name: stmt.Schema.Table}, clause.Column{Name: field.DBName}).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if err := migrator.AddColumn(&user.User{}, field.DBName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewAppCore 创建开发者账户（算法厂商应用）管理，需要先调用 MigrateDeveloperAccounts
+func NewAppCore(logger *slog.Logger) user.Core {
+	return user.NewCore(userdb.NewDB(GetDatabase()), logger, nil)
+}
+
+// ListAlgorithmAppScopes 获取算法厂商应用的任务类型白名单
+func ListAlgorithmAppScopes() ([]model.AlgorithmAppScope, error) {
+	var scopes []model.AlgorithmAppScope
+	err := GetDatabase().Order("app_id ASC").Find(&scopes).Error
+	return scopes, err
+}
+
+// GetAlgorithmAppScope 获取应用的任务类型白名单，没有记录时返回 nil
+func GetAlgorithmAppScope(appID string) (*model.AlgorithmAppScope, error) {
+	var scope model.AlgorithmAppScope
+	err := GetDatabase().Where("app_id = ?", appID).First(&scope).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &scope, nil
+}
+
+// SaveAlgorithmAppScope 保存应用的任务类型白名单，任务类型为空时删除记录（不限制）
+func SaveAlgorithmAppScope(scope *model.AlgorithmAppScope) error {
+	if len(scope.TaskTypes) == 0 {
+		return GetDatabase().Where("app_id = ?", scope.AppID).Delete(&model.AlgorithmAppScope{}).Error
+	}
+	return GetDatabase().Save(scope).Error
+}
+
+// AddAlgorithmAudit 记录一条注册审计
+func AddAlgorithmAudit(audit *model.AlgorithmAudit) error {
+	return GetDatabase().Create(audit).Error
+}
+
+// ListAlgorithmAudits 分页查询注册审计记录（按时间倒序），appID/serviceID 为空时不筛选
+func ListAlgorithmAudits(appID, serviceID string, page, pageSize int) ([]model.AlgorithmAudit, int64, error) {
+	db := GetDatabase().Model(&model.AlgorithmAudit{})
+	if appID != "" {
+		db = db.Where("app_id = ?", appID)
+	}
+	if serviceID != "" {
+		db = db.Where("service_id = ?", serviceID)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	var audits []model.AlgorithmAudit
+	err := db.Order("id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&audits).Error
+	return audits, total, err
+}
+
+// CleanupAlgorithmAudits 删除指定时间之前的审计记录，返回删除数量
+func CleanupAlgorithmAudits(before time.Time) (int64, error) {
+	result := GetDatabase().Where("created_at < ?", before).Delete(&model.AlgorithmAudit{})
+	return result.RowsAffected, result.Error
+}
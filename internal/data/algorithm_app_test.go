@@ -0,0 +1,64 @@
+package data
+
+import (
+	"easydarwin/internal/data/model"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+func TestMigrateDeveloperAccountsSQLite(t *testing.T) {
+	setupLifecycleDB(t)
+
+	if err := MigrateDeveloperAccounts(); err != nil {
+		t.Fatal(err)
+	}
+	// 再次执行不应报错
+	if err := MigrateDeveloperAccounts(); err != nil {
+		t.Fatal(err)
+	}
+
+	var columns []struct {
+		Name string
+		Type string
+	}
+	if err := GetDatabase().Raw("PRAGMA table_info(users)").Scan(&columns).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range columns {
+		if c.Type == "jsonb" || c.Type == "int8[]" {
+			t.Fatalf("column %s uses postgres-only type %s", c.Name, c.Type)
+		}
+	}
+
+	core := NewAppCore(slog.Default())
+	if _, err := core.CreateApp("vendor1", nil); err != nil {
+		t.Fatal(err)
+	}
+	apps, total, err := core.FindApps(10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(apps) != 1 {
+		t.Fatalf("expected 1 app, got %d", total)
+	}
+
+	alert := model.Alert{TaskID: "cam1"}
+	if err := GetDatabase().Create(&alert).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := AssignAlert(alert.ID, apps[0].ID, 1, ""); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("developer account should not be an assignee, got %v", err)
+	}
+	if err := TransitionAlert(alert.ID, model.AlertStatusInProgress, apps[0].ID, ""); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("developer account should not be an actor, got %v", err)
+	}
+
+	var users []User
+	if err := GetDatabase().Scopes(ExcludeDevelopers).Find(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Username != "operator" {
+		t.Fatalf("expected only the login user, got %+v", users)
+	}
+}
@@ -0,0 +1,20 @@
+package data
+
+import "easydarwin/internal/data/model"
+
+// ListAlgorithmCanaries 获取所有任务类型的灰度发布规则
+func ListAlgorithmCanaries() ([]model.AlgorithmCanary, error) {
+	var canaries []model.AlgorithmCanary
+	err := GetDatabase().Order("task_type ASC").Find(&canaries).Error
+	return canaries, err
+}
+
+// SaveAlgorithmCanary 保存任务类型的灰度发布规则（整条覆盖）
+func SaveAlgorithmCanary(canary *model.AlgorithmCanary) error {
+	return GetDatabase().Save(canary).Error
+}
+
+// DeleteAlgorithmCanary 删除任务类型的灰度发布规则
+func DeleteAlgorithmCanary(taskType string) error {
+	return GetDatabase().Where("task_type = ?", taskType).Delete(&model.AlgorithmCanary{}).Error
+}
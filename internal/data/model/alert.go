@@ -8,20 +8,34 @@ import (
 
 // Alert 告警记录
 type Alert struct {
-	ID              uint           `json:"id" gorm:"primarykey"`
-	TaskID          string         `json:"task_id" gorm:"type:varchar(100);index"`
-	TaskType        string         `json:"task_type" gorm:"type:varchar(50);index"`
-	ImagePath       string         `json:"image_path" gorm:"type:varchar(500)"`
-	ImageURL        string         `json:"image_url" gorm:"type:varchar(1000)"` // 预签名URL或本地URL
-	AlgorithmID     string         `json:"algorithm_id" gorm:"type:varchar(100)"`
-	AlgorithmName   string         `json:"algorithm_name" gorm:"type:varchar(100)"`
-	Result          string         `json:"result" gorm:"type:text"` // JSON格式推理结果
-	Confidence      float64        `json:"confidence"`
-	DetectionCount  int            `json:"detection_count" gorm:"default:0;index"` // 检测出的实例个数
-	InferenceTimeMs int            `json:"inference_time_ms"`
-	CreatedAt       time.Time      `json:"created_at" gorm:"index"`
-	UpdatedAt       time.Time      `json:"updated_at"`
-	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+	ID                 uint             `json:"id" gorm:"primarykey"`
+	TaskID             string           `json:"task_id" gorm:"type:varchar(100);index"`
+	TaskType           string           `json:"task_type" gorm:"type:varchar(50);index"`
+	ImagePath          string           `json:"image_path" gorm:"type:varchar(500)"`
+	ImageURL           string           `json:"image_url" gorm:"type:varchar(1000)"`                     // 预签名URL或本地URL
+	AnnotatedImagePath string           `json:"annotated_image_path,omitempty" gorm:"type:varchar(500)"` // 绘制了检测框的标注图片路径
+	AnnotatedImageURL  string           `json:"annotated_image_url,omitempty" gorm:"-"`                  // 标注图片预签名URL（查询时生成）
+	ClipPath           string           `json:"clip_path,omitempty" gorm:"type:varchar(500)"`            // 告警前后的视频片段路径（MP4）
+	ClipURL            string           `json:"clip_url,omitempty" gorm:"-"`                             // 视频片段预签名URL（查询时生成）
+	AlgorithmID        string           `json:"algorithm_id" gorm:"type:varchar(100)"`
+	AlgorithmName      string           `json:"algorithm_name" gorm:"type:varchar(100)"`
+	AlgorithmVersion   string           `json:"algorithm_version,omitempty" gorm:"type:varchar(50)"` // 产生告警的算法服务版本
+	Result             string           `json:"result" gorm:"type:text"`                             // JSON格式推理结果
+	Confidence         float64          `json:"confidence"`
+	DetectionCount     int              `json:"detection_count" gorm:"default:0;index"` // 检测出的实例个数
+	InferenceTimeMs    int              `json:"inference_time_ms"`
+	HitCount           int              `json:"hit_count" gorm:"default:1"`                         // 合并的命中次数（包括被抑制的重复告警）
+	FirstSeenAt        time.Time        `json:"first_seen_at"`                                      // 首次命中时间
+	LastSeenAt         time.Time        `json:"last_seen_at"`                                       // 最近一次命中时间
+	DedupKey           string           `json:"dedup_key,omitempty" gorm:"type:varchar(100);index"` // 抑制分组标识，用于合并被抑制的告警
+	Status             string           `json:"status" gorm:"type:varchar(20);default:new;index"`   // 处理状态：new|acknowledged|in_progress|resolved|false_positive
+	AssigneeID         int              `json:"assignee_id" gorm:"default:0;index"`                 // 处理人（users.id），0表示未指派
+	ResolvedAt         *time.Time       `json:"resolved_at,omitempty"`                              // 关闭（已解决/误报）时间
+	Detections         []AlertDetection `json:"detections,omitempty" gorm:"foreignKey:AlertID"`     // 解析后的检测目标（Result 保留原始JSON）
+	Feedback           *AlertFeedback   `json:"feedback,omitempty" gorm:"foreignKey:AlertID"`       // 人工复核结果
+	CreatedAt          time.Time        `json:"created_at" gorm:"index"`
+	UpdatedAt          time.Time        `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt   `json:"-" gorm:"index"`
 }
 
 // TableName 指定表名
@@ -35,6 +49,13 @@ type AlertFilter struct {
 	TaskType        string    `form:"task_type"`
 	MinDetections   int       `form:"min_detections"` // 最少检测个数
 	MaxDetections   int       `form:"max_detections"` // 最多检测个数
+	Class           string    `form:"class"`          // 包含该类别的检测目标
+	MinConfidence   float64   `form:"min_confidence"` // 检测目标最低置信度
+	MinBBoxArea     float64   `form:"min_bbox_area"`  // 检测框最小面积
+	MaxBBoxArea     float64   `form:"max_bbox_area"`  // 检测框最大面积
+	TrackID         string    `form:"track_id"`       // 跟踪ID
+	Status          string    `form:"status"`         // 处理状态，多个用逗号分隔
+	AssigneeID      int       `form:"assignee_id"`    // 处理人
 	StartTime       time.Time `form:"start_time"`
 	EndTime         time.Time `form:"end_time"`
 	Page            int       `form:"page"`
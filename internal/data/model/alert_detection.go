@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// AlertDetection 告警中的检测目标（从推理结果中解析，用于按类别/置信度/检测框查询告警）
+type AlertDetection struct {
+	ID         uint                   `json:"id" gorm:"primarykey"`
+	AlertID    uint                   `json:"alert_id" gorm:"index"`
+	Class      string                 `json:"class" gorm:"type:varchar(100);index"`
+	Confidence float64                `json:"confidence" gorm:"index"`
+	X1         float64                `json:"x1"` // 检测框 [x1, y1, x2, y2]，没有检测框时为0
+	Y1         float64                `json:"y1"`
+	X2         float64                `json:"x2"`
+	Y2         float64                `json:"y2"`
+	Area       float64                `json:"area" gorm:"index"` // 检测框面积
+	TrackID    string                 `json:"track_id,omitempty" gorm:"type:varchar(100);index"`
+	Attributes map[string]interface{} `json:"attributes,omitempty" gorm:"type:text;serializer:json"` // 属性（如是否佩戴安全帽）
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// TableName 指定表名
+func (AlertDetection) TableName() string {
+	return "alert_detections"
+}
@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+// FeedbackLabel 人工标注的目标
+type FeedbackLabel struct {
+	Class string     `json:"class"`
+	BBox  [4]float64 `json:"bbox"` // [x1, y1, x2, y2]，与算法返回的检测框坐标一致
+}
+
+// AlertFeedback 告警人工复核结果（每条告警保留最近一次复核），用于统计算法准确率和导出训练数据
+type AlertFeedback struct {
+	ID               uint            `json:"id" gorm:"primarykey"`
+	AlertID          uint            `json:"alert_id" gorm:"uniqueIndex"`
+	TaskType         string          `json:"task_type" gorm:"type:varchar(50);index"`
+	AlgorithmID      string          `json:"algorithm_id" gorm:"type:varchar(100);index"`
+	AlgorithmVersion string          `json:"algorithm_version" gorm:"type:varchar(50);index"`
+	Correct          bool            `json:"correct" gorm:"index"`                    // 告警是否正确
+	Labels           []FeedbackLabel `json:"labels" gorm:"type:text;serializer:json"` // 修正后的目标，为空时：告警正确则沿用检测目标，告警错误则作为负样本
+	UserID           int             `json:"user_id"`                                 // 复核人（users.id）
+	Note             string          `json:"note,omitempty" gorm:"type:varchar(500)"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at" gorm:"index"`
+}
+
+// TableName 指定表名
+func (AlertFeedback) TableName() string {
+	return "alert_feedback"
+}
+
+// 复核状态筛选
+const (
+	FeedbackStateAll        = ""
+	FeedbackStateCorrect    = "correct"    // 复核为正确
+	FeedbackStateIncorrect  = "incorrect"  // 复核为误报
+	FeedbackStateReviewed   = "reviewed"   // 已复核
+	FeedbackStateUnreviewed = "unreviewed" // 未复核
+)
+
+// AlertExportFilter 训练数据导出的告警筛选条件
+type AlertExportFilter struct {
+	TaskType         string    `json:"task_type"`
+	AlgorithmID      string    `json:"algorithm_id"`
+	AlgorithmVersion string    `json:"algorithm_version"`
+	StartTime        time.Time `json:"start_time"`
+	EndTime          time.Time `json:"end_time"`
+	Feedback         string    `json:"feedback"` // correct|incorrect|reviewed|unreviewed，为空表示全部
+	Limit            int       `json:"limit"`    // 最多导出的告警数
+}
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+// 告警处理状态
+const (
+	AlertStatusNew           = "new"            // 新告警
+	AlertStatusAcknowledged  = "acknowledged"   // 已确认
+	AlertStatusInProgress    = "in_progress"    // 处理中
+	AlertStatusResolved      = "resolved"       // 已解决
+	AlertStatusFalsePositive = "false_positive" // 误报
+)
+
+// 告警处理记录类型
+const (
+	AlertActionStatus = "status" // 状态流转
+	AlertActionAssign = "assign" // 指派处理人
+)
+
+// alertTransitions 允许的状态流转，已解决/误报的告警可重新打开
+var alertTransitions = map[string][]string{
+	AlertStatusNew:           {AlertStatusAcknowledged, AlertStatusInProgress, AlertStatusResolved, AlertStatusFalsePositive},
+	AlertStatusAcknowledged:  {AlertStatusInProgress, AlertStatusResolved, AlertStatusFalsePositive},
+	AlertStatusInProgress:    {AlertStatusAcknowledged, AlertStatusResolved, AlertStatusFalsePositive},
+	AlertStatusResolved:      {AlertStatusNew},
+	AlertStatusFalsePositive: {AlertStatusNew},
+}
+
+// ValidAlertStatus 判断是否为合法的告警状态
+func ValidAlertStatus(status string) bool {
+	_, ok := alertTransitions[status]
+	return ok
+}
+
+// CanTransitAlertStatus 判断告警状态能否从 from 流转到 to（历史告警状态为空时按新告警处理）
+func CanTransitAlertStatus(from, to string) bool {
+	if from == "" {
+		from = AlertStatusNew
+	}
+	return slices.Contains(alertTransitions[from], to)
+}
+
+// IsAlertClosed 告警是否已关闭（已解决或误报）
+func IsAlertClosed(status string) bool {
+	return status == AlertStatusResolved || status == AlertStatusFalsePositive
+}
+
+// AlertComment 告警处理备注
+type AlertComment struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	AlertID   uint      `json:"alert_id" gorm:"index"`
+	UserID    int       `json:"user_id"` // 备注人（users.id）
+	Content   string    `json:"content" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (AlertComment) TableName() string {
+	return "alert_comments"
+}
+
+// AlertHistory 告警处理记录（状态流转与指派）
+type AlertHistory struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	AlertID      uint      `json:"alert_id" gorm:"index"`
+	UserID       int       `json:"user_id"`                        // 操作人（users.id）
+	Action       string    `json:"action" gorm:"type:varchar(20)"` // status|assign
+	FromStatus   string    `json:"from_status,omitempty" gorm:"type:varchar(20)"`
+	ToStatus     string    `json:"to_status,omitempty" gorm:"type:varchar(20)"`
+	FromAssignee int       `json:"from_assignee,omitempty"`
+	ToAssignee   int       `json:"to_assignee,omitempty"`
+	Note         string    `json:"note,omitempty" gorm:"type:varchar(500)"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName 指定表名
+func (AlertHistory) TableName() string {
+	return "alert_history"
+}
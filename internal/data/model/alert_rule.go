@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// Polygon 多边形区域，顶点坐标与算法返回的检测框坐标一致
+type Polygon [][2]float64
+
+// AlertRule 告警规则：按任务对推理结果判定是否产生告警
+// 作用范围：TaskID 不为空时只作用于该任务，否则作用于 TaskType 下的所有任务（任务有专属规则时不再使用任务类型规则）
+type AlertRule struct {
+	ID             uint      `json:"id" gorm:"primarykey"`
+	Name           string    `json:"name" gorm:"type:varchar(100)"`
+	TaskID         string    `json:"task_id" gorm:"type:varchar(100);index"`
+	TaskType       string    `json:"task_type" gorm:"type:varchar(50);index"`
+	Enabled        bool      `json:"enabled"`
+	Classes        []string  `json:"classes" gorm:"type:text;serializer:json"`         // 只统计这些类别，为空表示所有类别
+	ExcludeClasses []string  `json:"exclude_classes" gorm:"type:text;serializer:json"` // 不统计这些类别
+	MinConfidence  float64   `json:"min_confidence"`                                   // 最低置信度
+	MinCount       int       `json:"min_count"`                                        // 满足条件的目标数至少N个才告警，默认: 1
+	MaxCount       int       `json:"max_count"`                                        // 满足条件的目标数最多N个，0表示不限制
+	IncludeRegions []Polygon `json:"include_regions" gorm:"type:text;serializer:json"` // 目标中心点须在任一区域内，为空表示全画面
+	ExcludeRegions []Polygon `json:"exclude_regions" gorm:"type:text;serializer:json"` // 目标中心点在任一区域内时不统计
+	PersistHits    int       `json:"persist_hits"`                                     // 最近 PersistFrames 帧中至少命中N帧才告警，0表示不要求
+	PersistFrames  int       `json:"persist_frames"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (AlertRule) TableName() string {
+	return "alert_rules"
+}
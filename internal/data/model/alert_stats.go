@@ -0,0 +1,58 @@
+package model
+
+import "time"
+
+// 告警统计的时间粒度
+const (
+	StatsIntervalHour = "hour"
+	StatsIntervalDay  = "day"
+	StatsIntervalWeek = "week" // 从周一开始
+)
+
+// 告警统计的分组字段
+const (
+	StatsGroupTask      = "task_id"
+	StatsGroupTaskType  = "task_type"
+	StatsGroupAlgorithm = "algorithm_id"
+	StatsGroupClass     = "class" // 按检测目标类别（一条告警包含多个类别时分别计数）
+	StatsGroupStatus    = "status"
+)
+
+// AlertStatsFilter 告警统计筛选条件
+type AlertStatsFilter struct {
+	TaskID      string    `form:"task_id"`
+	TaskType    string    `form:"task_type"`
+	AlgorithmID string    `form:"algorithm_id"`
+	Status      string    `form:"status"` // 处理状态，多个用逗号分隔
+	StartTime   time.Time `form:"start_time"`
+	EndTime     time.Time `form:"end_time"`
+}
+
+// AlertStatsSummary 告警总体统计
+type AlertStatsSummary struct {
+	Total         int64   `json:"total"`
+	TaskCount     int64   `json:"task_count"` // 产生告警的任务数
+	AvgConfidence float64 `json:"avg_confidence"`
+	MaxConfidence float64 `json:"max_confidence"`
+	AvgDetections float64 `json:"avg_detections"` // 平均检测个数
+}
+
+// AlertTimeBucket 按时间统计的告警数
+type AlertTimeBucket struct {
+	Time  time.Time `json:"time"` // 时间段起点
+	Count int64     `json:"count"`
+}
+
+// AlertGroupCount 按字段分组统计的告警数
+type AlertGroupCount struct {
+	Key           string  `json:"key"`
+	Count         int64   `json:"count"`
+	AvgConfidence float64 `json:"avg_confidence"` // 按类别分组时为检测目标的平均置信度
+}
+
+// DetectionHistogramBucket 检测个数分布
+type DetectionHistogramBucket struct {
+	DetectionCount int   `json:"detection_count"`
+	OrMore         bool  `json:"or_more,omitempty"` // 最后一档，包含检测个数更多的告警
+	Count          int64 `json:"count"`
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// AlgorithmAppScope 算法厂商应用允许注册的任务类型
+// 应用凭证即开发者账户（user.Core.CreateApp 创建，app_id + secret），这里只保存任务类型白名单
+type AlgorithmAppScope struct {
+	AppID     string    `json:"app_id" gorm:"type:varchar(100);primaryKey"`
+	TaskTypes []string  `json:"task_types" gorm:"type:text;serializer:json"` // 允许注册的任务类型，没有记录表示不限制
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (AlgorithmAppScope) TableName() string {
+	return "algorithm_app_scopes"
+}
+
+// AlgorithmAudit 算法服务注册审计记录
+type AlgorithmAudit struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	Action     string    `json:"action" gorm:"type:varchar(20);index"` // register|unregister|clear_all
+	Success    bool      `json:"success"`
+	AppID      string    `json:"app_id" gorm:"type:varchar(100);index"` // 发起操作的应用，管理员操作为空
+	ServiceID  string    `json:"service_id" gorm:"type:varchar(100);index"`
+	Endpoint   string    `json:"endpoint" gorm:"type:varchar(500)"`
+	TaskTypes  []string  `json:"task_types" gorm:"type:text;serializer:json"`
+	RemoteAddr string    `json:"remote_addr" gorm:"type:varchar(100)"`
+	Detail     string    `json:"detail,omitempty" gorm:"type:varchar(500)"` // 失败原因等
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName 指定表名
+func (AlgorithmAudit) TableName() string {
+	return "algorithm_audits"
+}
@@ -0,0 +1,17 @@
+package model
+
+// AlgorithmCanary 任务类型的灰度发布规则及状态（运行时通过API调整后保存，重启和多节点同步时加载）
+type AlgorithmCanary struct {
+	TaskType  string   `json:"task_type" gorm:"type:varchar(100);primaryKey"`
+	Version   string   `json:"version" gorm:"type:varchar(100)"` // 灰度版本
+	Percent   float64  `json:"percent"`
+	TaskIDs   []string `json:"task_ids" gorm:"type:text;serializer:json"`
+	Split     string   `json:"split" gorm:"type:varchar(20)"`
+	State     string   `json:"state" gorm:"type:varchar(20)"` // canary|promoted|rolled_back
+	UpdatedAt int64    `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (AlgorithmCanary) TableName() string {
+	return "algorithm_canaries"
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// AlertOutbox 告警推送发件箱，消息队列不可用时暂存待推送的告警，按ID顺序投递
+type AlertOutbox struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	AlertID   uint      `json:"alert_id" gorm:"index"`
+	TaskID    string    `json:"task_id" gorm:"type:varchar(100)"`
+	Payload   string    `json:"payload" gorm:"type:text"`  // 告警JSON
+	Attempts  int       `json:"attempts" gorm:"default:0"` // 已尝试投递次数
+	LastError string    `json:"last_error" gorm:"type:varchar(500)"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (AlertOutbox) TableName() string {
+	return "alert_outbox"
+}
@@ -0,0 +1,59 @@
+package model
+
+import "time"
+
+// ShadowComparison 影子推理对比记录：同一张图片主算法与影子服务的推理结果及一致性指标
+type ShadowComparison struct {
+	ID             uint   `json:"id" gorm:"primarykey"`
+	TaskID         string `json:"task_id" gorm:"type:varchar(100);index"`
+	TaskType       string `json:"task_type" gorm:"type:varchar(50);index"`
+	ImagePath      string `json:"image_path" gorm:"type:varchar(500)"` // 原始图片路径（主算法处理后可能已删除或移动）
+	PrimaryID      string `json:"primary_id" gorm:"type:varchar(100)"`
+	PrimaryVersion string `json:"primary_version" gorm:"type:varchar(50)"`
+	ShadowID       string `json:"shadow_id" gorm:"type:varchar(100);index"`
+	ShadowVersion  string `json:"shadow_version" gorm:"type:varchar(50)"`
+	PrimaryCount   int    `json:"primary_count"` // 主算法检测个数（算法原始输出，不经过告警规则）
+	ShadowCount    int    `json:"shadow_count"`
+	PrimaryResult  string `json:"primary_result" gorm:"type:text"`
+	ShadowResult   string `json:"shadow_result" gorm:"type:text"`
+	PrimaryTimeMs  int    `json:"primary_time_ms"`
+	ShadowTimeMs   int    `json:"shadow_time_ms"`
+	ShadowError    string `json:"shadow_error,omitempty" gorm:"type:varchar(500)"` // 影子推理失败原因，失败时不计算一致性指标
+
+	SameCount    bool    `json:"same_count"`                            // 检测个数是否相同
+	ClassOverlap float64 `json:"class_overlap"`                         // 检测类别集合的 Jaccard 相似度，都没有检测结果时为1
+	Matched      int     `json:"matched"`                               // 匹配上的目标数（同类别且检测框IoU达到阈值）
+	MatchRate    float64 `json:"match_rate"`                            // 2*matched/(primary_count+shadow_count)，都没有检测结果时为1
+	MatchedIoU   float64 `json:"matched_iou" gorm:"column:matched_iou"` // 匹配目标的平均IoU
+
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName 指定表名
+func (ShadowComparison) TableName() string {
+	return "shadow_comparisons"
+}
+
+// ShadowComparisonFilter 影子推理对比记录筛选条件
+type ShadowComparisonFilter struct {
+	TaskID        string    `form:"task_id"`
+	TaskType      string    `form:"task_type"`
+	ShadowID      string    `form:"shadow_id"`
+	ShadowVersion string    `form:"shadow_version"`
+	Disagreement  bool      `form:"disagreement"` // 只返回不一致的记录（检测个数不同、目标未全部匹配或影子推理失败）
+	StartTime     time.Time `form:"start_time"`
+	EndTime       time.Time `form:"end_time"`
+}
+
+// ShadowAgreement 影子推理一致性统计，一致性指标只统计影子推理成功的记录
+type ShadowAgreement struct {
+	Time            *time.Time `json:"time,omitempty"` // 按时间统计时为时间段起点
+	Samples         int64      `json:"samples"`
+	Errors          int64      `json:"errors"`                                        // 影子推理失败数
+	SameCountRate   float64    `json:"same_count_rate"`                               // 检测个数相同的比例
+	AvgClassOverlap float64    `json:"avg_class_overlap"`                             // 平均类别重合度
+	AvgMatchRate    float64    `json:"avg_match_rate"`                                // 平均目标匹配率
+	AvgMatchedIoU   float64    `json:"avg_matched_iou" gorm:"column:avg_matched_iou"` // 有匹配目标的记录的平均IoU
+	AvgPrimaryMs    float64    `json:"avg_primary_ms"`
+	AvgShadowMs     float64    `json:"avg_shadow_ms"`
+}
@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+// Webhook 告警回调目标：告警落库后按条件以HTTP POST推送（与消息队列推送相互独立）
+type Webhook struct {
+	ID        uint              `json:"id" gorm:"primarykey"`
+	Name      string            `json:"name" gorm:"type:varchar(100)"`
+	URL       string            `json:"url" gorm:"type:varchar(1000)"`
+	Secret    string            `json:"secret,omitempty" gorm:"type:varchar(200)"` // HMAC-SHA256 签名密钥，为空时不签名（查询时不返回）
+	SecretSet bool              `json:"secret_set" gorm:"-"`                       // 是否设置了密钥（查询时生成）
+	Enabled   bool              `json:"enabled"`
+	TaskIDs   []string          `json:"task_ids" gorm:"type:text;serializer:json"`   // 只推送这些任务的告警，为空表示全部
+	TaskTypes []string          `json:"task_types" gorm:"type:text;serializer:json"` // 只推送这些任务类型的告警
+	Classes   []string          `json:"classes" gorm:"type:text;serializer:json"`    // 只推送包含这些类别检测目标的告警
+	Template  string            `json:"template" gorm:"type:text"`                   // 请求体模板（Go text/template），为空时发送告警JSON
+	Headers   map[string]string `json:"headers" gorm:"type:text;serializer:json"`    // 附加的请求头
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// WebhookDelivery 告警回调投递记录（每次尝试一条）
+type WebhookDelivery struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	WebhookID  uint      `json:"webhook_id" gorm:"index"`
+	AlertID    uint      `json:"alert_id" gorm:"index"`
+	Event      string    `json:"event" gorm:"type:varchar(20)"` // alert|test
+	DeliveryID string    `json:"delivery_id" gorm:"type:varchar(50);index"`
+	Attempt    int       `json:"attempt"` // 第几次尝试（从1开始）
+	Success    bool      `json:"success"`
+	StatusCode int       `json:"status_code"`                                  // 响应状态码，请求失败时为0
+	Response   string    `json:"response,omitempty" gorm:"type:varchar(1000)"` // 响应内容（截断）
+	Error      string    `json:"error,omitempty" gorm:"type:varchar(500)"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName 指定表名
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
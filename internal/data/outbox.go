@@ -0,0 +1,82 @@
+package data
+
+import (
+	"easydarwin/internal/data/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EnqueueOutbox 写入发件箱，并在同一事务中删除最旧的 trim 条记录（发件箱已满时），返回删除条数
+func EnqueueOutbox(entry *model.AlertOutbox, trim int) (int, error) {
+	if trim <= 0 {
+		return 0, GetDatabase().Create(entry).Error
+	}
+
+	var dropped int
+	err := GetDatabase().Transaction(func(tx *gorm.DB) error {
+		var oldIDs []uint
+		if err := tx.Model(&model.AlertOutbox{}).
+			Order("id ASC").
+			Limit(trim).
+			Pluck("id", &oldIDs).Error; err != nil {
+			return err
+		}
+		if len(oldIDs) > 0 {
+			if err := tx.Delete(&model.AlertOutbox{}, oldIDs).Error; err != nil {
+				return err
+			}
+			dropped = len(oldIDs)
+		}
+		return tx.Create(entry).Error
+	})
+	return dropped, err
+}
+
+// ListOutbox 按写入顺序获取待投递记录
+func ListOutbox(limit int) ([]model.AlertOutbox, error) {
+	var entries []model.AlertOutbox
+	err := GetDatabase().Order("id ASC").Limit(limit).Find(&entries).Error
+	return entries, err
+}
+
+// DeleteOutbox 删除已投递的记录
+func DeleteOutbox(id uint) error {
+	return GetDatabase().Delete(&model.AlertOutbox{}, id).Error
+}
+
+// MarkOutboxFailed 记录投递失败
+func MarkOutboxFailed(id uint, errMsg string) error {
+	if len(errMsg) > 500 {
+		errMsg = errMsg[:500]
+	}
+	return GetDatabase().Model(&model.AlertOutbox{}).Where("id = ?", id).Updates(map[string]any{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": errMsg,
+	}).Error
+}
+
+// PurgeOutboxBefore 删除早于指定时间的记录，返回删除条数
+func PurgeOutboxBefore(t time.Time) (int64, error) {
+	result := GetDatabase().Where("created_at < ?", t).Delete(&model.AlertOutbox{})
+	return result.RowsAffected, result.Error
+}
+
+// GetOutboxBacklog 获取发件箱积压数量和最早一条未投递记录的写入时间（无积压时为零值）
+func GetOutboxBacklog() (int64, time.Time, error) {
+	db := GetDatabase()
+
+	var count int64
+	if err := db.Model(&model.AlertOutbox{}).Count(&count).Error; err != nil {
+		return 0, time.Time{}, err
+	}
+	if count == 0 {
+		return 0, time.Time{}, nil
+	}
+
+	var oldest model.AlertOutbox
+	if err := db.Order("id ASC").Select("id", "created_at").Take(&oldest).Error; err != nil {
+		return count, time.Time{}, err
+	}
+	return count, oldest.CreatedAt, nil
+}
@@ -0,0 +1,127 @@
+package data
+
+import (
+	"easydarwin/internal/data/model"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// shadowAgreementColumns 一致性统计的聚合列，一致性指标只统计影子推理成功的记录
+const shadowAgreementColumns = "COUNT(*) AS samples, " +
+	"SUM(CASE WHEN shadow_error != '' THEN 1 ELSE 0 END) AS errors, " +
+	"COALESCE(AVG(CASE WHEN shadow_error = '' THEN CASE WHEN same_count THEN 1.0 ELSE 0.0 END END), 0) AS same_count_rate, " +
+	"COALESCE(AVG(CASE WHEN shadow_error = '' THEN class_overlap END), 0) AS avg_class_overlap, " +
+	"COALESCE(AVG(CASE WHEN shadow_error = '' THEN match_rate END), 0) AS avg_match_rate, " +
+	"COALESCE(AVG(CASE WHEN shadow_error = '' AND matched > 0 THEN matched_iou END), 0) AS avg_matched_iou, " +
+	"COALESCE(AVG(primary_time_ms), 0) AS avg_primary_ms, " +
+	"COALESCE(AVG(CASE WHEN shadow_error = '' THEN shadow_time_ms END), 0) AS avg_shadow_ms"
+
+// AddShadowComparison 保存一条影子推理对比记录
+func AddShadowComparison(c *model.ShadowComparison) error {
+	return GetDatabase().Create(c).Error
+}
+
+// shadowFilter 按筛选条件构建对比记录查询
+func shadowFilter(filter model.ShadowComparisonFilter) *gorm.DB {
+	db := GetDatabase().Model(&model.ShadowComparison{})
+	if filter.TaskID != "" {
+		db = db.Where("task_id = ?", filter.TaskID)
+	}
+	if filter.TaskType != "" {
+		db = db.Where("task_type = ?", filter.TaskType)
+	}
+	if filter.ShadowID != "" {
+		db = db.Where("shadow_id = ?", filter.ShadowID)
+	}
+	if filter.ShadowVersion != "" {
+		db = db.Where("shadow_version = ?", filter.ShadowVersion)
+	}
+	if filter.Disagreement {
+		db = db.Where("shadow_error != '' OR NOT same_count OR match_rate < 1")
+	}
+	if !filter.StartTime.IsZero() {
+		db = db.Where("created_at >= ?", filter.StartTime)
+	}
+	if !filter.EndTime.IsZero() {
+		db = db.Where("created_at <= ?", filter.EndTime)
+	}
+	return db
+}
+
+// ListShadowComparisons 分页查询影子推理对比记录（按时间倒序）
+func ListShadowComparisons(filter model.ShadowComparisonFilter, page, pageSize int) ([]model.ShadowComparison, int64, error) {
+	db := shadowFilter(filter)
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	var items []model.ShadowComparison
+	err := db.Order("id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&items).Error
+	return items, total, err
+}
+
+// GetShadowAgreement 影子推理一致性总体统计
+func GetShadowAgreement(filter model.ShadowComparisonFilter) (*model.ShadowAgreement, error) {
+	var agreement model.ShadowAgreement
+	if err := shadowFilter(filter).Select(shadowAgreementColumns).Scan(&agreement).Error; err != nil {
+		return nil, err
+	}
+	return &agreement, nil
+}
+
+// ShadowAgreementByTime 按小时/天/周统计影子推理一致性，时间段划分与告警统计相同，只返回有记录的时间段
+func ShadowAgreementByTime(filter model.ShadowComparisonFilter, interval string, loc *time.Location) ([]model.ShadowAgreement, error) {
+	size, ok := statsIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("%w: interval must be hour, day or week", ErrInvalidStatsParam)
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	_, offset := time.Now().In(loc).Zone()
+	shift := int64(offset)
+	if interval == model.StatsIntervalWeek {
+		shift += 3 * 86400 // 1970-01-01 是周四，偏移到周一
+	}
+
+	db := shadowFilter(filter)
+	var rows []struct {
+		Bucket int64
+		model.ShadowAgreement
+	}
+	// 分桶表达式中只拼接内部计算的整数，不包含用户输入
+	bucket := fmt.Sprintf("(%s + %d) / %d", epochExpr(db), shift, size)
+	if err := db.Select(bucket + " AS bucket, " + shadowAgreementColumns).
+		Group("bucket").Order("bucket").
+		Limit(maxStatsTimeBuckets).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	buckets := make([]model.ShadowAgreement, len(rows))
+	for i, row := range rows {
+		t := time.Unix(row.Bucket*size-shift, 0).In(loc)
+		buckets[i] = row.ShadowAgreement
+		buckets[i].Time = &t
+	}
+	return buckets, nil
+}
+
+// CleanupShadowComparisons 删除指定时间之前的对比记录，返回删除数量
+func CleanupShadowComparisons(before time.Time) (int64, error) {
+	result := GetDatabase().Where("created_at < ?", before).Delete(&model.ShadowComparison{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,61 @@
+package data
+
+import (
+	"easydarwin/internal/data/model"
+	"testing"
+	"time"
+)
+
+func TestShadowAgreement(t *testing.T) {
+	setupLifecycleDB(t)
+
+	loc := time.FixedZone("UTC+8", 8*3600)
+	base := time.Date(2026, 3, 4, 10, 15, 0, 0, loc)
+	comparisons := []model.ShadowComparison{
+		{TaskType: "helmet", ShadowID: "s1", SameCount: true, ClassOverlap: 1, Matched: 2, MatchRate: 1, MatchedIoU: 0.8, PrimaryTimeMs: 40, ShadowTimeMs: 60, CreatedAt: base},
+		{TaskType: "helmet", ShadowID: "s1", SameCount: false, ClassOverlap: 0.5, Matched: 1, MatchRate: 0.5, MatchedIoU: 0.6, PrimaryTimeMs: 40, ShadowTimeMs: 80, CreatedAt: base.Add(10 * time.Minute)},
+		{TaskType: "helmet", ShadowID: "s1", SameCount: true, ClassOverlap: 1, MatchRate: 1, PrimaryTimeMs: 40, ShadowTimeMs: 100, CreatedAt: base.Add(2 * time.Hour)},
+		{TaskType: "helmet", ShadowID: "s1", ShadowError: "timeout", PrimaryTimeMs: 40, CreatedAt: base.Add(2 * time.Hour)},
+		{TaskType: "fire", ShadowID: "s2", SameCount: true, ClassOverlap: 1, MatchRate: 1, CreatedAt: base},
+	}
+	if err := GetDatabase().Create(&comparisons).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	filter := model.ShadowComparisonFilter{TaskType: "helmet"}
+	agreement, err := GetShadowAgreement(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agreement.Samples != 4 || agreement.Errors != 1 || agreement.AvgMatchedIoU != 0.7 || agreement.AvgShadowMs != 80 {
+		t.Fatalf("unexpected agreement: %+v", agreement)
+	}
+	if agreement.SameCountRate < 0.66 || agreement.SameCountRate > 0.67 || agreement.AvgMatchRate < 0.83 || agreement.AvgMatchRate > 0.84 {
+		t.Fatalf("unexpected agreement rates: %+v", agreement)
+	}
+
+	buckets, err := ShadowAgreementByTime(filter, model.StatsIntervalHour, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 2 || !buckets[0].Time.Equal(base.Truncate(time.Hour)) || buckets[0].Samples != 2 || buckets[0].SameCountRate != 0.5 {
+		t.Fatalf("unexpected buckets: %+v", buckets)
+	}
+	if buckets[1].Samples != 2 || buckets[1].Errors != 1 || buckets[1].SameCountRate != 1 {
+		t.Fatalf("unexpected buckets: %+v", buckets[1])
+	}
+
+	filter.Disagreement = true
+	items, total, err := ListShadowComparisons(filter, 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || items[0].ShadowError != "timeout" || items[1].MatchRate != 0.5 {
+		t.Fatalf("unexpected disagreements: %d %+v", total, items)
+	}
+
+	deleted, err := CleanupShadowComparisons(base.Add(time.Hour))
+	if err != nil || deleted != 3 {
+		t.Fatal("unexpected cleanup", deleted, err)
+	}
+}
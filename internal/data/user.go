@@ -2,6 +2,9 @@ package data
 
 import (
 	"easydarwin/utils/pkg/orm"
+	"easydarwin/utils/plugin/core/user"
+
+	"gorm.io/gorm"
 )
 
 type User struct {
@@ -12,8 +15,14 @@ type User struct {
 	Role      string   `gorm:"column:role;notNull;default:''" json:"role"`                    // 角色名称
 	CreatedAt orm.Time `gorm:"column:created_at;notNull;CURRENT_TIMESTAMP" json:"created_at"` // 创建时间
 	Remark    string   `gorm:"column:remark;notNull;default:''" json:"remark"`                // 描述
+	Type      string   `gorm:"column:type;notNull;default:''" json:"-"`                       // 用户类型，开发者账户为 user.UserTypeDeveloper
 }
 
 func (*User) TableName() string {
 	return "users"
 }
+
+// ExcludeDevelopers 排除开发者账户（算法厂商应用），开发者账户与登录用户共用 users 表，不能登录也不能作为告警处理人
+func ExcludeDevelopers(db *gorm.DB) *gorm.DB {
+	return db.Where("type <> ?", user.UserTypeDeveloper)
+}
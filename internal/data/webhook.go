@@ -0,0 +1,77 @@
+package data
+
+import (
+	"easydarwin/internal/data/model"
+	"time"
+)
+
+// ListWebhooks 获取告警回调目标
+func ListWebhooks() ([]model.Webhook, error) {
+	var hooks []model.Webhook
+	err := GetDatabase().Order("id ASC").Find(&hooks).Error
+	return hooks, err
+}
+
+// GetWebhook 根据ID获取告警回调目标
+func GetWebhook(id uint) (*model.Webhook, error) {
+	var hook model.Webhook
+	if err := GetDatabase().First(&hook, id).Error; err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// CreateWebhook 创建告警回调目标
+func CreateWebhook(hook *model.Webhook) error {
+	return GetDatabase().Create(hook).Error
+}
+
+// UpdateWebhook 更新告警回调目标（整条覆盖）
+func UpdateWebhook(hook *model.Webhook) error {
+	return GetDatabase().Save(hook).Error
+}
+
+// DeleteWebhook 删除告警回调目标及其投递记录
+func DeleteWebhook(id uint) error {
+	if err := GetDatabase().Delete(&model.Webhook{}, id).Error; err != nil {
+		return err
+	}
+	return GetDatabase().Where("webhook_id = ?", id).Delete(&model.WebhookDelivery{}).Error
+}
+
+// AddWebhookDelivery 记录一次投递
+func AddWebhookDelivery(delivery *model.WebhookDelivery) error {
+	return GetDatabase().Create(delivery).Error
+}
+
+// ListWebhookDeliveries 分页查询投递记录（按时间倒序），alertID 为0时不按告警筛选
+func ListWebhookDeliveries(webhookID, alertID uint, page, pageSize int) ([]model.WebhookDelivery, int64, error) {
+	db := GetDatabase().Model(&model.WebhookDelivery{}).Where("webhook_id = ?", webhookID)
+	if alertID > 0 {
+		db = db.Where("alert_id = ?", alertID)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	var deliveries []model.WebhookDelivery
+	err := db.Order("id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&deliveries).Error
+	return deliveries, total, err
+}
+
+// CleanupWebhookDeliveries 删除指定时间之前的投递记录，返回删除数量
+func CleanupWebhookDeliveries(before time.Time) (int64, error) {
+	result := GetDatabase().Where("created_at < ?", before).Delete(&model.WebhookDelivery{})
+	return result.RowsAffected, result.Error
+}
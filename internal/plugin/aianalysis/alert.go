@@ -12,10 +12,12 @@ import (
 type SystemAlertType string
 
 const (
-	AlertTypeBacklog     SystemAlertType = "queue_backlog"      // 队列积压
-	AlertTypeSlowInfer   SystemAlertType = "slow_inference"     // 推理慢
-	AlertTypeHighDrop    SystemAlertType = "high_drop_rate"     // 高丢弃率
-	AlertTypeNoAlgorithm SystemAlertType = "no_algorithm"       // 无可用算法
+	AlertTypeBacklog       SystemAlertType = "queue_backlog"  // 队列积压
+	AlertTypeSlowInfer     SystemAlertType = "slow_inference" // 推理慢
+	AlertTypeHighDrop      SystemAlertType = "high_drop_rate" // 高丢弃率
+	AlertTypeNoAlgorithm   SystemAlertType = "no_algorithm"   // 无可用算法
+	AlertTypeCircuitOpen   SystemAlertType = "circuit_open"   // 算法实例被熔断
+	AlertTypeCircuitClosed SystemAlertType = "circuit_closed" // 算法实例熔断恢复
 )
 
 // AlertLevel 告警级别
@@ -30,11 +32,11 @@ const (
 
 // SystemAlert 系统告警
 type SystemAlert struct {
-	Type      SystemAlertType
-	Level     AlertLevel
-	Message   string
-	Data      map[string]interface{}
-	Timestamp time.Time
+	Type      SystemAlertType        `json:"type"`
+	Level     AlertLevel             `json:"level"`
+	Message   string                 `json:"message"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
 }
 
 // AlertManager 告警管理器
@@ -46,6 +48,7 @@ type AlertManager struct {
 	log           *slog.Logger
 	webhookURL    string
 	emailAddress  string
+	onAlert       func(SystemAlert) // 系统告警回调（用于实时推送）
 }
 
 // NewAlertManager 创建告警管理器
@@ -62,10 +65,16 @@ func NewAlertManager(maxAlerts int, maxAlertsInDB int, logger *slog.Logger) *Ale
 	}
 }
 
+// SetOnAlertCallback 设置系统告警回调（回调中不能阻塞）
+func (am *AlertManager) SetOnAlertCallback(callback func(SystemAlert)) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.onAlert = callback
+}
+
 // SendAlert 发送告警
 func (am *AlertManager) SendAlert(alert SystemAlert) {
 	am.mu.Lock()
-	defer am.mu.Unlock()
 	
 	// 添加时间戳
 	if alert.Timestamp.IsZero() {
@@ -90,6 +99,14 @@ func (am *AlertManager) SendAlert(alert SystemAlert) {
 	
 	// 发送通知（webhook/邮件等）
 	am.sendNotification(alert)
+
+	onAlert := am.onAlert
+	am.mu.Unlock()
+
+	// 释放锁后再回调，回调中可以查询告警管理器
+	if onAlert != nil {
+		onAlert(alert)
+	}
 }
 
 // saveToDatabase 保存告警到数据库
@@ -0,0 +1,327 @@
+package aianalysis
+
+import (
+	"context"
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data/model"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const defaultAMQPRoutingKey = "alert.{task_type}.{task_id}"
+
+// AMQPQueue RabbitMQ(AMQP 0-9-1)消息队列实现
+// 开启publisher confirm，连接或通道断开后自动重连并恢复通道
+type AMQPQueue struct {
+	address    string
+	exchange   string
+	routingKey string
+	cfg        conf.AMQPConfig
+	log        *slog.Logger
+
+	mu       sync.RWMutex
+	conn     *amqp.Connection
+	ch       *amqp.Channel
+	done     chan struct{}
+	closed   bool
+	watching bool // 重连协程已启动（重复调用 Connect 时只返回当前连接状态）
+}
+
+// NewAMQPQueue 创建AMQP队列
+// exchange 为空时使用 cfg.Exchange；routingKey 模板支持 {task_type}、{task_id}、{algorithm_id} 占位符
+func NewAMQPQueue(address, exchange string, cfg conf.AMQPConfig, logger *slog.Logger) *AMQPQueue {
+	if cfg.Exchange != "" {
+		exchange = cfg.Exchange
+	}
+	if cfg.ExchangeType == "" {
+		cfg.ExchangeType = amqp.ExchangeTopic
+	}
+	if cfg.RoutingKey == "" {
+		cfg.RoutingKey = defaultAMQPRoutingKey
+	}
+	if cfg.ConfirmTimeoutSec <= 0 {
+		cfg.ConfirmTimeoutSec = 10
+	}
+	if cfg.ReconnectIntervalSec <= 0 {
+		cfg.ReconnectIntervalSec = 30
+	}
+
+	return &AMQPQueue{
+		address:    address,
+		exchange:   exchange,
+		routingKey: cfg.RoutingKey,
+		cfg:        cfg,
+		log:        logger,
+		done:       make(chan struct{}),
+	}
+}
+
+// Connect 连接到RabbitMQ，并启动断线重连协程
+// 首次连接失败时同样在后台按退避间隔重连，broker恢复后自动可用
+func (a *AMQPQueue) Connect() error {
+	a.mu.Lock()
+	if a.watching {
+		connected := a.ch != nil
+		a.mu.Unlock()
+		if !connected {
+			return fmt.Errorf("amqp not connected, reconnecting in background")
+		}
+		return nil
+	}
+	a.watching = true
+	a.mu.Unlock()
+
+	conn, err := a.dial()
+	if err == nil {
+		var ch *amqp.Channel
+		if ch, err = a.openChannel(conn); err != nil {
+			conn.Close()
+		} else {
+			a.mu.Lock()
+			a.conn, a.ch = conn, ch
+			a.mu.Unlock()
+		}
+	}
+	if err != nil {
+		go func() {
+			if a.recover(nil) {
+				a.watch()
+			}
+		}()
+		return err
+	}
+
+	go a.watch()
+
+	a.log.Info("amqp connected",
+		slog.String("exchange", a.exchange),
+		slog.String("exchange_type", a.cfg.ExchangeType),
+		slog.String("routing_key", a.routingKey))
+	return nil
+}
+
+// dial 建立AMQP连接（amqps:// 地址自动使用TLS）
+func (a *AMQPQueue) dial() (*amqp.Connection, error) {
+	conn, err := amqp.DialConfig(a.address, amqp.Config{
+		Heartbeat: 10 * time.Second,
+		Locale:    "en_US",
+		Properties: amqp.Table{
+			"connection_name": "easydarwin-ai-alerts",
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("amqp dial failed: %w", err)
+	}
+	return conn, nil
+}
+
+// openChannel 打开通道，开启confirm模式并按需声明交换机
+func (a *AMQPQueue) openChannel(conn *amqp.Connection) (*amqp.Channel, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("amqp open channel failed: %w", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("amqp enable confirm failed: %w", err)
+	}
+	if a.cfg.DeclareExchange && a.exchange != "" {
+		if err := ch.ExchangeDeclare(a.exchange, a.cfg.ExchangeType, true, false, false, false, nil); err != nil {
+			ch.Close()
+			return nil, fmt.Errorf("amqp declare exchange %s failed: %w", a.exchange, err)
+		}
+	}
+	return ch, nil
+}
+
+// watch 监听连接/通道关闭事件：仅通道关闭时恢复通道，连接关闭时重新建立连接
+func (a *AMQPQueue) watch() {
+	for {
+		a.mu.RLock()
+		conn, ch := a.conn, a.ch
+		a.mu.RUnlock()
+
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+		var reason *amqp.Error
+		select {
+		case <-a.done:
+			return
+		case reason = <-connClosed:
+		case reason = <-chClosed:
+		}
+
+		a.mu.Lock()
+		a.ch = nil
+		a.mu.Unlock()
+
+		attrs := []any{slog.Bool("connection_closed", conn.IsClosed())}
+		if reason != nil {
+			attrs = append(attrs, slog.String("reason", reason.Error()))
+		}
+		a.log.Warn("amqp connection lost, recovering", attrs...)
+
+		if !a.recover(conn) {
+			return
+		}
+	}
+}
+
+// recover 按退避间隔重试恢复连接和通道（conn 为nil时重新建立连接），队列关闭时返回false
+func (a *AMQPQueue) recover(conn *amqp.Connection) bool {
+	maxDelay := time.Duration(a.cfg.ReconnectIntervalSec) * time.Second
+	delay := time.Second
+
+	for attempt := 1; ; attempt++ {
+		var err error
+		if conn == nil || conn.IsClosed() {
+			var newConn *amqp.Connection
+			if newConn, err = a.dial(); err == nil {
+				conn = newConn
+			}
+		}
+
+		var ch *amqp.Channel
+		if err == nil {
+			if ch, err = a.openChannel(conn); err != nil && !conn.IsClosed() {
+				conn.Close()
+			}
+		}
+
+		if err == nil {
+			a.mu.Lock()
+			if a.closed {
+				a.mu.Unlock()
+				ch.Close()
+				conn.Close()
+				return false
+			}
+			a.conn, a.ch = conn, ch
+			a.mu.Unlock()
+
+			a.log.Info("amqp recovered", slog.Int("attempt", attempt))
+			return true
+		}
+
+		a.log.Warn("amqp recover failed",
+			slog.Int("attempt", attempt),
+			slog.Duration("retry_in", delay),
+			slog.String("err", err.Error()))
+
+		select {
+		case <-a.done:
+			return false
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// PublishAlert 发布告警消息，等待broker确认后返回
+func (a *AMQPQueue) PublishAlert(alert model.Alert) error {
+	msg, err := buildAMQPPublishing(alert, a.cfg.Persistent)
+	if err != nil {
+		return err
+	}
+
+	a.mu.RLock()
+	ch := a.ch
+	a.mu.RUnlock()
+	if ch == nil {
+		return fmt.Errorf("amqp not connected")
+	}
+
+	routingKey := renderAMQPRoutingKey(a.routingKey, alert)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(a.cfg.ConfirmTimeoutSec)*time.Second)
+	defer cancel()
+
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, a.exchange, routingKey, false, false, msg)
+	if err != nil {
+		return err
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("amqp wait confirm failed: %w", err)
+	}
+	if !acked {
+		return fmt.Errorf("amqp broker nacked alert %d", alert.ID)
+	}
+
+	a.log.Info("alert published to amqp",
+		slog.Uint64("alert_id", uint64(alert.ID)),
+		slog.String("exchange", a.exchange),
+		slog.String("routing_key", routingKey),
+		slog.String("task_id", alert.TaskID),
+		slog.String("task_type", alert.TaskType),
+		slog.Int("detection_count", alert.DetectionCount))
+
+	return nil
+}
+
+// Close 关闭AMQP连接，停止重连
+func (a *AMQPQueue) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	close(a.done)
+
+	if a.ch != nil {
+		a.ch.Close()
+		a.ch = nil
+	}
+	if a.conn != nil {
+		return a.conn.Close()
+	}
+	return nil
+}
+
+// buildAMQPPublishing 构建AMQP消息，task_id/task_type/algorithm_id 写入消息头供消费者路由
+func buildAMQPPublishing(alert model.Alert, persistent bool) (amqp.Publishing, error) {
+	alertJSON, err := json.Marshal(alert)
+	if err != nil {
+		return amqp.Publishing{}, err
+	}
+
+	deliveryMode := amqp.Transient
+	if persistent {
+		deliveryMode = amqp.Persistent
+	}
+
+	return amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: deliveryMode,
+		MessageId:    strconv.FormatUint(uint64(alert.ID), 10),
+		Timestamp:    alert.CreatedAt,
+		Type:         "alert",
+		Headers: amqp.Table{
+			"task_id":      alert.TaskID,
+			"task_type":    alert.TaskType,
+			"algorithm_id": alert.AlgorithmID,
+		},
+		Body: alertJSON,
+	}, nil
+}
+
+// amqpRoutingKeyEscaper 替换路由键中的分隔符和通配符，避免任务ID等字段破坏路由结构
+var amqpRoutingKeyEscaper = strings.NewReplacer(".", "_", "*", "_", "#", "_")
+
+// renderAMQPRoutingKey 按告警信息渲染路由键模板
+func renderAMQPRoutingKey(template string, alert model.Alert) string {
+	return renderAlertTemplate(template, alert, amqpRoutingKeyEscaper)
+}
@@ -0,0 +1,285 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data/model"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestRenderAMQPRoutingKey(t *testing.T) {
+	alert := model.Alert{TaskID: "cam.01", TaskType: "区域入侵", AlgorithmID: "algo*#"}
+	key := renderAMQPRoutingKey("alert.{task_type}.{task_id}.{algorithm_id}", alert)
+	if key != "alert.区域入侵.cam_01.algo__" {
+		t.Fatal("unexpected routing key", key)
+	}
+	if key := renderAMQPRoutingKey(defaultAMQPRoutingKey, model.Alert{TaskType: "helmet"}); key != "alert.helmet.unknown" {
+		t.Fatal("unexpected routing key", key)
+	}
+}
+
+func TestBuildAMQPPublishing(t *testing.T) {
+	alert := model.Alert{ID: 42, TaskID: "task1", TaskType: "intrusion", AlgorithmID: "yolo", CreatedAt: time.Unix(1700000000, 0)}
+
+	msg, err := buildAMQPPublishing(alert, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.DeliveryMode != amqp.Persistent || msg.MessageId != "42" || msg.ContentType != "application/json" {
+		t.Fatal("unexpected publishing", msg.DeliveryMode, msg.MessageId, msg.ContentType)
+	}
+	if msg.Headers["task_id"] != "task1" || msg.Headers["task_type"] != "intrusion" || msg.Headers["algorithm_id"] != "yolo" {
+		t.Fatal("unexpected headers", msg.Headers)
+	}
+	if err := msg.Headers.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got model.Alert
+	if err := json.Unmarshal(msg.Body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 42 || got.TaskID != "task1" {
+		t.Fatal("unexpected body", string(msg.Body))
+	}
+
+	if msg, _ := buildAMQPPublishing(alert, false); msg.DeliveryMode != amqp.Transient {
+		t.Fatal("expect transient delivery mode")
+	}
+}
+
+func TestAMQPQueueConnectFailed(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	q := NewAMQPQueue("amqp://guest:guest@"+addr+"/", "easydarwin.alerts", conf.AMQPConfig{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer q.Close()
+	if err := q.Connect(); err == nil {
+		t.Fatal("expect connect error without broker")
+	}
+	if err := q.PublishAlert(model.Alert{}); err == nil {
+		t.Fatal("expect publish error when not connected")
+	}
+}
+
+// fakeAMQPBroker 最小的 AMQP 0-9-1 服务端：完成握手、开启confirm，按 acks 依次确认或拒绝发布的消息
+type fakeAMQPBroker struct {
+	ln       net.Listener
+	acks     chan bool     // 每条发布消息的确认结果（true=ack，false=nack）
+	channels chan net.Conn // 每次打开通道后通知所在的连接
+	opened   chan uint16   // 打开的通道号
+}
+
+func newFakeAMQPBroker(t *testing.T, addr string) *fakeAMQPBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeAMQPBroker{ln: ln, acks: make(chan bool, 10), channels: make(chan net.Conn, 10), opened: make(chan uint16, 10)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+// amqpMethod 编码方法帧
+func amqpMethod(channel, class, method uint16, args []byte) []byte {
+	payload := binary.BigEndian.AppendUint16(nil, class)
+	payload = binary.BigEndian.AppendUint16(payload, method)
+	payload = append(payload, args...)
+	frame := []byte{1}
+	frame = binary.BigEndian.AppendUint16(frame, channel)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	frame = append(frame, payload...)
+	return append(frame, 0xCE)
+}
+
+func amqpShortStr(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+func amqpLongStr(s string) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(s))), s...)
+}
+
+func (b *fakeAMQPBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+
+	start := []byte{0, 9}
+	start = binary.BigEndian.AppendUint32(start, 0) // server-properties
+	start = append(start, amqpLongStr("PLAIN")...)
+	start = append(start, amqpLongStr("en_US")...)
+	conn.Write(amqpMethod(0, 10, 10, start))
+
+	deliveryTag := make(map[uint16]uint64)
+	for {
+		head := make([]byte, 7)
+		if _, err := io.ReadFull(conn, head); err != nil {
+			return
+		}
+		channel := binary.BigEndian.Uint16(head[1:3])
+		payload := make([]byte, binary.BigEndian.Uint32(head[3:7])+1)
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			return
+		}
+		if head[0] != 1 {
+			continue // 内容头、消息体、心跳
+		}
+
+		switch class, method := binary.BigEndian.Uint16(payload[0:2]), binary.BigEndian.Uint16(payload[2:4]); {
+		case class == 10 && method == 11: // Connection.StartOk
+			tune := binary.BigEndian.AppendUint16(nil, 16)
+			tune = binary.BigEndian.AppendUint32(tune, 131072)
+			tune = binary.BigEndian.AppendUint16(tune, 0)
+			conn.Write(amqpMethod(0, 10, 30, tune))
+		case class == 10 && method == 40: // Connection.Open
+			conn.Write(amqpMethod(0, 10, 41, amqpShortStr("")))
+		case class == 10 && method == 50: // Connection.Close
+			conn.Write(amqpMethod(0, 10, 51, nil))
+			return
+		case class == 20 && method == 10: // Channel.Open
+			conn.Write(amqpMethod(channel, 20, 11, amqpLongStr("")))
+			b.opened <- channel
+			b.channels <- conn
+		case class == 20 && method == 40: // Channel.Close
+			conn.Write(amqpMethod(channel, 20, 41, nil))
+		case class == 85 && method == 10: // Confirm.Select
+			conn.Write(amqpMethod(channel, 85, 11, nil))
+		case class == 60 && method == 40: // Basic.Publish
+			deliveryTag[channel]++
+			args := binary.BigEndian.AppendUint64(nil, deliveryTag[channel])
+			if <-b.acks {
+				conn.Write(amqpMethod(channel, 60, 80, append(args, 0)))
+			} else {
+				conn.Write(amqpMethod(channel, 60, 120, append(args, 0)))
+			}
+		}
+	}
+}
+
+func TestAMQPQueueNack(t *testing.T) {
+	b := newFakeAMQPBroker(t, "127.0.0.1:0")
+	q := NewAMQPQueue("amqp://guest:guest@"+b.ln.Addr().String()+"/", "easydarwin.alerts", conf.AMQPConfig{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := q.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	b.acks <- false
+	if err := q.PublishAlert(model.Alert{ID: 1}); err == nil || !strings.Contains(err.Error(), "nacked") {
+		t.Fatal("expect nack error, got", err)
+	}
+	b.acks <- true
+	if err := q.PublishAlert(model.Alert{ID: 2}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAMQPQueueRecoversChannel(t *testing.T) {
+	b := newFakeAMQPBroker(t, "127.0.0.1:0")
+	q := NewAMQPQueue("amqp://guest:guest@"+b.ln.Addr().String()+"/", "easydarwin.alerts", conf.AMQPConfig{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := q.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	// 服务端关闭通道（如发布到不存在的交换机），连接保持
+	first, conn := <-b.opened, <-b.channels
+	closeArgs := binary.BigEndian.AppendUint16(nil, 404)
+	closeArgs = append(closeArgs, amqpShortStr("NOT_FOUND")...)
+	closeArgs = binary.BigEndian.AppendUint16(closeArgs, 60)
+	closeArgs = binary.BigEndian.AppendUint16(closeArgs, 40)
+	conn.Write(amqpMethod(first, 20, 40, closeArgs))
+
+	select {
+	case <-b.opened:
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel not reopened")
+	}
+	if newConn := <-b.channels; newConn != conn {
+		t.Fatal("channel recovery should reuse the connection")
+	}
+
+	b.acks <- true
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := q.PublishAlert(model.Alert{ID: 3})
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("publish after channel recovery failed:", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestAMQPQueueReconnectsAfterInitialFailure(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	q := NewAMQPQueue("amqp://guest:guest@"+addr+"/", "easydarwin.alerts", conf.AMQPConfig{ReconnectIntervalSec: 1}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer q.Close()
+	if err := q.Connect(); err == nil {
+		t.Fatal("expect connect error without broker")
+	}
+	if err := q.Connect(); err == nil {
+		t.Fatal("expect repeated connect to report disconnected")
+	}
+
+	// broker 启动后自动连接（重复调用 Connect 不会启动多个重连协程）
+	b := newFakeAMQPBroker(t, addr)
+	select {
+	case <-b.opened:
+	case <-time.After(10 * time.Second):
+		t.Fatal("not reconnected after broker started")
+	}
+	select {
+	case <-b.opened:
+		t.Fatal("unexpected second connection")
+	case <-time.After(1500 * time.Millisecond):
+	}
+	if err := q.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	b.acks <- true
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := q.PublishAlert(model.Alert{ID: 4})
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("publish after reconnect failed:", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,398 @@
+package aianalysis
+
+import (
+	"bytes"
+	"context"
+	"easydarwin/internal/conf"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// 标注绘制内容
+const (
+	AnnotateBox        = "box"
+	AnnotateLabel      = "label"
+	AnnotateConfidence = "confidence"
+	AnnotateRegion     = "region"
+	AnnotateTimestamp  = "timestamp"
+	AnnotateCamera     = "camera"
+)
+
+const (
+	annotatedSuffix        = "_annotated"
+	defaultAnnotationColor = "#FF0000"
+	defaultRegionColor     = "#00FF00"
+	defaultLineWidth       = 3
+	defaultFontSize        = 20
+	defaultJPEGQuality     = 85
+)
+
+var allAnnotateElements = []string{AnnotateBox, AnnotateLabel, AnnotateConfidence, AnnotateRegion, AnnotateTimestamp, AnnotateCamera}
+
+// AnnotationInput 绘制一张告警图片所需的信息
+type AnnotationInput struct {
+	TaskType   string
+	Camera     string
+	Time       time.Time
+	Detections []Detection
+	Regions    []AnnotationRegion
+}
+
+// AnnotationRegion 任务配置中的区域（polygon/rectangle/line）
+type AnnotationRegion struct {
+	Name   string
+	Type   string
+	Points [][2]float64
+	Color  string
+}
+
+// Annotator 告警图片标注器（纯Go绘制，不依赖OpenCV等外部库）
+type Annotator struct {
+	cfg  conf.AnnotationConfig
+	font *opentype.Font // 为nil时使用内置点阵字体
+}
+
+// NewAnnotator 创建告警图片标注器
+func NewAnnotator(cfg conf.AnnotationConfig) (*Annotator, error) {
+	if cfg.JPEGQuality <= 0 || cfg.JPEGQuality > 100 {
+		cfg.JPEGQuality = defaultJPEGQuality
+	}
+
+	a := &Annotator{cfg: cfg}
+	if cfg.FontFile != "" {
+		data, err := os.ReadFile(cfg.FontFile)
+		if err != nil {
+			return nil, fmt.Errorf("read font file failed: %w", err)
+		}
+		f, err := opentype.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse font file failed: %w", err)
+		}
+		a.font = f
+	}
+	return a, nil
+}
+
+// annotatedImagePath 标注图片与原图放在同一目录，文件名加 _annotated 后缀
+func annotatedImagePath(imagePath string) string {
+	ext := path.Ext(imagePath)
+	return strings.TrimSuffix(imagePath, ext) + annotatedSuffix + ".jpg"
+}
+
+// style 获取任务类型生效的样式并填充默认值
+func (a *Annotator) style(taskType string) conf.AnnotationStyle {
+	style := a.cfg.Style
+	if override, ok := conf.LookupTaskType(a.cfg.TaskTypes, taskType); ok {
+		style = override
+	}
+	if len(style.Elements) == 0 {
+		style.Elements = allAnnotateElements
+	}
+	if style.BoxColor == "" {
+		style.BoxColor = defaultAnnotationColor
+	}
+	if style.LineWidth <= 0 {
+		style.LineWidth = defaultLineWidth
+	}
+	if style.FontSize <= 0 {
+		style.FontSize = defaultFontSize
+	}
+	return style
+}
+
+// fontFace 每次绘制创建独立的字体实例（opentype字体实例不能并发使用）
+func (a *Annotator) fontFace(size float64) (font.Face, error) {
+	if a.font == nil {
+		return basicfont.Face7x13, nil
+	}
+	return opentype.NewFace(a.font, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+// Annotate 解码图片、绘制标注并编码为JPEG
+func (a *Annotator) Annotate(data []byte, input AnnotationInput) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image failed: %w", err)
+	}
+
+	canvas, err := a.Render(src, input)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, canvas, &jpeg.Options{Quality: a.cfg.JPEGQuality}); err != nil {
+		return nil, fmt.Errorf("encode image failed: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Render 在原图副本上绘制区域、检测框、标签和时间/摄像头信息
+func (a *Annotator) Render(src image.Image, input AnnotationInput) (*image.RGBA, error) {
+	style := a.style(input.TaskType)
+	face, err := a.fontFace(style.FontSize)
+	if err != nil {
+		return nil, fmt.Errorf("create font face failed: %w", err)
+	}
+	defer face.Close()
+
+	bounds := src.Bounds()
+	canvas := image.NewRGBA(bounds)
+	draw.Draw(canvas, bounds, src, bounds.Min, draw.Src)
+	has := func(element string) bool { return slices.Contains(style.Elements, element) }
+
+	if has(AnnotateRegion) {
+		for _, region := range input.Regions {
+			c := parseHexColor(region.Color, parseHexColor(defaultRegionColor, color.RGBA{G: 255, A: 255}))
+			drawPolyline(canvas, region.Points, region.Type != "line", style.LineWidth, c)
+			if region.Name != "" && len(region.Points) > 0 && has(AnnotateLabel) {
+				p := region.Points[0]
+				drawLabel(canvas, face, region.Name, int(p[0]), int(p[1]), c)
+			}
+		}
+	}
+
+	boxColor := parseHexColor(style.BoxColor, color.RGBA{R: 255, A: 255})
+	for _, d := range input.Detections {
+		if !d.HasBBox {
+			continue
+		}
+		c := boxColor
+		if hex, ok := style.ClassColors[d.Class]; ok {
+			c = parseHexColor(hex, boxColor)
+		}
+		x1, y1, x2, y2 := int(d.BBox[0]), int(d.BBox[1]), int(d.BBox[2]), int(d.BBox[3])
+		if has(AnnotateBox) {
+			drawRect(canvas, x1, y1, x2, y2, style.LineWidth, c)
+		}
+
+		var label []string
+		if has(AnnotateLabel) && d.Class != "" {
+			label = append(label, d.Class)
+		}
+		if has(AnnotateConfidence) && d.Confidence > 0 {
+			label = append(label, fmt.Sprintf("%.2f", d.Confidence))
+		}
+		if len(label) > 0 {
+			drawLabel(canvas, face, strings.Join(label, " "), x1, y1, c)
+		}
+	}
+
+	// 左上角：摄像头和时间
+	var header []string
+	if has(AnnotateCamera) && input.Camera != "" {
+		header = append(header, input.Camera)
+	}
+	if has(AnnotateTimestamp) && !input.Time.IsZero() {
+		header = append(header, input.Time.Format("2006-01-02 15:04:05"))
+	}
+	if len(header) > 0 {
+		lineHeight := face.Metrics().Height.Ceil() + 4
+		drawLabel(canvas, face, strings.Join(header, "  "), bounds.Min.X, bounds.Min.Y+lineHeight, color.RGBA{A: 255})
+	}
+	return canvas, nil
+}
+
+// drawLabel 在 (x, y) 上方绘制带背景的文字，超出上边界时绘制在下方
+func drawLabel(img *image.RGBA, face font.Face, text string, x, y int, bg color.RGBA) {
+	const padding = 2
+	width := font.MeasureString(face, text).Ceil()
+	height := face.Metrics().Height.Ceil()
+
+	top := y - height - 2*padding
+	if top < img.Bounds().Min.Y {
+		top = y
+	}
+	rect := image.Rect(x, top, x+width+2*padding, top+height+2*padding).Intersect(img.Bounds())
+	draw.Draw(img, rect, image.NewUniform(bg), image.Point{}, draw.Src)
+
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(contrastColor(bg)),
+		Face: face,
+		Dot:  fixed.P(x+padding, top+padding+face.Metrics().Ascent.Ceil()),
+	}
+	d.DrawString(text)
+}
+
+// drawRect 绘制矩形框
+func drawRect(img *image.RGBA, x1, y1, x2, y2, width int, c color.RGBA) {
+	fill := image.NewUniform(c)
+	for _, r := range []image.Rectangle{
+		image.Rect(x1, y1, x2, y1+width),
+		image.Rect(x1, y2-width, x2, y2),
+		image.Rect(x1, y1, x1+width, y2),
+		image.Rect(x2-width, y1, x2, y2),
+	} {
+		draw.Draw(img, r.Intersect(img.Bounds()), fill, image.Point{}, draw.Src)
+	}
+}
+
+// drawPolyline 绘制折线，closed 为 true 时首尾相连
+func drawPolyline(img *image.RGBA, points [][2]float64, closed bool, width int, c color.RGBA) {
+	if len(points) < 2 {
+		return
+	}
+	for i := 0; i+1 < len(points); i++ {
+		drawLine(img, points[i], points[i+1], width, c)
+	}
+	if closed && len(points) > 2 {
+		drawLine(img, points[len(points)-1], points[0], width, c)
+	}
+}
+
+// drawLine Bresenham 画线，每个点绘制 width×width 的方块实现线宽
+func drawLine(img *image.RGBA, from, to [2]float64, width int, c color.RGBA) {
+	x0, y0, x1, y1 := int(from[0]), int(from[1]), int(to[0]), int(to[1])
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	fill := image.NewUniform(c)
+	half := width / 2
+	for e := dx + dy; ; {
+		r := image.Rect(x0-half, y0-half, x0-half+width, y0-half+width).Intersect(img.Bounds())
+		draw.Draw(img, r, fill, image.Point{}, draw.Src)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// parseHexColor 解析 #RRGGBB 颜色，格式错误时返回 fallback
+func parseHexColor(hex string, fallback color.RGBA) color.RGBA {
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(strings.TrimPrefix(hex, "#"), "%02x%02x%02x", &r, &g, &b); err != nil || len(strings.TrimPrefix(hex, "#")) != 6 {
+		return fallback
+	}
+	return color.RGBA{R: r, G: g, B: b, A: 255}
+}
+
+// contrastColor 根据背景亮度选择黑色或白色文字
+func contrastColor(bg color.RGBA) color.RGBA {
+	if int(bg.R)*299+int(bg.G)*587+int(bg.B)*114 > 128000 {
+		return color.RGBA{A: 255}
+	}
+	return color.RGBA{R: 255, G: 255, B: 255, A: 255}
+}
+
+// parseRegions 从任务算法配置的 regions 中解析启用的区域
+func parseRegions(algoConfig map[string]interface{}) []AnnotationRegion {
+	items, ok := algoConfig["regions"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var regions []AnnotationRegion
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if enabled, ok := obj["enabled"].(bool); ok && !enabled {
+			continue
+		}
+
+		region := AnnotationRegion{}
+		region.Name, _ = obj["name"].(string)
+		region.Type, _ = obj["type"].(string)
+		if props, ok := obj["properties"].(map[string]interface{}); ok {
+			region.Color, _ = props["color"].(string)
+		}
+		points, _ := obj["points"].([]interface{})
+		for _, p := range points {
+			xy, ok := p.([]interface{})
+			if !ok || len(xy) < 2 {
+				continue
+			}
+			x, okX := toFloat(xy[0])
+			y, okY := toFloat(xy[1])
+			if okX && okY {
+				region.Points = append(region.Points, [2]float64{x, y})
+			}
+		}
+		// 矩形只给出对角两点时补全四个顶点
+		if region.Type == "rectangle" && len(region.Points) == 2 {
+			p1, p2 := region.Points[0], region.Points[1]
+			region.Points = [][2]float64{p1, {p2[0], p1[1]}, p2, {p1[0], p2[1]}}
+		}
+		if len(region.Points) >= 2 {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// renderAnnotatedImage 生成标注图片并上传到 dstPath（data 为空时从 srcPath 读取原图），返回是否上传成功
+func (s *Scheduler) renderAnnotatedImage(srcPath, dstPath string, data []byte, input AnnotationInput) bool {
+	start := time.Now()
+	if len(data) == 0 {
+		var err error
+		if data, err = s.loadImage(srcPath); err != nil {
+			s.log.Error("failed to load image for annotation",
+				slog.String("path", srcPath),
+				slog.String("err", err.Error()))
+			return false
+		}
+	}
+
+	annotated, err := s.annotator.Annotate(data, input)
+	if err != nil {
+		s.log.Error("failed to annotate alert image",
+			slog.String("path", srcPath),
+			slog.String("err", err.Error()))
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.store.Put(ctx, dstPath, bytes.NewReader(annotated), int64(len(annotated)), "image/jpeg"); err != nil {
+		s.log.Error("failed to upload annotated image",
+			slog.String("path", dstPath),
+			slog.String("err", err.Error()))
+		return false
+	}
+
+	s.log.Debug("annotated image saved",
+		slog.String("src", srcPath),
+		slog.String("dst", dstPath),
+		slog.Int("detections", len(input.Detections)),
+		slog.Duration("duration_ms", time.Since(start)))
+	return true
+}
@@ -0,0 +1,122 @@
+package aianalysis
+
+import (
+	"bytes"
+	"easydarwin/internal/conf"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+	"time"
+)
+
+func testFrame(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAnnotatedImagePath(t *testing.T) {
+	got := annotatedImagePath("alerts/人数统计/cam1/20250115-150001.123.png")
+	if got != "alerts/人数统计/cam1/20250115-150001.123_annotated.jpg" {
+		t.Fatalf("annotated path = %s", got)
+	}
+}
+
+func TestAnnotatorRender(t *testing.T) {
+	a, err := NewAnnotator(conf.AnnotationConfig{
+		Style: conf.AnnotationStyle{BoxColor: "#0000FF", LineWidth: 2},
+		TaskTypes: map[string]conf.AnnotationStyle{
+			"人员跌倒": {Elements: []string{AnnotateTimestamp}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(testFrame(t, 200, 100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := AnnotationInput{
+		TaskType: "人数统计",
+		Camera:   "cam1",
+		Time:     time.Date(2025, 1, 15, 15, 0, 1, 0, time.Local),
+		Detections: []Detection{
+			{Class: "person", Confidence: 0.9, BBox: [4]float64{100, 40, 180, 90}, HasBBox: true},
+		},
+		Regions: []AnnotationRegion{{Type: "line", Points: [][2]float64{{10, 95}, {190, 95}}, Color: "#00FF00"}},
+	}
+
+	canvas, err := a.Render(src, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 检测框左边线、区域线
+	if c := canvas.RGBAAt(100, 70); c != (color.RGBA{B: 255, A: 255}) {
+		t.Fatalf("box edge color = %v", c)
+	}
+	if c := canvas.RGBAAt(100, 95); c != (color.RGBA{G: 255, A: 255}) {
+		t.Fatalf("region line color = %v", c)
+	}
+	// 原图未被修改
+	if r, g, b, _ := src.At(100, 70).RGBA(); r>>8 < 0xf0 || g>>8 < 0xf0 || b>>8 < 0xf0 {
+		t.Fatal("source image must not be modified")
+	}
+
+	// 按任务类型覆盖样式：只绘制时间，不绘制检测框
+	input.TaskType = "人员跌倒"
+	canvas, err = a.Render(src, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := canvas.RGBAAt(100, 70); c == (color.RGBA{B: 255, A: 255}) {
+		t.Fatal("box should not be drawn for task type without box element")
+	}
+}
+
+func TestAnnotatorAnnotate(t *testing.T) {
+	a, err := NewAnnotator(conf.AnnotationConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := a.Annotate(testFrame(t, 64, 48), AnnotationInput{Camera: "cam1", Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 64 || img.Bounds().Dy() != 48 {
+		t.Fatalf("annotated size = %v", img.Bounds())
+	}
+
+	if _, err := NewAnnotator(conf.AnnotationConfig{FontFile: "/nonexistent.ttf"}); err == nil {
+		t.Fatal("expected error for missing font file")
+	}
+}
+
+func TestParseRegions(t *testing.T) {
+	algoConfig := map[string]interface{}{
+		"regions": []interface{}{
+			map[string]interface{}{
+				"name": "入口", "type": "rectangle", "enabled": true,
+				"points":     []interface{}{[]interface{}{10.0, 20.0}, []interface{}{110.0, 120.0}},
+				"properties": map[string]interface{}{"color": "#FF0000"},
+			},
+			map[string]interface{}{"type": "polygon", "enabled": false, "points": []interface{}{}},
+		},
+	}
+	regions := parseRegions(algoConfig)
+	if len(regions) != 1 || len(regions[0].Points) != 4 || regions[0].Color != "#FF0000" {
+		t.Fatalf("unexpected regions: %+v", regions)
+	}
+}
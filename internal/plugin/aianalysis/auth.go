@@ -0,0 +1,243 @@
+package aianalysis
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"easydarwin/utils/plugin/core/user"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 算法服务签名请求头
+const (
+	HeaderAlgorithmTimestamp = "X-Algorithm-Timestamp" // Unix 秒
+	HeaderAlgorithmSignature = "X-Algorithm-Signature" // sha256=<hex>
+)
+
+var (
+	// ErrAlgorithmUnauthorized 凭证或签名无效
+	ErrAlgorithmUnauthorized = errors.New("unauthorized")
+	// ErrAlgorithmForbidden 凭证有效但无权执行该操作
+	ErrAlgorithmForbidden = errors.New("forbidden")
+)
+
+// AlgorithmAuth 算法服务注册鉴权：
+// 算法厂商应用即开发者账户（user.Core.CreateApp 签发 app_id + secret，只保存哈希），注册时校验凭证，并按应用限制可注册的任务类型；
+// 注册成功后返回由 sign_key 派生的 session_key，心跳和注销请求使用它签名，任意节点都能校验。
+// 管理操作（清空服务、强制注销、查询审计、设置任务类型）使用系统管理员账户（HTTP Basic）
+type AlgorithmAuth struct {
+	enable    bool
+	apps      user.Core
+	signKey   []byte
+	skew      time.Duration
+	retention time.Duration
+	log       *slog.Logger
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewAlgorithmAuth 创建注册鉴权，apps 为开发者账户管理
+func NewAlgorithmAuth(cfg conf.AlgorithmAuthConfig, apps user.Core, logger *slog.Logger) (*AlgorithmAuth, error) {
+	a := &AlgorithmAuth{
+		enable:    cfg.Enable,
+		apps:      apps,
+		signKey:   []byte(cfg.SignKey),
+		skew:      time.Duration(cfg.TimestampSkewSec) * time.Second,
+		retention: time.Duration(cfg.AuditRetentionDays) * 24 * time.Hour,
+		log:       logger,
+		stopCh:    make(chan struct{}),
+	}
+	if a.skew <= 0 {
+		a.skew = 300 * time.Second
+	}
+	if a.retention <= 0 {
+		a.retention = 90 * 24 * time.Hour
+	}
+	if len(a.signKey) == 0 {
+		a.signKey = make([]byte, 32)
+		if _, err := rand.Read(a.signKey); err != nil {
+			return nil, fmt.Errorf("generate sign key: %w", err)
+		}
+		if a.enable {
+			logger.Warn("ai_analysis.auth.sign_key not set, using a random key: algorithm services must re-register after restart and keys differ between nodes")
+		}
+	}
+	return a, nil
+}
+
+// Enabled 是否启用注册鉴权
+func (a *AlgorithmAuth) Enabled() bool {
+	return a != nil && a.enable
+}
+
+// Start 启动审计记录清理
+func (a *AlgorithmAuth) Start() {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.stopCh:
+				return
+			case <-ticker.C:
+				deleted, err := data.CleanupAlgorithmAudits(time.Now().Add(-a.retention))
+				if err != nil {
+					a.log.Error("failed to cleanup algorithm audits", slog.String("err", err.Error()))
+				} else if deleted > 0 {
+					a.log.Info("algorithm audits cleaned up", slog.Int64("deleted", deleted))
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止审计记录清理，可重复调用
+func (a *AlgorithmAuth) Stop() {
+	a.stopOnce.Do(func() { close(a.stopCh) })
+	a.wg.Wait()
+}
+
+// AuthenticateAdmin 校验系统管理员账户，password 与登录接口提交的密码相同
+func (a *AlgorithmAuth) AuthenticateAdmin(username, password string) (*user.User, error) {
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("%w: admin credentials required", ErrAlgorithmUnauthorized)
+	}
+	admin, err := a.apps.GetUserByUsername(username)
+	if err != nil || admin.Type == user.UserTypeDeveloper {
+		return nil, fmt.Errorf("%w: unknown user", ErrAlgorithmUnauthorized)
+	}
+	if subtle.ConstantTimeCompare(admin.Password, []byte(password)) != 1 {
+		return nil, fmt.Errorf("%w: invalid password", ErrAlgorithmUnauthorized)
+	}
+	if admin.Role != "admin" || !admin.Enabled {
+		return nil, fmt.Errorf("%w: user %s is not an administrator", ErrAlgorithmForbidden, username)
+	}
+	return admin, nil
+}
+
+// AppExists 算法厂商应用（开发者账户）是否存在
+func (a *AlgorithmAuth) AppExists(appID string) bool {
+	app, err := a.apps.GetUserByUsername(appID)
+	return err == nil && app.Type == user.UserTypeDeveloper
+}
+
+// Authenticate 校验算法厂商应用的 app_id + secret，返回应用允许注册的任务类型（没有限制时 TaskTypes 为空）
+func (a *AlgorithmAuth) Authenticate(appID, secret string) (*model.AlgorithmAppScope, error) {
+	if appID == "" || secret == "" {
+		return nil, fmt.Errorf("%w: app credentials required", ErrAlgorithmUnauthorized)
+	}
+	app, err := a.apps.GetUserByUsername(appID)
+	if err != nil || app.Type != user.UserTypeDeveloper {
+		return nil, fmt.Errorf("%w: unknown app", ErrAlgorithmUnauthorized)
+	}
+	if user.CompareHashAndPasswordsd(app.Password, secret) != nil {
+		return nil, fmt.Errorf("%w: invalid secret", ErrAlgorithmUnauthorized)
+	}
+	if !app.Enabled {
+		return nil, fmt.Errorf("%w: app disabled", ErrAlgorithmForbidden)
+	}
+	scope, err := data.GetAlgorithmAppScope(app.Username)
+	if err != nil {
+		return nil, err
+	}
+	if scope == nil {
+		scope = &model.AlgorithmAppScope{AppID: app.Username}
+	}
+	return scope, nil
+}
+
+// AuthorizeRegister 检查应用能否注册该服务：任务类型在允许范围内，且不能覆盖其他应用注册的 service_id 或 endpoint
+func (a *AlgorithmAuth) AuthorizeRegister(scope *model.AlgorithmAppScope, svc conf.AlgorithmService, registered []conf.AlgorithmService) error {
+	if len(scope.TaskTypes) > 0 {
+		for _, taskType := range svc.TaskTypes {
+			if !slices.Contains(scope.TaskTypes, taskType) {
+				return fmt.Errorf("%w: task type %s not allowed for app %s", ErrAlgorithmForbidden, taskType, scope.AppID)
+			}
+		}
+	}
+	for _, existing := range registered {
+		if existing.AppID == scope.AppID {
+			continue
+		}
+		if existing.ServiceID == svc.ServiceID || existing.Endpoint == svc.Endpoint {
+			return fmt.Errorf("%w: service %s (%s) is registered by another app", ErrAlgorithmForbidden, existing.ServiceID, existing.Endpoint)
+		}
+	}
+	return nil
+}
+
+// SessionKey 派生服务实例的签名密钥，重新注册后旧密钥失效
+func (a *AlgorithmAuth) SessionKey(svc conf.AlgorithmService) string {
+	mac := hmac.New(sha256.New, a.signKey)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d", svc.AppID, svc.ServiceID, svc.Endpoint, svc.RegisterAt)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignAlgorithmRequest 计算算法服务请求签名：
+// HMAC-SHA256(session_key, "<METHOD>\n<path>\n<timestamp>\n<hex(sha256(body))>")
+func SignAlgorithmRequest(sessionKey, method, path, timestamp string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(sessionKey))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", strings.ToUpper(method), path, timestamp, hex.EncodeToString(bodyHash[:]))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyRequest 校验心跳/注销请求签名，services 为请求针对的服务实例（同一 service_id 可能有多个实例，任一实例的密钥匹配即可）
+func (a *AlgorithmAuth) VerifyRequest(services []conf.AlgorithmService, method, path, timestamp, signature string, body []byte) error {
+	if len(services) == 0 {
+		return fmt.Errorf("%w: service not found", ErrAlgorithmUnauthorized)
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid %s", ErrAlgorithmUnauthorized, HeaderAlgorithmTimestamp)
+	}
+	if d := time.Since(time.Unix(ts, 0)); d > a.skew || d < -a.skew {
+		return fmt.Errorf("%w: timestamp out of range", ErrAlgorithmUnauthorized)
+	}
+	for _, svc := range services {
+		expected := SignAlgorithmRequest(a.SessionKey(svc), method, path, timestamp, body)
+		if hmac.Equal([]byte(expected), []byte(signature)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: invalid signature", ErrAlgorithmUnauthorized)
+}
+
+// Audit 异步记录注册审计
+func (a *AlgorithmAuth) Audit(audit model.AlgorithmAudit) {
+	level := slog.LevelInfo
+	if !audit.Success {
+		level = slog.LevelWarn
+	}
+	a.log.Log(context.Background(), level, "algorithm registry audit",
+		slog.String("action", audit.Action),
+		slog.Bool("success", audit.Success),
+		slog.String("app_id", audit.AppID),
+		slog.String("service_id", audit.ServiceID),
+		slog.String("endpoint", audit.Endpoint),
+		slog.String("remote_addr", audit.RemoteAddr),
+		slog.String("detail", audit.Detail))
+
+	go func() {
+		if err := data.AddAlgorithmAudit(&audit); err != nil {
+			a.log.Error("failed to save algorithm audit", slog.String("err", err.Error()))
+		}
+	}()
+}
@@ -0,0 +1,168 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"errors"
+	"io"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestAuth(t *testing.T) *AlgorithmAuth {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	auth, err := NewAlgorithmAuth(conf.AlgorithmAuthConfig{Enable: true, SignKey: "cluster-key"}, data.NewAppCore(logger), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+// setupTestAccounts 创建系统管理员和开发者账户表，返回管理员ID
+func setupTestAccounts(t *testing.T) int {
+	t.Helper()
+	setupTestDB(t)
+	if err := data.MigrateDeveloperAccounts(); err != nil {
+		t.Fatal(err)
+	}
+	admin := data.User{Username: "admin", Password: "admin-hash", Role: "admin"}
+	if err := data.GetDatabase().Create(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	return admin.ID
+}
+
+func TestAlgorithmAuthAppCredentials(t *testing.T) {
+	adminID := setupTestAccounts(t)
+	auth := newTestAuth(t)
+	apps := data.NewAppCore(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// 算法厂商应用即开发者账户
+	secret, err := apps.CreateApp("vendor_a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope, err := auth.Authenticate("vendor_a", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scope.AppID != "vendor_a" || len(scope.TaskTypes) != 0 {
+		t.Fatal("app without scope should not be restricted", scope)
+	}
+	if _, err := auth.Authenticate("vendor_a", "wrong"); !errors.Is(err, ErrAlgorithmUnauthorized) {
+		t.Fatal("expect unauthorized for wrong secret, got", err)
+	}
+	if _, err := auth.Authenticate("admin", "admin-hash"); !errors.Is(err, ErrAlgorithmUnauthorized) {
+		t.Fatal("system user must not register algorithms, got", err)
+	}
+
+	if err := data.SaveAlgorithmAppScope(&model.AlgorithmAppScope{AppID: "vendor_a", TaskTypes: []string{"人数统计"}}); err != nil {
+		t.Fatal(err)
+	}
+	if scope, err := auth.Authenticate("vendor_a", secret); err != nil || len(scope.TaskTypes) != 1 {
+		t.Fatal("scope not loaded", scope, err)
+	}
+
+	app, err := apps.GetUserByUsername("vendor_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSecret, err := apps.ResetSecret(app.ID, adminID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Authenticate("vendor_a", secret); err == nil {
+		t.Fatal("old secret should be rejected after reset")
+	}
+	if _, err := auth.Authenticate("vendor_a", newSecret); err != nil {
+		t.Fatal(err)
+	}
+
+	// 管理接口使用系统管理员账户，开发者账户不能作为管理员
+	if _, err := auth.AuthenticateAdmin("admin", "admin-hash"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.AuthenticateAdmin("admin", "guess"); !errors.Is(err, ErrAlgorithmUnauthorized) {
+		t.Fatal("expect invalid admin password rejected, got", err)
+	}
+	if _, err := auth.AuthenticateAdmin("vendor_a", string(app.Password)); !errors.Is(err, ErrAlgorithmUnauthorized) {
+		t.Fatal("developer account must not be an administrator, got", err)
+	}
+	if !auth.AppExists("vendor_a") || auth.AppExists("admin") {
+		t.Fatal("AppExists should only match developer accounts")
+	}
+}
+
+func TestAlgorithmAuthAuthorizeRegister(t *testing.T) {
+	auth := newTestAuth(t)
+	app := &model.AlgorithmAppScope{AppID: "vendor_a", TaskTypes: []string{"人数统计"}}
+
+	svc := testService("http://10.0.0.5:8000/infer", 0)
+	if err := auth.AuthorizeRegister(app, svc, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	svc.TaskTypes = []string{"人数统计", "吸烟检测"}
+	if err := auth.AuthorizeRegister(app, svc, nil); !errors.Is(err, ErrAlgorithmForbidden) {
+		t.Fatal("expect task type not allowed, got", err)
+	}
+
+	// 不能覆盖其他应用注册的 endpoint，同一应用可以重新注册
+	other := testService("http://10.0.0.5:8000/infer", 0)
+	other.ServiceID = "other"
+	other.AppID = "vendor_b"
+	svc.TaskTypes = []string{"人数统计"}
+	if err := auth.AuthorizeRegister(app, svc, []conf.AlgorithmService{other}); !errors.Is(err, ErrAlgorithmForbidden) {
+		t.Fatal("expect hijack rejected, got", err)
+	}
+	other.AppID = "vendor_a"
+	if err := auth.AuthorizeRegister(app, svc, []conf.AlgorithmService{other}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAlgorithmAuthSignedRequest(t *testing.T) {
+	auth := newTestAuth(t)
+	svc := testService("http://10.0.0.5:8000/infer", 0)
+	svc.AppID = "vendor_a"
+	svc.RegisterAt = time.Now().Unix()
+
+	key := auth.SessionKey(svc)
+	path := "/api/v1/ai_analysis/heartbeat/" + svc.ServiceID
+	body := []byte(`{"total_requests":10}`)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	sig := SignAlgorithmRequest(key, "POST", path, ts, body)
+
+	services := []conf.AlgorithmService{svc}
+	if err := auth.VerifyRequest(services, "POST", path, ts, sig, body); err != nil {
+		t.Fatal(err)
+	}
+
+	// 其他节点使用相同 sign_key 可以校验
+	if err := newTestAuth(t).VerifyRequest(services, "POST", path, ts, sig, body); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := auth.VerifyRequest(services, "POST", path, ts, sig, []byte(`{"total_requests":11}`)); err == nil {
+		t.Fatal("expect tampered body rejected")
+	}
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	if err := auth.VerifyRequest(services, "POST", path, old, SignAlgorithmRequest(key, "POST", path, old, body), body); err == nil {
+		t.Fatal("expect stale timestamp rejected")
+	}
+
+	// 重新注册后旧 session_key 失效
+	svc.RegisterAt++
+	if err := auth.VerifyRequest([]conf.AlgorithmService{svc}, "POST", path, ts, sig, body); err == nil {
+		t.Fatal("expect old session key rejected after re-register")
+	}
+
+	// 可重复停止
+	auth.Start()
+	auth.Stop()
+	auth.Stop()
+}
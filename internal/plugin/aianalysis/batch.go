@@ -0,0 +1,329 @@
+package aianalysis
+
+import (
+	"bytes"
+	"context"
+	"easydarwin/internal/conf"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxBatchSizeLimit     = 64 // 单个批次最大图片数
+	defaultBatchWaitMs    = 50 // 默认凑批等待时间
+	maxBatchWaitMsLimit   = 5000
+	batchResponseBodyHint = 200 // 解析失败时日志中保留的响应体长度
+)
+
+// inferenceJob 单张图片的推理任务（推理前准备阶段的结果）
+type inferenceJob struct {
+	image           ImageInfo
+	req             conf.InferenceRequest
+	algoConfig      map[string]interface{}
+	inferStart      time.Time
+	statDuration    time.Duration
+	presignDuration time.Duration
+	probe           uint64 // 半开熔断器的探测凭证（见 AcquireAlgorithm）
+	batched         bool   // 批量推理的图片，实例的熔断和响应时间统计由批次统一记录
+}
+
+// normalizeBatchConfig 校验批量推理参数并填充默认值
+func normalizeBatchConfig(service *conf.AlgorithmService) error {
+	if service.MaxBatchSize < 0 || service.MaxBatchSize > maxBatchSizeLimit {
+		return fmt.Errorf("max_batch_size must be between 0 and %d", maxBatchSizeLimit)
+	}
+	if service.MaxBatchSize <= 1 {
+		service.MaxBatchSize = 1
+		return nil
+	}
+	if service.MaxBatchWaitMs <= 0 {
+		service.MaxBatchWaitMs = defaultBatchWaitMs
+	}
+	if service.MaxBatchWaitMs > maxBatchWaitMsLimit {
+		service.MaxBatchWaitMs = maxBatchWaitMsLimit
+	}
+	return nil
+}
+
+// batchKey 批次按实例和任务类型划分
+type batchKey struct {
+	endpoint string
+	taskType string
+}
+
+// pendingBatch 正在凑批的批次
+type pendingBatch struct {
+	algorithm conf.AlgorithmService
+	images    []ImageInfo
+	probe     uint64 // 批次中某张图片选择实例时占用的半开探测凭证
+	timer     *time.Timer
+	done      chan struct{} // 批次推理完成后关闭
+}
+
+// batchCollector 按 endpoint + task_type 凑批：达到 MaxBatchSize 立即发送，
+// 否则等待 MaxBatchWaitMs 后发送已收集的图片
+type batchCollector struct {
+	run func(algorithm conf.AlgorithmService, images []ImageInfo, probe uint64)
+
+	mu      sync.Mutex
+	pending map[batchKey]*pendingBatch
+}
+
+func newBatchCollector(run func(algorithm conf.AlgorithmService, images []ImageInfo, probe uint64)) *batchCollector {
+	return &batchCollector{
+		run:     run,
+		pending: make(map[batchKey]*pendingBatch),
+	}
+}
+
+// add 将图片加入批次，返回的channel在该批次推理完成后关闭
+func (c *batchCollector) add(image ImageInfo, algorithm conf.AlgorithmService, probe uint64) <-chan struct{} {
+	key := batchKey{endpoint: algorithm.Endpoint, taskType: image.TaskType}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.pending[key]
+	if !ok {
+		b = &pendingBatch{
+			algorithm: algorithm,
+			done:      make(chan struct{}),
+		}
+		c.pending[key] = b
+		b.timer = time.AfterFunc(time.Duration(algorithm.MaxBatchWaitMs)*time.Millisecond, func() {
+			c.flush(key, b)
+		})
+	}
+	b.images = append(b.images, image)
+	if probe != 0 {
+		b.probe = probe
+	}
+
+	if len(b.images) >= b.algorithm.MaxBatchSize {
+		b.timer.Stop()
+		delete(c.pending, key)
+		go c.execute(b)
+	}
+	return b.done
+}
+
+// flush 等待超时后发送批次（批次已因凑满被发送时忽略）
+func (c *batchCollector) flush(key batchKey, b *pendingBatch) {
+	c.mu.Lock()
+	if c.pending[key] != b {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.pending, key)
+	c.mu.Unlock()
+
+	c.execute(b)
+}
+
+func (c *batchCollector) execute(b *pendingBatch) {
+	defer close(b.done)
+	c.run(b.algorithm, b.images, b.probe)
+}
+
+// runBatch 执行一个批次：占用一个并发名额，发送一次批量推理请求
+func (s *Scheduler) runBatch(algorithm conf.AlgorithmService, images []ImageInfo, probe uint64) {
+	s.semaphore <- struct{}{}
+	atomic.AddInt32(&s.activeInferences, 1)
+	defer func() {
+		<-s.semaphore
+		atomic.AddInt32(&s.activeInferences, -1)
+	}()
+
+	s.log.Info("scheduling batch inference",
+		slog.String("task_type", images[0].TaskType),
+		slog.String("algorithm", algorithm.ServiceID),
+		slog.String("endpoint", algorithm.Endpoint),
+		slog.Int("batch_size", len(images)))
+
+	s.inferBatchAndSave(images, algorithm, probe)
+}
+
+// inferBatchAndSave 批量调用算法推理，并逐张处理结果（统计、告警、清理与单张推理一致）
+func (s *Scheduler) inferBatchAndSave(images []ImageInfo, algorithm conf.AlgorithmService, probe uint64) {
+	jobs := make([]*inferenceJob, 0, len(images))
+	for _, image := range images {
+		if job, ok := s.prepareInference(image, algorithm); ok {
+			jobs = append(jobs, job)
+		}
+	}
+	if len(jobs) == 0 {
+		return
+	}
+
+	reqs := make([]conf.InferenceRequest, len(jobs))
+	for i, job := range jobs {
+		reqs[i] = job.req
+	}
+
+	callStart := time.Now()
+	if s.monitor != nil {
+		for range jobs {
+			s.monitor.RecordRequestSent()
+		}
+	}
+
+	resps, err := s.callAlgorithmBatch(algorithm, reqs)
+	callDuration := time.Since(callStart)
+
+	if s.monitor != nil {
+		for range jobs {
+			s.monitor.RecordResponseReceived()
+		}
+	}
+
+	s.log.Info("batch inference returned",
+		slog.String("algorithm", algorithm.ServiceID),
+		slog.String("endpoint", algorithm.Endpoint),
+		slog.Int("batch_size", len(jobs)),
+		slog.Duration("batch_call_duration_ms", callDuration),
+		slog.Bool("success", err == nil))
+
+	// 一次批量调用只计一个熔断和响应时间样本，使用批次实际耗时
+	s.recordBatchResult(algorithm, resps, err, callDuration, probe)
+
+	for i, job := range jobs {
+		var resp *conf.InferenceResponse
+		if err == nil {
+			resp = resps[i]
+		}
+		job.batched = true
+		s.handleInferenceResult(job, algorithm, resp, err, callDuration)
+	}
+}
+
+// recordBatchResult 记录一次批量调用的实例统计：调用失败或批次内全部推理失败时计为一次失败，
+// 图片不存在不计入；否则按批次实际耗时计为一次成功
+func (s *Scheduler) recordBatchResult(algorithm conf.AlgorithmService, resps []*conf.InferenceResponse, err error, callDuration time.Duration, probe uint64) {
+	if err != nil {
+		if !isNotFoundError(err) {
+			s.registry.RecordInferenceFailure(algorithm.Endpoint, algorithm.ServiceID, probe)
+		}
+		return
+	}
+	for _, resp := range resps {
+		if resp.Success {
+			s.registry.RecordInferenceSuccess(algorithm.Endpoint, callDuration.Milliseconds(), probe)
+			return
+		}
+	}
+	s.registry.RecordInferenceFailure(algorithm.Endpoint, algorithm.ServiceID, probe)
+}
+
+// callAlgorithmBatch 批量调用算法服务（重试策略与单张推理一致），响应与请求按顺序一一对应
+func (s *Scheduler) callAlgorithmBatch(algorithm conf.AlgorithmService, reqs []conf.InferenceRequest) ([]*conf.InferenceResponse, error) {
+	if isGRPCProtocol(algorithm.Protocol) {
+		return retryAlgorithmCall(s, algorithm.Endpoint, func() ([]*conf.InferenceResponse, error) {
+			return s.grpcTransport.InferBatch(context.Background(), algorithm.Endpoint, reqs)
+		})
+	}
+
+	body, contentType, err := buildHTTPBatchBody(algorithm.ImageMode, reqs)
+	if err != nil {
+		return nil, err
+	}
+	return retryAlgorithmCall(s, algorithm.Endpoint, func() ([]*conf.InferenceResponse, error) {
+		return s.callAlgorithmBatchHTTP(algorithm, body, contentType, len(reqs))
+	})
+}
+
+// callAlgorithmBatchHTTP 发送一次HTTP批量推理请求
+func (s *Scheduler) callAlgorithmBatchHTTP(algorithm conf.AlgorithmService, body []byte, contentType string, count int) ([]*conf.InferenceResponse, error) {
+	endpoint := algorithm.BatchEndpoint
+	if endpoint == "" {
+		endpoint = algorithm.Endpoint
+	}
+	httpReq, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request failed: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+
+	httpResp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("connection error (service likely offline): %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response failed: %w", err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", httpResp.StatusCode, truncateBody(respBody))
+	}
+
+	var batchResp conf.BatchInferenceResponse
+	if err := json.Unmarshal(respBody, &batchResp); err != nil {
+		return nil, fmt.Errorf("decode batch response failed: %w (body: %s)", err, truncateBody(respBody))
+	}
+	if len(batchResp.Results) != count {
+		return nil, fmt.Errorf("batch response count mismatch: got %d, want %d", len(batchResp.Results), count)
+	}
+
+	resps := make([]*conf.InferenceResponse, len(batchResp.Results))
+	for i := range batchResp.Results {
+		resps[i] = &batchResp.Results[i]
+	}
+	return resps, nil
+}
+
+// buildHTTPBatchBody 构建HTTP批量推理请求体
+// multipart 模式下 request 字段为批量JSON请求（不含图片），随后按请求顺序附带多个 image 字段
+func buildHTTPBatchBody(mode string, reqs []conf.InferenceRequest) ([]byte, string, error) {
+	batch := conf.BatchInferenceRequest{Requests: make([]conf.InferenceRequest, len(reqs))}
+	copy(batch.Requests, reqs)
+	if mode == ImageModeBase64 {
+		for i := range batch.Requests {
+			batch.Requests[i].ImageBase64 = base64.StdEncoding.EncodeToString(batch.Requests[i].ImageData)
+		}
+	}
+
+	reqJSON, err := json.Marshal(batch)
+	if err != nil {
+		return nil, "", fmt.Errorf("marshal batch request failed: %w", err)
+	}
+	if mode == ImageModeMultipart {
+		return buildMultipartBody(reqJSON, reqs)
+	}
+	return reqJSON, "application/json", nil
+}
+
+// truncateBody 截断响应体用于日志和错误信息
+func truncateBody(body []byte) string {
+	if len(body) > batchResponseBodyHint {
+		return string(body[:batchResponseBodyHint]) + "..."
+	}
+	return string(body)
+}
+
+// markInferring 标记图片正在推理（用于清理时保护），返回取消标记的函数
+func (s *Scheduler) markInferring(image ImageInfo) func() {
+	// 将"即将推理"转换为"正在推理"（如果之前已标记为pending）
+	normalizedPath := filepath.ToSlash(image.Path)
+	if s.IsImagePendingInference(image.Path) {
+		s.UnmarkPendingInference(image.Path)
+	}
+
+	s.inferringMu.Lock()
+	s.inferringImages[normalizedPath] = true
+	s.inferringMu.Unlock()
+
+	return func() {
+		s.inferringMu.Lock()
+		delete(s.inferringImages, normalizedPath)
+		s.inferringMu.Unlock()
+	}
+}
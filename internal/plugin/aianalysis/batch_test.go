@@ -0,0 +1,221 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/conf"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatchCollectorFlushesFullBatch(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]ImageInfo
+	c := newBatchCollector(func(algorithm conf.AlgorithmService, images []ImageInfo, probe uint64) {
+		mu.Lock()
+		batches = append(batches, images)
+		mu.Unlock()
+	})
+
+	algorithm := conf.AlgorithmService{Endpoint: "http://a", MaxBatchSize: 4, MaxBatchWaitMs: 5000}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-c.add(ImageInfo{Path: fmt.Sprintf("%d.jpg", i), TaskType: "人数统计"}, algorithm, 0)
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("full batches should be sent without waiting for max wait")
+	}
+
+	if len(batches) != 2 || len(batches[0]) != 4 || len(batches[1]) != 4 {
+		t.Fatalf("unexpected batches: %v", batches)
+	}
+}
+
+func TestBatchCollectorFlushesAfterMaxWait(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]ImageInfo
+	c := newBatchCollector(func(algorithm conf.AlgorithmService, images []ImageInfo, probe uint64) {
+		mu.Lock()
+		batches = append(batches, images)
+		mu.Unlock()
+	})
+
+	algorithm := conf.AlgorithmService{Endpoint: "http://a", MaxBatchSize: 16, MaxBatchWaitMs: 20}
+	start := time.Now()
+	done1 := c.add(ImageInfo{Path: "1.jpg", TaskType: "人数统计"}, algorithm, 0)
+	done2 := c.add(ImageInfo{Path: "2.jpg", TaskType: "人数统计"}, algorithm, 0)
+	// 不同任务类型单独成批
+	done3 := c.add(ImageInfo{Path: "3.jpg", TaskType: "人员跌倒"}, algorithm, 0)
+	<-done1
+	<-done2
+	<-done3
+
+	if time.Since(start) < 20*time.Millisecond {
+		t.Fatal("partial batch sent before max wait")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(batches) != 2 {
+		t.Fatalf("batches = %d, want 2 (one per task type)", len(batches))
+	}
+}
+
+func TestCallAlgorithmBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/infer_batch" {
+			http.NotFound(w, r)
+			return
+		}
+		var req conf.BatchInferenceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := conf.BatchInferenceResponse{}
+		for _, item := range req.Requests {
+			resp.Results = append(resp.Results, conf.InferenceResponse{
+				Success: item.ImageBase64 != "",
+				Result:  map[string]interface{}{"image_path": item.ImagePath},
+			})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	s := &Scheduler{httpClient: server.Client(), log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	algorithm := conf.AlgorithmService{
+		Endpoint:      server.URL + "/infer",
+		BatchEndpoint: server.URL + "/infer_batch",
+		ImageMode:     ImageModeBase64,
+		MaxBatchSize:  4,
+	}
+	reqs := []conf.InferenceRequest{
+		{ImagePath: "a.jpg", ImageData: []byte("a")},
+		{ImagePath: "b.jpg", ImageData: []byte("b")},
+	}
+
+	resps, err := s.callAlgorithmBatch(algorithm, reqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, resp := range resps {
+		if !resp.Success || resp.Result.(map[string]interface{})["image_path"] != reqs[i].ImagePath {
+			t.Fatalf("result %d mismatched: %+v", i, resp)
+		}
+	}
+}
+
+func TestCallAlgorithmBatchCountMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(conf.BatchInferenceResponse{Results: []conf.InferenceResponse{{Success: true}}})
+	}))
+	defer server.Close()
+
+	s := &Scheduler{httpClient: server.Client(), log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	_, err := s.callAlgorithmBatch(conf.AlgorithmService{Endpoint: server.URL}, []conf.InferenceRequest{{}, {}})
+	if err == nil {
+		t.Fatal("expected error when result count differs from request count")
+	}
+}
+
+func TestCallAlgorithmBatchRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(conf.BatchInferenceResponse{Results: []conf.InferenceResponse{{Success: true}, {Success: true}}})
+	}))
+	defer server.Close()
+
+	s := &Scheduler{httpClient: server.Client(), log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	if _, err := s.callAlgorithmBatch(conf.AlgorithmService{Endpoint: server.URL}, []conf.InferenceRequest{{}, {}}); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("calls = %d, want 2", calls.Load())
+	}
+}
+
+func TestRecordBatchResultCountsOneSample(t *testing.T) {
+	r := newTestRegistry(t, testService("gpu", 0))
+	r.ConfigureCircuitBreaker(conf.CircuitBreakerConfig{Enable: true, MinRequests: 10})
+	s := &Scheduler{registry: r, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	algorithm := conf.AlgorithmService{Endpoint: "gpu", ServiceID: "gpu"}
+	samples := func() int {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		return len(r.breakers["gpu"].outcomes)
+	}
+
+	// 成功的批次按实际耗时计一个样本
+	ok := []*conf.InferenceResponse{{Success: true}, {Success: false}, {Success: true}}
+	s.recordBatchResult(algorithm, ok, nil, 300*time.Millisecond, 0)
+	r.mu.RLock()
+	times := r.responseTimes["gpu"]
+	r.mu.RUnlock()
+	if len(times) != 1 || times[0] != 300 || r.GetCallCount("gpu") != 1 {
+		t.Fatalf("response times = %v, call count = %d", times, r.GetCallCount("gpu"))
+	}
+
+	// 失败的批次只计一次失败，图片不存在不计入
+	s.recordBatchResult(algorithm, nil, fmt.Errorf("HTTP 500: boom"), time.Second, 0)
+	s.recordBatchResult(algorithm, []*conf.InferenceResponse{{}, {}}, nil, time.Second, 0)
+	s.recordBatchResult(algorithm, nil, fmt.Errorf("HTTP 404: Not Found"), time.Second, 0)
+	if got := samples(); got != 3 {
+		t.Fatalf("breaker samples = %d, want 3", got)
+	}
+}
+
+func TestPopBatchReturnsWhenQueueDrained(t *testing.T) {
+	q := NewInferenceQueue(10, StrategyDropOldest, 0, nil, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	q.Add([]ImageInfo{{Path: "a/1.jpg"}, {Path: "a/2.jpg"}, {Path: "a/3.jpg"}})
+
+	batch := q.PopBatch(8)
+	if len(batch) != 3 {
+		t.Fatalf("len = %d, want 3", len(batch))
+	}
+	if q.Size() != 0 {
+		t.Fatalf("size = %d, want 0", q.Size())
+	}
+	if q.PopBatch(8) != nil {
+		t.Fatal("expected nil from empty queue")
+	}
+}
+
+func TestRegisterBatchConfig(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	svc := testService("http://10.0.0.1:8000/infer", 0)
+	svc.MaxBatchSize = 100
+	if err := registry.Register(svc); err == nil {
+		t.Fatal("expected error for oversized max_batch_size")
+	}
+
+	svc.MaxBatchSize = 8
+	if err := registry.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+	if got := registry.GetAlgorithms("人数统计")[0].MaxBatchWaitMs; got != defaultBatchWaitMs {
+		t.Fatalf("max_batch_wait_ms = %d, want default %d", got, defaultBatchWaitMs)
+	}
+	if registry.MaxBatchSize() != 8 {
+		t.Fatalf("registry max batch size = %d, want 8", registry.MaxBatchSize())
+	}
+}
@@ -0,0 +1,222 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/conf"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// BreakerState 熔断器状态
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // 正常：实例参与负载均衡
+	BreakerOpen     BreakerState = "open"      // 熔断：实例被剔除，不再分配请求
+	BreakerHalfOpen BreakerState = "half_open" // 半开：每次只放行一个探测请求，连续成功后恢复
+)
+
+// BreakerStatus 熔断器状态快照
+type BreakerStatus struct {
+	State          BreakerState `json:"state"`
+	ErrorRate      float64      `json:"error_rate"`       // 窗口内错误率（0-1）
+	P95LatencyMs   int64        `json:"p95_latency_ms"`   // 窗口内成功请求的P95响应时间
+	Samples        int          `json:"samples"`          // 窗口内样本数
+	ProbeSuccesses int          `json:"probe_successes"`  // 半开状态下已连续成功的探测次数
+	Reason         string       `json:"reason,omitempty"` // 最近一次熔断原因
+	OpenedAt       *time.Time   `json:"opened_at,omitempty"`
+	ChangedAt      time.Time    `json:"changed_at"` // 最近一次状态变化时间
+}
+
+// breakerOutcome 一次调用结果
+type breakerOutcome struct {
+	failed    bool
+	latencyMs int64
+}
+
+// circuitBreaker 单个endpoint的熔断器（由注册中心加锁访问）
+type circuitBreaker struct {
+	cfg conf.CircuitBreakerConfig
+
+	state          BreakerState
+	outcomes       []breakerOutcome // 滑动窗口
+	openedAt       time.Time
+	changedAt      time.Time
+	reason         string
+	probeToken     uint64 // 半开状态下已放行的探测请求凭证，0表示尚未放行
+	lastToken      uint64
+	probeSuccesses int
+}
+
+// normalizeBreakerConfig 填充熔断配置默认值
+func normalizeBreakerConfig(cfg conf.CircuitBreakerConfig) conf.CircuitBreakerConfig {
+	if cfg.WindowSize <= 0 {
+		cfg.WindowSize = 20
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 10
+	}
+	if cfg.MinRequests > cfg.WindowSize {
+		cfg.MinRequests = cfg.WindowSize
+	}
+	if cfg.ErrorRateThreshold <= 0 || cfg.ErrorRateThreshold > 1 {
+		cfg.ErrorRateThreshold = 0.5
+	}
+	if cfg.OpenDurationSec <= 0 {
+		cfg.OpenDurationSec = 30
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 3
+	}
+	return cfg
+}
+
+func newCircuitBreaker(cfg conf.CircuitBreakerConfig, now time.Time) *circuitBreaker {
+	return &circuitBreaker{
+		cfg:       cfg,
+		state:     BreakerClosed,
+		changedAt: now,
+	}
+}
+
+// allow 判断实例当前是否可以接收请求（不占用探测名额）
+// 熔断时间到期后进入半开状态，返回状态是否发生变化
+func (b *circuitBreaker) allow(now time.Time) (allowed bool, changed bool) {
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) < time.Duration(b.cfg.OpenDurationSec)*time.Second {
+			return false, false
+		}
+		b.transition(BreakerHalfOpen, now)
+		return true, true
+	case BreakerHalfOpen:
+		return b.probeToken == 0, false
+	default:
+		return true, false
+	}
+}
+
+// acquire 实例被选中时调用，半开状态下占用探测名额并返回探测凭证，其余状态返回0
+func (b *circuitBreaker) acquire() uint64 {
+	if b.state != BreakerHalfOpen {
+		return 0
+	}
+	b.lastToken++
+	b.probeToken = b.lastToken
+	return b.probeToken
+}
+
+// release 请求结束但没有记录结果时（如图片不存在）释放探测名额，只释放凭证对应的探测
+func (b *circuitBreaker) release(token uint64) {
+	if token != 0 && token == b.probeToken {
+		b.probeToken = 0
+	}
+}
+
+// record 记录调用结果，返回状态是否发生变化
+// 半开状态下只有探测凭证对应的结果生效
+func (b *circuitBreaker) record(failed bool, latencyMs int64, token uint64, now time.Time) bool {
+	switch b.state {
+	case BreakerHalfOpen:
+		if token == 0 || token != b.probeToken {
+			// 熔断前已发出的请求或已失效的探测，结果不影响状态
+			return false
+		}
+		b.probeToken = 0
+		if failed {
+			b.reason = "half-open probe failed"
+			b.open(now)
+			return true
+		}
+		b.probeSuccesses++
+		if b.probeSuccesses >= b.cfg.HalfOpenProbes {
+			b.outcomes = b.outcomes[:0]
+			b.reason = ""
+			b.transition(BreakerClosed, now)
+			return true
+		}
+		return false
+	case BreakerOpen:
+		// 熔断前已发出的请求，结果不影响状态
+		return false
+	}
+
+	b.outcomes = append(b.outcomes, breakerOutcome{failed: failed, latencyMs: latencyMs})
+	if len(b.outcomes) > b.cfg.WindowSize {
+		b.outcomes = b.outcomes[len(b.outcomes)-b.cfg.WindowSize:]
+	}
+	if len(b.outcomes) < b.cfg.MinRequests {
+		return false
+	}
+
+	errorRate, p95 := b.windowStats()
+	if errorRate >= b.cfg.ErrorRateThreshold {
+		b.reason = fmt.Sprintf("error rate %.0f%% >= %.0f%%", errorRate*100, b.cfg.ErrorRateThreshold*100)
+		b.open(now)
+		return true
+	}
+	if b.cfg.LatencyP95Ms > 0 && p95 > b.cfg.LatencyP95Ms {
+		b.reason = fmt.Sprintf("p95 latency %dms > %dms", p95, b.cfg.LatencyP95Ms)
+		b.open(now)
+		return true
+	}
+	return false
+}
+
+// open 进入熔断状态
+func (b *circuitBreaker) open(now time.Time) {
+	b.openedAt = now
+	b.outcomes = b.outcomes[:0]
+	b.transition(BreakerOpen, now)
+}
+
+func (b *circuitBreaker) transition(state BreakerState, now time.Time) {
+	b.state = state
+	b.changedAt = now
+	b.probeToken = 0
+	b.probeSuccesses = 0
+}
+
+// windowStats 计算窗口内错误率和成功请求的P95响应时间
+func (b *circuitBreaker) windowStats() (float64, int64) {
+	if len(b.outcomes) == 0 {
+		return 0, 0
+	}
+
+	failures := 0
+	latencies := make([]int64, 0, len(b.outcomes))
+	for _, o := range b.outcomes {
+		if o.failed {
+			failures++
+		} else {
+			latencies = append(latencies, o.latencyMs)
+		}
+	}
+
+	var p95 int64
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		idx := (len(latencies)*95+99)/100 - 1
+		p95 = latencies[idx]
+	}
+	return float64(failures) / float64(len(b.outcomes)), p95
+}
+
+// status 获取状态快照
+func (b *circuitBreaker) status() BreakerStatus {
+	errorRate, p95 := b.windowStats()
+	status := BreakerStatus{
+		State:          b.state,
+		ErrorRate:      errorRate,
+		P95LatencyMs:   p95,
+		Samples:        len(b.outcomes),
+		ProbeSuccesses: b.probeSuccesses,
+		Reason:         b.reason,
+		ChangedAt:      b.changedAt,
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
@@ -0,0 +1,166 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/conf"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerStateMachine(t *testing.T) {
+	cfg := normalizeBreakerConfig(conf.CircuitBreakerConfig{Enable: true, WindowSize: 10, MinRequests: 4, HalfOpenProbes: 2, OpenDurationSec: 30})
+	now := time.Now()
+	b := newCircuitBreaker(cfg, now)
+
+	// 错误率未达到阈值前保持关闭
+	b.record(false, 10, 0, now)
+	b.record(true, 0, 0, now)
+	if b.record(false, 10, 0, now) || b.state != BreakerClosed {
+		t.Fatal("breaker should stay closed")
+	}
+	b.record(true, 0, 0, now)
+	if b.state != BreakerOpen {
+		t.Fatal("expect open at 50% error rate, got", b.state)
+	}
+
+	// 熔断期间拒绝请求，到期后进入半开并只放行一个探测请求
+	if allowed, _ := b.allow(now.Add(10 * time.Second)); allowed {
+		t.Fatal("open breaker should reject requests")
+	}
+	later := now.Add(31 * time.Second)
+	if allowed, changed := b.allow(later); !allowed || !changed || b.state != BreakerHalfOpen {
+		t.Fatal("expect half-open after open duration", b.state)
+	}
+	probe := b.acquire()
+	if allowed, _ := b.allow(later); allowed {
+		t.Fatal("only one probe allowed at a time")
+	}
+
+	// 探测失败重新熔断
+	if !b.record(true, 0, probe, later) || b.state != BreakerOpen {
+		t.Fatal("failed probe should reopen breaker", b.state)
+	}
+
+	// 连续探测成功后恢复
+	later = later.Add(31 * time.Second)
+	b.allow(later)
+	b.record(false, 10, b.acquire(), later)
+	if b.state != BreakerHalfOpen {
+		t.Fatal("need more probes before closing", b.state)
+	}
+	if !b.record(false, 10, b.acquire(), later) || b.state != BreakerClosed {
+		t.Fatal("expect closed after successful probes", b.state)
+	}
+}
+
+func TestCircuitBreakerIgnoresStaleResults(t *testing.T) {
+	cfg := normalizeBreakerConfig(conf.CircuitBreakerConfig{Enable: true, WindowSize: 4, MinRequests: 2, HalfOpenProbes: 1, OpenDurationSec: 30})
+	now := time.Now()
+	b := newCircuitBreaker(cfg, now)
+	b.record(true, 0, 0, now)
+	b.record(true, 0, 0, now)
+
+	later := now.Add(31 * time.Second)
+	b.allow(later)
+	probe := b.acquire()
+
+	// 熔断前发出的请求结束时不能释放探测名额，结果也不计入
+	b.release(0)
+	if b.record(true, 0, 0, later) || b.state != BreakerHalfOpen {
+		t.Fatal("stale result should not affect half-open breaker", b.state)
+	}
+	if allowed, _ := b.allow(later); allowed {
+		t.Fatal("probe slot released by a non-probe request")
+	}
+
+	// 探测请求未记录结果就结束时释放名额，过期凭证不能再释放新的探测
+	b.release(probe)
+	if allowed, _ := b.allow(later); !allowed {
+		t.Fatal("probe slot should be released by its own token")
+	}
+	next := b.acquire()
+	b.release(probe)
+	if allowed, _ := b.allow(later); allowed {
+		t.Fatal("expired token released the new probe")
+	}
+	if !b.record(false, 10, next, later) || b.state != BreakerClosed {
+		t.Fatal("expect closed after probe success", b.state)
+	}
+}
+
+func TestCircuitBreakerLatency(t *testing.T) {
+	cfg := normalizeBreakerConfig(conf.CircuitBreakerConfig{Enable: true, WindowSize: 20, MinRequests: 20, LatencyP95Ms: 500})
+	now := time.Now()
+	b := newCircuitBreaker(cfg, now)
+
+	for i := 0; i < 18; i++ {
+		b.record(false, 100, 0, now)
+	}
+	b.record(false, 2000, 0, now)
+	if b.state != BreakerClosed {
+		t.Fatal("breaker should stay closed before min requests")
+	}
+	// 20个样本中2个慢请求，P95为第19个值
+	b.record(false, 2000, 0, now)
+	if b.state != BreakerOpen {
+		t.Fatal("expect open when p95 latency exceeds threshold", b.status())
+	}
+}
+
+func TestRegistryEjectsOpenEndpoint(t *testing.T) {
+	r := newTestRegistry(t, testService("good", 0), testService("bad", 0))
+	r.ConfigureCircuitBreaker(conf.CircuitBreakerConfig{Enable: true, MinRequests: 5})
+
+	changes := make(chan BreakerStatus, 4)
+	r.SetOnBreakerStateChange(func(endpoint string, status BreakerStatus) {
+		if endpoint == "bad" {
+			changes <- status
+		}
+	})
+
+	for i := 0; i < 5; i++ {
+		r.RecordInferenceFailure("bad", "bad", 0)
+		r.RecordInferenceSuccess("good", 20, 0)
+	}
+
+	select {
+	case status := <-changes:
+		if status.State != BreakerOpen {
+			t.Fatal("expect open notification", status.State)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("breaker change not notified")
+	}
+
+	for i := 0; i < 20; i++ {
+		if got := r.GetAlgorithmWithLoadBalance("人数统计", ""); got == nil || got.Endpoint != "good" {
+			t.Fatal("open endpoint should be ejected", got)
+		}
+	}
+
+	stats := r.GetServiceStats("人数统计")
+	for _, stat := range stats {
+		if stat.Endpoint == "bad" && (stat.Breaker == nil || stat.Breaker.State != BreakerOpen) {
+			t.Fatal("breaker state not exposed", stat.Breaker)
+		}
+	}
+	info := r.GetLoadBalanceInfo("人数统计")
+	for _, svc := range info.Services {
+		if svc.Endpoint == "bad" && (svc.BreakerState != string(BreakerOpen) || svc.AllocationRatio != 0) {
+			t.Fatal("ejected endpoint should not be allocated", svc)
+		}
+	}
+
+	r.Unregister("good")
+	if got := r.GetAlgorithmWithLoadBalance("人数统计", ""); got != nil {
+		t.Fatal("expect no service when all endpoints are ejected", got.Endpoint)
+	}
+
+	// 注销后删除熔断器，重新注册的实例从关闭状态开始
+	r.Unregister("bad")
+	r.mu.RLock()
+	_, ok := r.breakers["bad"]
+	r.mu.RUnlock()
+	if ok {
+		t.Fatal("breaker of unregistered endpoint should be removed")
+	}
+}
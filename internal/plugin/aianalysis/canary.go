@@ -0,0 +1,537 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+	"math/rand"
+	"slices"
+	"sort"
+	"time"
+)
+
+// 灰度发布状态
+const (
+	CanaryStateCanary     = "canary"      // 按比例/任务ID分流到灰度版本
+	CanaryStatePromoted   = "promoted"    // 已全量：只使用灰度版本
+	CanaryStateRolledBack = "rolled_back" // 已回滚：不再使用灰度版本
+
+	CanarySplitTask  = "task"  // 按任务ID哈希分流，同一任务固定使用一个版本
+	CanarySplitImage = "image" // 按图片随机分流
+
+	// VersionLatencyWindow 版本统计的响应时间滑动窗口大小
+	VersionLatencyWindow = 100
+)
+
+// ErrCanaryNotFound 任务类型未配置灰度发布
+var ErrCanaryNotFound = errors.New("canary not found")
+
+// ErrCanaryStore 灰度规则写入持久化存储失败
+var ErrCanaryStore = errors.New("canary store failed")
+
+// canaryStore 灰度规则持久化存储：运行时调整的规则和全量/回滚状态在重启后保留，多节点部署时各节点同步时重新加载
+type canaryStore interface {
+	LoadCanaries() (map[string]*CanaryStatus, error)
+	SaveCanary(status CanaryStatus) error
+	DeleteCanary(taskType string) error
+}
+
+// dbCanaryStore 使用数据库保存灰度规则
+type dbCanaryStore struct{}
+
+func (dbCanaryStore) LoadCanaries() (map[string]*CanaryStatus, error) {
+	rows, err := data.ListAlgorithmCanaries()
+	if err != nil {
+		return nil, err
+	}
+	canaries := make(map[string]*CanaryStatus, len(rows))
+	for _, row := range rows {
+		canaries[row.TaskType] = &CanaryStatus{
+			TaskType:  row.TaskType,
+			Version:   row.Version,
+			Percent:   row.Percent,
+			TaskIDs:   row.TaskIDs,
+			Split:     row.Split,
+			State:     row.State,
+			UpdatedAt: row.UpdatedAt,
+		}
+	}
+	return canaries, nil
+}
+
+func (dbCanaryStore) SaveCanary(status CanaryStatus) error {
+	return data.SaveAlgorithmCanary(&model.AlgorithmCanary{
+		TaskType:  status.TaskType,
+		Version:   status.Version,
+		Percent:   status.Percent,
+		TaskIDs:   status.TaskIDs,
+		Split:     status.Split,
+		State:     status.State,
+		UpdatedAt: status.UpdatedAt,
+	})
+}
+
+func (dbCanaryStore) DeleteCanary(taskType string) error {
+	return data.DeleteAlgorithmCanary(taskType)
+}
+
+// CanaryStatus 任务类型的灰度发布状态
+type CanaryStatus struct {
+	TaskType  string   `json:"task_type"`
+	Version   string   `json:"version"` // 灰度版本
+	Percent   float64  `json:"percent"`
+	TaskIDs   []string `json:"task_ids,omitempty"`
+	Split     string   `json:"split"`
+	State     string   `json:"state"`
+	UpdatedAt int64    `json:"updated_at"`
+}
+
+// useCanary 判断任务的本次推理是否路由到灰度版本
+func (c *CanaryStatus) useCanary(taskID string) bool {
+	switch c.State {
+	case CanaryStatePromoted:
+		return true
+	case CanaryStateRolledBack:
+		return false
+	}
+	if taskID != "" && slices.Contains(c.TaskIDs, taskID) {
+		return true
+	}
+	if c.Percent <= 0 {
+		return false
+	}
+	if c.Percent >= 100 {
+		return true
+	}
+	if c.Split == CanarySplitImage {
+		return rand.Float64()*100 < c.Percent
+	}
+	return float64(crc32.ChecksumIEEE([]byte(taskID))%10000) < c.Percent*100
+}
+
+// versionStats 算法版本的推理统计
+type versionStats struct {
+	requests   int64
+	failures   int64
+	detections int64   // 产生检测结果的成功推理次数
+	latencies  []int64 // 最近N次成功推理的响应时间（毫秒）
+	since      time.Time
+}
+
+// VersionStat 任务类型下某个算法版本的统计，用于对比灰度版本与稳定版本
+type VersionStat struct {
+	TaskType      string  `json:"task_type"`
+	Version       string  `json:"version"`
+	Canary        bool    `json:"canary"`    // 是否为灰度版本
+	Instances     int     `json:"instances"` // 当前注册的实例数
+	Requests      int64   `json:"requests"`
+	Failures      int64   `json:"failures"`
+	FailureRate   float64 `json:"failure_rate"`
+	DetectionRate float64 `json:"detection_rate"` // 成功推理中产生检测结果的比例
+	AvgLatencyMs  int64   `json:"avg_latency_ms"` // 最近N次成功推理的平均响应时间
+	P95LatencyMs  int64   `json:"p95_latency_ms"`
+	Since         int64   `json:"since,omitempty"` // 开始统计的时间（本节点启动后首次推理）
+
+	// 人工复核结果（按版本汇总所有算法服务，来自 alert_feedback 表，不随节点重启清零）
+	FeedbackCorrect   int64   `json:"feedback_correct"`
+	FeedbackIncorrect int64   `json:"feedback_incorrect"`
+	Precision         float64 `json:"precision"` // 复核为正确的比例
+}
+
+// normalizeCanaryRule 校验灰度规则
+func normalizeCanaryRule(rule conf.CanaryRule) (conf.CanaryRule, error) {
+	if rule.Version == "" {
+		return rule, fmt.Errorf("canary version is required")
+	}
+	if rule.Percent < 0 || rule.Percent > 100 {
+		return rule, fmt.Errorf("canary percent must be between 0 and 100")
+	}
+	switch rule.Split {
+	case "":
+		rule.Split = CanarySplitTask
+	case CanarySplitTask, CanarySplitImage:
+	default:
+		return rule, fmt.Errorf("unknown canary split: %s", rule.Split)
+	}
+	return rule, nil
+}
+
+// ConfigureCanary 按配置设置各任务类型的灰度规则，无效的配置项被忽略并返回错误
+func (r *AlgorithmRegistry) ConfigureCanary(cfg conf.CanaryConfig) error {
+	var errs []error
+	for taskType, rule := range cfg.TaskTypes {
+		if _, err := r.SetCanary(taskType, rule); err != nil {
+			errs = append(errs, fmt.Errorf("task type %s: %w", taskType, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetCanaryStore 设置灰度规则的持久化存储并加载其中的规则：存储中已有的规则（运行时调整的比例、全量/回滚状态）优先，
+// 配置文件中有而存储中没有的规则写入存储
+func (r *AlgorithmRegistry) SetCanaryStore(store canaryStore) error {
+	r.canaryMu.Lock()
+	defer r.canaryMu.Unlock()
+
+	loaded, err := store.LoadCanaries()
+	if err != nil {
+		return err
+	}
+	for _, status := range r.GetCanaries() {
+		if _, ok := conf.LookupTaskType(loaded, status.TaskType); ok {
+			continue
+		}
+		if err := store.SaveCanary(status); err != nil {
+			return err
+		}
+		loaded[status.TaskType] = &status
+	}
+
+	r.mu.Lock()
+	r.canaryStore = store
+	r.canaries = loaded
+	r.mu.Unlock()
+	return nil
+}
+
+// reloadCanaries 从持久化存储重新加载灰度规则（集群同步时调用，获取其他节点通过API做的调整）
+func (r *AlgorithmRegistry) reloadCanaries() {
+	r.canaryMu.Lock()
+	defer r.canaryMu.Unlock()
+	if r.canaryStore == nil {
+		return
+	}
+
+	loaded, err := r.canaryStore.LoadCanaries()
+	if err != nil {
+		r.log.Warn("failed to reload canaries", slog.String("err", err.Error()))
+		return
+	}
+	r.mu.Lock()
+	r.canaries = loaded
+	r.mu.Unlock()
+}
+
+// SetCanary 设置任务类型的灰度规则（覆盖已有规则，状态重置为灰度中）
+func (r *AlgorithmRegistry) SetCanary(taskType string, rule conf.CanaryRule) (CanaryStatus, error) {
+	if taskType == "" {
+		return CanaryStatus{}, fmt.Errorf("task_type is required")
+	}
+	rule, err := normalizeCanaryRule(rule)
+	if err != nil {
+		return CanaryStatus{}, err
+	}
+
+	status := &CanaryStatus{
+		TaskType:  taskType,
+		Version:   rule.Version,
+		Percent:   rule.Percent,
+		TaskIDs:   slices.Clone(rule.TaskIDs),
+		Split:     rule.Split,
+		State:     CanaryStateCanary,
+		UpdatedAt: time.Now().Unix(),
+	}
+
+	r.canaryMu.Lock()
+	defer r.canaryMu.Unlock()
+
+	// 忽略大小写覆盖已有规则，避免同一任务类型出现两条规则
+	existing, replaced := r.GetCanary(taskType)
+	if r.canaryStore != nil {
+		if replaced && existing.TaskType != taskType {
+			if err := r.canaryStore.DeleteCanary(existing.TaskType); err != nil {
+				return CanaryStatus{}, fmt.Errorf("%w: %v", ErrCanaryStore, err)
+			}
+		}
+		if err := r.canaryStore.SaveCanary(*status); err != nil {
+			return CanaryStatus{}, fmt.Errorf("%w: %v", ErrCanaryStore, err)
+		}
+	}
+
+	r.mu.Lock()
+	if replaced {
+		delete(r.canaries, existing.TaskType)
+	}
+	r.canaries[taskType] = status
+	r.mu.Unlock()
+
+	r.log.Info("canary configured",
+		slog.String("task_type", taskType),
+		slog.String("version", rule.Version),
+		slog.Float64("percent", rule.Percent),
+		slog.Any("task_ids", rule.TaskIDs),
+		slog.String("split", rule.Split))
+	return *status, nil
+}
+
+// PromoteCanary 全量发布灰度版本：任务类型的所有流量路由到灰度版本，旧版本实例可随后注销
+func (r *AlgorithmRegistry) PromoteCanary(taskType string) (CanaryStatus, error) {
+	return r.setCanaryState(taskType, CanaryStatePromoted)
+}
+
+// RollbackCanary 回滚灰度版本：任务类型的所有流量路由到其他版本，灰度版本实例无需注销
+func (r *AlgorithmRegistry) RollbackCanary(taskType string) (CanaryStatus, error) {
+	return r.setCanaryState(taskType, CanaryStateRolledBack)
+}
+
+func (r *AlgorithmRegistry) setCanaryState(taskType, state string) (CanaryStatus, error) {
+	r.canaryMu.Lock()
+	defer r.canaryMu.Unlock()
+
+	status, ok := r.GetCanary(taskType)
+	if !ok {
+		return CanaryStatus{}, ErrCanaryNotFound
+	}
+	status.State = state
+	status.UpdatedAt = time.Now().Unix()
+	if r.canaryStore != nil {
+		if err := r.canaryStore.SaveCanary(status); err != nil {
+			return CanaryStatus{}, fmt.Errorf("%w: %v", ErrCanaryStore, err)
+		}
+	}
+
+	r.mu.Lock()
+	r.canaries[status.TaskType] = &status
+	r.mu.Unlock()
+
+	r.log.Warn("canary state changed",
+		slog.String("task_type", status.TaskType),
+		slog.String("version", status.Version),
+		slog.String("state", state))
+	return status, nil
+}
+
+// RemoveCanary 删除任务类型的灰度规则，所有版本的实例重新按负载均衡策略共同分担流量
+func (r *AlgorithmRegistry) RemoveCanary(taskType string) error {
+	r.canaryMu.Lock()
+	defer r.canaryMu.Unlock()
+
+	status, ok := r.GetCanary(taskType)
+	if !ok {
+		return ErrCanaryNotFound
+	}
+	if r.canaryStore != nil {
+		if err := r.canaryStore.DeleteCanary(status.TaskType); err != nil {
+			return fmt.Errorf("%w: %v", ErrCanaryStore, err)
+		}
+	}
+
+	r.mu.Lock()
+	delete(r.canaries, status.TaskType)
+	r.mu.Unlock()
+	r.log.Info("canary removed", slog.String("task_type", status.TaskType))
+	return nil
+}
+
+// GetCanaries 获取所有任务类型的灰度发布状态（按任务类型排序）
+func (r *AlgorithmRegistry) GetCanaries() []CanaryStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]CanaryStatus, 0, len(r.canaries))
+	for _, status := range r.canaries {
+		list = append(list, *status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].TaskType < list[j].TaskType })
+	return list
+}
+
+// GetCanary 获取任务类型的灰度发布状态
+func (r *AlgorithmRegistry) GetCanary(taskType string) (CanaryStatus, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	status, ok := conf.LookupTaskType(r.canaries, taskType)
+	if !ok {
+		return CanaryStatus{}, false
+	}
+	return *status, true
+}
+
+// canaryFilterLocked 按灰度规则选出本次推理使用的版本分组（需要已加锁）
+// 目标分组没有可用实例时退回另一分组，避免图片因没有算法服务被丢弃
+func (r *AlgorithmRegistry) canaryFilterLocked(taskType, taskID string, services []conf.AlgorithmService) []conf.AlgorithmService {
+	status, ok := conf.LookupTaskType(r.canaries, taskType)
+	if !ok {
+		return services
+	}
+
+	var canary, stable []conf.AlgorithmService
+	for _, svc := range services {
+		if svc.Version == status.Version {
+			canary = append(canary, svc)
+		} else {
+			stable = append(stable, svc)
+		}
+	}
+
+	preferred, fallback := stable, canary
+	if status.useCanary(taskID) {
+		preferred, fallback = canary, stable
+	}
+	if len(preferred) > 0 {
+		return preferred
+	}
+
+	if len(fallback) > 0 {
+		r.log.Debug("canary: preferred version group unavailable, falling back",
+			slog.String("task_type", taskType),
+			slog.String("task_id", taskID),
+			slog.String("canary_version", status.Version),
+			slog.String("state", status.State))
+	}
+	return fallback
+}
+
+// versionStatsLocked 获取任务类型下某个版本的统计（需要已加锁）
+func (r *AlgorithmRegistry) versionStatsLocked(taskType, version string) *versionStats {
+	byVersion, ok := r.versionStats[taskType]
+	if !ok {
+		byVersion = make(map[string]*versionStats)
+		r.versionStats[taskType] = byVersion
+	}
+	st, ok := byVersion[version]
+	if !ok {
+		st = &versionStats{since: time.Now()}
+		byVersion[version] = st
+	}
+	return st
+}
+
+// RecordVersionSuccess 记录算法版本的一次成功推理及是否产生检测结果
+func (r *AlgorithmRegistry) RecordVersionSuccess(taskType, version string, responseTimeMs int64, detected bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st := r.versionStatsLocked(taskType, version)
+	st.requests++
+	if detected {
+		st.detections++
+	}
+	st.latencies = append(st.latencies, responseTimeMs)
+	if len(st.latencies) > VersionLatencyWindow {
+		st.latencies = st.latencies[len(st.latencies)-VersionLatencyWindow:]
+	}
+}
+
+// RecordVersionFailure 记录算法版本的一次失败推理
+func (r *AlgorithmRegistry) RecordVersionFailure(taskType, version string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st := r.versionStatsLocked(taskType, version)
+	st.requests++
+	st.failures++
+}
+
+// ResetVersionStats 清空任务类型的版本统计（开始新一轮灰度前使用）
+func (r *AlgorithmRegistry) ResetVersionStats(taskType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.versionStats, taskType)
+}
+
+// GetVersionStats 获取任务类型下各版本的推理统计（包括已注册但还没有推理的版本，按版本排序）
+func (r *AlgorithmRegistry) GetVersionStats(taskType string) []VersionStat {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	canaryVersion := ""
+	if status, ok := conf.LookupTaskType(r.canaries, taskType); ok {
+		canaryVersion = status.Version
+	}
+
+	byVersion := make(map[string]*VersionStat)
+	get := func(version string) *VersionStat {
+		stat, ok := byVersion[version]
+		if !ok {
+			stat = &VersionStat{TaskType: taskType, Version: version, Canary: version == canaryVersion}
+			byVersion[version] = stat
+		}
+		return stat
+	}
+
+	for _, svc := range primaryServices(r.services[taskType]) {
+		get(svc.Version).Instances++
+	}
+	for version, st := range r.versionStats[taskType] {
+		stat := get(version)
+		stat.Requests = st.requests
+		stat.Failures = st.failures
+		stat.Since = st.since.Unix()
+		if st.requests > 0 {
+			stat.FailureRate = float64(st.failures) / float64(st.requests)
+		}
+		if succeeded := st.requests - st.failures; succeeded > 0 {
+			stat.DetectionRate = float64(st.detections) / float64(succeeded)
+		}
+		stat.AvgLatencyMs, stat.P95LatencyMs = latencyStats(st.latencies)
+	}
+
+	stats := make([]VersionStat, 0, len(byVersion))
+	for _, stat := range byVersion {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Version < stats[j].Version })
+	return stats
+}
+
+// latencyStats 计算平均和P95响应时间
+func latencyStats(latencies []int64) (avg, p95 int64) {
+	if len(latencies) == 0 {
+		return 0, 0
+	}
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+
+	var sum int64
+	for _, l := range sorted {
+		sum += l
+	}
+	return sum / int64(len(sorted)), sorted[(len(sorted)*95+99)/100-1]
+}
+
+// mergeFeedbackStats 将复核结果按版本汇总到版本统计中，只有复核记录的版本（如已注销的旧版本）也会加入
+func mergeFeedbackStats(taskType string, stats []VersionStat, feedback []data.FeedbackStats) []VersionStat {
+	index := make(map[string]int, len(stats))
+	for i, stat := range stats {
+		index[stat.Version] = i
+	}
+	for _, fb := range feedback {
+		if fb.TaskType != taskType {
+			continue
+		}
+		i, ok := index[fb.AlgorithmVersion]
+		if !ok {
+			stats = append(stats, VersionStat{TaskType: taskType, Version: fb.AlgorithmVersion})
+			i = len(stats) - 1
+			index[fb.AlgorithmVersion] = i
+		}
+		stats[i].FeedbackCorrect += fb.Correct
+		stats[i].FeedbackIncorrect += fb.Incorrect
+	}
+	for i := range stats {
+		if total := stats[i].FeedbackCorrect + stats[i].FeedbackIncorrect; total > 0 {
+			stats[i].Precision = float64(stats[i].FeedbackCorrect) / float64(total)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Version < stats[j].Version })
+	return stats
+}
+
+// GetVersionStats 获取任务类型下各算法版本的推理统计及人工复核准确率
+func (s *Service) GetVersionStats(taskType string) ([]VersionStat, error) {
+	if s.registry == nil {
+		return nil, fmt.Errorf("registry not ready")
+	}
+	stats := s.registry.GetVersionStats(taskType)
+	feedback, err := data.GetFeedbackStats(taskType)
+	if err != nil {
+		return stats, err
+	}
+	return mergeFeedbackStats(taskType, stats, feedback), nil
+}
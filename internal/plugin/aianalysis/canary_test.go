@@ -0,0 +1,199 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func versionedService(endpoint, version string) conf.AlgorithmService {
+	svc := testService(endpoint, 0)
+	svc.Version = version
+	return svc
+}
+
+func TestCanaryRouting(t *testing.T) {
+	r := newTestRegistry(t, versionedService("v1-a", "1.0"), versionedService("v1-b", "1.0"), versionedService("v2", "2.0"))
+
+	if _, err := r.SetCanary("人数统计", conf.CanaryRule{Version: "2.0", Percent: 20, TaskIDs: []string{"cam_pinned"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 指定任务固定使用灰度版本
+	for i := 0; i < 10; i++ {
+		if got := r.GetAlgorithmWithLoadBalance("人数统计", "cam_pinned"); got.Version != "2.0" {
+			t.Fatal("pinned task should use canary version, got", got.Endpoint)
+		}
+	}
+
+	// 按任务哈希分流：同一任务始终使用同一版本，整体比例接近 percent
+	canaryTasks := 0
+	for i := 0; i < 1000; i++ {
+		taskID := fmt.Sprintf("cam%d", i)
+		first := r.GetAlgorithmWithLoadBalance("人数统计", taskID).Version
+		if again := r.GetAlgorithmWithLoadBalance("人数统计", taskID).Version; again != first {
+			t.Fatal("task split should be sticky", taskID)
+		}
+		if first == "2.0" {
+			canaryTasks++
+		}
+	}
+	if canaryTasks < 120 || canaryTasks > 280 {
+		t.Fatal("unexpected canary share", canaryTasks)
+	}
+
+	// 全量：所有任务使用灰度版本
+	if _, err := r.PromoteCanary("人数统计"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if got := r.GetAlgorithmWithLoadBalance("人数统计", fmt.Sprintf("cam%d", i)); got.Version != "2.0" {
+			t.Fatal("promoted canary should receive all traffic")
+		}
+	}
+
+	// 回滚：包括指定任务在内都不再使用灰度版本
+	if _, err := r.RollbackCanary("人数统计"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if got := r.GetAlgorithmWithLoadBalance("人数统计", "cam_pinned"); got.Version == "2.0" {
+			t.Fatal("rolled back canary should receive no traffic")
+		}
+	}
+
+	// 目标版本没有实例时退回其他版本
+	r.Unregister("v1-a")
+	r.Unregister("v1-b")
+	if got := r.GetAlgorithmWithLoadBalance("人数统计", "cam1"); got == nil || got.Version != "2.0" {
+		t.Fatal("should fall back to canary version when stable is unavailable")
+	}
+
+	if err := r.RemoveCanary("人数统计"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RemoveCanary("人数统计"); !errors.Is(err, ErrCanaryNotFound) {
+		t.Fatal("expect canary not found, got", err)
+	}
+	if _, err := r.PromoteCanary("人数统计"); !errors.Is(err, ErrCanaryNotFound) {
+		t.Fatal("expect canary not found, got", err)
+	}
+}
+
+func TestCanaryPersistence(t *testing.T) {
+	setupTestDB(t)
+	v1, v2 := versionedService("v1", "1.0"), versionedService("v2", "2.0")
+	v1.TaskTypes = []string{"PersonCount"}
+	v2.TaskTypes = []string{"PersonCount"}
+	r := newTestRegistry(t, v1, v2)
+	if err := r.ConfigureCanary(conf.CanaryConfig{TaskTypes: map[string]conf.CanaryRule{
+		"personcount": {Version: "2.0", Percent: 10},
+		"FallDetect":  {Version: "3.0", Percent: 10},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetCanaryStore(dbCanaryStore{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 任务类型忽略大小写匹配
+	if _, err := r.PromoteCanary("PERSONCOUNT"); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.GetAlgorithmWithLoadBalance("PersonCount", "cam1"); got == nil || got.Version != "2.0" {
+		t.Fatal("promoted canary should match task type ignoring case")
+	}
+	if err := r.RemoveCanary("falldetect"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启后以数据库中的状态为准，配置文件中的规则不覆盖已保存的状态，已删除的规则不恢复
+	restarted := newTestRegistry(t)
+	if err := restarted.ConfigureCanary(conf.CanaryConfig{TaskTypes: map[string]conf.CanaryRule{
+		"PersonCount": {Version: "2.0", Percent: 10},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.SetCanaryStore(dbCanaryStore{}); err != nil {
+		t.Fatal(err)
+	}
+	canaries := restarted.GetCanaries()
+	if len(canaries) != 1 || canaries[0].TaskType != "personcount" || canaries[0].State != CanaryStatePromoted {
+		t.Fatalf("canaries after restart = %+v", canaries)
+	}
+
+	// 其他节点的调整在同步时重新加载
+	if _, err := restarted.RollbackCanary("PersonCount"); err != nil {
+		t.Fatal(err)
+	}
+	r.reloadCanaries()
+	if status, ok := r.GetCanary("PersonCount"); !ok || status.State != CanaryStateRolledBack {
+		t.Fatalf("canary after reload = %+v", status)
+	}
+}
+
+func TestCanaryRuleValidation(t *testing.T) {
+	r := newTestRegistry(t)
+	for _, rule := range []conf.CanaryRule{
+		{Percent: 10},
+		{Version: "2.0", Percent: 101},
+		{Version: "2.0", Split: "camera"},
+	} {
+		if _, err := r.SetCanary("人数统计", rule); err == nil {
+			t.Fatal("expect invalid rule rejected", rule)
+		}
+	}
+	status, err := r.SetCanary("人数统计", conf.CanaryRule{Version: "2.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Split != CanarySplitTask || status.State != CanaryStateCanary {
+		t.Fatal("unexpected defaults", status)
+	}
+}
+
+func TestVersionStats(t *testing.T) {
+	r := newTestRegistry(t, versionedService("v1", "1.0"), versionedService("v2", "2.0"))
+	r.SetCanary("人数统计", conf.CanaryRule{Version: "2.0", Percent: 50})
+
+	for i := 1; i <= 20; i++ {
+		r.RecordVersionSuccess("人数统计", "1.0", int64(i*10), i%2 == 0)
+	}
+	r.RecordVersionFailure("人数统计", "2.0")
+	r.RecordVersionSuccess("人数统计", "2.0", 30, true)
+
+	stats := r.GetVersionStats("人数统计")
+	if len(stats) != 2 || stats[0].Version != "1.0" || stats[1].Version != "2.0" {
+		t.Fatal("unexpected versions", stats)
+	}
+	v1, v2 := stats[0], stats[1]
+	if v1.Canary || !v2.Canary || v1.Instances != 1 {
+		t.Fatal("unexpected canary flags", stats)
+	}
+	if v1.Requests != 20 || v1.FailureRate != 0 || v1.DetectionRate != 0.5 || v1.AvgLatencyMs != 105 || v1.P95LatencyMs != 190 {
+		t.Fatalf("unexpected stable stats %+v", v1)
+	}
+	if v2.Requests != 2 || v2.FailureRate != 0.5 || v2.DetectionRate != 1 {
+		t.Fatalf("unexpected canary stats %+v", v2)
+	}
+
+	merged := mergeFeedbackStats("人数统计", stats, []data.FeedbackStats{
+		{AlgorithmID: "a", AlgorithmVersion: "1.0", TaskType: "人数统计", Correct: 6, Incorrect: 2},
+		{AlgorithmID: "b", AlgorithmVersion: "1.0", TaskType: "人数统计", Correct: 2, Incorrect: 0},
+		{AlgorithmID: "a", AlgorithmVersion: "0.9", TaskType: "人数统计", Correct: 1, Incorrect: 1},
+		{AlgorithmID: "a", AlgorithmVersion: "2.0", TaskType: "吸烟检测", Correct: 1},
+	})
+	if len(merged) != 3 || merged[0].Version != "0.9" || merged[0].Precision != 0.5 {
+		t.Fatalf("unexpected merged stats %+v", merged)
+	}
+	if merged[1].FeedbackCorrect != 8 || merged[1].Precision != 0.8 || merged[2].FeedbackCorrect != 0 {
+		t.Fatalf("unexpected feedback precision %+v", merged)
+	}
+
+	r.ResetVersionStats("人数统计")
+	if stats := r.GetVersionStats("人数统计"); stats[0].Requests != 0 || stats[1].Requests != 0 {
+		t.Fatal("stats should be reset")
+	}
+}
@@ -0,0 +1,639 @@
+package aianalysis
+
+import (
+	"bytes"
+	"context"
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"easydarwin/internal/plugin/frameextractor"
+	"easydarwin/pkg/lalmax/hook"
+	"easydarwin/utils/pkg/objstore"
+	"easydarwin/utils/pkg/system"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/q191201771/lal/pkg/base"
+	"github.com/q191201771/lal/pkg/httpflv"
+	"github.com/q191201771/lal/pkg/remux"
+)
+
+const (
+	defaultClipPreSeconds  = 5
+	defaultClipPostSeconds = 5
+	maxClipSeconds         = 60
+	defaultClipConcurrent  = 2
+	defaultClipIdleTimeout = 5 * time.Minute
+
+	clipBufferMargin    = 3 * time.Second  // 缓存时长在片段时长之外多保留的时间
+	clipMaxBufferMsgs   = 20000            // 单路流最多缓存的消息数（长时间没有关键帧时防止无限增长）
+	clipRetryInterval   = 30 * time.Second // 任务的流不在本服务时，间隔N秒再尝试订阅
+	clipJanitorInterval = 30 * time.Second
+	clipFFmpegTimeout   = 30 * time.Second // 转封装超时（直接拉流录制时另加告警后片段时长）
+	clipPendingTimeout  = 10 * time.Minute // 片段已上传但告警一直未落库（写入失败）时放弃写入片段路径
+)
+
+// alertClipPath 告警视频片段与告警图片放在同一目录，文件名相同、扩展名为 .mp4
+func alertClipPath(imagePath string) string {
+	return strings.TrimSuffix(imagePath, path.Ext(imagePath)) + ".mp4"
+}
+
+// localStreamName 从任务的拉流地址中解析本服务的流名称（rtsp://host:port/live/<stream>）
+func localStreamName(streamURL string) string {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// tsDiff 计算RTMP时间戳差值（毫秒），处理32位回绕
+func tsDiff(a, b uint32) int64 {
+	return int64(int32(a - b))
+}
+
+// selectClip 选取时间戳在 [start, end] 内的消息，起点对齐到不晚于 start 的最后一个视频关键帧
+// 缓存不足 start 时从第一个关键帧开始；没有关键帧时返回nil
+func selectClip(msgs []base.RtmpMsg, start, end uint32) []base.RtmpMsg {
+	first := -1
+	for i, m := range msgs {
+		if !m.IsVideoKeyNalu() {
+			continue
+		}
+		if tsDiff(m.Header.TimestampAbs, start) <= 0 {
+			first = i
+			continue
+		}
+		if first == -1 {
+			first = i
+		}
+		break
+	}
+	if first == -1 {
+		return nil
+	}
+
+	var clip []base.RtmpMsg
+	for _, m := range msgs[first:] {
+		if tsDiff(m.Header.TimestampAbs, end) <= 0 {
+			clip = append(clip, m)
+		}
+	}
+	return clip
+}
+
+// clipBuffer 订阅本服务的流并缓存最近一段时间的音视频消息（实现 hook.IHookSessionSubscriber）
+// 订阅时 hook session 会先回放 GOP 缓存，因此订阅后立即就有告警前的片段
+type clipBuffer struct {
+	window int64 // 缓存时长（毫秒）
+
+	mu          sync.Mutex
+	videoHeader *base.RtmpMsg
+	audioHeader *base.RtmpMsg
+	msgs        []base.RtmpMsg // 总是从视频关键帧开始（超出 clipMaxBufferMsgs 时除外）
+	lastTs      uint32         // 最新消息的时间戳
+	lastWall    time.Time      // 最新消息的接收时间，用于把告警时间换算为流时间戳
+	stopped     bool
+}
+
+func newClipBuffer(window time.Duration) *clipBuffer {
+	return &clipBuffer{window: window.Milliseconds()}
+}
+
+// OnMsg 缓存音视频消息（在 hook session 的协程中调用）
+func (b *clipBuffer) OnMsg(msg base.RtmpMsg) {
+	if msg.Header.MsgTypeId != base.RtmpTypeIdVideo && msg.Header.MsgTypeId != base.RtmpTypeIdAudio {
+		return
+	}
+	msg = msg.Clone()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if msg.IsVideoKeySeqHeader() {
+		b.videoHeader = &msg
+		return
+	}
+	if msg.IsAacSeqHeader() {
+		b.audioHeader = &msg
+		return
+	}
+
+	ts := msg.Header.TimestampAbs
+	if b.lastWall.IsZero() || tsDiff(ts, b.lastTs) > 0 {
+		b.lastTs = ts
+	}
+	b.lastWall = time.Now()
+	b.msgs = append(b.msgs, msg)
+
+	if msg.IsVideoKeyNalu() {
+		b.trim()
+	} else if len(b.msgs) > clipMaxBufferMsgs {
+		b.msgs = slices.Clone(b.msgs[len(b.msgs)/2:])
+	}
+}
+
+// OnStop 流结束，缓存不再更新
+func (b *clipBuffer) OnStop() {
+	b.mu.Lock()
+	b.stopped = true
+	b.mu.Unlock()
+}
+
+func (b *clipBuffer) isStopped() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stopped
+}
+
+// trim 以GOP为单位丢弃超出缓存时长的消息，调用方需持有 b.mu
+func (b *clipBuffer) trim() {
+	cut := 0
+	for i, m := range b.msgs {
+		if tsDiff(b.lastTs, m.Header.TimestampAbs) < b.window {
+			break
+		}
+		if m.IsVideoKeyNalu() {
+			cut = i
+		}
+	}
+	if cut > 0 {
+		b.msgs = slices.Clone(b.msgs[cut:])
+	}
+}
+
+// snapshot 截取告警时间前 pre 到后 post 的片段（含序列头），时间戳从0开始
+func (b *clipBuffer) snapshot(alertTime time.Time, pre, post time.Duration) []base.RtmpMsg {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.lastWall.IsZero() {
+		return nil
+	}
+	// 按最新消息的接收时间把告警时间换算为流时间戳
+	lag := max(b.lastWall.Sub(alertTime).Milliseconds(), 0)
+	alertTs := b.lastTs - uint32(lag)
+	msgs := selectClip(b.msgs, alertTs-uint32(pre.Milliseconds()), alertTs+uint32(post.Milliseconds()))
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	clip := make([]base.RtmpMsg, 0, len(msgs)+2)
+	for _, header := range []*base.RtmpMsg{b.videoHeader, b.audioHeader} {
+		if header != nil {
+			h := *header
+			h.Header.TimestampAbs = 0
+			clip = append(clip, h)
+		}
+	}
+	baseTs := msgs[0].Header.TimestampAbs
+	for _, m := range msgs {
+		m.Header.TimestampAbs = uint32(max(tsDiff(m.Header.TimestampAbs, baseTs), 0))
+		clip = append(clip, m)
+	}
+	return clip
+}
+
+// clipWatch 任务的流订阅状态
+type clipWatch struct {
+	streamURL  string
+	consumerID string
+	session    *hook.HookSession // 为nil表示任务的流不在本服务（只能直接拉流录制告警后片段）
+	buffer     *clipBuffer
+	lastUsed   time.Time
+	checkedAt  time.Time
+}
+
+// clipAlert 告警视频片段与告警落库的汇合：片段上传成功且告警已落库后才写入片段路径
+type clipAlert struct {
+	path    string
+	alertID uint      // 告警落库后的ID，0表示尚未落库
+	saved   bool      // 片段已上传
+	savedAt time.Time // 片段上传时间
+}
+
+// ClipRecorder 告警视频片段录制器
+// 任务的流经过本服务转发时，作为 hook session 的消费者持续缓存最近的音视频，告警产生后再等待告警后片段，
+// 截取 [告警前 pre_seconds, 告警后 post_seconds] 写为FLV，由ffmpeg转封装为MP4上传到告警图片旁；
+// 否则用ffmpeg直接拉取任务的流地址录制告警后片段
+type ClipRecorder struct {
+	log    *slog.Logger
+	store  objstore.Store
+	ffmpeg string
+
+	pre         time.Duration
+	post        time.Duration
+	idleTimeout time.Duration
+	resolveURL  func(taskID string) string // 获取任务的拉流地址
+
+	mu      sync.Mutex
+	watches map[string]*clipWatch       // task_id -> 订阅
+	pending map[*model.Alert]*clipAlert // 录制中或等待告警落库的片段
+
+	onSaved func(alert *model.Alert) // 片段路径写入告警后回调（携带更新后的告警）
+
+	sem      chan struct{}
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewClipRecorder 创建告警视频片段录制器
+func NewClipRecorder(cfg conf.AlertClipConfig, store objstore.Store, logger *slog.Logger) *ClipRecorder {
+	pre, post := cfg.PreSeconds, cfg.PostSeconds
+	if pre <= 0 {
+		pre = defaultClipPreSeconds
+	}
+	if post <= 0 {
+		post = defaultClipPostSeconds
+	}
+	concurrent := cfg.MaxConcurrent
+	if concurrent <= 0 {
+		concurrent = defaultClipConcurrent
+	}
+	idleTimeout := time.Duration(cfg.IdleTimeoutSec) * time.Second
+	if idleTimeout <= 0 {
+		idleTimeout = defaultClipIdleTimeout
+	}
+	ffmpeg := cfg.FFmpegPath
+	if ffmpeg == "" {
+		ffmpeg = defaultFFmpegPath()
+	}
+
+	return &ClipRecorder{
+		log:         logger,
+		store:       store,
+		ffmpeg:      ffmpeg,
+		pre:         time.Duration(min(pre, maxClipSeconds)) * time.Second,
+		post:        time.Duration(min(post, maxClipSeconds)) * time.Second,
+		idleTimeout: idleTimeout,
+		resolveURL:  taskStreamURL,
+		watches:     make(map[string]*clipWatch),
+		pending:     make(map[*model.Alert]*clipAlert),
+		sem:         make(chan struct{}, concurrent),
+		stopCh:      make(chan struct{}),
+	}
+}
+
+// SetOnSaved 设置片段路径写入告警后的回调，用于向下游推送告警更新
+func (r *ClipRecorder) SetOnSaved(callback func(alert *model.Alert)) {
+	r.onSaved = callback
+}
+
+// defaultFFmpegPath 与抽帧服务使用同一个 ffmpeg
+func defaultFFmpegPath() string {
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(system.GetCWD(), "ffmpeg.exe")
+	case "darwin":
+		return "ffmpeg"
+	}
+	return filepath.Join(system.GetCWD(), "ffmpeg")
+}
+
+// taskStreamURL 从抽帧服务获取任务的拉流地址
+func taskStreamURL(taskID string) string {
+	fxService := frameextractor.GetGlobal()
+	if fxService == nil {
+		return ""
+	}
+	if task := fxService.GetTaskByID(taskID); task != nil {
+		return task.RtspURL
+	}
+	return ""
+}
+
+// Start 启动空闲订阅清理协程
+func (r *ClipRecorder) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(clipJanitorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stopCh:
+				return
+			case <-ticker.C:
+				r.releaseIdle(time.Now())
+			}
+		}
+	}()
+}
+
+// Stop 停止录制（等待正在转封装的片段完成，尚在等待告警后片段的录制直接放弃）并取消所有订阅，可重复调用
+func (r *ClipRecorder) Stop() {
+	r.stopOnce.Do(func() { close(r.stopCh) })
+	r.wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for taskID, w := range r.watches {
+		r.release(w)
+		delete(r.watches, taskID)
+	}
+}
+
+// Watch 确保任务的流已被订阅缓存，每次收到任务的推理结果时调用，
+// 保证告警产生时已有告警前的片段
+func (r *ClipRecorder) Watch(taskID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.watch(taskID, time.Now())
+}
+
+// watch 调用方需持有 r.mu
+func (r *ClipRecorder) watch(taskID string, now time.Time) *clipWatch {
+	if w, ok := r.watches[taskID]; ok {
+		w.lastUsed = now
+		if w.buffer != nil && !w.buffer.isStopped() {
+			return w
+		}
+		if w.buffer == nil && now.Sub(w.checkedAt) < clipRetryInterval {
+			return w
+		}
+		// 流已结束或之前不在本服务，重新订阅
+		r.release(w)
+		delete(r.watches, taskID)
+	}
+
+	w := &clipWatch{streamURL: r.resolveURL(taskID), lastUsed: now, checkedAt: now}
+	if name := localStreamName(w.streamURL); name != "" {
+		if ok, session := hook.GetHookSessionManagerInstance().GetHookSession(name); ok && session != nil {
+			w.session = session
+			w.consumerID = fmt.Sprintf("alert-clip-%s-%d", taskID, now.UnixNano())
+			w.buffer = newClipBuffer(r.pre + r.post + clipBufferMargin)
+			session.AddConsumer(w.consumerID, w.buffer)
+			r.log.Info("alert clip buffering started",
+				slog.String("task_id", taskID),
+				slog.String("stream", name))
+		}
+	}
+	r.watches[taskID] = w
+	return w
+}
+
+// release 取消订阅，调用方需持有 r.mu
+func (r *ClipRecorder) release(w *clipWatch) {
+	if w.session != nil {
+		w.session.RemoveConsumer(w.consumerID)
+	}
+}
+
+// releaseIdle 取消长时间没有推理结果的任务的订阅（任务已停止），并放弃长时间等不到告警落库的片段
+func (r *ClipRecorder) releaseIdle(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for taskID, w := range r.watches {
+		if now.Sub(w.lastUsed) > r.idleTimeout {
+			r.release(w)
+			delete(r.watches, taskID)
+			r.log.Debug("alert clip buffering released", slog.String("task_id", taskID))
+		}
+	}
+	for alert, c := range r.pending {
+		if c.saved && now.Sub(c.savedAt) > clipPendingTimeout {
+			delete(r.pending, alert)
+			r.log.Warn("alert clip abandoned, alert not saved",
+				slog.String("path", c.path))
+		}
+	}
+}
+
+// AlertsCreated 告警落库后调用（批量写入器回调），片段已上传的告警写入片段路径
+func (r *ClipRecorder) AlertsCreated(alerts []*model.Alert) {
+	for _, alert := range alerts {
+		r.mu.Lock()
+		c, ok := r.pending[alert]
+		if ok {
+			c.alertID = alert.ID
+			if c.saved {
+				delete(r.pending, alert)
+			}
+		}
+		r.mu.Unlock()
+		if ok && c.saved {
+			r.attach(c.alertID, c.path)
+		}
+	}
+}
+
+// Forget 告警未能进入写入队列时调用，片段上传后删除
+func (r *ClipRecorder) Forget(alert *model.Alert) {
+	r.mu.Lock()
+	delete(r.pending, alert)
+	r.mu.Unlock()
+}
+
+// finish 片段录制结束：上传成功且告警已落库时写入片段路径；告警已放弃时删除上传的片段
+func (r *ClipRecorder) finish(alert *model.Alert, clipPath string, saved bool) {
+	r.mu.Lock()
+	c, ok := r.pending[alert]
+	if ok {
+		c.saved, c.savedAt = saved, time.Now()
+		if !saved || c.alertID != 0 {
+			delete(r.pending, alert)
+		}
+	}
+	r.mu.Unlock()
+
+	switch {
+	case ok && saved && c.alertID != 0:
+		r.attach(c.alertID, clipPath)
+	case !ok && saved:
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := r.store.Delete(ctx, clipPath); err != nil {
+			r.log.Warn("failed to delete orphan alert clip",
+				slog.String("path", clipPath),
+				slog.String("err", err.Error()))
+		}
+	}
+}
+
+// attach 将片段路径写入告警并推送告警更新
+func (r *ClipRecorder) attach(alertID uint, clipPath string) {
+	alert, err := data.UpdateAlertClip(alertID, clipPath)
+	if err != nil {
+		r.log.Error("failed to save alert clip path",
+			slog.Uint64("alert_id", uint64(alertID)),
+			slog.String("path", clipPath),
+			slog.String("err", err.Error()))
+		return
+	}
+	if alert != nil && r.onSaved != nil {
+		r.onSaved(alert)
+	}
+}
+
+// Record 异步录制告警视频片段并上传到 dstPath，返回是否接受了录制任务
+// 录制名额（max_concurrent）从接受任务起占用到上传结束，名额已满或录制器已停止时直接放弃。
+// 上传成功且告警落库（AlertsCreated）后才写入告警的片段路径，调用方不应预先设置 ClipPath
+func (r *ClipRecorder) Record(taskID string, alertTime time.Time, dstPath string, alert *model.Alert) bool {
+	select {
+	case <-r.stopCh:
+		return false
+	default:
+	}
+
+	r.mu.Lock()
+	w := r.watch(taskID, time.Now())
+	buffer, streamURL := w.buffer, w.streamURL
+	r.mu.Unlock()
+
+	if buffer == nil && streamURL == "" {
+		r.log.Warn("no stream for alert clip", slog.String("task_id", taskID))
+		return false
+	}
+
+	select {
+	case r.sem <- struct{}{}:
+	default:
+		r.log.Warn("alert clip dropped, too many clips in progress",
+			slog.String("task_id", taskID),
+			slog.String("path", dstPath),
+			slog.Int("max_concurrent", cap(r.sem)))
+		return false
+	}
+
+	r.mu.Lock()
+	r.pending[alert] = &clipAlert{path: dstPath}
+	r.mu.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		saved := false
+		defer r.wg.Done()
+		defer func() { <-r.sem }()
+		defer func() { r.finish(alert, dstPath, saved) }()
+
+		if buffer != nil {
+			// 等待告警后片段进入缓存
+			timer := time.NewTimer(time.Until(alertTime.Add(r.post)))
+			defer timer.Stop()
+			select {
+			case <-r.stopCh:
+				return
+			case <-timer.C:
+			}
+		}
+
+		start := time.Now()
+		var clip []byte
+		var err error
+		if buffer != nil {
+			clip, err = r.recordFromBuffer(buffer, alertTime)
+		} else {
+			clip, err = r.recordFromURL(streamURL)
+		}
+		if err != nil {
+			r.log.Error("failed to record alert clip",
+				slog.String("task_id", taskID),
+				slog.String("path", dstPath),
+				slog.String("err", err.Error()))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := r.store.Put(ctx, dstPath, bytes.NewReader(clip), int64(len(clip)), "video/mp4"); err != nil {
+			r.log.Error("failed to upload alert clip",
+				slog.String("path", dstPath),
+				slog.String("err", err.Error()))
+			return
+		}
+
+		saved = true
+		r.log.Info("alert clip saved",
+			slog.String("task_id", taskID),
+			slog.String("path", dstPath),
+			slog.Bool("pre_roll", buffer != nil),
+			slog.Int("size", len(clip)),
+			slog.Duration("duration_ms", time.Since(start)))
+	}()
+	return true
+}
+
+// recordFromBuffer 从缓存截取告警前后的片段并转封装为MP4
+func (r *ClipRecorder) recordFromBuffer(buffer *clipBuffer, alertTime time.Time) ([]byte, error) {
+	msgs := buffer.snapshot(alertTime, r.pre, r.post)
+	if len(msgs) == 0 {
+		return nil, errors.New("no video key frame buffered around alert time")
+	}
+
+	dir, err := os.MkdirTemp("", "alert-clip-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	flvPath := filepath.Join(dir, "clip.flv")
+	if err := writeFlvFile(flvPath, msgs); err != nil {
+		return nil, err
+	}
+	return r.runFFmpeg(dir, clipFFmpegTimeout, "-i", flvPath)
+}
+
+// recordFromURL 直接拉取任务的流录制告警后片段（没有告警前片段）
+func (r *ClipRecorder) recordFromURL(streamURL string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "alert-clip-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	var input []string
+	if strings.HasPrefix(strings.ToLower(streamURL), "rtsp") {
+		input = append(input, "-rtsp_transport", "tcp")
+	}
+	input = append(input, "-i", streamURL, "-t", fmt.Sprintf("%.0f", r.post.Seconds()))
+	return r.runFFmpeg(dir, r.post+clipFFmpegTimeout, input...)
+}
+
+// writeFlvFile 将RTMP消息写为FLV文件
+func writeFlvFile(filename string, msgs []base.RtmpMsg) error {
+	var w httpflv.FlvFileWriter
+	if err := w.Open(filename); err != nil {
+		return err
+	}
+	defer w.Dispose()
+
+	if err := w.WriteFlvHeader(); err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		if err := w.WriteTag(*remux.RtmpMsg2FlvTag(msg)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runFFmpeg 输出为MP4（视频直接复制，音频统一转码为AAC以兼容G711等MP4不支持的编码）
+func (r *ClipRecorder) runFFmpeg(dir string, timeout time.Duration, input ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	output := filepath.Join(dir, "clip.mp4")
+	args := append([]string{"-hide_banner", "-loglevel", "error", "-y"}, input...)
+	args = append(args, "-c:v", "copy", "-c:a", "aac", "-movflags", "+faststart", output)
+	if out, err := exec.CommandContext(ctx, r.ffmpeg, args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return os.ReadFile(output)
+}
@@ -0,0 +1,214 @@
+package aianalysis
+
+import (
+	"context"
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"easydarwin/pkg/lalmax/hook"
+	"easydarwin/utils/pkg/objstore"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/q191201771/lal/pkg/base"
+)
+
+func videoMsg(ts uint32, key bool) base.RtmpMsg {
+	frameType := byte(0x27)
+	if key {
+		frameType = 0x17
+	}
+	return base.RtmpMsg{
+		Header:  base.RtmpHeader{MsgTypeId: base.RtmpTypeIdVideo, TimestampAbs: ts},
+		Payload: []byte{frameType, base.RtmpAvcPacketTypeNalu, 0, 0, 0},
+	}
+}
+
+// feedFrames 每500ms一帧，每2秒一个关键帧
+func feedFrames(onMsg func(base.RtmpMsg), from, to uint32) {
+	for ts := from; ts <= to; ts += 500 {
+		onMsg(videoMsg(ts, ts%2000 == 0))
+	}
+}
+
+func TestSelectClip(t *testing.T) {
+	var msgs []base.RtmpMsg
+	feedFrames(func(m base.RtmpMsg) { msgs = append(msgs, m) }, 0, 7500)
+
+	clip := selectClip(msgs, 3000, 5000)
+	if len(clip) == 0 || clip[0].Header.TimestampAbs != 2000 || clip[len(clip)-1].Header.TimestampAbs != 5000 {
+		t.Fatalf("clip should start at key frame 2000 and end at 5000, got %d msgs", len(clip))
+	}
+	if clip := selectClip(msgs[1:], 0, 3000); len(clip) == 0 || clip[0].Header.TimestampAbs != 2000 {
+		t.Fatal("clip should start at the first key frame when buffer is shorter than pre-roll")
+	}
+	if clip := selectClip(msgs[1:4], 0, 5000); clip != nil {
+		t.Fatal("clip without key frame should be nil")
+	}
+}
+
+func TestClipBufferSnapshot(t *testing.T) {
+	b := newClipBuffer(5 * time.Second)
+	b.OnMsg(base.RtmpMsg{
+		Header:  base.RtmpHeader{MsgTypeId: base.RtmpTypeIdVideo},
+		Payload: []byte{0x17, base.RtmpAvcPacketTypeSeqHeader, 0, 0, 0},
+	})
+	feedFrames(b.OnMsg, 0, 19500)
+
+	if !b.msgs[0].IsVideoKeyNalu() || b.msgs[0].Header.TimestampAbs != 12000 {
+		t.Fatalf("buffer should be trimmed to key frame 12000, starts at %d", b.msgs[0].Header.TimestampAbs)
+	}
+
+	// 告警发生在最新一帧之前3秒（流时间戳16500），截取 [14500, 18500]
+	clip := b.snapshot(b.lastWall.Add(-3*time.Second), 2*time.Second, 2*time.Second)
+	if len(clip) < 2 || !clip[0].IsVideoKeySeqHeader() {
+		t.Fatalf("clip should start with sequence header, got %d msgs", len(clip))
+	}
+	if !clip[1].IsVideoKeyNalu() || clip[1].Header.TimestampAbs != 0 {
+		t.Fatal("clip should start at a key frame with timestamp 0")
+	}
+	if last := clip[len(clip)-1].Header.TimestampAbs; last != 4500 {
+		t.Fatalf("clip should cover key frame 14000 to 18500, last timestamp = %d", last)
+	}
+}
+
+func TestClipPaths(t *testing.T) {
+	if got := alertClipPath("alerts/人数统计/cam1/20250115-150001.123.jpg"); got != "alerts/人数统计/cam1/20250115-150001.123.mp4" {
+		t.Fatalf("alertClipPath = %s", got)
+	}
+	if got := localStreamName("rtsp://127.0.0.1:15544/live/stream_1"); got != "stream_1" {
+		t.Fatalf("localStreamName = %s", got)
+	}
+	if got := localStreamName("rtsp://127.0.0.1:15544"); got != "" {
+		t.Fatalf("url without path should have no stream name, got %s", got)
+	}
+}
+
+func TestClipRecorderWatch(t *testing.T) {
+	r := NewClipRecorder(conf.AlertClipConfig{Enable: true}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	r.resolveURL = func(taskID string) string { return "rtsp://127.0.0.1:15544/live/clip_test_" + taskID }
+
+	r.Watch("remote")
+	if w := r.watches["remote"]; w == nil || w.buffer != nil || w.streamURL == "" {
+		t.Fatal("task without local stream should fall back to stream url")
+	}
+
+	session := hook.NewHookSession("clip_test", "clip_test_cam1", nil, 0, 100)
+	r.Watch("cam1")
+	w := r.watches["cam1"]
+	if w == nil || w.buffer == nil {
+		t.Fatal("task with local stream should be buffered")
+	}
+	feedFrames(session.OnMsg, 0, 2000)
+	if len(w.buffer.msgs) == 0 {
+		t.Fatal("buffer should receive stream messages")
+	}
+
+	session.OnStop()
+	r.Watch("cam1")
+	if r.watches["cam1"].buffer != nil {
+		t.Fatal("stopped stream should be released")
+	}
+
+	r.releaseIdle(time.Now().Add(r.idleTimeout + time.Second))
+	if len(r.watches) != 0 {
+		t.Fatal("idle watches should be released")
+	}
+}
+
+func TestClipRecorderDropsWhenBusy(t *testing.T) {
+	r := NewClipRecorder(conf.AlertClipConfig{Enable: true, MaxConcurrent: 1}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	r.resolveURL = func(taskID string) string { return "rtsp://10.0.0.1:554/" + taskID }
+
+	// 录制名额已满时放弃录制，不为每条告警挂起协程
+	r.sem <- struct{}{}
+	if r.Record("cam1", time.Now(), "alerts/cam1/1.mp4", &model.Alert{}) {
+		t.Fatal("clip should be dropped when all slots are busy")
+	}
+	<-r.sem
+
+	r.resolveURL = func(string) string { return "" }
+	if r.Record("cam2", time.Now(), "alerts/cam2/1.mp4", &model.Alert{}) {
+		t.Fatal("clip without stream should not be accepted")
+	}
+
+	r.Stop()
+	r.Stop()
+	if r.Record("cam1", time.Now(), "alerts/cam1/2.mp4", &model.Alert{}) {
+		t.Fatal("stopped recorder should not accept clips")
+	}
+}
+
+func TestClipRecorderAttachesClipAfterUpload(t *testing.T) {
+	setupTestDB(t)
+	store, err := objstore.NewLocal(t.TempDir(), objstore.LocalOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewClipRecorder(conf.AlertClipConfig{Enable: true}, store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	var updated []*model.Alert
+	r.SetOnSaved(func(alert *model.Alert) { updated = append(updated, alert) })
+
+	// 模拟 Record 登记的片段，告警写入批量写入器后落库
+	record := func(taskID, clipPath string) *model.Alert {
+		alert := &model.Alert{TaskID: taskID, CreatedAt: time.Now()}
+		r.pending[alert] = &clipAlert{path: clipPath}
+		return alert
+	}
+	create := func(alert *model.Alert) {
+		if err := data.CreateAlert(alert); err != nil {
+			t.Fatal(err)
+		}
+		r.AlertsCreated([]*model.Alert{alert})
+	}
+	clipPathOf := func(alert *model.Alert) string {
+		var got model.Alert
+		if err := data.GetDatabase().First(&got, alert.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return got.ClipPath
+	}
+
+	// 告警先落库，片段上传后写入路径
+	first := record("cam1", "alerts/cam1/1.mp4")
+	create(first)
+	if clipPathOf(first) != "" || len(updated) != 0 {
+		t.Fatal("clip path should not be saved before upload")
+	}
+	r.finish(first, "alerts/cam1/1.mp4", true)
+	if clipPathOf(first) != "alerts/cam1/1.mp4" || len(updated) != 1 || updated[0].ClipPath != "alerts/cam1/1.mp4" {
+		t.Fatalf("clip path should be saved and published after upload, updated = %+v", updated)
+	}
+
+	// 片段先上传，告警落库时写入路径
+	second := record("cam2", "alerts/cam2/1.mp4")
+	r.finish(second, "alerts/cam2/1.mp4", true)
+	create(second)
+	if clipPathOf(second) != "alerts/cam2/1.mp4" || len(updated) != 2 {
+		t.Fatal("clip path should be saved when the alert is created")
+	}
+
+	// 录制或上传失败时告警不指向片段
+	failed := record("cam3", "alerts/cam3/1.mp4")
+	r.finish(failed, "alerts/cam3/1.mp4", false)
+	create(failed)
+	if clipPathOf(failed) != "" || len(updated) != 2 || len(r.pending) != 0 {
+		t.Fatal("failed clip should not be attached")
+	}
+
+	// 告警未能写入时删除上传的片段
+	ctx := context.Background()
+	if err := store.Put(ctx, "alerts/cam4/1.mp4", strings.NewReader("mp4"), 3, "video/mp4"); err != nil {
+		t.Fatal(err)
+	}
+	orphan := record("cam4", "alerts/cam4/1.mp4")
+	r.Forget(orphan)
+	r.finish(orphan, "alerts/cam4/1.mp4", true)
+	if _, err := store.Stat(ctx, "alerts/cam4/1.mp4"); !errors.Is(err, objstore.ErrNotFound) {
+		t.Fatal("orphan clip should be deleted, got", err)
+	}
+}
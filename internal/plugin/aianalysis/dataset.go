@@ -0,0 +1,575 @@
+package aianalysis
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"easydarwin/utils/pkg/objstore"
+	"easydarwin/utils/pkg/system"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 训练数据格式
+const (
+	DatasetFormatYOLO = "yolo"
+	DatasetFormatCOCO = "coco"
+)
+
+// 训练数据输出方式
+const (
+	DatasetOutputZip   = "zip"   // 本地ZIP文件，通过API下载
+	DatasetOutputMinIO = "minio" // 写入对象存储指定前缀（本地存储时写入存储目录）
+)
+
+// 导出任务状态
+const (
+	DatasetJobPending = "pending"
+	DatasetJobRunning = "running"
+	DatasetJobDone    = "done"
+	DatasetJobFailed  = "failed"
+)
+
+const (
+	defaultDatasetMaxAlerts      = 10000
+	defaultDatasetRetentionHours = 24
+	defaultDatasetMinIOPrefix    = "datasets"
+	datasetImageTimeout          = 30 * time.Second
+)
+
+var ErrDatasetJobNotFound = errors.New("dataset export job not found")
+
+// DatasetExportRequest 训练数据导出请求
+type DatasetExportRequest struct {
+	model.AlertExportFilter
+	Format string `json:"format"` // yolo|coco，默认: yolo
+	Output string `json:"output"` // zip|minio，默认: zip
+	Prefix string `json:"prefix"` // 输出到MinIO时的对象前缀，默认: datasets/<任务ID>
+}
+
+// DatasetExportJob 训练数据导出任务
+type DatasetExportJob struct {
+	ID         string               `json:"id"`
+	Status     string               `json:"status"`
+	Request    DatasetExportRequest `json:"request"`
+	Total      int                  `json:"total"`    // 符合条件的告警数
+	Exported   int                  `json:"exported"` // 已导出的图片数
+	Skipped    int                  `json:"skipped"`  // 图片读取失败跳过的告警数
+	Output     string               `json:"output"`   // ZIP文件路径或MinIO前缀
+	Error      string               `json:"error,omitempty"`
+	CreatedAt  time.Time            `json:"created_at"`
+	FinishedAt *time.Time           `json:"finished_at,omitempty"`
+}
+
+// datasetSample 一张训练图片及其标注
+type datasetSample struct {
+	Name   string // 不含扩展名的文件名
+	Ext    string
+	Width  int
+	Height int
+	Labels []model.FeedbackLabel // 像素坐标
+}
+
+// exportLabels 告警导出为训练数据时使用的标注：
+// 人工修正的目标优先；复核为误报且未修正时作为负样本（无标注）；否则使用算法检测目标
+func exportLabels(alert model.Alert) []model.FeedbackLabel {
+	if fb := alert.Feedback; fb != nil {
+		if len(fb.Labels) > 0 {
+			return fb.Labels
+		}
+		if !fb.Correct {
+			return nil
+		}
+	}
+	var labels []model.FeedbackLabel
+	for _, d := range alert.Detections {
+		if d.Class == "" || d.X2 <= d.X1 || d.Y2 <= d.Y1 {
+			continue
+		}
+		labels = append(labels, model.FeedbackLabel{Class: d.Class, BBox: [4]float64{d.X1, d.Y1, d.X2, d.Y2}})
+	}
+	return labels
+}
+
+// pixelBox 将检测框转换为像素坐标（坐标均不大于1时视为归一化坐标），并裁剪到图片范围内
+func pixelBox(box [4]float64, width, height int) [4]float64 {
+	w, h := float64(width), float64(height)
+	if box[0] <= 1 && box[1] <= 1 && box[2] <= 1 && box[3] <= 1 {
+		box = [4]float64{box[0] * w, box[1] * h, box[2] * w, box[3] * h}
+	}
+	return [4]float64{
+		min(max(box[0], 0), w),
+		min(max(box[1], 0), h),
+		min(max(box[2], 0), w),
+		min(max(box[3], 0), h),
+	}
+}
+
+// datasetClasses 所有样本中的类别（按名称排序，下标即类别ID）
+func datasetClasses(samples []datasetSample) []string {
+	var classes []string
+	for _, s := range samples {
+		for _, l := range s.Labels {
+			if !slices.Contains(classes, l.Class) {
+				classes = append(classes, l.Class)
+			}
+		}
+	}
+	slices.Sort(classes)
+	return classes
+}
+
+// buildYOLOLabel 生成YOLO标注文件内容：每行 "类别ID 中心x 中心y 宽 高"（归一化坐标）
+func buildYOLOLabel(sample datasetSample, classes []string) []byte {
+	var buf bytes.Buffer
+	w, h := float64(sample.Width), float64(sample.Height)
+	for _, l := range sample.Labels {
+		cls := slices.Index(classes, l.Class)
+		b := l.BBox
+		if cls < 0 || w <= 0 || h <= 0 || b[2] <= b[0] || b[3] <= b[1] {
+			continue
+		}
+		fmt.Fprintf(&buf, "%d %.6f %.6f %.6f %.6f\n", cls,
+			(b[0]+b[2])/2/w, (b[1]+b[3])/2/h, (b[2]-b[0])/w, (b[3]-b[1])/h)
+	}
+	return buf.Bytes()
+}
+
+// buildYOLODataYAML 生成YOLO数据集描述文件
+func buildYOLODataYAML(classes []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("path: .\ntrain: images\nval: images\n")
+	fmt.Fprintf(&buf, "nc: %d\nnames:\n", len(classes))
+	for i, c := range classes {
+		fmt.Fprintf(&buf, "  %d: %s\n", i, strconv.Quote(c))
+	}
+	return buf.Bytes()
+}
+
+type cocoImage struct {
+	ID       int    `json:"id"`
+	FileName string `json:"file_name"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+}
+
+type cocoAnnotation struct {
+	ID         int        `json:"id"`
+	ImageID    int        `json:"image_id"`
+	CategoryID int        `json:"category_id"`
+	BBox       [4]float64 `json:"bbox"` // [x, y, 宽, 高]
+	Area       float64    `json:"area"`
+	IsCrowd    int        `json:"iscrowd"`
+}
+
+type cocoCategory struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type cocoDataset struct {
+	Images      []cocoImage      `json:"images"`
+	Annotations []cocoAnnotation `json:"annotations"`
+	Categories  []cocoCategory   `json:"categories"`
+}
+
+// buildCOCO 生成COCO标注文件（类别ID从1开始）
+func buildCOCO(samples []datasetSample, classes []string) ([]byte, error) {
+	ds := cocoDataset{
+		Images:      make([]cocoImage, 0, len(samples)),
+		Annotations: []cocoAnnotation{},
+		Categories:  make([]cocoCategory, 0, len(classes)),
+	}
+	for i, c := range classes {
+		ds.Categories = append(ds.Categories, cocoCategory{ID: i + 1, Name: c})
+	}
+	for i, s := range samples {
+		imageID := i + 1
+		ds.Images = append(ds.Images, cocoImage{ID: imageID, FileName: s.Name + s.Ext, Width: s.Width, Height: s.Height})
+		for _, l := range s.Labels {
+			cls := slices.Index(classes, l.Class)
+			b := l.BBox
+			if cls < 0 || b[2] <= b[0] || b[3] <= b[1] {
+				continue
+			}
+			w, h := b[2]-b[0], b[3]-b[1]
+			ds.Annotations = append(ds.Annotations, cocoAnnotation{
+				ID:         len(ds.Annotations) + 1,
+				ImageID:    imageID,
+				CategoryID: cls + 1,
+				BBox:       [4]float64{b[0], b[1], w, h},
+				Area:       w * h,
+			})
+		}
+	}
+	return json.MarshalIndent(ds, "", "  ")
+}
+
+// datasetWriter 训练数据输出
+type datasetWriter interface {
+	Write(name string, content []byte) error
+	Close() error
+}
+
+// zipDatasetWriter 写入本地ZIP文件
+type zipDatasetWriter struct {
+	file *os.File
+	zw   *zip.Writer
+}
+
+func newZipDatasetWriter(filename string) (*zipDatasetWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &zipDatasetWriter{file: f, zw: zip.NewWriter(f)}, nil
+}
+
+func (w *zipDatasetWriter) Write(name string, content []byte) error {
+	fw, err := w.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(content)
+	return err
+}
+
+func (w *zipDatasetWriter) Close() error {
+	if err := w.zw.Close(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// storeDatasetWriter 写入对象存储指定前缀
+type storeDatasetWriter struct {
+	ctx    context.Context
+	store  objstore.Store
+	prefix string
+}
+
+func (w *storeDatasetWriter) Write(name string, content []byte) error {
+	contentType := "application/octet-stream"
+	switch path.Ext(name) {
+	case ".jpg", ".jpeg":
+		contentType = "image/jpeg"
+	case ".png":
+		contentType = "image/png"
+	case ".json":
+		contentType = "application/json"
+	case ".txt", ".yaml":
+		contentType = "text/plain"
+	}
+	return w.store.Put(w.ctx, path.Join(w.prefix, name), bytes.NewReader(content), int64(len(content)), contentType)
+}
+
+func (w *storeDatasetWriter) Close() error {
+	return nil
+}
+
+// DatasetExporter 将告警图片及标注导出为训练数据（YOLO/COCO），导出任务在后台执行
+type DatasetExporter struct {
+	log       *slog.Logger
+	store     objstore.Store
+	outputDir string
+	maxAlerts int
+	retention time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	seq    atomic.Uint64
+
+	mu   sync.Mutex
+	jobs map[string]*DatasetExportJob
+}
+
+// NewDatasetExporter 创建训练数据导出器
+func NewDatasetExporter(cfg conf.DatasetExportConfig, store objstore.Store, logger *slog.Logger) *DatasetExporter {
+	outputDir := cfg.OutputDir
+	if outputDir == "" {
+		outputDir = filepath.Join(system.GetCWD(), "datasets")
+	}
+	maxAlerts := cfg.MaxAlerts
+	if maxAlerts <= 0 {
+		maxAlerts = defaultDatasetMaxAlerts
+	}
+	retentionHours := cfg.RetentionHours
+	if retentionHours <= 0 {
+		retentionHours = defaultDatasetRetentionHours
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &DatasetExporter{
+		log:       logger,
+		store:     store,
+		outputDir: outputDir,
+		maxAlerts: maxAlerts,
+		retention: time.Duration(retentionHours) * time.Hour,
+		ctx:       ctx,
+		cancel:    cancel,
+		jobs:      make(map[string]*DatasetExportJob),
+	}
+}
+
+// Stop 取消正在执行的导出任务并等待退出
+func (e *DatasetExporter) Stop() {
+	e.cancel()
+	e.wg.Wait()
+}
+
+// Submit 校验导出请求并创建后台导出任务
+func (e *DatasetExporter) Submit(req DatasetExportRequest) (*DatasetExportJob, error) {
+	if req.Format == "" {
+		req.Format = DatasetFormatYOLO
+	}
+	if req.Format != DatasetFormatYOLO && req.Format != DatasetFormatCOCO {
+		return nil, fmt.Errorf("unsupported format: %s", req.Format)
+	}
+	if req.Output == "" {
+		req.Output = DatasetOutputZip
+	}
+	if req.Output != DatasetOutputZip && req.Output != DatasetOutputMinIO {
+		return nil, fmt.Errorf("unsupported output: %s", req.Output)
+	}
+	switch req.Feedback {
+	case model.FeedbackStateAll, model.FeedbackStateCorrect, model.FeedbackStateIncorrect,
+		model.FeedbackStateReviewed, model.FeedbackStateUnreviewed:
+	default:
+		return nil, fmt.Errorf("unsupported feedback state: %s", req.Feedback)
+	}
+	if req.Limit <= 0 || req.Limit > e.maxAlerts {
+		req.Limit = e.maxAlerts
+	}
+
+	e.pruneJobs()
+
+	id := fmt.Sprintf("%s-%d", time.Now().Format("20060102150405"), e.seq.Add(1))
+	job := &DatasetExportJob{
+		ID:        id,
+		Status:    DatasetJobPending,
+		Request:   req,
+		CreatedAt: time.Now(),
+	}
+	if req.Output == DatasetOutputZip {
+		job.Output = filepath.Join(e.outputDir, "dataset-"+id+".zip")
+	} else {
+		prefix := strings.Trim(req.Prefix, "/")
+		if prefix == "" {
+			prefix = path.Join(defaultDatasetMinIOPrefix, id)
+		}
+		job.Output = prefix
+	}
+
+	e.mu.Lock()
+	e.jobs[id] = job
+	e.mu.Unlock()
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		e.run(job)
+	}()
+
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// GetJob 获取导出任务
+func (e *DatasetExporter) GetJob(id string) (DatasetExportJob, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	job, ok := e.jobs[id]
+	if !ok {
+		return DatasetExportJob{}, ErrDatasetJobNotFound
+	}
+	return *job, nil
+}
+
+// ListJobs 获取所有导出任务（按创建时间倒序）
+func (e *DatasetExporter) ListJobs() []DatasetExportJob {
+	e.mu.Lock()
+	jobs := make([]DatasetExportJob, 0, len(e.jobs))
+	for _, job := range e.jobs {
+		jobs = append(jobs, *job)
+	}
+	e.mu.Unlock()
+
+	slices.SortFunc(jobs, func(a, b DatasetExportJob) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return jobs
+}
+
+// pruneJobs 清理超过保留时间的已结束任务及其ZIP文件
+func (e *DatasetExporter) pruneJobs() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for id, job := range e.jobs {
+		if job.FinishedAt == nil || time.Since(*job.FinishedAt) < e.retention {
+			continue
+		}
+		if job.Request.Output == DatasetOutputZip {
+			if err := os.Remove(job.Output); err != nil && !os.IsNotExist(err) {
+				e.log.Warn("failed to remove expired dataset", slog.String("file", job.Output), slog.String("err", err.Error()))
+			}
+		}
+		delete(e.jobs, id)
+	}
+}
+
+func (e *DatasetExporter) update(job *DatasetExportJob, fn func(job *DatasetExportJob)) {
+	e.mu.Lock()
+	fn(job)
+	e.mu.Unlock()
+}
+
+func (e *DatasetExporter) run(job *DatasetExportJob) {
+	e.update(job, func(job *DatasetExportJob) { job.Status = DatasetJobRunning })
+
+	err := e.export(job)
+	now := time.Now()
+	e.update(job, func(job *DatasetExportJob) {
+		job.FinishedAt = &now
+		if err != nil {
+			job.Status = DatasetJobFailed
+			job.Error = err.Error()
+		} else {
+			job.Status = DatasetJobDone
+		}
+	})
+
+	if err != nil {
+		e.log.Error("dataset export failed", slog.String("job", job.ID), slog.String("err", err.Error()))
+		if job.Request.Output == DatasetOutputZip {
+			os.Remove(job.Output)
+		}
+		return
+	}
+	e.log.Info("dataset export finished",
+		slog.String("job", job.ID),
+		slog.String("format", job.Request.Format),
+		slog.String("output", job.Output),
+		slog.Int("exported", job.Exported),
+		slog.Int("skipped", job.Skipped))
+}
+
+func (e *DatasetExporter) export(job *DatasetExportJob) error {
+	req := job.Request
+	alerts, err := data.ListAlertsForExport(req.AlertExportFilter)
+	if err != nil {
+		return fmt.Errorf("query alerts: %w", err)
+	}
+	e.update(job, func(job *DatasetExportJob) { job.Total = len(alerts) })
+
+	var w datasetWriter
+	if req.Output == DatasetOutputZip {
+		zw, err := newZipDatasetWriter(job.Output)
+		if err != nil {
+			return err
+		}
+		w = zw
+	} else {
+		w = &storeDatasetWriter{ctx: e.ctx, store: e.store, prefix: job.Output}
+	}
+
+	samples := make([]datasetSample, 0, len(alerts))
+	for _, alert := range alerts {
+		if err := e.ctx.Err(); err != nil {
+			w.Close()
+			return err
+		}
+
+		img, err := e.readImage(alert.ImagePath)
+		if err != nil {
+			e.log.Warn("skip alert without readable image",
+				slog.Uint64("alert_id", uint64(alert.ID)),
+				slog.String("image", alert.ImagePath),
+				slog.String("err", err.Error()))
+			e.update(job, func(job *DatasetExportJob) { job.Skipped++ })
+			continue
+		}
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(img))
+		if err != nil {
+			e.update(job, func(job *DatasetExportJob) { job.Skipped++ })
+			continue
+		}
+
+		sample := datasetSample{
+			Name:   fmt.Sprintf("alert_%d", alert.ID),
+			Ext:    strings.ToLower(path.Ext(alert.ImagePath)),
+			Width:  cfg.Width,
+			Height: cfg.Height,
+		}
+		for _, l := range exportLabels(alert) {
+			sample.Labels = append(sample.Labels, model.FeedbackLabel{Class: l.Class, BBox: pixelBox(l.BBox, cfg.Width, cfg.Height)})
+		}
+		if err := w.Write("images/"+sample.Name+sample.Ext, img); err != nil {
+			w.Close()
+			return fmt.Errorf("write image: %w", err)
+		}
+		samples = append(samples, sample)
+		e.update(job, func(job *DatasetExportJob) { job.Exported++ })
+	}
+
+	if err := writeDatasetAnnotations(w, req.Format, samples); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// writeDatasetAnnotations 写入标注文件（YOLO：labels/*.txt、classes.txt、data.yaml；COCO：annotations.json）
+func writeDatasetAnnotations(w datasetWriter, format string, samples []datasetSample) error {
+	classes := datasetClasses(samples)
+	if format == DatasetFormatCOCO {
+		content, err := buildCOCO(samples, classes)
+		if err != nil {
+			return err
+		}
+		return w.Write("annotations.json", content)
+	}
+
+	for _, s := range samples {
+		if err := w.Write("labels/"+s.Name+".txt", buildYOLOLabel(s, classes)); err != nil {
+			return fmt.Errorf("write label: %w", err)
+		}
+	}
+	if err := w.Write("classes.txt", []byte(strings.Join(classes, "\n")+"\n")); err != nil {
+		return err
+	}
+	return w.Write("data.yaml", buildYOLODataYAML(classes))
+}
+
+func (e *DatasetExporter) readImage(imagePath string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(e.ctx, datasetImageTimeout)
+	defer cancel()
+	obj, err := e.store.Get(ctx, imagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return io.ReadAll(obj)
+}
@@ -0,0 +1,88 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/data/model"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestExportLabels(t *testing.T) {
+	detections := []model.AlertDetection{
+		{Class: "person", X1: 10, Y1: 10, X2: 50, Y2: 90},
+		{Class: "helmet"}, // 没有检测框
+	}
+	corrected := []model.FeedbackLabel{{Class: "car", BBox: [4]float64{1, 2, 3, 4}}}
+
+	cases := []struct {
+		name  string
+		alert model.Alert
+		want  int
+		class string
+	}{
+		{"unreviewed", model.Alert{Detections: detections}, 1, "person"},
+		{"correct", model.Alert{Detections: detections, Feedback: &model.AlertFeedback{Correct: true}}, 1, "person"},
+		{"false positive", model.Alert{Detections: detections, Feedback: &model.AlertFeedback{Correct: false}}, 0, ""},
+		{"corrected", model.Alert{Detections: detections, Feedback: &model.AlertFeedback{Correct: false, Labels: corrected}}, 1, "car"},
+	}
+	for _, tc := range cases {
+		labels := exportLabels(tc.alert)
+		if len(labels) != tc.want {
+			t.Fatalf("%s: got %d labels, want %d", tc.name, len(labels), tc.want)
+		}
+		if tc.want > 0 && labels[0].Class != tc.class {
+			t.Fatalf("%s: got class %q, want %q", tc.name, labels[0].Class, tc.class)
+		}
+	}
+}
+
+func TestPixelBox(t *testing.T) {
+	if got := pixelBox([4]float64{0.1, 0.2, 0.5, 1}, 200, 100); got != [4]float64{20, 20, 100, 100} {
+		t.Fatalf("normalized box = %v", got)
+	}
+	if got := pixelBox([4]float64{-5, 10, 250, 60}, 200, 100); got != [4]float64{0, 10, 200, 60} {
+		t.Fatalf("pixel box = %v", got)
+	}
+}
+
+func TestDatasetBuilders(t *testing.T) {
+	samples := []datasetSample{
+		{Name: "alert_1", Ext: ".jpg", Width: 200, Height: 100, Labels: []model.FeedbackLabel{
+			{Class: "person", BBox: [4]float64{20, 20, 100, 100}},
+			{Class: "car", BBox: [4]float64{0, 0, 200, 50}},
+		}},
+		{Name: "alert_2", Ext: ".jpg", Width: 200, Height: 100}, // 负样本
+	}
+	classes := datasetClasses(samples)
+	if strings.Join(classes, ",") != "car,person" {
+		t.Fatalf("classes = %v", classes)
+	}
+
+	label := string(buildYOLOLabel(samples[0], classes))
+	want := "1 0.300000 0.600000 0.400000 0.800000\n0 0.500000 0.250000 1.000000 0.500000\n"
+	if label != want {
+		t.Fatalf("yolo label = %q, want %q", label, want)
+	}
+	if len(buildYOLOLabel(samples[1], classes)) != 0 {
+		t.Fatal("negative sample should have an empty label file")
+	}
+	if yaml := string(buildYOLODataYAML(classes)); !strings.Contains(yaml, "nc: 2") || !strings.Contains(yaml, `1: "person"`) {
+		t.Fatalf("unexpected data.yaml: %s", yaml)
+	}
+
+	content, err := buildCOCO(samples, classes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ds cocoDataset
+	if err := json.Unmarshal(content, &ds); err != nil {
+		t.Fatal(err)
+	}
+	if len(ds.Images) != 2 || len(ds.Annotations) != 2 || len(ds.Categories) != 2 {
+		t.Fatalf("unexpected coco dataset: %+v", ds)
+	}
+	ann := ds.Annotations[0]
+	if ann.ImageID != 1 || ann.CategoryID != 2 || ann.BBox != [4]float64{20, 20, 80, 80} || ann.Area != 6400 {
+		t.Fatalf("unexpected annotation: %+v", ann)
+	}
+}
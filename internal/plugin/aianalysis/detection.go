@@ -0,0 +1,175 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/data/model"
+	"strconv"
+)
+
+// Detection 从推理结果中解析出的单个检测目标
+type Detection struct {
+	Class      string                 `json:"class"`
+	Confidence float64                `json:"confidence"`
+	BBox       [4]float64             `json:"bbox"` // [x1, y1, x2, y2]
+	HasBBox    bool                   `json:"-"`
+	TrackID    string                 `json:"track_id,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// detectionListKeys 推理结果中检测列表的常见字段名
+var detectionListKeys = []string{"detections", "objects"}
+
+// parseDetections 从推理结果中解析检测目标，支持 detections/objects 列表，
+// 每项的类别字段支持 class/label/name，置信度支持 confidence/score，检测框支持 bbox/box，
+// 跟踪ID支持 track_id/track，属性支持 attributes/attrs
+func parseDetections(result interface{}) []Detection {
+	resultMap, ok := result.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	for _, key := range detectionListKeys {
+		items, ok := resultMap[key].([]interface{})
+		if !ok {
+			continue
+		}
+		detections := make([]Detection, 0, len(items))
+		for _, item := range items {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			detections = append(detections, parseDetection(obj))
+		}
+		return detections
+	}
+	return nil
+}
+
+func parseDetection(obj map[string]interface{}) Detection {
+	var d Detection
+	for _, key := range []string{"class", "label", "name"} {
+		if v, ok := obj[key].(string); ok {
+			d.Class = v
+			break
+		}
+	}
+	for _, key := range []string{"confidence", "score"} {
+		if v, ok := toFloat(obj[key]); ok {
+			d.Confidence = v
+			break
+		}
+	}
+	for _, key := range []string{"bbox", "box"} {
+		if bbox, ok := parseBBox(obj[key]); ok {
+			d.BBox, d.HasBBox = bbox, true
+			break
+		}
+	}
+	for _, key := range []string{"track_id", "track"} {
+		if v, ok := obj[key].(string); ok {
+			d.TrackID = v
+			break
+		}
+		if v, ok := toFloat(obj[key]); ok {
+			d.TrackID = strconv.FormatInt(int64(v), 10)
+			break
+		}
+	}
+	for _, key := range []string{"attributes", "attrs"} {
+		if v, ok := obj[key].(map[string]interface{}); ok {
+			d.Attributes = v
+			break
+		}
+	}
+	return d
+}
+
+// toAlertDetections 转换为告警检测目标记录
+func toAlertDetections(detections []Detection) []model.AlertDetection {
+	if len(detections) == 0 {
+		return nil
+	}
+	records := make([]model.AlertDetection, len(detections))
+	for i, d := range detections {
+		records[i] = model.AlertDetection{
+			Class:      d.Class,
+			Confidence: d.Confidence,
+			TrackID:    d.TrackID,
+			Attributes: d.Attributes,
+		}
+		if d.HasBBox {
+			records[i].X1, records[i].Y1, records[i].X2, records[i].Y2 = d.BBox[0], d.BBox[1], d.BBox[2], d.BBox[3]
+			records[i].Area = max(d.BBox[2]-d.BBox[0], 0) * max(d.BBox[3]-d.BBox[1], 0)
+		}
+	}
+	return records
+}
+
+// parseBBox 解析检测框：数组 [x1, y1, x2, y2]，或对象 {x1, y1, x2, y2} / {x, y, w, h}
+func parseBBox(v interface{}) ([4]float64, bool) {
+	switch box := v.(type) {
+	case []interface{}:
+		if len(box) != 4 {
+			return [4]float64{}, false
+		}
+		var out [4]float64
+		for i := range box {
+			f, ok := toFloat(box[i])
+			if !ok {
+				return [4]float64{}, false
+			}
+			out[i] = f
+		}
+		return out, true
+	case map[string]interface{}:
+		if x1, ok := toFloat(box["x1"]); ok {
+			y1, _ := toFloat(box["y1"])
+			x2, _ := toFloat(box["x2"])
+			y2, _ := toFloat(box["y2"])
+			return [4]float64{x1, y1, x2, y2}, true
+		}
+		x, okX := toFloat(box["x"])
+		y, okY := toFloat(box["y"])
+		w, okW := toFloat(box["w"])
+		h, okH := toFloat(box["h"])
+		if !okW {
+			w, okW = toFloat(box["width"])
+		}
+		if !okH {
+			h, okH = toFloat(box["height"])
+		}
+		if okX && okY && okW && okH {
+			return [4]float64{x, y, x + w, y + h}, true
+		}
+	}
+	return [4]float64{}, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// bboxIoU 计算两个检测框的交并比
+func bboxIoU(a, b [4]float64) float64 {
+	ix1, iy1 := max(a[0], b[0]), max(a[1], b[1])
+	ix2, iy2 := min(a[2], b[2]), min(a[3], b[3])
+	if ix2 <= ix1 || iy2 <= iy1 {
+		return 0
+	}
+	inter := (ix2 - ix1) * (iy2 - iy1)
+	union := (a[2]-a[0])*(a[3]-a[1]) + (b[2]-b[0])*(b[3]-b[1]) - inter
+	if union <= 0 {
+		return 0
+	}
+	return inter / union
+}
@@ -0,0 +1,99 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"testing"
+)
+
+func TestParseDetections(t *testing.T) {
+	result := map[string]interface{}{
+		"objects": []interface{}{
+			map[string]interface{}{
+				"label":      "person",
+				"score":      0.8,
+				"box":        map[string]interface{}{"x": 10.0, "y": 20.0, "w": 30.0, "h": 40.0},
+				"track_id":   7.0,
+				"attributes": map[string]interface{}{"helmet": false},
+			},
+			map[string]interface{}{"name": "car"},
+		},
+	}
+	detections := parseDetections(result)
+	if len(detections) != 2 {
+		t.Fatalf("len = %d, want 2", len(detections))
+	}
+	d := detections[0]
+	if d.Class != "person" || d.Confidence != 0.8 || !d.HasBBox || d.BBox != [4]float64{10, 20, 40, 60} {
+		t.Fatalf("unexpected detection: %+v", d)
+	}
+	if d.TrackID != "7" || d.Attributes["helmet"] != false {
+		t.Fatalf("track id / attributes not parsed: %+v", d)
+	}
+	if detections[1].HasBBox {
+		t.Fatal("detection without box should not have bbox")
+	}
+
+	records := toAlertDetections(detections)
+	if records[0].Area != 1200 || records[1].Area != 0 {
+		t.Fatalf("area = %v, %v", records[0].Area, records[1].Area)
+	}
+}
+
+func TestListAlertsByDetection(t *testing.T) {
+	setupTestDB(t)
+
+	alerts := []*model.Alert{
+		{TaskID: "cam1", Detections: []model.AlertDetection{
+			{Class: "no_helmet", Confidence: 0.9, Area: 5000},
+			{Class: "person", Confidence: 0.6, Area: 200},
+		}},
+		{TaskID: "cam2", Detections: []model.AlertDetection{
+			{Class: "no_helmet", Confidence: 0.5, Area: 5000},
+		}},
+		{TaskID: "cam3"},
+	}
+	for _, alert := range alerts {
+		if err := data.CreateAlert(alert); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		filter model.AlertFilter
+		want   []string
+	}{
+		{model.AlertFilter{Class: "no_helmet"}, []string{"cam1", "cam2"}},
+		{model.AlertFilter{Class: "no_helmet", MinConfidence: 0.8}, []string{"cam1"}},
+		// 条件须由同一个检测目标满足
+		{model.AlertFilter{Class: "person", MinBBoxArea: 1000}, nil},
+		{model.AlertFilter{MaxBBoxArea: 1000}, []string{"cam1"}},
+		{model.AlertFilter{}, []string{"cam1", "cam2", "cam3"}},
+	}
+	for i, c := range cases {
+		list, total, err := data.ListAlerts(c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]bool)
+		for _, alert := range list {
+			got[alert.TaskID] = true
+		}
+		if int(total) != len(c.want) || len(got) != len(c.want) {
+			t.Fatalf("case %d: got %v, want %v", i, got, c.want)
+		}
+		for _, id := range c.want {
+			if !got[id] {
+				t.Fatalf("case %d: missing %s in %v", i, id, got)
+			}
+		}
+	}
+
+	alert, err := data.GetAlertByID(alerts[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alert.Detections) != 2 {
+		t.Fatalf("detections not loaded: %+v", alert.Detections)
+	}
+}
@@ -2,20 +2,17 @@ package aianalysis
 
 import (
 	"context"
+	"easydarwin/utils/pkg/objstore"
 	"log/slog"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/notification"
 )
 
-// EventListener MinIO事件监听器（替代扫描器）
+// EventListener 对象存储事件监听器（替代扫描器）
 type EventListener struct {
-	minio         *minio.Client
-	bucket        string
+	store         objstore.Store
 	basePath      string
 	alertBasePath string // 告警图片路径前缀
 	processed     map[string]time.Time // 已处理图片 path -> 处理时间
@@ -31,10 +28,9 @@ type EventListener struct {
 }
 
 // NewEventListener 创建事件监听器
-func NewEventListener(minioClient *minio.Client, bucket, basePath, alertBasePath string, logger *slog.Logger) *EventListener {
+func NewEventListener(store objstore.Store, basePath, alertBasePath string, logger *slog.Logger) *EventListener {
 	return &EventListener{
-		minio:         minioClient,
-		bucket:        bucket,
+		store:         store,
 		basePath:      basePath,
 		alertBasePath: alertBasePath,
 		processed:     make(map[string]time.Time),
@@ -65,7 +61,7 @@ func (e *EventListener) Stop() {
 	})
 }
 
-// listenEvents 监听MinIO事件
+// listenEvents 监听对象存储事件
 func (e *EventListener) listenEvents() {
 	// 检查是否已经在监听
 	e.listeningMu.Lock()
@@ -101,8 +97,8 @@ func (e *EventListener) listenEvents() {
 		}
 	}()
 	
-	e.log.Info("starting MinIO event listener",
-		slog.String("bucket", e.bucket),
+	e.log.Info("starting object store event listener",
+		slog.String("store", e.store.Name()),
 		slog.String("base_path", e.basePath),
 		slog.String("alert_base_path", e.alertBasePath))
 
@@ -119,18 +115,15 @@ func (e *EventListener) listenEvents() {
 	}()
 
 	// 监听对象创建和删除事件
-	notificationCh := e.minio.ListenBucketNotification(ctx, e.bucket, e.basePath, "", []string{
-		"s3:ObjectCreated:*",  // 对象创建事件（包括Put、Post、Copy等）
-		"s3:ObjectRemoved:*",  // 对象删除事件（包括Delete、DeleteMarkerCreated等）
-	})
+	notificationCh := e.store.Notify(ctx, e.basePath)
 
 	for {
 		select {
 		case <-e.stopListen:
-			e.log.Info("MinIO event listener stopped")
+			e.log.Info("object store event listener stopped")
 			cancel()
 			return
-		case notificationInfo, ok := <-notificationCh:
+		case event, ok := <-notificationCh:
 			if !ok {
 				// 通道已关闭，可能是连接断开，重新连接
 				e.log.Warn("notification channel closed, reconnecting...")
@@ -140,37 +133,34 @@ func (e *EventListener) listenEvents() {
 				// 检查是否应该停止
 				select {
 				case <-e.stopListen:
-					e.log.Info("MinIO event listener stopped during reconnect")
+					e.log.Info("object store event listener stopped during reconnect")
 					return
 				default:
 				}
 				
 				// 重新创建context和监听
 				ctx, cancel = context.WithCancel(context.Background())
-				notificationCh = e.minio.ListenBucketNotification(ctx, e.bucket, e.basePath, "", []string{
-					"s3:ObjectCreated:*",
-					"s3:ObjectRemoved:*",
-				})
-				e.log.Info("reconnected to MinIO event notification")
+				notificationCh = e.store.Notify(ctx, e.basePath)
+				e.log.Info("reconnected to object store event notification")
 				continue
 			}
 			
-			if notificationInfo.Err != nil {
+			if event.Err != nil {
 				// 检查是否是context取消错误（正常关闭）
-				if notificationInfo.Err == context.Canceled {
+				if event.Err == context.Canceled {
 					e.log.Info("notification context canceled, stopping listener")
 					return
 				}
 				
 				e.log.Error("notification error",
-					slog.String("err", notificationInfo.Err.Error()))
+					slog.String("err", event.Err.Error()))
 				// 发生错误时，等待一段时间后重新连接
 				time.Sleep(5 * time.Second)
 				
 				// 检查是否应该停止
 				select {
 				case <-e.stopListen:
-					e.log.Info("MinIO event listener stopped during error recovery")
+					e.log.Info("object store event listener stopped during error recovery")
 					return
 				default:
 				}
@@ -178,45 +168,35 @@ func (e *EventListener) listenEvents() {
 				// 重新创建context和监听
 				cancel()
 				ctx, cancel = context.WithCancel(context.Background())
-				notificationCh = e.minio.ListenBucketNotification(ctx, e.bucket, e.basePath, "", []string{
-					"s3:ObjectCreated:*",
-					"s3:ObjectRemoved:*",
-				})
-				e.log.Info("reconnected to MinIO event notification after error")
+				notificationCh = e.store.Notify(ctx, e.basePath)
+				e.log.Info("reconnected to object store event notification after error")
 				continue
 			}
 
-			// 处理通知记录
-			for _, record := range notificationInfo.Records {
-				e.handleNotificationRecord(record)
-			}
+			// 处理事件
+			e.handleEvent(event)
 		}
 	}
 }
 
-// handleNotificationRecord 处理通知记录
-func (e *EventListener) handleNotificationRecord(record notification.Event) {
+// handleEvent 处理对象事件
+func (e *EventListener) handleEvent(event objstore.Event) {
 	// 添加panic恢复机制，防止单个事件处理失败导致整个监听器崩溃
 	defer func() {
 		if r := recover(); r != nil {
-			e.log.Error("panic in handleNotificationRecord, recovered",
+			e.log.Error("panic in handleEvent, recovered",
 				slog.Any("panic", r),
-				slog.String("event_name", record.EventName),
-				slog.String("object_key", record.S3.Object.Key))
+				slog.String("event_type", string(event.Type)),
+				slog.String("object_key", event.Key))
 		}
 	}()
 	
-	// 解析事件名称
-	eventName := record.EventName
-	objectKey := record.S3.Object.Key
-
 	// 规范化路径
-	normalizedPath := filepath.ToSlash(objectKey)
+	normalizedPath := filepath.ToSlash(event.Key)
 
-	e.log.Debug("received MinIO event",
-		slog.String("event_name", eventName),
-		slog.String("object_key", normalizedPath),
-		slog.String("bucket", record.S3.Bucket.Name))
+	e.log.Debug("received object store event",
+		slog.String("event_type", string(event.Type)),
+		slog.String("object_key", normalizedPath))
 
 	// 跳过告警路径中的图片
 	if e.alertBasePath != "" && strings.HasPrefix(normalizedPath, e.alertBasePath) {
@@ -225,25 +205,20 @@ func (e *EventListener) handleNotificationRecord(record notification.Event) {
 		return
 	}
 
-	// 处理对象创建事件
-	if strings.HasPrefix(eventName, "s3:ObjectCreated:") {
-		e.handleObjectCreated(normalizedPath, record)
-		return
-	}
-
-	// 处理对象删除事件
-	if strings.HasPrefix(eventName, "s3:ObjectRemoved:") {
+	switch event.Type {
+	case objstore.EventCreated:
+		e.handleObjectCreated(normalizedPath, event)
+	case objstore.EventDeleted:
 		e.handleObjectRemoved(normalizedPath)
-		return
+	default:
+		e.log.Debug("unhandled event type",
+			slog.String("event_type", string(event.Type)),
+			slog.String("object_key", normalizedPath))
 	}
-
-	e.log.Debug("unhandled event type",
-		slog.String("event_name", eventName),
-		slog.String("object_key", normalizedPath))
 }
 
 // handleObjectCreated 处理对象创建事件
-func (e *EventListener) handleObjectCreated(objectKey string, record notification.Event) {
+func (e *EventListener) handleObjectCreated(objectKey string, event objstore.Event) {
 	// 过滤非图片文件
 	if !isImageFile(objectKey) {
 		return
@@ -283,8 +258,8 @@ func (e *EventListener) handleObjectCreated(objectKey string, record notificatio
 	}
 
 	// 获取对象信息
-	// 优先从MinIO获取完整信息（包括大小和修改时间）
-	objInfo, err := e.minio.StatObject(context.Background(), e.bucket, objectKey, minio.StatObjectOptions{})
+	// 优先从对象存储获取完整信息（包括大小和修改时间）
+	objInfo, err := e.store.Stat(context.Background(), objectKey)
 	var size int64
 	var modTime time.Time
 	
@@ -295,13 +270,13 @@ func (e *EventListener) handleObjectCreated(objectKey string, record notificatio
 			slog.String("err", err.Error()))
 		
 		// 使用事件中的大小
-		if record.S3.Object.Size > 0 {
-			size = record.S3.Object.Size
+		if event.Size > 0 {
+			size = event.Size
 		}
 		// 使用当前时间作为默认值
 		modTime = time.Now()
 	} else {
-		// 使用从MinIO获取的完整信息
+		// 使用从对象存储获取的完整信息
 		size = objInfo.Size
 		modTime = objInfo.LastModified
 	}
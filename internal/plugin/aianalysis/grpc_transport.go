@@ -0,0 +1,417 @@
+package aianalysis
+
+import (
+	"context"
+	"easydarwin/internal/conf"
+	"easydarwin/internal/plugin/aianalysis/inferpb"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// 算法服务调用协议
+const (
+	ProtocolHTTP       = "http"        // POST endpoint，JSON请求体（默认）
+	ProtocolGRPC       = "grpc"        // gRPC 一元调用 InferenceService.Infer
+	ProtocolGRPCStream = "grpc_stream" // gRPC 双向流 InferenceService.InferStream，每个endpoint复用一条流
+)
+
+// errGRPCTransportClosed gRPC传输层已关闭
+var errGRPCTransportClosed = errors.New("grpc transport closed")
+
+// normalizeProtocol 校验算法服务协议，为空时使用HTTP
+func normalizeProtocol(protocol string) (string, error) {
+	switch protocol {
+	case "":
+		return ProtocolHTTP, nil
+	case ProtocolHTTP, ProtocolGRPC, ProtocolGRPCStream:
+		return protocol, nil
+	default:
+		return "", fmt.Errorf("unsupported protocol: %s (supported: http, grpc, grpc_stream)", protocol)
+	}
+}
+
+// isGRPCProtocol 是否为gRPC协议
+func isGRPCProtocol(protocol string) bool {
+	return protocol == ProtocolGRPC || protocol == ProtocolGRPCStream
+}
+
+// grpcTarget 将endpoint转换为gRPC拨号地址（允许带 grpc:// 前缀）
+func grpcTarget(endpoint string) string {
+	return strings.TrimPrefix(endpoint, "grpc://")
+}
+
+// GRPCTransport gRPC推理传输层
+// 按endpoint缓存连接；grpc_stream 协议下每个endpoint复用一条双向流，
+// 通过 request_id 匹配响应，流断开后在下次调用时重建
+type GRPCTransport struct {
+	timeout time.Duration // 单次推理超时
+	log     *slog.Logger
+
+	mu      sync.Mutex
+	conns   map[string]*grpc.ClientConn // endpoint -> 连接
+	streams map[string]*inferStream     // endpoint -> 双向流
+	closed  bool
+
+	seq atomic.Uint64 // 请求ID序号
+}
+
+// NewGRPCTransport 创建gRPC传输层
+func NewGRPCTransport(timeout time.Duration, logger *slog.Logger) *GRPCTransport {
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	return &GRPCTransport{
+		timeout: timeout,
+		log:     logger,
+		conns:   make(map[string]*grpc.ClientConn),
+		streams: make(map[string]*inferStream),
+	}
+}
+
+// conn 获取endpoint对应的连接（懒连接，连接断开由gRPC自动重连）
+func (t *GRPCTransport) conn(endpoint string) (*grpc.ClientConn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, errGRPCTransportClosed
+	}
+	if cc, ok := t.conns[endpoint]; ok {
+		return cc, nil
+	}
+
+	cc, err := grpc.NewClient(grpcTarget(endpoint), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("grpc dial %s failed: %w", endpoint, err)
+	}
+	t.conns[endpoint] = cc
+	return cc, nil
+}
+
+// Infer 一元调用推理
+func (t *GRPCTransport) Infer(ctx context.Context, endpoint string, req conf.InferenceRequest) (*conf.InferenceResponse, error) {
+	cc, err := t.conn(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	pbReq, err := toInferRequest(req, t.nextRequestID())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	pbResp, err := inferpb.NewInferenceServiceClient(cc).Infer(ctx, pbReq)
+	if err != nil {
+		return nil, grpcCallError(err)
+	}
+	return fromInferResponse(pbResp)
+}
+
+// InferBatch 批量推理，响应与请求按顺序一一对应
+func (t *GRPCTransport) InferBatch(ctx context.Context, endpoint string, reqs []conf.InferenceRequest) ([]*conf.InferenceResponse, error) {
+	cc, err := t.conn(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := &inferpb.InferBatchRequest{Requests: make([]*inferpb.InferRequest, len(reqs))}
+	for i, req := range reqs {
+		if batch.Requests[i], err = toInferRequest(req, t.nextRequestID()); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	pbResp, err := inferpb.NewInferenceServiceClient(cc).InferBatch(ctx, batch)
+	if err != nil {
+		return nil, grpcCallError(err)
+	}
+	if len(pbResp.GetResponses()) != len(reqs) {
+		return nil, fmt.Errorf("grpc batch response count mismatch: got %d, want %d", len(pbResp.GetResponses()), len(reqs))
+	}
+
+	resps := make([]*conf.InferenceResponse, len(reqs))
+	for i, r := range pbResp.GetResponses() {
+		if resps[i], err = fromInferResponse(r); err != nil {
+			return nil, err
+		}
+	}
+	return resps, nil
+}
+
+// InferStream 通过endpoint的共享双向流推理
+func (t *GRPCTransport) InferStream(ctx context.Context, endpoint string, req conf.InferenceRequest) (*conf.InferenceResponse, error) {
+	pbReq, err := toInferRequest(req, t.nextRequestID())
+	if err != nil {
+		return nil, err
+	}
+	stream, err := t.stream(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	pbResp, err := stream.call(ctx, pbReq)
+	if err != nil {
+		return nil, grpcCallError(err)
+	}
+	return fromInferResponse(pbResp)
+}
+
+// Health 健康检查，注册时用于确认算法服务支持gRPC协议
+func (t *GRPCTransport) Health(ctx context.Context, endpoint string) (*inferpb.HealthResponse, error) {
+	cc, err := t.conn(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := inferpb.NewInferenceServiceClient(cc).Health(ctx, &inferpb.HealthRequest{})
+	if err != nil {
+		return nil, grpcCallError(err)
+	}
+	if !resp.GetServing() {
+		return resp, fmt.Errorf("grpc service %s not serving", endpoint)
+	}
+	return resp, nil
+}
+
+// Close 关闭所有流和连接
+func (t *GRPCTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+
+	for endpoint, s := range t.streams {
+		s.cancel()
+		delete(t.streams, endpoint)
+	}
+	var errs []error
+	for endpoint, cc := range t.conns {
+		if err := cc.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close grpc conn %s: %w", endpoint, err))
+		}
+		delete(t.conns, endpoint)
+	}
+	return errors.Join(errs...)
+}
+
+func (t *GRPCTransport) nextRequestID() string {
+	return strconv.FormatUint(t.seq.Add(1), 10)
+}
+
+// stream 获取endpoint的双向流，流已断开时重建
+func (t *GRPCTransport) stream(endpoint string) (*inferStream, error) {
+	cc, err := t.conn(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, errGRPCTransportClosed
+	}
+	if s, ok := t.streams[endpoint]; ok && !s.broken() {
+		return s, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client, err := inferpb.NewInferenceServiceClient(cc).InferStream(ctx)
+	if err != nil {
+		cancel()
+		return nil, grpcCallError(err)
+	}
+
+	s := &inferStream{
+		client:  client,
+		cancel:  cancel,
+		pending: make(map[string]chan *inferpb.InferResponse),
+		done:    make(chan struct{}),
+	}
+	go s.recvLoop(endpoint, t.log)
+	t.streams[endpoint] = s
+	return s, nil
+}
+
+// inferStream 一条共享的推理双向流
+type inferStream struct {
+	client inferpb.InferenceService_InferStreamClient
+	cancel context.CancelFunc
+
+	sendMu sync.Mutex // gRPC流不支持并发Send
+
+	mu      sync.Mutex
+	pending map[string]chan *inferpb.InferResponse // request_id -> 等待中的调用
+	err     error                                  // 流断开原因
+	done    chan struct{}                          // 流断开时关闭
+}
+
+// call 发送请求并等待对应 request_id 的响应
+func (s *inferStream) call(ctx context.Context, req *inferpb.InferRequest) (*inferpb.InferResponse, error) {
+	ch := make(chan *inferpb.InferResponse, 1)
+
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return nil, s.err
+	}
+	s.pending[req.RequestId] = ch
+	s.mu.Unlock()
+
+	s.sendMu.Lock()
+	err := s.client.Send(req)
+	s.sendMu.Unlock()
+	if err != nil {
+		s.forget(req.RequestId)
+		// 发送失败说明流已不可用，断开后由下次调用重建
+		s.cancel()
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-s.done:
+		select {
+		case resp := <-ch:
+			return resp, nil
+		default:
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return nil, s.err
+	case <-ctx.Done():
+		s.forget(req.RequestId)
+		return nil, ctx.Err()
+	}
+}
+
+// recvLoop 接收响应并分发给等待中的调用，流断开时唤醒所有调用
+func (s *inferStream) recvLoop(endpoint string, logger *slog.Logger) {
+	for {
+		resp, err := s.client.Recv()
+		if err != nil {
+			s.mu.Lock()
+			s.err = fmt.Errorf("grpc stream closed: %w", err)
+			pending := len(s.pending)
+			s.pending = nil
+			s.mu.Unlock()
+			close(s.done)
+			s.cancel()
+
+			if status.Code(err) != codes.Canceled {
+				logger.Warn("grpc inference stream closed",
+					slog.String("endpoint", endpoint),
+					slog.Int("pending", pending),
+					slog.String("err", err.Error()))
+			}
+			return
+		}
+
+		s.mu.Lock()
+		ch, ok := s.pending[resp.GetRequestId()]
+		if ok {
+			delete(s.pending, resp.GetRequestId())
+		}
+		s.mu.Unlock()
+
+		if !ok {
+			// 调用已超时放弃，丢弃迟到的响应
+			continue
+		}
+		ch <- resp
+	}
+}
+
+// forget 移除等待中的调用
+func (s *inferStream) forget(requestID string) {
+	s.mu.Lock()
+	delete(s.pending, requestID)
+	s.mu.Unlock()
+}
+
+// broken 流是否已断开
+func (s *inferStream) broken() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// toInferRequest 将HTTP协议的推理请求转换为gRPC请求
+func toInferRequest(req conf.InferenceRequest, requestID string) (*inferpb.InferRequest, error) {
+	pbReq := &inferpb.InferRequest{
+		RequestId:     requestID,
+		TaskId:        req.TaskID,
+		TaskType:      req.TaskType,
+		ImagePath:     req.ImagePath,
+		ImageUrl:      req.ImageURL,
+		ImageData:     req.ImageData,
+		ImageFormat:   req.ImageFormat,
+		AlgoConfigUrl: req.AlgoConfigURL,
+	}
+	if req.AlgoConfig != nil {
+		configJSON, err := json.Marshal(req.AlgoConfig)
+		if err != nil {
+			return nil, fmt.Errorf("marshal algo_config failed: %w", err)
+		}
+		pbReq.AlgoConfigJson = string(configJSON)
+	}
+	return pbReq, nil
+}
+
+// fromInferResponse 将gRPC响应转换为HTTP协议的推理响应，result_json 解析为与HTTP协议一致的结构
+func fromInferResponse(resp *inferpb.InferResponse) (*conf.InferenceResponse, error) {
+	out := &conf.InferenceResponse{
+		Success:         resp.GetSuccess(),
+		Confidence:      resp.GetConfidence(),
+		InferenceTimeMs: resp.GetInferenceTimeMs(),
+		Error:           resp.GetError(),
+	}
+	if resp.GetResultJson() != "" {
+		if err := json.Unmarshal([]byte(resp.GetResultJson()), &out.Result); err != nil {
+			return nil, fmt.Errorf("decode result_json failed: %w", err)
+		}
+	}
+	return out, nil
+}
+
+// grpcCallError 转换gRPC错误，NotFound（图片不存在）转换为与HTTP协议一致的404错误，便于调度器统一处理
+func grpcCallError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.NotFound:
+		return fmt.Errorf("grpc 404 Not Found: %s", st.Message())
+	case codes.Unavailable:
+		return fmt.Errorf("connection error (service likely offline): %w", err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,309 @@
+package aianalysis
+
+import (
+	"context"
+	"easydarwin/internal/conf"
+	"easydarwin/internal/plugin/aianalysis/inferpb"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeInferenceServer 测试用gRPC算法服务：返回 task_id 和检测数，image_path 为 "missing" 时返回NotFound，
+// 为 "flaky" 时第一次调用返回Internal
+type fakeInferenceServer struct {
+	inferpb.UnimplementedInferenceServiceServer
+
+	calls atomic.Int32 // "flaky" 图片的调用次数
+}
+
+func (f *fakeInferenceServer) infer(req *inferpb.InferRequest) (*inferpb.InferResponse, error) {
+	switch req.GetImagePath() {
+	case "missing":
+		return nil, status.Error(codes.NotFound, "image not found")
+	case "flaky":
+		if f.calls.Add(1) == 1 {
+			return nil, status.Error(codes.Internal, "transient failure")
+		}
+	}
+	var cfg map[string]interface{}
+	if req.GetAlgoConfigJson() != "" {
+		if err := json.Unmarshal([]byte(req.GetAlgoConfigJson()), &cfg); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	result, _ := json.Marshal(map[string]interface{}{
+		"task_id":     req.GetTaskId(),
+		"total_count": 3,
+		"threshold":   cfg["threshold"],
+	})
+	return &inferpb.InferResponse{
+		RequestId:       req.GetRequestId(),
+		Success:         true,
+		ResultJson:      string(result),
+		Confidence:      0.9,
+		InferenceTimeMs: 12.5,
+	}, nil
+}
+
+func (f *fakeInferenceServer) Infer(_ context.Context, req *inferpb.InferRequest) (*inferpb.InferResponse, error) {
+	return f.infer(req)
+}
+
+func (f *fakeInferenceServer) InferBatch(_ context.Context, req *inferpb.InferBatchRequest) (*inferpb.InferBatchResponse, error) {
+	out := &inferpb.InferBatchResponse{}
+	for _, r := range req.GetRequests() {
+		resp, err := f.infer(r)
+		if err != nil {
+			resp = &inferpb.InferResponse{RequestId: r.GetRequestId(), Error: err.Error()}
+		}
+		out.Responses = append(out.Responses, resp)
+	}
+	return out, nil
+}
+
+// InferStream 并发处理请求并乱序返回，验证客户端按 request_id 匹配响应
+func (f *fakeInferenceServer) InferStream(stream inferpb.InferenceService_InferStreamServer) error {
+	var sendMu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func(req *inferpb.InferRequest) {
+			defer wg.Done()
+			time.Sleep(time.Duration(len(req.GetTaskId())%5) * time.Millisecond)
+			resp, err := f.infer(req)
+			if err != nil {
+				resp = &inferpb.InferResponse{RequestId: req.GetRequestId(), Error: err.Error()}
+			}
+			sendMu.Lock()
+			stream.Send(resp)
+			sendMu.Unlock()
+		}(req)
+	}
+}
+
+func (f *fakeInferenceServer) Health(context.Context, *inferpb.HealthRequest) (*inferpb.HealthResponse, error) {
+	return &inferpb.HealthResponse{Serving: true, Version: "test"}, nil
+}
+
+func startFakeInferenceServer(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	inferpb.RegisterInferenceServiceServer(server, &fakeInferenceServer{})
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return lis.Addr().String()
+}
+
+func newTestGRPCTransport(t *testing.T) *GRPCTransport {
+	t.Helper()
+	transport := NewGRPCTransport(5*time.Second, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() { transport.Close() })
+	return transport
+}
+
+func TestNormalizeProtocol(t *testing.T) {
+	for in, want := range map[string]string{"": ProtocolHTTP, "http": ProtocolHTTP, "grpc": ProtocolGRPC, "grpc_stream": ProtocolGRPCStream} {
+		got, err := normalizeProtocol(in)
+		if err != nil || got != want {
+			t.Fatalf("normalizeProtocol(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := normalizeProtocol("thrift"); err == nil {
+		t.Fatal("expected error for unknown protocol")
+	}
+}
+
+func TestGRPCTransportInfer(t *testing.T) {
+	endpoint := "grpc://" + startFakeInferenceServer(t)
+	transport := newTestGRPCTransport(t)
+
+	resp, err := transport.Infer(context.Background(), endpoint, conf.InferenceRequest{
+		TaskID:     "cam1",
+		TaskType:   "人数统计",
+		ImagePath:  "frames/cam1/1.jpg",
+		AlgoConfig: map[string]interface{}{"threshold": 0.5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || resp.InferenceTimeMs != 12.5 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	result := resp.Result.(map[string]interface{})
+	if result["task_id"] != "cam1" || result["threshold"] != 0.5 {
+		t.Fatalf("unexpected result: %v", result)
+	}
+	if extractDetectionCount(resp.Result) != 3 {
+		t.Fatalf("detection count = %d, want 3", extractDetectionCount(resp.Result))
+	}
+
+	_, err = transport.Infer(context.Background(), endpoint, conf.InferenceRequest{TaskID: "cam1", ImagePath: "missing"})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected 404 error, got %v", err)
+	}
+}
+
+func TestCallAlgorithmGRPCRetries(t *testing.T) {
+	endpoint := "grpc://" + startFakeInferenceServer(t)
+	s := &Scheduler{
+		log:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+		grpcTransport: newTestGRPCTransport(t),
+	}
+	algorithm := conf.AlgorithmService{Endpoint: endpoint, Protocol: ProtocolGRPC}
+
+	// 临时错误按HTTP调用的策略重试
+	resp, err := s.callAlgorithm(algorithm, conf.InferenceRequest{TaskID: "cam1", ImagePath: "flaky"})
+	if err != nil || !resp.Success {
+		t.Fatalf("expected success after retry, got %+v, %v", resp, err)
+	}
+
+	// 图片不存在不重试
+	start := time.Now()
+	if _, err := s.callAlgorithm(algorithm, conf.InferenceRequest{TaskID: "cam1", ImagePath: "missing"}); !isNotFoundError(err) {
+		t.Fatalf("expected 404 error, got %v", err)
+	}
+	if time.Since(start) >= algorithmCallRetryDelay {
+		t.Fatal("not found error should not be retried")
+	}
+}
+
+func TestGRPCTransportInferStreamConcurrent(t *testing.T) {
+	endpoint := startFakeInferenceServer(t)
+	transport := newTestGRPCTransport(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			taskID := fmt.Sprintf("cam%d", i)
+			resp, err := transport.InferStream(context.Background(), endpoint, conf.InferenceRequest{TaskID: taskID})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if got := resp.Result.(map[string]interface{})["task_id"]; got != taskID {
+				errs <- fmt.Errorf("response mismatched: got %v, want %s", got, taskID)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	transport.mu.Lock()
+	streams := len(transport.streams)
+	transport.mu.Unlock()
+	if streams != 1 {
+		t.Fatalf("streams = %d, want 1 shared stream", streams)
+	}
+}
+
+func TestGRPCTransportStreamReconnect(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := lis.Addr().String()
+	server := grpc.NewServer()
+	inferpb.RegisterInferenceServiceServer(server, &fakeInferenceServer{})
+	go server.Serve(lis)
+
+	transport := newTestGRPCTransport(t)
+	if _, err := transport.InferStream(context.Background(), endpoint, conf.InferenceRequest{TaskID: "cam1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 服务重启后流断开，下次调用应重建流
+	server.Stop()
+	lis, err = net.Listen("tcp", endpoint)
+	if err != nil {
+		t.Skipf("cannot rebind %s: %v", endpoint, err)
+	}
+	server = grpc.NewServer()
+	inferpb.RegisterInferenceServiceServer(server, &fakeInferenceServer{})
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := transport.InferStream(context.Background(), endpoint, conf.InferenceRequest{TaskID: "cam1"})
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stream not recovered: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestGRPCTransportBatchAndHealth(t *testing.T) {
+	endpoint := startFakeInferenceServer(t)
+	transport := newTestGRPCTransport(t)
+
+	health, err := transport.Health(context.Background(), endpoint)
+	if err != nil || health.GetVersion() != "test" {
+		t.Fatalf("health = %v, %v", health, err)
+	}
+
+	resps, err := transport.InferBatch(context.Background(), endpoint, []conf.InferenceRequest{
+		{TaskID: "a"}, {TaskID: "b", ImagePath: "missing"}, {TaskID: "c"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resps) != 3 {
+		t.Fatalf("len = %d, want 3", len(resps))
+	}
+	if resps[0].Result.(map[string]interface{})["task_id"] != "a" || resps[2].Result.(map[string]interface{})["task_id"] != "c" {
+		t.Fatal("batch responses out of order")
+	}
+	if resps[1].Success || resps[1].Error == "" {
+		t.Fatalf("expected failed response for missing image: %+v", resps[1])
+	}
+}
+
+func TestRegisterRejectsUnknownProtocol(t *testing.T) {
+	registry := newTestRegistry(t)
+	svc := testService("10.0.0.1:9000", 0)
+	svc.Protocol = "thrift"
+	if err := registry.Register(svc); err == nil {
+		t.Fatal("expected error for unknown protocol")
+	}
+
+	svc.Protocol = ""
+	if err := registry.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+	if got := registry.GetAlgorithms("人数统计")[0].Protocol; got != ProtocolHTTP {
+		t.Fatalf("protocol = %q, want %q", got, ProtocolHTTP)
+	}
+}
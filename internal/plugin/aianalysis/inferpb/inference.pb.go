@@ -0,0 +1,506 @@
+// 算法服务 gRPC 推理协议
+//
+// 算法服务注册时声明 protocol = "grpc"（一元调用）或 "grpc_stream"（双向流），
+// endpoint 填写 gRPC 监听地址（如 10.1.6.230:9000）。
+//
+// 重新生成代码：
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//          --go-grpc_out=. --go-grpc_opt=paths=source_relative inference.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: inference.proto
+
+package inferpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type InferRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	RequestId      string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`                  // 请求ID，流式调用时用于匹配响应
+	TaskId         string                 `protobuf:"bytes,2,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`                           // 任务ID
+	TaskType       string                 `protobuf:"bytes,3,opt,name=task_type,json=taskType,proto3" json:"task_type,omitempty"`                     // 任务类型
+	ImagePath      string                 `protobuf:"bytes,4,opt,name=image_path,json=imagePath,proto3" json:"image_path,omitempty"`                  // MinIO对象路径
+	ImageUrl       string                 `protobuf:"bytes,5,opt,name=image_url,json=imageUrl,proto3" json:"image_url,omitempty"`                     // 图片预签名URL（image_data 为空时从此地址下载）
+	AlgoConfigJson string                 `protobuf:"bytes,6,opt,name=algo_config_json,json=algoConfigJson,proto3" json:"algo_config_json,omitempty"` // 算法配置（JSON，可选）
+	AlgoConfigUrl  string                 `protobuf:"bytes,7,opt,name=algo_config_url,json=algoConfigUrl,proto3" json:"algo_config_url,omitempty"`    // 算法配置文件URL（可选）
+	ImageData      []byte                 `protobuf:"bytes,8,opt,name=image_data,json=imageData,proto3" json:"image_data,omitempty"`                  // 图片内容（内联传输时填写）
+	ImageFormat    string                 `protobuf:"bytes,9,opt,name=image_format,json=imageFormat,proto3" json:"image_format,omitempty"`            // 图片格式：jpeg|png
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *InferRequest) Reset() {
+	*x = InferRequest{}
+	mi := &file_inference_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InferRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InferRequest) ProtoMessage() {}
+
+func (x *InferRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inference_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InferRequest.ProtoReflect.Descriptor instead.
+func (*InferRequest) Descriptor() ([]byte, []int) {
+	return file_inference_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *InferRequest) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *InferRequest) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
+func (x *InferRequest) GetTaskType() string {
+	if x != nil {
+		return x.TaskType
+	}
+	return ""
+}
+
+func (x *InferRequest) GetImagePath() string {
+	if x != nil {
+		return x.ImagePath
+	}
+	return ""
+}
+
+func (x *InferRequest) GetImageUrl() string {
+	if x != nil {
+		return x.ImageUrl
+	}
+	return ""
+}
+
+func (x *InferRequest) GetAlgoConfigJson() string {
+	if x != nil {
+		return x.AlgoConfigJson
+	}
+	return ""
+}
+
+func (x *InferRequest) GetAlgoConfigUrl() string {
+	if x != nil {
+		return x.AlgoConfigUrl
+	}
+	return ""
+}
+
+func (x *InferRequest) GetImageData() []byte {
+	if x != nil {
+		return x.ImageData
+	}
+	return nil
+}
+
+func (x *InferRequest) GetImageFormat() string {
+	if x != nil {
+		return x.ImageFormat
+	}
+	return ""
+}
+
+type InferResponse struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	RequestId       string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Success         bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	ResultJson      string                 `protobuf:"bytes,3,opt,name=result_json,json=resultJson,proto3" json:"result_json,omitempty"` // 推理结果（JSON，与HTTP协议的 result 字段格式一致）
+	Confidence      float64                `protobuf:"fixed64,4,opt,name=confidence,proto3" json:"confidence,omitempty"`
+	InferenceTimeMs float64                `protobuf:"fixed64,5,opt,name=inference_time_ms,json=inferenceTimeMs,proto3" json:"inference_time_ms,omitempty"`
+	Error           string                 `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *InferResponse) Reset() {
+	*x = InferResponse{}
+	mi := &file_inference_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InferResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InferResponse) ProtoMessage() {}
+
+func (x *InferResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_inference_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InferResponse.ProtoReflect.Descriptor instead.
+func (*InferResponse) Descriptor() ([]byte, []int) {
+	return file_inference_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *InferResponse) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *InferResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *InferResponse) GetResultJson() string {
+	if x != nil {
+		return x.ResultJson
+	}
+	return ""
+}
+
+func (x *InferResponse) GetConfidence() float64 {
+	if x != nil {
+		return x.Confidence
+	}
+	return 0
+}
+
+func (x *InferResponse) GetInferenceTimeMs() float64 {
+	if x != nil {
+		return x.InferenceTimeMs
+	}
+	return 0
+}
+
+func (x *InferResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type InferBatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Requests      []*InferRequest        `protobuf:"bytes,1,rep,name=requests,proto3" json:"requests,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InferBatchRequest) Reset() {
+	*x = InferBatchRequest{}
+	mi := &file_inference_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InferBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InferBatchRequest) ProtoMessage() {}
+
+func (x *InferBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inference_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InferBatchRequest.ProtoReflect.Descriptor instead.
+func (*InferBatchRequest) Descriptor() ([]byte, []int) {
+	return file_inference_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *InferBatchRequest) GetRequests() []*InferRequest {
+	if x != nil {
+		return x.Requests
+	}
+	return nil
+}
+
+type InferBatchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Responses     []*InferResponse       `protobuf:"bytes,1,rep,name=responses,proto3" json:"responses,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InferBatchResponse) Reset() {
+	*x = InferBatchResponse{}
+	mi := &file_inference_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InferBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InferBatchResponse) ProtoMessage() {}
+
+func (x *InferBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_inference_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InferBatchResponse.ProtoReflect.Descriptor instead.
+func (*InferBatchResponse) Descriptor() ([]byte, []int) {
+	return file_inference_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *InferBatchResponse) GetResponses() []*InferResponse {
+	if x != nil {
+		return x.Responses
+	}
+	return nil
+}
+
+type HealthRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HealthRequest) Reset() {
+	*x = HealthRequest{}
+	mi := &file_inference_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HealthRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthRequest) ProtoMessage() {}
+
+func (x *HealthRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inference_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthRequest.ProtoReflect.Descriptor instead.
+func (*HealthRequest) Descriptor() ([]byte, []int) {
+	return file_inference_proto_rawDescGZIP(), []int{4}
+}
+
+type HealthResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Serving       bool                   `protobuf:"varint,1,opt,name=serving,proto3" json:"serving,omitempty"`
+	Version       string                 `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HealthResponse) Reset() {
+	*x = HealthResponse{}
+	mi := &file_inference_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HealthResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthResponse) ProtoMessage() {}
+
+func (x *HealthResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_inference_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthResponse.ProtoReflect.Descriptor instead.
+func (*HealthResponse) Descriptor() ([]byte, []int) {
+	return file_inference_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *HealthResponse) GetServing() bool {
+	if x != nil {
+		return x.Serving
+	}
+	return false
+}
+
+func (x *HealthResponse) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+var File_inference_proto protoreflect.FileDescriptor
+
+const file_inference_proto_rawDesc = "" +
+	"\n" +
+	"\x0finference.proto\x12\x17easydarwin.inference.v1\"\xb3\x02\n" +
+	"\fInferRequest\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x17\n" +
+	"\atask_id\x18\x02 \x01(\tR\x06taskId\x12\x1b\n" +
+	"\ttask_type\x18\x03 \x01(\tR\btaskType\x12\x1d\n" +
+	"\n" +
+	"image_path\x18\x04 \x01(\tR\timagePath\x12\x1b\n" +
+	"\timage_url\x18\x05 \x01(\tR\bimageUrl\x12(\n" +
+	"\x10algo_config_json\x18\x06 \x01(\tR\x0ealgoConfigJson\x12&\n" +
+	"\x0falgo_config_url\x18\a \x01(\tR\ralgoConfigUrl\x12\x1d\n" +
+	"\n" +
+	"image_data\x18\b \x01(\fR\timageData\x12!\n" +
+	"\fimage_format\x18\t \x01(\tR\vimageFormat\"\xcb\x01\n" +
+	"\rInferResponse\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x18\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x1f\n" +
+	"\vresult_json\x18\x03 \x01(\tR\n" +
+	"resultJson\x12\x1e\n" +
+	"\n" +
+	"confidence\x18\x04 \x01(\x01R\n" +
+	"confidence\x12*\n" +
+	"\x11inference_time_ms\x18\x05 \x01(\x01R\x0finferenceTimeMs\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\"V\n" +
+	"\x11InferBatchRequest\x12A\n" +
+	"\brequests\x18\x01 \x03(\v2%.easydarwin.inference.v1.InferRequestR\brequests\"Z\n" +
+	"\x12InferBatchResponse\x12D\n" +
+	"\tresponses\x18\x01 \x03(\v2&.easydarwin.inference.v1.InferResponseR\tresponses\"\x0f\n" +
+	"\rHealthRequest\"D\n" +
+	"\x0eHealthResponse\x12\x18\n" +
+	"\aserving\x18\x01 \x01(\bR\aserving\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\tR\aversion2\x8e\x03\n" +
+	"\x10InferenceService\x12V\n" +
+	"\x05Infer\x12%.easydarwin.inference.v1.InferRequest\x1a&.easydarwin.inference.v1.InferResponse\x12e\n" +
+	"\n" +
+	"InferBatch\x12*.easydarwin.inference.v1.InferBatchRequest\x1a+.easydarwin.inference.v1.InferBatchResponse\x12`\n" +
+	"\vInferStream\x12%.easydarwin.inference.v1.InferRequest\x1a&.easydarwin.inference.v1.InferResponse(\x010\x01\x12Y\n" +
+	"\x06Health\x12&.easydarwin.inference.v1.HealthRequest\x1a'.easydarwin.inference.v1.HealthResponseB/Z-easydarwin/internal/plugin/aianalysis/inferpbb\x06proto3"
+
+var (
+	file_inference_proto_rawDescOnce sync.Once
+	file_inference_proto_rawDescData []byte
+)
+
+func file_inference_proto_rawDescGZIP() []byte {
+	file_inference_proto_rawDescOnce.Do(func() {
+		file_inference_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_inference_proto_rawDesc), len(file_inference_proto_rawDesc)))
+	})
+	return file_inference_proto_rawDescData
+}
+
+var file_inference_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_inference_proto_goTypes = []any{
+	(*InferRequest)(nil),       // 0: easydarwin.inference.v1.InferRequest
+	(*InferResponse)(nil),      // 1: easydarwin.inference.v1.InferResponse
+	(*InferBatchRequest)(nil),  // 2: easydarwin.inference.v1.InferBatchRequest
+	(*InferBatchResponse)(nil), // 3: easydarwin.inference.v1.InferBatchResponse
+	(*HealthRequest)(nil),      // 4: easydarwin.inference.v1.HealthRequest
+	(*HealthResponse)(nil),     // 5: easydarwin.inference.v1.HealthResponse
+}
+var file_inference_proto_depIdxs = []int32{
+	0, // 0: easydarwin.inference.v1.InferBatchRequest.requests:type_name -> easydarwin.inference.v1.InferRequest
+	1, // 1: easydarwin.inference.v1.InferBatchResponse.responses:type_name -> easydarwin.inference.v1.InferResponse
+	0, // 2: easydarwin.inference.v1.InferenceService.Infer:input_type -> easydarwin.inference.v1.InferRequest
+	2, // 3: easydarwin.inference.v1.InferenceService.InferBatch:input_type -> easydarwin.inference.v1.InferBatchRequest
+	0, // 4: easydarwin.inference.v1.InferenceService.InferStream:input_type -> easydarwin.inference.v1.InferRequest
+	4, // 5: easydarwin.inference.v1.InferenceService.Health:input_type -> easydarwin.inference.v1.HealthRequest
+	1, // 6: easydarwin.inference.v1.InferenceService.Infer:output_type -> easydarwin.inference.v1.InferResponse
+	3, // 7: easydarwin.inference.v1.InferenceService.InferBatch:output_type -> easydarwin.inference.v1.InferBatchResponse
+	1, // 8: easydarwin.inference.v1.InferenceService.InferStream:output_type -> easydarwin.inference.v1.InferResponse
+	5, // 9: easydarwin.inference.v1.InferenceService.Health:output_type -> easydarwin.inference.v1.HealthResponse
+	6, // [6:10] is the sub-list for method output_type
+	2, // [2:6] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_inference_proto_init() }
+func file_inference_proto_init() {
+	if File_inference_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_inference_proto_rawDesc), len(file_inference_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_inference_proto_goTypes,
+		DependencyIndexes: file_inference_proto_depIdxs,
+		MessageInfos:      file_inference_proto_msgTypes,
+	}.Build()
+	File_inference_proto = out.File
+	file_inference_proto_goTypes = nil
+	file_inference_proto_depIdxs = nil
+}
@@ -0,0 +1,281 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/conf"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 负载均衡策略名称
+const (
+	LBWeightedRoundRobin = "weighted_rr"     // 按响应时间加权轮询（默认）
+	LBLeastInFlight      = "least_in_flight" // 选择进行中请求最少的实例
+	LBConsistentHash     = "consistent_hash" // 按 task_id 一致性哈希，同一任务固定到同一实例
+	LBPriority           = "priority"        // 按优先级选择，高优先级实例全部下线后才使用低优先级实例
+
+	consistentHashReplicas = 100 // 一致性哈希每个实例的虚拟节点数
+)
+
+// LBRequest 负载均衡请求信息
+type LBRequest struct {
+	TaskType string
+	TaskID   string
+}
+
+// LBCandidate 负载均衡候选实例
+type LBCandidate struct {
+	Service       *conf.AlgorithmService
+	Weight        int   // 按响应时间计算的权重
+	AvgResponseMs int64 // 平均响应时间
+	HasData       bool  // 是否有响应时间数据
+	InFlight      int   // 进行中的请求数
+	CallCount     int   // 成功调用次数
+}
+
+// LoadBalanceStrategy 负载均衡策略
+// Select 和 Allocation 由注册中心在持有锁的情况下调用，策略内部状态无需额外加锁
+type LoadBalanceStrategy interface {
+	// Name 策略名称
+	Name() string
+
+	// Select 从候选实例中选择一个，返回下标
+	Select(req LBRequest, candidates []LBCandidate) int
+
+	// Allocation 返回各实例的预期分配比例（%），无法预估时返回nil
+	Allocation(candidates []LBCandidate) []float64
+}
+
+// NewLoadBalanceStrategy 按名称创建负载均衡策略，名称为空时使用加权轮询
+func NewLoadBalanceStrategy(name string) (LoadBalanceStrategy, error) {
+	switch name {
+	case "", LBWeightedRoundRobin:
+		return &weightedRoundRobin{counters: make(map[string]int)}, nil
+	case LBLeastInFlight:
+		return &leastInFlight{counters: make(map[string]int)}, nil
+	case LBConsistentHash:
+		return &consistentHash{rings: make(map[string]*hashRing)}, nil
+	case LBPriority:
+		return &priorityFailover{counters: make(map[string]int)}, nil
+	default:
+		return nil, fmt.Errorf("unknown load balance strategy: %s", name)
+	}
+}
+
+// responseTimeWeight 按平均响应时间计算权重：weight = max(1, min(100, 1000 / avgTime))
+// 例如：50ms → 权重20，100ms → 权重10，200ms → 权重5；无数据的新服务默认权重10
+func responseTimeWeight(times []int64) (weight int, avgTime int64, hasData bool) {
+	if len(times) == 0 {
+		return 10, 0, false
+	}
+
+	var sum int64
+	for _, t := range times {
+		sum += t
+	}
+	avgTime = sum / int64(len(times))
+
+	if avgTime <= 0 {
+		return 10, avgTime, true
+	}
+	weight = int(1000 / avgTime)
+	if weight < 1 {
+		weight = 1 // 最小权重1，保证每个服务都能获得请求
+	}
+	if weight > 100 {
+		weight = 100 // 最大权重100，避免极端情况
+	}
+	return weight, avgTime, true
+}
+
+// weightedRoundRobin 加权轮询：响应越快权重越高，同时保证每个实例都能获得请求
+type weightedRoundRobin struct {
+	counters map[string]int // task_type -> current weight counter
+}
+
+func (s *weightedRoundRobin) Name() string { return LBWeightedRoundRobin }
+
+func (s *weightedRoundRobin) Select(req LBRequest, candidates []LBCandidate) int {
+	totalWeight := 0
+	for _, c := range candidates {
+		totalWeight += c.Weight
+	}
+	if totalWeight <= 0 {
+		return 0
+	}
+
+	// 实例增减后总权重会变化，取模保证计数器落在有效区间
+	counter := s.counters[req.TaskType] % totalWeight
+	s.counters[req.TaskType] = (counter + 1) % totalWeight
+
+	cumulative := 0
+	for i, c := range candidates {
+		cumulative += c.Weight
+		if counter < cumulative {
+			return i
+		}
+	}
+	return 0
+}
+
+func (s *weightedRoundRobin) Allocation(candidates []LBCandidate) []float64 {
+	totalWeight := 0
+	for _, c := range candidates {
+		totalWeight += c.Weight
+	}
+	ratios := make([]float64, len(candidates))
+	if totalWeight > 0 {
+		for i, c := range candidates {
+			ratios[i] = float64(c.Weight) / float64(totalWeight) * 100
+		}
+	}
+	return ratios
+}
+
+// leastInFlight 最少进行中请求：适合GPU/CPU混部等处理能力差异大的场景，进行中请求数相同时轮询
+type leastInFlight struct {
+	counters map[string]int // task_type -> round-robin counter（用于打破平局）
+}
+
+func (s *leastInFlight) Name() string { return LBLeastInFlight }
+
+func (s *leastInFlight) Select(req LBRequest, candidates []LBCandidate) int {
+	start := s.counters[req.TaskType] % len(candidates)
+	s.counters[req.TaskType] = (start + 1) % len(candidates)
+
+	selected := start
+	for n := 1; n < len(candidates); n++ {
+		i := (start + n) % len(candidates)
+		if candidates[i].InFlight < candidates[selected].InFlight {
+			selected = i
+		}
+	}
+	return selected
+}
+
+func (s *leastInFlight) Allocation(candidates []LBCandidate) []float64 {
+	return nil
+}
+
+// consistentHash 按 task_id 一致性哈希：同一摄像头的帧始终发往同一实例（有状态跟踪算法），
+// 实例增减时只有少量任务会迁移
+type consistentHash struct {
+	rings map[string]*hashRing // task_type -> 哈希环（实例列表变化时重建）
+}
+
+// hashRing 一致性哈希环
+type hashRing struct {
+	key    string   // 构建哈希环使用的实例列表（endpoint按顺序拼接）
+	hashes []uint32 // 有序虚拟节点哈希值
+	owners []string // 虚拟节点对应的endpoint
+}
+
+func (s *consistentHash) Name() string { return LBConsistentHash }
+
+func (s *consistentHash) Select(req LBRequest, candidates []LBCandidate) int {
+	ring := s.ring(req.TaskType, candidates)
+
+	h := crc32.ChecksumIEEE([]byte(req.TaskID))
+	idx := sort.Search(len(ring.hashes), func(i int) bool { return ring.hashes[i] >= h })
+	if idx == len(ring.hashes) {
+		idx = 0
+	}
+
+	owner := ring.owners[idx]
+	for i, c := range candidates {
+		if c.Service.Endpoint == owner {
+			return i
+		}
+	}
+	return 0
+}
+
+func (s *consistentHash) Allocation(candidates []LBCandidate) []float64 {
+	return nil
+}
+
+// ring 获取任务类型对应的哈希环，实例列表变化时重建
+func (s *consistentHash) ring(taskType string, candidates []LBCandidate) *hashRing {
+	endpoints := make([]string, len(candidates))
+	for i, c := range candidates {
+		endpoints[i] = c.Service.Endpoint
+	}
+	sort.Strings(endpoints)
+	key := strings.Join(endpoints, "|")
+
+	if ring, ok := s.rings[taskType]; ok && ring.key == key {
+		return ring
+	}
+
+	type vnode struct {
+		hash  uint32
+		owner string
+	}
+	vnodes := make([]vnode, 0, len(endpoints)*consistentHashReplicas)
+	for _, endpoint := range endpoints {
+		for i := 0; i < consistentHashReplicas; i++ {
+			vnodes = append(vnodes, vnode{
+				hash:  crc32.ChecksumIEEE([]byte(endpoint + "#" + strconv.Itoa(i))),
+				owner: endpoint,
+			})
+		}
+	}
+	sort.Slice(vnodes, func(i, j int) bool { return vnodes[i].hash < vnodes[j].hash })
+
+	ring := &hashRing{
+		key:    key,
+		hashes: make([]uint32, len(vnodes)),
+		owners: make([]string, len(vnodes)),
+	}
+	for i, v := range vnodes {
+		ring.hashes[i] = v.hash
+		ring.owners[i] = v.owner
+	}
+	s.rings[taskType] = ring
+	return ring
+}
+
+// priorityFailover 优先级/故障转移：只使用优先级最高（Priority数值最小）的实例，
+// 同优先级内轮询，高优先级实例全部下线后自动切换到下一优先级
+type priorityFailover struct {
+	counters map[string]int // task_type -> round-robin counter
+}
+
+func (s *priorityFailover) Name() string { return LBPriority }
+
+func (s *priorityFailover) Select(req LBRequest, candidates []LBCandidate) int {
+	active := priorityGroup(candidates)
+
+	counter := s.counters[req.TaskType] % len(active)
+	s.counters[req.TaskType] = (counter + 1) % len(active)
+	return active[counter]
+}
+
+func (s *priorityFailover) Allocation(candidates []LBCandidate) []float64 {
+	active := priorityGroup(candidates)
+	ratios := make([]float64, len(candidates))
+	for _, i := range active {
+		ratios[i] = 100 / float64(len(active))
+	}
+	return ratios
+}
+
+// priorityGroup 返回优先级最高的实例下标
+func priorityGroup(candidates []LBCandidate) []int {
+	best := candidates[0].Service.Priority
+	for _, c := range candidates[1:] {
+		if c.Service.Priority < best {
+			best = c.Service.Priority
+		}
+	}
+
+	var active []int
+	for i, c := range candidates {
+		if c.Service.Priority == best {
+			active = append(active, i)
+		}
+	}
+	return active
+}
@@ -0,0 +1,173 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/conf"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func newTestRegistry(t *testing.T, services ...conf.AlgorithmService) *AlgorithmRegistry {
+	t.Helper()
+
+	r := NewRegistry(90, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for _, svc := range services {
+		if err := r.Register(svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+func testService(endpoint string, priority int) conf.AlgorithmService {
+	return conf.AlgorithmService{
+		ServiceID: endpoint,
+		Endpoint:  endpoint,
+		TaskTypes: []string{"人数统计"},
+		Priority:  priority,
+	}
+}
+
+func TestWeightedRoundRobinPrefersFastService(t *testing.T) {
+	r := newTestRegistry(t, testService("fast", 0), testService("slow", 0))
+	r.RecordInferenceSuccess("fast", 50, 0)  // 权重20
+	r.RecordInferenceSuccess("slow", 200, 0) // 权重5
+
+	counts := make(map[string]int)
+	for i := 0; i < 250; i++ {
+		counts[r.GetAlgorithmWithLoadBalance("人数统计", "").Endpoint]++
+	}
+	if counts["fast"] != 200 || counts["slow"] != 50 {
+		t.Fatal("unexpected distribution", counts)
+	}
+}
+
+func TestLeastInFlight(t *testing.T) {
+	r := newTestRegistry(t, testService("gpu", 0), testService("cpu", 0))
+	if err := r.SetLoadBalanceStrategy("人数统计", LBLeastInFlight); err != nil {
+		t.Fatal(err)
+	}
+
+	r.BeginInference("cpu")
+	r.BeginInference("cpu")
+	r.BeginInference("gpu")
+	for i := 0; i < 5; i++ {
+		if got := r.GetAlgorithmWithLoadBalance("人数统计", "").Endpoint; got != "gpu" {
+			t.Fatal("expect least in-flight service, got", got)
+		}
+	}
+
+	r.EndInference("cpu", 0)
+	r.EndInference("cpu", 0)
+	if got := r.GetAlgorithmWithLoadBalance("人数统计", "").Endpoint; got != "cpu" {
+		t.Fatal("expect cpu after requests finished, got", got)
+	}
+}
+
+func TestConsistentHashByTaskID(t *testing.T) {
+	r := newTestRegistry(t, testService("a", 0), testService("b", 0), testService("c", 0))
+	if err := r.ConfigureLoadBalance(conf.LoadBalanceConfig{Strategy: LBConsistentHash}); err != nil {
+		t.Fatal(err)
+	}
+
+	owners := make(map[string]string)
+	used := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		taskID := fmt.Sprintf("camera-%d", i)
+		owners[taskID] = r.GetAlgorithmWithLoadBalance("人数统计", taskID).Endpoint
+		used[owners[taskID]] = true
+		for j := 0; j < 3; j++ {
+			if got := r.GetAlgorithmWithLoadBalance("人数统计", taskID).Endpoint; got != owners[taskID] {
+				t.Fatal("task moved between services", taskID, owners[taskID], got)
+			}
+		}
+	}
+	if len(used) != 3 {
+		t.Fatal("expect tasks spread over all services", used)
+	}
+
+	// 移除一个实例后，只有原本属于该实例的任务会迁移
+	if err := r.Unregister("c"); err != nil {
+		t.Fatal(err)
+	}
+	for taskID, owner := range owners {
+		got := r.GetAlgorithmWithLoadBalance("人数统计", taskID).Endpoint
+		if owner != "c" && got != owner {
+			t.Fatal("task on surviving service moved", taskID, owner, got)
+		}
+	}
+}
+
+func TestPriorityFailover(t *testing.T) {
+	r := newTestRegistry(t, testService("primary1", 0), testService("primary2", 0), testService("backup", 1))
+	if err := r.SetLoadBalanceStrategy("", LBPriority); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if got := r.GetAlgorithmWithLoadBalance("人数统计", "").Endpoint; got == "backup" {
+			t.Fatal("backup selected while primaries online")
+		}
+	}
+
+	info := r.GetLoadBalanceInfo("人数统计")
+	if info.Strategy != LBPriority {
+		t.Fatal("unexpected strategy", info.Strategy)
+	}
+	for _, svc := range info.Services {
+		if svc.Endpoint == "backup" && svc.AllocationRatio != 0 {
+			t.Fatal("backup should not receive traffic", svc.AllocationRatio)
+		}
+	}
+
+	r.Unregister("primary1")
+	r.Unregister("primary2")
+	if got := r.GetAlgorithmWithLoadBalance("人数统计", "").Endpoint; got != "backup" {
+		t.Fatal("expect failover to backup, got", got)
+	}
+}
+
+func TestConfigureLoadBalanceInvalid(t *testing.T) {
+	r := newTestRegistry(t)
+	err := r.ConfigureLoadBalance(conf.LoadBalanceConfig{
+		Strategy:  "random",
+		TaskTypes: map[string]string{"人数统计": LBConsistentHash},
+	})
+	if err == nil {
+		t.Fatal("expect error for unknown strategy")
+	}
+
+	defaultStrategy, overrides := r.GetLoadBalanceStrategies()
+	if defaultStrategy != LBWeightedRoundRobin || overrides["人数统计"] != LBConsistentHash {
+		t.Fatal("unexpected strategies", defaultStrategy, overrides)
+	}
+}
+
+func TestLoadBalanceTaskTypeIgnoresCase(t *testing.T) {
+	svc := testService("a", 0)
+	svc.TaskTypes = []string{"PersonCount"}
+	r := newTestRegistry(t, svc)
+
+	// viper 读取配置后 task_types 的键为小写
+	if err := r.ConfigureLoadBalance(conf.LoadBalanceConfig{TaskTypes: map[string]string{"personcount": LBPriority}}); err != nil {
+		t.Fatal(err)
+	}
+	if info := r.GetLoadBalanceInfo("PersonCount"); info.Strategy != LBPriority {
+		t.Fatal("override not applied to task type with capital letters", info.Strategy)
+	}
+
+	// 通过API按原始大小写修改时替换已有覆盖
+	if err := r.SetLoadBalanceStrategy("PersonCount", LBLeastInFlight); err != nil {
+		t.Fatal(err)
+	}
+	if _, overrides := r.GetLoadBalanceStrategies(); len(overrides) != 1 || overrides["PersonCount"] != LBLeastInFlight {
+		t.Fatal("unexpected overrides", overrides)
+	}
+	if err := r.SetLoadBalanceStrategy("PERSONCOUNT", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, overrides := r.GetLoadBalanceStrategies(); len(overrides) != 0 {
+		t.Fatal("override not cleared", overrides)
+	}
+}
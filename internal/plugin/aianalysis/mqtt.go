@@ -0,0 +1,343 @@
+package aianalysis
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data/model"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	mqttProtocolV311 = 4 // MQTT 3.1.1
+	mqttProtocolV5   = 5 // MQTT 5
+
+	defaultMQTTTopic = "alerts/{task_type}/{task_id}"
+)
+
+// MQTTQueue MQTT消息队列实现（支持 MQTT 3.1.1 与 MQTT 5）
+type MQTTQueue struct {
+	address       string
+	topicTemplate string
+	cfg           conf.MQTTConfig
+	log           *slog.Logger
+
+	mu     sync.RWMutex                // 保护 v3/v5/cancel（Close 与发布并发）
+	v3     mqtt.Client                 // MQTT 3.1.1 客户端
+	v5     *autopaho.ConnectionManager // MQTT 5 连接管理器（自动重连）
+	cancel context.CancelFunc          // 关闭 MQTT 5 连接管理器
+}
+
+// NewMQTTQueue 创建MQTT队列
+// topicTemplate 支持 {task_type}、{task_id}、{algorithm_id} 占位符，例如 alerts/{task_type}/{task_id}
+func NewMQTTQueue(address, topicTemplate string, cfg conf.MQTTConfig, logger *slog.Logger) *MQTTQueue {
+	if topicTemplate == "" {
+		topicTemplate = defaultMQTTTopic
+	}
+	if cfg.ProtocolVersion == 0 {
+		cfg.ProtocolVersion = mqttProtocolV311
+	}
+	if cfg.QoS < 0 || cfg.QoS > 2 {
+		cfg.QoS = 0
+	}
+	if cfg.KeepAliveSec <= 0 {
+		cfg.KeepAliveSec = 30
+	}
+	if cfg.ClientID == "" {
+		hostname, _ := os.Hostname()
+		cfg.ClientID = fmt.Sprintf("easydarwin-ai-%s-%d", hostname, time.Now().UnixNano()%100000)
+	}
+
+	return &MQTTQueue{
+		address:       normalizeMQTTAddress(address),
+		topicTemplate: topicTemplate,
+		cfg:           cfg,
+		log:           logger,
+	}
+}
+
+// Connect 连接到MQTT Broker
+func (m *MQTTQueue) Connect() error {
+	tlsCfg, err := m.buildTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	switch m.cfg.ProtocolVersion {
+	case mqttProtocolV311:
+		err = m.connectV3(tlsCfg)
+	case mqttProtocolV5:
+		err = m.connectV5(tlsCfg)
+	default:
+		return fmt.Errorf("unsupported mqtt protocol_version: %d (4=3.1.1, 5=5.0)", m.cfg.ProtocolVersion)
+	}
+	if err != nil {
+		return err
+	}
+
+	m.log.Info("mqtt connected",
+		slog.String("address", m.address),
+		slog.Int("protocol_version", m.cfg.ProtocolVersion),
+		slog.String("client_id", m.cfg.ClientID),
+		slog.String("topic_template", m.topicTemplate),
+		slog.Int("qos", m.cfg.QoS),
+		slog.Bool("retain", m.cfg.Retain))
+	return nil
+}
+
+// connectV3 使用 MQTT 3.1.1 连接（paho.mqtt.golang 内置自动重连）
+func (m *MQTTQueue) connectV3(tlsCfg *tls.Config) error {
+	opts := mqtt.NewClientOptions().
+		AddBroker(m.address).
+		SetClientID(m.cfg.ClientID).
+		SetProtocolVersion(mqttProtocolV311).
+		SetKeepAlive(time.Duration(m.cfg.KeepAliveSec) * time.Second).
+		SetConnectTimeout(5 * time.Second).
+		SetWriteTimeout(10 * time.Second).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(30 * time.Second).
+		SetCleanSession(true).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			m.log.Warn("mqtt connection lost, reconnecting", slog.String("err", err.Error()))
+		})
+	if m.cfg.Username != "" {
+		opts.SetUsername(m.cfg.Username)
+		opts.SetPassword(m.cfg.Password)
+	}
+	if tlsCfg != nil {
+		opts.SetTLSConfig(tlsCfg)
+	}
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(10 * time.Second) {
+		return fmt.Errorf("mqtt connect timeout: %s", m.address)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("mqtt connect failed: %w", err)
+	}
+
+	m.mu.Lock()
+	m.v3 = client
+	m.mu.Unlock()
+	return nil
+}
+
+// connectV5 使用 MQTT 5 连接（autopaho 负责断线重连）
+func (m *MQTTQueue) connectV5(tlsCfg *tls.Config) error {
+	serverURL, err := url.Parse(m.address)
+	if err != nil {
+		return fmt.Errorf("invalid mqtt address %s: %w", m.address, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cliCfg := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{serverURL},
+		TlsCfg:                        tlsCfg,
+		KeepAlive:                     uint16(m.cfg.KeepAliveSec),
+		CleanStartOnInitialConnection: true,
+		ConnectTimeout:                5 * time.Second,
+		ReconnectBackoff: func(attempt int) time.Duration {
+			delay := time.Duration(attempt+1) * time.Second
+			if delay > 30*time.Second {
+				delay = 30 * time.Second
+			}
+			return delay
+		},
+		ConnectUsername: m.cfg.Username,
+		ConnectPassword: []byte(m.cfg.Password),
+		OnConnectError: func(err error) {
+			m.log.Warn("mqtt connect attempt failed", slog.String("err", err.Error()))
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: m.cfg.ClientID,
+			OnClientError: func(err error) {
+				m.log.Warn("mqtt client error", slog.String("err", err.Error()))
+			},
+		},
+	}
+
+	cm, err := autopaho.NewConnection(ctx, cliCfg)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("mqtt connect failed: %w", err)
+	}
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer waitCancel()
+	if err := cm.AwaitConnection(waitCtx); err != nil {
+		cancel()
+		return fmt.Errorf("mqtt connect failed: %w", err)
+	}
+
+	m.mu.Lock()
+	m.v5 = cm
+	m.cancel = cancel
+	m.mu.Unlock()
+	return nil
+}
+
+// PublishAlert 发布告警消息
+func (m *MQTTQueue) PublishAlert(alert model.Alert) error {
+	alertJSON, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	topic := renderMQTTTopic(m.topicTemplate, alert)
+	qos := byte(m.cfg.QoS)
+
+	m.mu.RLock()
+	v3, v5 := m.v3, m.v5
+	m.mu.RUnlock()
+
+	switch {
+	case v3 != nil:
+		token := v3.Publish(topic, qos, m.cfg.Retain, alertJSON)
+		if !token.WaitTimeout(10 * time.Second) {
+			return fmt.Errorf("mqtt publish timeout: %s", topic)
+		}
+		if err := token.Error(); err != nil {
+			return err
+		}
+	case v5 != nil:
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		_, err := v5.Publish(ctx, &paho.Publish{
+			Topic:   topic,
+			QoS:     qos,
+			Retain:  m.cfg.Retain,
+			Payload: alertJSON,
+			Properties: &paho.PublishProperties{
+				ContentType: "application/json",
+				User: paho.UserProperties{
+					{Key: "task_id", Value: alert.TaskID},
+					{Key: "task_type", Value: alert.TaskType},
+					{Key: "algorithm_id", Value: alert.AlgorithmID},
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("mqtt not connected")
+	}
+
+	m.log.Info("alert published to mqtt",
+		slog.Uint64("alert_id", uint64(alert.ID)),
+		slog.String("topic", topic),
+		slog.String("task_id", alert.TaskID),
+		slog.String("task_type", alert.TaskType),
+		slog.Int("detection_count", alert.DetectionCount))
+
+	return nil
+}
+
+// Close 关闭MQTT连接
+func (m *MQTTQueue) Close() error {
+	m.mu.Lock()
+	v3, v5, stop := m.v3, m.v5, m.cancel
+	m.v3, m.v5, m.cancel = nil, nil, nil
+	m.mu.Unlock()
+
+	if v3 != nil {
+		v3.Disconnect(250)
+	}
+	if v5 != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		err := v5.Disconnect(ctx)
+		stop()
+		return err
+	}
+	return nil
+}
+
+// buildTLSConfig 根据地址协议和证书配置构建TLS配置（非TLS地址返回nil）
+func (m *MQTTQueue) buildTLSConfig() (*tls.Config, error) {
+	if !isMQTTTLSAddress(m.address) {
+		return nil, nil
+	}
+
+	tlsCfg := &tls.Config{
+		InsecureSkipVerify: m.cfg.InsecureSkipVerify,
+	}
+
+	if m.cfg.CAFile != "" {
+		caPEM, err := os.ReadFile(m.cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read mqtt ca_file failed: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("invalid mqtt ca_file: %s", m.cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if m.cfg.CertFile != "" || m.cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(m.cfg.CertFile, m.cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load mqtt client certificate failed: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
+
+// normalizeMQTTAddress 未指定协议时默认使用 tcp://
+func normalizeMQTTAddress(address string) string {
+	if address == "" || strings.Contains(address, "://") {
+		return address
+	}
+	return "tcp://" + address
+}
+
+// isMQTTTLSAddress 判断地址是否为TLS连接
+func isMQTTTLSAddress(address string) bool {
+	for _, scheme := range []string{"ssl://", "tls://", "mqtts://", "wss://"} {
+		if strings.HasPrefix(address, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// mqttTopicEscaper 替换主题中的层级分隔符和通配符，避免任务ID等字段破坏主题结构
+var mqttTopicEscaper = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// renderMQTTTopic 按告警信息渲染主题模板
+func renderMQTTTopic(template string, alert model.Alert) string {
+	return renderAlertTemplate(template, alert, mqttTopicEscaper)
+}
+
+// renderAlertTemplate 用告警的 task_type/task_id/algorithm_id 替换模板占位符，空值渲染为 unknown
+func renderAlertTemplate(template string, alert model.Alert, escaper *strings.Replacer) string {
+	field := func(v string) string {
+		if v == "" {
+			return "unknown"
+		}
+		return escaper.Replace(v)
+	}
+
+	return strings.NewReplacer(
+		"{task_type}", field(alert.TaskType),
+		"{task_id}", field(alert.TaskID),
+		"{algorithm_id}", field(alert.AlgorithmID),
+	).Replace(template)
+}
@@ -0,0 +1,125 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data/model"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+)
+
+// startTestBroker 启动进程内MQTT Broker，返回监听地址
+func startTestBroker(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	server := mochi.New(&mochi.Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err := server.AddHook(new(auth.Hook), &auth.Options{
+		Ledger: &auth.Ledger{
+			Auth: auth.AuthRules{
+				{Username: "alert", Password: "secret", Allow: true},
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.AddListener(listeners.NewTCP(listeners.Config{ID: "t1", Address: addr})); err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+
+	return addr
+}
+
+func TestRenderMQTTTopic(t *testing.T) {
+	alert := model.Alert{TaskID: "cam/01", TaskType: "区域入侵", AlgorithmID: "algo+1"}
+	topic := renderMQTTTopic("alerts/{task_type}/{task_id}/{algorithm_id}", alert)
+	if topic != "alerts/区域入侵/cam_01/algo_1" {
+		t.Fatal("unexpected topic", topic)
+	}
+	if topic := renderMQTTTopic("alerts/{task_id}", model.Alert{}); topic != "alerts/unknown" {
+		t.Fatal("unexpected topic", topic)
+	}
+}
+
+func TestMQTTQueuePublish(t *testing.T) {
+	addr := startTestBroker(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for _, version := range []int{mqttProtocolV311, mqttProtocolV5} {
+		q := NewMQTTQueue(addr, "alerts/{task_type}/{task_id}", conf.MQTTConfig{
+			ProtocolVersion: version,
+			Username:        "alert",
+			Password:        "secret",
+			QoS:             1,
+			Retain:          true,
+		}, logger)
+		if err := q.Connect(); err != nil {
+			t.Fatal("connect", version, err)
+		}
+
+		taskID := "task" + string(rune('0'+version))
+		alert := model.Alert{ID: 7, TaskID: taskID, TaskType: "intrusion", DetectionCount: 2}
+		if err := q.PublishAlert(alert); err != nil {
+			t.Fatal("publish", version, err)
+		}
+		if err := q.Close(); err != nil {
+			t.Fatal("close", version, err)
+		}
+
+		// 发布之后才订阅，只有retained消息才能被收到
+		received := make(chan mqtt.Message, 1)
+		sub := mqtt.NewClient(mqtt.NewClientOptions().
+			AddBroker("tcp://" + addr).
+			SetClientID("subscriber").
+			SetUsername("alert").
+			SetPassword("secret"))
+		if token := sub.Connect(); !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+			t.Fatal("subscriber connect", token.Error())
+		}
+		sub.Subscribe("alerts/intrusion/"+taskID, 1, func(_ mqtt.Client, msg mqtt.Message) {
+			received <- msg
+		})
+
+		select {
+		case msg := <-received:
+			if !msg.Retained() {
+				t.Fatal("expect retained message", version)
+			}
+			var got model.Alert
+			if err := json.Unmarshal(msg.Payload(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != 7 || got.TaskID != taskID || got.DetectionCount != 2 {
+				t.Fatal("unexpected payload", string(msg.Payload()))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("retained alert not received", version)
+		}
+		sub.Disconnect(100)
+	}
+}
+
+func TestMQTTQueueAuthFailed(t *testing.T) {
+	addr := startTestBroker(t)
+	q := NewMQTTQueue(addr, "", conf.MQTTConfig{Username: "alert", Password: "wrong"}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := q.Connect(); err == nil {
+		q.Close()
+		t.Fatal("expect connect error with wrong password")
+	}
+}
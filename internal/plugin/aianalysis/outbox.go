@@ -0,0 +1,332 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	outboxDrainBatch    = 100             // 每轮最多投递的记录数
+	outboxRetryInterval = 5 * time.Second // 投递失败后的重试间隔
+)
+
+// OutboxQueue 带本地发件箱的消息队列
+// 告警落库后写入数据库发件箱，再由后台协程按写入顺序投递到实际的消息队列，
+// 投递成功后才删除记录（至少一次语义），进程重启后自动补发未投递的告警
+type OutboxQueue struct {
+	inner   MessageQueue
+	maxSize int           // 发件箱最大记录数，0表示不限制
+	maxAge  time.Duration // 记录最长保留时间，0表示不限制
+	log     *slog.Logger
+
+	notify    chan struct{}
+	stopCh    chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	// 发件箱记录数缓存（首次写入时从数据库加载），避免每次写入都统计数量
+	enqueueMu   sync.Mutex
+	depth       int64
+	depthLoaded bool
+
+	mu          sync.Mutex
+	started     bool // 实际的消息队列已连接过（之后由其自行重连）
+	connected   bool // 最近一次连接或投递是否成功
+	delivered   int64
+	dropped     int64 // 超过容量被丢弃
+	expired     int64 // 超过保留时间被丢弃
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// OutboxStats 发件箱统计
+type OutboxStats struct {
+	Connected       bool       `json:"connected"`         // 消息队列是否已连接
+	Depth           int64      `json:"depth"`             // 待投递数量
+	OldestCreatedAt *time.Time `json:"oldest_created_at"` // 最早一条未投递告警的写入时间
+	OldestAgeSec    float64    `json:"oldest_age_sec"`    // 最早一条未投递告警已等待的时长（秒）
+	Delivered       int64      `json:"delivered"`         // 本次运行累计投递数
+	Dropped         int64      `json:"dropped"`           // 超过容量被丢弃数
+	Expired         int64      `json:"expired"`           // 超过保留时间被丢弃数
+	MaxSize         int        `json:"max_size"`
+	MaxAgeHours     float64    `json:"max_age_hours"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time `json:"last_error_at,omitempty"`
+}
+
+// NewOutboxQueue 创建带发件箱的消息队列
+func NewOutboxQueue(inner MessageQueue, maxSize int, maxAge time.Duration, logger *slog.Logger) *OutboxQueue {
+	return &OutboxQueue{
+		inner:   inner,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		log:     logger,
+		notify:  make(chan struct{}, 1),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// Connect 连接实际的消息队列并启动投递协程
+// 连接失败时仍启动投递协程，由其持续重连，告警在此期间暂存于发件箱
+func (o *OutboxQueue) Connect() error {
+	err := o.inner.Connect()
+	o.mu.Lock()
+	o.started = err == nil
+	o.connected = err == nil
+	if err != nil {
+		o.recordError(err)
+	}
+	o.mu.Unlock()
+
+	o.wg.Add(1)
+	go o.drainLoop()
+
+	// 补发上次运行遗留的告警
+	o.wake()
+	return err
+}
+
+// PublishAlert 将告警写入发件箱，由后台协程投递
+func (o *OutboxQueue) PublishAlert(alert model.Alert) error {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	o.enqueueMu.Lock()
+	if !o.depthLoaded {
+		if o.depth, _, err = data.GetOutboxBacklog(); err != nil {
+			o.enqueueMu.Unlock()
+			return err
+		}
+		o.depthLoaded = true
+	}
+	trim := 0
+	if o.maxSize > 0 && o.depth >= int64(o.maxSize) {
+		trim = int(o.depth) - o.maxSize + 1
+	}
+	dropped, err := data.EnqueueOutbox(&model.AlertOutbox{
+		AlertID: alert.ID,
+		TaskID:  alert.TaskID,
+		Payload: string(payload),
+	}, trim)
+	if err == nil {
+		o.depth += 1 - int64(dropped)
+	}
+	o.enqueueMu.Unlock()
+	if err != nil {
+		return err
+	}
+	if dropped > 0 {
+		o.mu.Lock()
+		o.dropped += int64(dropped)
+		o.mu.Unlock()
+		o.log.Warn("alert outbox full, oldest alerts dropped",
+			slog.Int("dropped", dropped),
+			slog.Int("max_size", o.maxSize))
+	}
+
+	o.wake()
+	return nil
+}
+
+// Close 停止投递协程并关闭实际的消息队列，未投递的告警保留在发件箱中等待下次启动补发
+func (o *OutboxQueue) Close() error {
+	var err error
+	o.closeOnce.Do(func() {
+		close(o.stopCh)
+		o.wg.Wait()
+		err = o.inner.Close()
+	})
+	return err
+}
+
+// Stats 获取发件箱统计
+func (o *OutboxQueue) Stats() (OutboxStats, error) {
+	depth, oldest, err := data.GetOutboxBacklog()
+	if err != nil {
+		return OutboxStats{}, err
+	}
+
+	o.mu.Lock()
+	stats := OutboxStats{
+		Connected:   o.connected,
+		Depth:       depth,
+		Delivered:   o.delivered,
+		Dropped:     o.dropped,
+		Expired:     o.expired,
+		MaxSize:     o.maxSize,
+		MaxAgeHours: o.maxAge.Hours(),
+		LastError:   o.lastError,
+	}
+	if !o.lastErrorAt.IsZero() {
+		lastErrorAt := o.lastErrorAt
+		stats.LastErrorAt = &lastErrorAt
+	}
+	o.mu.Unlock()
+
+	if !oldest.IsZero() {
+		stats.OldestCreatedAt = &oldest
+		stats.OldestAgeSec = time.Since(oldest).Seconds()
+	}
+	return stats, nil
+}
+
+// wake 唤醒投递协程
+func (o *OutboxQueue) wake() {
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+// drainLoop 投递循环：收到新告警时立即投递，失败后按固定间隔重试
+func (o *OutboxQueue) drainLoop() {
+	defer o.wg.Done()
+
+	ticker := time.NewTicker(outboxRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-o.stopCh:
+			return
+		case <-o.notify:
+		case <-ticker.C:
+		}
+		o.purgeExpired()
+		o.drain()
+	}
+}
+
+// purgeExpired 丢弃超过保留时间的告警
+func (o *OutboxQueue) purgeExpired() {
+	if o.maxAge <= 0 {
+		return
+	}
+	n, err := data.PurgeOutboxBefore(time.Now().Add(-o.maxAge))
+	if err != nil {
+		o.log.Error("failed to purge expired outbox alerts", slog.String("err", err.Error()))
+		return
+	}
+	if n > 0 {
+		o.adjustDepth(-n)
+		o.mu.Lock()
+		o.expired += n
+		o.mu.Unlock()
+		o.log.Warn("expired alerts dropped from outbox",
+			slog.Int64("count", n),
+			slog.Duration("max_age", o.maxAge))
+	}
+}
+
+// drain 按写入顺序投递发件箱中的告警，遇到失败即停止本轮，保证顺序
+func (o *OutboxQueue) drain() {
+	if !o.ensureConnected() {
+		return
+	}
+
+	for {
+		entries, err := data.ListOutbox(outboxDrainBatch)
+		if err != nil {
+			o.log.Error("failed to load outbox alerts", slog.String("err", err.Error()))
+			return
+		}
+		if len(entries) == 0 {
+			return
+		}
+
+		for _, entry := range entries {
+			select {
+			case <-o.stopCh:
+				return
+			default:
+			}
+
+			var alert model.Alert
+			if err := json.Unmarshal([]byte(entry.Payload), &alert); err != nil {
+				o.log.Error("invalid outbox payload, discarded",
+					slog.Uint64("outbox_id", uint64(entry.ID)),
+					slog.String("err", err.Error()))
+				o.remove(entry.ID)
+				continue
+			}
+
+			if err := o.inner.PublishAlert(alert); err != nil {
+				o.mu.Lock()
+				o.connected = false
+				o.recordError(err)
+				o.mu.Unlock()
+				if err := data.MarkOutboxFailed(entry.ID, err.Error()); err != nil {
+					o.log.Error("failed to update outbox entry", slog.String("err", err.Error()))
+				}
+				o.log.Warn("failed to deliver outbox alert, will retry",
+					slog.Uint64("outbox_id", uint64(entry.ID)),
+					slog.Uint64("alert_id", uint64(alert.ID)),
+					slog.Int("attempts", entry.Attempts+1),
+					slog.String("err", err.Error()))
+				return
+			}
+
+			o.mu.Lock()
+			o.connected = true
+			o.delivered++
+			o.mu.Unlock()
+			o.remove(entry.ID)
+		}
+	}
+}
+
+// ensureConnected 从未连接成功时尝试连接实际的消息队列
+// 连接成功过之后由实际的消息队列自行重连，这里直接尝试投递，投递结果更新连接状态
+func (o *OutboxQueue) ensureConnected() bool {
+	o.mu.Lock()
+	started := o.started
+	o.mu.Unlock()
+	if started {
+		return true
+	}
+
+	err := o.inner.Connect()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err != nil {
+		o.recordError(err)
+		return false
+	}
+	o.started = true
+	o.connected = true
+	o.log.Info("message queue connected, draining alert outbox")
+	return true
+}
+
+// remove 删除已处理的记录（删除失败时该记录会被重复投递）
+func (o *OutboxQueue) remove(id uint) {
+	if err := data.DeleteOutbox(id); err != nil {
+		o.log.Error("failed to delete outbox entry",
+			slog.Uint64("outbox_id", uint64(id)),
+			slog.String("err", err.Error()))
+		return
+	}
+	o.adjustDepth(-1)
+}
+
+// adjustDepth 更新发件箱记录数缓存
+func (o *OutboxQueue) adjustDepth(delta int64) {
+	o.enqueueMu.Lock()
+	if o.depthLoaded {
+		o.depth = max(o.depth+delta, 0)
+	}
+	o.enqueueMu.Unlock()
+}
+
+// recordError 记录最近一次错误，调用方需持有 o.mu
+func (o *OutboxQueue) recordError(err error) {
+	o.lastError = err.Error()
+	o.lastErrorAt = time.Now()
+}
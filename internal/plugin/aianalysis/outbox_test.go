@@ -0,0 +1,202 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeQueue 可控制成功/失败的消息队列
+type fakeQueue struct {
+	mu        sync.Mutex
+	down      bool
+	published []model.Alert
+}
+
+func (f *fakeQueue) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+func (f *fakeQueue) Connect() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return errors.New("broker unreachable")
+	}
+	return nil
+}
+
+func (f *fakeQueue) PublishAlert(alert model.Alert) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return errors.New("broker unreachable")
+	}
+	f.published = append(f.published, alert)
+	return nil
+}
+
+func (f *fakeQueue) Close() error { return nil }
+
+func (f *fakeQueue) publishedIDs() []uint {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ids := make([]uint, 0, len(f.published))
+	for _, a := range f.published {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
+
+// setupTestDB 使用临时SQLite数据库替换全局数据库
+func setupTestDB(t *testing.T) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := data.DB
+	data.DB = db
+	t.Cleanup(func() { data.DB = prev })
+
+	if err := data.MigrateAlertTable(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutboxQueueReplayInOrder(t *testing.T) {
+	setupTestDB(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	broker := &fakeQueue{down: true}
+	o := NewOutboxQueue(broker, 0, 0, logger)
+	for i := uint(1); i <= 3; i++ {
+		if err := o.PublishAlert(model.Alert{ID: i, TaskID: "task1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	o.drain()
+
+	stats, err := o.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Depth != 3 || stats.Connected || stats.LastError == "" || stats.OldestCreatedAt == nil {
+		t.Fatal("unexpected stats while broker down", stats)
+	}
+
+	// 模拟重启：新的发件箱实例补发上次遗留的告警
+	broker.setDown(false)
+	o = NewOutboxQueue(broker, 0, 0, logger)
+	o.drain()
+
+	ids := broker.publishedIDs()
+	if len(ids) != 3 || ids[0] != 1 || ids[1] != 2 || ids[2] != 3 {
+		t.Fatal("unexpected delivery order", ids)
+	}
+	stats, _ = o.Stats()
+	if stats.Depth != 0 || stats.Delivered != 3 || stats.OldestCreatedAt != nil {
+		t.Fatal("unexpected stats after drain", stats)
+	}
+}
+
+func TestOutboxQueueLimits(t *testing.T) {
+	setupTestDB(t)
+
+	o := NewOutboxQueue(&fakeQueue{down: true}, 2, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for i := uint(1); i <= 3; i++ {
+		if err := o.PublishAlert(model.Alert{ID: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := data.ListOutbox(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].AlertID != 2 {
+		t.Fatal("expect oldest alert dropped", entries)
+	}
+
+	// 超过保留时间的告警被丢弃
+	if err := data.DB.Model(&model.AlertOutbox{}).Where("id = ?", entries[0].ID).
+		Update("created_at", time.Now().Add(-2*time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+	o.purgeExpired()
+
+	stats, err := o.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Depth != 1 || stats.Dropped != 1 || stats.Expired != 1 {
+		t.Fatal("unexpected stats", stats)
+	}
+}
+
+func TestOutboxQueueDrainLoop(t *testing.T) {
+	setupTestDB(t)
+
+	broker := &fakeQueue{}
+	o := NewOutboxQueue(broker, 0, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := o.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	if err := o.PublishAlert(model.Alert{ID: 9}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for len(broker.publishedIDs()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("alert not delivered by drain loop")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestOutboxQueueConnectionState(t *testing.T) {
+	setupTestDB(t)
+
+	broker := &fakeQueue{}
+	o := NewOutboxQueue(broker, 0, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	o.drain() // 首次投递时连接
+
+	// 投递失败后连接状态置为断开，恢复后重新置为已连接
+	broker.setDown(true)
+	if err := o.PublishAlert(model.Alert{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	o.drain()
+	if stats, _ := o.Stats(); stats.Connected || stats.Depth != 1 {
+		t.Fatal("expect disconnected after publish failure", stats)
+	}
+
+	broker.setDown(false)
+	o.drain()
+	if stats, _ := o.Stats(); !stats.Connected || stats.Depth != 0 || o.depth != 0 {
+		t.Fatal("expect connected after delivery", stats, o.depth)
+	}
+
+	// 重复关闭不会panic
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
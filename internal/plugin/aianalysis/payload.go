@@ -0,0 +1,140 @@
+package aianalysis
+
+import (
+	"bytes"
+	"context"
+	"easydarwin/internal/conf"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"path"
+	"strings"
+	"time"
+)
+
+// 图片传输方式（算法服务注册时声明）
+const (
+	ImageModeURL       = "url"       // 发送预签名URL，由算法服务自行下载（默认）
+	ImageModeBase64    = "base64"    // 图片内容base64编码后放在JSON请求体的 image_base64 字段
+	ImageModeMultipart = "multipart" // multipart/form-data：request 字段为JSON请求，image 字段为图片文件
+
+	// inlineImageMaxBytes 内联传输的图片大小上限，超过时拒绝推理
+	inlineImageMaxBytes = 32 << 20
+)
+
+// normalizeImageMode 校验图片传输方式，为空时使用预签名URL
+func normalizeImageMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return ImageModeURL, nil
+	case ImageModeURL, ImageModeBase64, ImageModeMultipart:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported image_mode: %s (supported: url, base64, multipart)", mode)
+	}
+}
+
+// isInlineImageMode 是否由调度器读取图片随请求发送（gRPC协议下统一放在 image_data 字段）
+func isInlineImageMode(mode string) bool {
+	return mode == ImageModeBase64 || mode == ImageModeMultipart
+}
+
+// imageFormat 按扩展名推断图片格式
+func imageFormat(imagePath string) string {
+	switch strings.ToLower(path.Ext(imagePath)) {
+	case ".png":
+		return "png"
+	case ".bmp":
+		return "bmp"
+	default:
+		return "jpeg"
+	}
+}
+
+// loadImage 从对象存储读取图片内容（内联传输模式）
+func (s *Scheduler) loadImage(imagePath string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	obj, err := s.store.Get(ctx, imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("get object failed: %w", err)
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(io.LimitReader(obj, inlineImageMaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read object failed: %w", err)
+	}
+	if len(data) > inlineImageMaxBytes {
+		return nil, fmt.Errorf("image exceeds inline limit of %d bytes", inlineImageMaxBytes)
+	}
+	return data, nil
+}
+
+// buildHTTPInferenceBody 按图片传输方式构建HTTP推理请求体，返回请求体和Content-Type
+func buildHTTPInferenceBody(mode string, req conf.InferenceRequest) ([]byte, string, error) {
+	switch mode {
+	case ImageModeBase64:
+		req.ImageBase64 = base64.StdEncoding.EncodeToString(req.ImageData)
+	case ImageModeMultipart:
+		return buildMultipartInferenceBody(req)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("marshal request failed: %w", err)
+	}
+	return body, "application/json", nil
+}
+
+// buildMultipartInferenceBody 构建multipart推理请求：request 字段为JSON请求（不含图片），image 字段为图片文件
+func buildMultipartInferenceBody(req conf.InferenceRequest) ([]byte, string, error) {
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("marshal request failed: %w", err)
+	}
+	return buildMultipartBody(reqJSON, []conf.InferenceRequest{req})
+}
+
+// buildMultipartBody 构建multipart请求体：request 字段为JSON，随后按请求顺序附带 image 文件
+func buildMultipartBody(reqJSON []byte, reqs []conf.InferenceRequest) ([]byte, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="request"`},
+		"Content-Type":        {"application/json"},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := part.Write(reqJSON); err != nil {
+		return nil, "", err
+	}
+
+	for _, req := range reqs {
+		format := req.ImageFormat
+		if format == "" {
+			format = imageFormat(req.ImagePath)
+		}
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Disposition": {fmt.Sprintf(`form-data; name="image"; filename=%q`, path.Base(req.ImagePath))},
+			"Content-Type":        {"image/" + format},
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write(req.ImageData); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
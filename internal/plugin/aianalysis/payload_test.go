@@ -0,0 +1,123 @@
+package aianalysis
+
+import (
+	"bytes"
+	"easydarwin/internal/conf"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testInlineRequest() conf.InferenceRequest {
+	return conf.InferenceRequest{
+		TaskID:      "cam1",
+		TaskType:    "人数统计",
+		ImagePath:   "人数统计/cam1/20250115-150001.123.jpg",
+		AlgoConfig:  map[string]interface{}{"threshold": 0.5},
+		ImageData:   []byte{0xff, 0xd8, 0xff, 0xe0, 0x00},
+		ImageFormat: "jpeg",
+	}
+}
+
+func TestNormalizeImageMode(t *testing.T) {
+	if mode, err := normalizeImageMode(""); err != nil || mode != ImageModeURL {
+		t.Fatalf("normalizeImageMode(\"\") = %q, %v", mode, err)
+	}
+	if _, err := normalizeImageMode("ftp"); err == nil {
+		t.Fatal("expected error for unknown image mode")
+	}
+}
+
+func TestBuildHTTPInferenceBodyBase64(t *testing.T) {
+	req := testInlineRequest()
+	body, contentType, err := buildHTTPInferenceBody(ImageModeBase64, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/json" {
+		t.Fatalf("content type = %s", contentType)
+	}
+
+	var decoded conf.InferenceRequest
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	data, err := base64.StdEncoding.DecodeString(decoded.ImageBase64)
+	if err != nil || !bytes.Equal(data, req.ImageData) {
+		t.Fatalf("image_base64 = %q, %v", decoded.ImageBase64, err)
+	}
+	if decoded.AlgoConfig["threshold"] != 0.5 || decoded.ImageFormat != "jpeg" {
+		t.Fatalf("unexpected request: %+v", decoded)
+	}
+}
+
+func TestBuildHTTPInferenceBodyURL(t *testing.T) {
+	req := testInlineRequest()
+	req.ImageData = nil
+	req.ImageURL = "http://minio/bucket/a.jpg?sig=x"
+	body, _, err := buildHTTPInferenceBody(ImageModeURL, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), "image_base64") {
+		t.Fatalf("url mode should not carry image content: %s", body)
+	}
+}
+
+func TestCallAlgorithmMultipart(t *testing.T) {
+	req := testInlineRequest()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "multipart/form-data" {
+			http.Error(w, "expected multipart", http.StatusBadRequest)
+			return
+		}
+
+		var meta conf.InferenceRequest
+		var image []byte
+		reader := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			content, _ := io.ReadAll(part)
+			switch part.FormName() {
+			case "request":
+				json.Unmarshal(content, &meta)
+			case "image":
+				if part.FileName() != "20250115-150001.123.jpg" || part.Header.Get("Content-Type") != "image/jpeg" {
+					http.Error(w, "bad image part", http.StatusBadRequest)
+					return
+				}
+				image = content
+			}
+		}
+
+		json.NewEncoder(w).Encode(conf.InferenceResponse{
+			Success: meta.TaskID == "cam1" && bytes.Equal(image, req.ImageData) && meta.AlgoConfig != nil,
+		})
+	}))
+	defer server.Close()
+
+	s := &Scheduler{httpClient: server.Client(), log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	resp, err := s.callAlgorithm(conf.AlgorithmService{Endpoint: server.URL, ImageMode: ImageModeMultipart}, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success {
+		t.Fatal("algorithm did not receive the inline image and config")
+	}
+}
@@ -0,0 +1,105 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/data/model"
+	"easydarwin/utils/plugin/core/msgpush"
+	"log/slog"
+	"slices"
+)
+
+// 实时推送的事件类型
+const (
+	PushEventAlert        = "alert"         // 告警落库
+	PushEventAlertUpdated = "alert_updated" // 重复命中合并后告警的 hit_count / last_seen_at 更新
+	PushEventSystemAlert  = "system_alert"  // 系统告警（队列积压、熔断等）
+)
+
+// AlertStreamFilter 实时推送连接的过滤条件，为空的条件不过滤
+type AlertStreamFilter struct {
+	Events        []string // 推送的事件类型，为空时推送全部
+	TaskIDs       []string // 只推送这些任务的告警
+	TaskTypes     []string // 只推送这些任务类型的告警
+	MinDetections int      // 只推送检测个数不少于N的告警
+}
+
+// Match 判断事件是否推送给该连接，任务条件只作用于告警事件
+func (f AlertStreamFilter) Match(ev msgpush.Event) bool {
+	if len(f.Events) > 0 && !slices.Contains(f.Events, ev.Event) {
+		return false
+	}
+	alert, ok := ev.Payload.(*model.Alert)
+	if !ok {
+		return true
+	}
+	if len(f.TaskIDs) > 0 && !slices.Contains(f.TaskIDs, alert.TaskID) {
+		return false
+	}
+	if len(f.TaskTypes) > 0 && !slices.Contains(f.TaskTypes, alert.TaskType) {
+		return false
+	}
+	return alert.DetectionCount >= f.MinDetections
+}
+
+// onAlertsCreated 告警落库后推送到消息队列、实时推送并通知告警回调（附带图片预签名URL）
+func (s *Service) onAlertsCreated(alerts []*model.Alert) {
+	for _, alert := range alerts {
+		s.publishAlert(PushEventAlert, webhookEventAlert, alert)
+	}
+	// 片段已上传的告警写入片段路径并推送更新
+	if s.clipRecorder != nil {
+		s.clipRecorder.AlertsCreated(alerts)
+	}
+}
+
+// onAlertRollup 重复命中合并写回后推送告警更新：消息队列中为同一告警ID的完整告警（hit_count / last_seen_at 已更新），
+// 实时推送和告警回调的事件类型为 alert_updated
+func (s *Service) onAlertRollup(alert *model.Alert) {
+	s.publishAlert(PushEventAlertUpdated, webhookEventAlertUpdated, alert)
+}
+
+// onAlertClipSaved 告警视频片段上传并写入告警后推送告警更新（clip_path 已更新），事件类型为 alert_updated
+func (s *Service) onAlertClipSaved(alert *model.Alert) {
+	s.publishAlert(PushEventAlertUpdated, webhookEventAlertUpdated, alert)
+}
+
+func (s *Service) publishAlert(pushEvent, webhookEvent string, alert *model.Alert) {
+	// 落库后再写入发件箱，发件箱记录和消息中的告警ID才有效
+	if s.mq != nil {
+		if err := s.mq.PublishAlert(*alert); err != nil {
+			s.log.Error("failed to publish alert to MQ",
+				slog.Uint64("alert_id", uint64(alert.ID)),
+				slog.String("task_id", alert.TaskID),
+				slog.String("err", err.Error()))
+		}
+	}
+
+	pushed := *alert
+	if pushed.ImageURL == "" && pushed.ImagePath != "" && s.scheduler != nil {
+		if url, err := s.scheduler.generatePresignedURL(pushed.ImagePath); err == nil {
+			pushed.ImageURL = url
+		}
+	}
+	if err := s.alertPush.Publish(pushEvent, &pushed); err != nil {
+		s.log.Error("failed to push alert", slog.Uint64("alert_id", uint64(alert.ID)), slog.String("err", err.Error()))
+	}
+	if s.webhookNotifier != nil {
+		s.webhookNotifier.Notify(webhookEvent, &pushed)
+	}
+}
+
+// publishSystemAlert 推送系统告警
+func (s *Service) publishSystemAlert(alert SystemAlert) {
+	if err := s.alertPush.Publish(PushEventSystemAlert, alert); err != nil {
+		s.log.Error("failed to push system alert", slog.String("type", string(alert.Type)), slog.String("err", err.Error()))
+	}
+}
+
+// GetAlertPush 获取告警实时推送（服务未启动时为nil）
+func (s *Service) GetAlertPush() *msgpush.Core {
+	return s.alertPush
+}
+
+// GetAlertPushOrigins 获取除同源外允许打开告警 WebSocket 的来源
+func (s *Service) GetAlertPushOrigins() []string {
+	return s.cfg.Push.AllowedOrigins
+}
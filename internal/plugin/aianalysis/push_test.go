@@ -0,0 +1,60 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/data/model"
+	"easydarwin/utils/plugin/core/msgpush"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestAlertStreamFilter(t *testing.T) {
+	b := msgpush.NewCore(nil)
+	b.SetStreamSize(10, 10)
+	filter := AlertStreamFilter{TaskIDs: []string{"cam1"}, MinDetections: 2}
+	sub := b.Subscribe(0, filter.Match)
+	onlySystem := b.Subscribe(0, AlertStreamFilter{Events: []string{PushEventSystemAlert}}.Match)
+
+	b.Publish(PushEventAlert, &model.Alert{ID: 1, TaskID: "cam1", DetectionCount: 1})
+	b.Publish(PushEventAlert, &model.Alert{ID: 2, TaskID: "cam2", DetectionCount: 3})
+	b.Publish(PushEventAlert, &model.Alert{ID: 3, TaskID: "cam1", DetectionCount: 3})
+	b.Publish(PushEventSystemAlert, SystemAlert{Type: AlertTypeBacklog})
+
+	ev := <-sub.Stream()
+	var alert model.Alert
+	if err := json.Unmarshal(ev.Data, &alert); err != nil || ev.Event != PushEventAlert || alert.ID != 3 {
+		t.Fatalf("unexpected alert event: %s %s", ev.Event, ev.Data)
+	}
+	if ev := <-sub.Stream(); ev.Event != PushEventSystemAlert {
+		t.Fatalf("system alerts should not be filtered by task, got %+v", ev)
+	}
+	if len(onlySystem.Stream()) != 1 {
+		t.Fatalf("events filter delivered %d events, want 1", len(onlySystem.Stream()))
+	}
+
+	// 断线续传同样按连接的条件过滤
+	resumed := b.Subscribe(1, filter.Match)
+	if len(resumed.Stream()) != 2 {
+		t.Fatalf("resumed %d events, want 2", len(resumed.Stream()))
+	}
+}
+
+func TestSystemAlertCallbackOutsideLock(t *testing.T) {
+	setupTestDB(t)
+	am := NewAlertManager(10, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	done := make(chan int, 1)
+	// 回调中查询告警管理器不能死锁
+	am.SetOnAlertCallback(func(SystemAlert) { done <- len(am.GetRecentAlerts(10)) })
+
+	go am.SendAlert(SystemAlert{Type: AlertTypeBacklog, Level: LevelWarning, Message: "backlog"})
+	select {
+	case n := <-done:
+		if n != 1 {
+			t.Fatalf("recent alerts = %d, want 1", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("system alert callback deadlocked")
+	}
+}
@@ -2,13 +2,19 @@ package aianalysis
 
 import (
 	"context"
+	"easydarwin/internal/conf"
+	"easydarwin/utils/pkg/objstore"
 	"log/slog"
 	"path/filepath"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
+)
 
-	"github.com/minio/minio-go/v7"
+const (
+	taskStatsIdleTTL       = time.Hour   // 子队列清空后按任务的统计保留时长（期间没有入队、出队或丢弃）
+	taskStatsPruneInterval = time.Minute // 清理空闲任务统计的间隔
 )
 
 // QueueStrategy 队列策略
@@ -20,34 +26,65 @@ const (
 	StrategyLatestOnly QueueStrategy = "latest_only" // 只保留最新的N张
 )
 
-// InferenceQueue 智能推理队列（使用Channel+Map+原子计数器混合方案）
+// InferenceQueue 智能推理队列：每个任务一个子队列，高优先级任务先出队，
+// 同一优先级内按权重加权公平排队（虚拟时间），避免高帧率任务占满推理能力。
+// 队列满时按策略丢弃最低优先级中积压最多的任务的图片，任务积压超过上限时丢弃该任务的图片
 type InferenceQueue struct {
-	// Channel作为主队列（无锁Pop）
-	ch chan ImageInfo
-	
-	// Map用于快速查找（用于Contains、Remove、GetImagePaths）
-	imageSet    map[string]bool // 用于快速检查图片是否已在队列中（path -> bool）
-	imageSetMu  sync.RWMutex    // 保护imageSet
-	
-	// 已删除标记（用于Remove操作）
-	deletedSet    map[string]bool // 标记为已删除的图片路径
-	deletedSetMu  sync.RWMutex    // 保护deletedSet
-	
-	// 原子计数器（用于Size统计）
-	sizeCounter int64 // 队列大小计数器（原子操作）
-	
-	maxSize          int
-	strategy         QueueStrategy
-	droppedCount     int64
-	processedCount   int64 // 已处理的图片数量（包括成功和失败的推理）
-	lastAlertTime    time.Time
-	alertThreshold   int
-	alertInterval    time.Duration
-	log              *slog.Logger
-	alertCallback    func(AlertInfo)
-	minio            *minio.Client // MinIO客户端
-	bucket           string         // MinIO bucket
-	deleteDropped    bool           // 是否删除丢弃的图片
+	mu     sync.Mutex
+	tasks  map[string]*taskQueue    // 任务ID -> 子队列（清空后移除，任务停止后不再占用内存）
+	stats  map[string]*taskCounters // 任务ID -> 累计统计（子队列清空后保留，空闲超过 taskStatsIdleTTL 后移除）
+	index  map[string]string        // 图片路径 -> 任务ID（用于去重、Contains、Remove）
+	size   int                      // 所有子队列的图片总数
+	clocks map[int]float64          // 各优先级的虚拟时钟（最近一次出队的虚拟时间）
+
+	maxSize        int
+	maxTaskBacklog int                               // 每个任务最多排队的图片数，0表示不限制
+	rules          map[string]conf.QueuePriorityRule // 按任务类型的调度规则
+	strategy       QueueStrategy
+	droppedCount   int64
+	processedCount int64 // 已处理的图片数量（包括成功和失败的推理）
+	lastAlertTime  time.Time
+	lastPrune      time.Time
+	alertThreshold int
+	alertInterval  time.Duration
+	log            *slog.Logger
+	alertCallback  func(AlertInfo)
+	store          objstore.Store // 对象存储
+	deleteDropped  bool           // 是否删除丢弃的图片
+}
+
+// taskQueue 单个任务的子队列
+type taskQueue struct {
+	taskID     string
+	taskType   string
+	items      []ImageInfo
+	priority   int
+	weight     int
+	maxBacklog int
+	vtime      float64 // 队首图片的虚拟开始时间，每出队一张增加 1/weight
+	stats      *taskCounters
+}
+
+// taskCounters 单个任务的累计统计
+type taskCounters struct {
+	taskType   string
+	enqueued   int64
+	dispatched int64
+	dropped    int64
+	lastActive time.Time
+}
+
+// TaskQueueStats 单个任务的队列统计
+type TaskQueueStats struct {
+	TaskID     string `json:"task_id"`
+	TaskType   string `json:"task_type"`
+	Priority   int    `json:"priority"`
+	Weight     int    `json:"weight"`
+	MaxBacklog int    `json:"max_backlog"` // 0表示不限制
+	Queued     int    `json:"queued"`      // 当前排队的图片数
+	Enqueued   int64  `json:"enqueued"`    // 累计入队
+	Dispatched int64  `json:"dispatched"`  // 累计出队推理
+	Dropped    int64  `json:"dropped"`     // 累计丢弃
 }
 
 // AlertInfo 告警信息
@@ -60,28 +97,27 @@ type AlertInfo struct {
 	Timestamp time.Time
 }
 
-// NewInferenceQueue 创建智能队列（使用Channel+Map+原子计数器）
-func NewInferenceQueue(maxSize int, strategy QueueStrategy, alertThreshold int, minioClient *minio.Client, bucket string, deleteDropped bool, logger *slog.Logger) *InferenceQueue {
+// NewInferenceQueue 创建智能队列
+func NewInferenceQueue(maxSize int, strategy QueueStrategy, alertThreshold int, store objstore.Store, deleteDropped bool, logger *slog.Logger) *InferenceQueue {
 	if maxSize <= 0 {
 		maxSize = 100
 	}
 	if alertThreshold <= 0 {
 		alertThreshold = maxSize / 2
 	}
-	
+
 	return &InferenceQueue{
-		ch:            make(chan ImageInfo, maxSize), // buffered channel，容量=maxSize
-		imageSet:      make(map[string]bool),
-		deletedSet:    make(map[string]bool),
-		sizeCounter:   0,
-		maxSize:       maxSize,
-		strategy:      strategy,
+		tasks:          make(map[string]*taskQueue),
+		stats:          make(map[string]*taskCounters),
+		index:          make(map[string]string),
+		clocks:         make(map[int]float64),
+		maxSize:        maxSize,
+		strategy:       strategy,
 		alertThreshold: alertThreshold,
-		alertInterval: 60 * time.Second,
-		log:           logger,
-		minio:         minioClient,
-		bucket:        bucket,
-		deleteDropped: deleteDropped,
+		alertInterval:  60 * time.Second,
+		log:            logger,
+		store:          store,
+		deleteDropped:  deleteDropped,
 	}
 }
 
@@ -90,120 +126,113 @@ func (q *InferenceQueue) SetAlertCallback(callback func(AlertInfo)) {
 	q.alertCallback = callback
 }
 
-// Add 添加图片到队列（使用Channel+Map）
+// SetScheduling 设置按任务的调度规则（优先级、权重、积压上限），对已有子队列立即生效
+func (q *InferenceQueue) SetScheduling(cfg conf.InferenceQueueConfig) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.maxTaskBacklog = max(cfg.MaxTaskBacklog, 0)
+	q.rules = cfg.TaskTypes
+	for _, tq := range q.tasks {
+		q.applyRule(tq)
+		if len(tq.items) > 0 {
+			tq.vtime = max(tq.vtime, q.clocks[tq.priority])
+		}
+	}
+}
+
+// applyRule 按任务类型设置子队列的优先级、权重和积压上限（任务类型忽略大小写匹配）
+func (q *InferenceQueue) applyRule(tq *taskQueue) {
+	rule, _ := conf.LookupTaskType(q.rules, tq.taskType)
+	tq.priority = rule.Priority
+	tq.weight = rule.Weight
+	if tq.weight <= 0 {
+		tq.weight = 1
+	}
+	tq.maxBacklog = rule.MaxBacklog
+	if tq.maxBacklog <= 0 {
+		tq.maxBacklog = q.maxTaskBacklog
+	}
+}
+
+// taskQueue 获取图片所属任务的子队列，不存在时创建
+func (q *InferenceQueue) taskQueue(img ImageInfo) *taskQueue {
+	tq, ok := q.tasks[img.TaskID]
+	if !ok {
+		stats, ok := q.stats[img.TaskID]
+		if !ok {
+			stats = &taskCounters{}
+			q.stats[img.TaskID] = stats
+		}
+		stats.taskType = img.TaskType
+		tq = &taskQueue{taskID: img.TaskID, taskType: img.TaskType, stats: stats}
+		q.applyRule(tq)
+		q.tasks[img.TaskID] = tq
+	}
+	return tq
+}
+
+// release 子队列清空后移除（按任务的统计保留），再次有图片时重新创建，
+// 虚拟时间从当前优先级的时钟开始，与保留空子队列时的调度结果相同（调用方需持有锁）
+func (q *InferenceQueue) release(tq *taskQueue) {
+	if len(tq.items) == 0 {
+		delete(q.tasks, tq.taskID)
+	}
+}
+
+// Add 添加图片到所属任务的子队列，返回成功加入的数量
 func (q *InferenceQueue) Add(images []ImageInfo) int {
 	added := 0
 	duplicateCount := 0
-	
+
+	q.mu.Lock()
+	q.pruneStats(time.Now())
 	for _, img := range images {
 		// 规范化路径格式（确保与MinIO key格式一致）
 		normalizedPath := filepath.ToSlash(img.Path)
-		
-		// 检查图片是否已在队列中（去重）- 使用Map
-		q.imageSetMu.RLock()
-		if q.imageSet[normalizedPath] {
-			q.imageSetMu.RUnlock()
+
+		// 检查图片是否已在队列中（去重）
+		if _, ok := q.index[normalizedPath]; ok {
 			duplicateCount++
 			continue
 		}
-		q.imageSetMu.RUnlock()
-		
-		// 检查队列是否已满（使用原子计数器）
-		currentSize := atomic.LoadInt64(&q.sizeCounter)
-		if int(currentSize) >= q.maxSize {
-			switch q.strategy {
-			case StrategyDropOldest:
-				// 丢弃最旧的：从Channel中Pop一个（非阻塞）
-				select {
-				case dropped := <-q.ch:
-					// 从imageSet中移除
-					normalizedDroppedPath := filepath.ToSlash(dropped.Path)
-					q.imageSetMu.Lock()
-					delete(q.imageSet, normalizedDroppedPath)
-					q.imageSetMu.Unlock()
-					atomic.AddInt64(&q.sizeCounter, -1)
-					atomic.AddInt64(&q.droppedCount, 1)
-					
-					// 删除MinIO中的图片
-					if q.deleteDropped {
-						q.deleteImageFromMinIO(dropped)
-					}
-					
-					q.log.Warn("queue full, dropped oldest image",
-						slog.String("task_type", dropped.TaskType),
-						slog.String("task_id", dropped.TaskID),
-						slog.String("image", dropped.Filename),
-						slog.Int64("queue_size", atomic.LoadInt64(&q.sizeCounter)),
-						slog.Int64("total_dropped", atomic.LoadInt64(&q.droppedCount)))
-				default:
-					// Channel为空，直接添加
-				}
-				
-			case StrategyDropNewest:
-				// 丢弃新的（不加入）
-				atomic.AddInt64(&q.droppedCount, 1)
-				
-				// 删除MinIO中的图片
-				if q.deleteDropped {
-					q.deleteImageFromMinIO(img)
-				}
-				
-				q.log.Warn("queue full, dropped newest image",
-					slog.String("image", img.Filename))
+
+		tq := q.taskQueue(img)
+
+		// 任务积压超过上限：按策略丢弃该任务的图片
+		if tq.maxBacklog > 0 && len(tq.items) >= tq.maxBacklog {
+			if !q.evict(tq, tq, img, "task backlog full") {
+				q.release(tq)
 				continue
-				
-			case StrategyLatestOnly:
-				// 清空队列，只保留最新的
-				cleared := 0
-				for {
-					select {
-					case dropped := <-q.ch:
-						// 从imageSet中移除
-						normalizedDroppedPath := filepath.ToSlash(dropped.Path)
-						q.imageSetMu.Lock()
-						delete(q.imageSet, normalizedDroppedPath)
-						q.imageSetMu.Unlock()
-						atomic.AddInt64(&q.sizeCounter, -1)
-						cleared++
-						
-						// 删除MinIO中的图片
-						if q.deleteDropped {
-							q.deleteImageFromMinIO(dropped)
-						}
-					default:
-						// Channel已空
-						goto cleared
-					}
-				}
-			cleared:
-				atomic.AddInt64(&q.droppedCount, int64(cleared))
-				q.log.Warn("queue full, cleared for latest images",
-					slog.Int("cleared", cleared))
 			}
 		}
-		
-		// 添加到Channel（非阻塞）
-		select {
-		case q.ch <- img:
-			// 成功添加到Channel
-			// 更新imageSet
-			q.imageSetMu.Lock()
-			q.imageSet[normalizedPath] = true
-			q.imageSetMu.Unlock()
-			atomic.AddInt64(&q.sizeCounter, 1)
-			added++
-		default:
-			// Channel已满（理论上不应该发生，因为上面已经处理了）
-			// 如果发生，按策略处理
-			if q.strategy == StrategyDropNewest {
-				atomic.AddInt64(&q.droppedCount, 1)
-				if q.deleteDropped {
-					q.deleteImageFromMinIO(img)
-				}
+
+		// 队列已满：按策略丢弃最低优先级中积压最多的任务的图片
+		if q.size >= q.maxSize {
+			victim := q.victim(tq)
+			admitted := q.evict(victim, tq, img, "queue full")
+			if victim != tq {
+				q.release(victim)
+			}
+			if !admitted {
+				q.release(tq)
+				continue
 			}
 		}
+
+		if len(tq.items) == 0 {
+			// 子队列从空变为非空：虚拟时间追上当前优先级的时钟，空闲期间不累积配额
+			tq.vtime = max(tq.vtime, q.clocks[tq.priority])
+		}
+		tq.items = append(tq.items, img)
+		tq.stats.enqueued++
+		tq.stats.lastActive = time.Now()
+		q.index[normalizedPath] = tq.taskID
+		q.size++
+		added++
 	}
-	
+	q.mu.Unlock()
+
 	// 如果发现重复图片，记录日志
 	if duplicateCount > 0 {
 		q.log.Warn("duplicate images detected and skipped",
@@ -211,154 +240,178 @@ func (q *InferenceQueue) Add(images []ImageInfo) int {
 			slog.Int("added_count", added),
 			slog.String("note", "images already in queue, preventing duplicate processing"))
 	}
-	
+
 	// 检查积压告警
 	q.checkBacklogAlert()
-	
+
 	return added
 }
 
-// Pop 取出一张图片（无锁！使用Channel）
+// victim 队列满时选择丢弃图片的子队列：优先级最低的任务中积压最多的（包括新图片所属的任务）
+func (q *InferenceQueue) victim(incoming *taskQueue) *taskQueue {
+	victim := incoming
+	for _, tq := range q.tasks {
+		if len(tq.items) == 0 {
+			continue
+		}
+		if tq.priority < victim.priority ||
+			(tq.priority == victim.priority && len(tq.items) > len(victim.items)) {
+			victim = tq
+		}
+	}
+	return victim
+}
+
+// evict 按策略从子队列丢弃图片，返回新图片是否可以加入（调用方需持有锁）
+// 丢弃新图片时计入新图片所属任务（owner）的统计，丢弃已排队的图片时计入 victim 的统计
+func (q *InferenceQueue) evict(victim, owner *taskQueue, incoming ImageInfo, reason string) bool {
+	// 丢弃最新的，或其他任务的优先级都更高（新图片所属任务没有排队的图片）时丢弃新图片
+	if q.strategy == StrategyDropNewest || len(victim.items) == 0 {
+		q.drop(owner, []ImageInfo{incoming}, false)
+		q.log.Warn(reason+", dropped newest image",
+			slog.String("task_type", incoming.TaskType),
+			slog.String("task_id", incoming.TaskID),
+			slog.String("image", incoming.Filename))
+		return false
+	}
+
+	n := 1
+	if q.strategy == StrategyLatestOnly {
+		// 清空该任务的子队列，只保留最新的
+		n = len(victim.items)
+	}
+	dropped := make([]ImageInfo, n)
+	copy(dropped, victim.items[:n])
+	clear(victim.items[:n])
+	victim.items = victim.items[n:]
+	if len(victim.items) == 0 {
+		victim.items = nil
+	}
+	q.drop(victim, dropped, true)
+
+	q.log.Warn(reason+", dropped oldest images",
+		slog.String("task_type", victim.taskType),
+		slog.String("task_id", victim.taskID),
+		slog.String("image", dropped[0].Filename),
+		slog.Int("dropped", n),
+		slog.Int("queue_size", q.size),
+		slog.Int64("total_dropped", atomic.LoadInt64(&q.droppedCount)))
+	return true
+}
+
+// drop 记录丢弃的图片（queued 表示图片已在队列中），按配置删除对象存储中的图片
+func (q *InferenceQueue) drop(tq *taskQueue, images []ImageInfo, queued bool) {
+	for _, img := range images {
+		if queued {
+			delete(q.index, filepath.ToSlash(img.Path))
+			q.size--
+		}
+		if q.deleteDropped {
+			q.deleteImageFromStore(img)
+		}
+	}
+	tq.stats.dropped += int64(len(images))
+	tq.stats.lastActive = time.Now()
+	atomic.AddInt64(&q.droppedCount, int64(len(images)))
+}
+
+// Pop 按优先级和权重取出一张图片
 func (q *InferenceQueue) Pop() (ImageInfo, bool) {
-	// 使用Channel非阻塞读取（无锁！）
-	for {
-		select {
-		case img := <-q.ch:
-			// 检查是否已标记为删除
-			normalizedPath := filepath.ToSlash(img.Path)
-			q.deletedSetMu.RLock()
-			if q.deletedSet[normalizedPath] {
-				// 已删除，从deletedSet中移除，继续Pop下一个
-				q.deletedSetMu.RUnlock()
-				q.deletedSetMu.Lock()
-				delete(q.deletedSet, normalizedPath)
-				q.deletedSetMu.Unlock()
-				atomic.AddInt64(&q.sizeCounter, -1)
-				// 从imageSet中移除
-				q.imageSetMu.Lock()
-				delete(q.imageSet, normalizedPath)
-				q.imageSetMu.Unlock()
-				continue // 继续Pop下一个
-			}
-			q.deletedSetMu.RUnlock()
-			
-			// 正常处理：从imageSet中移除
-			q.imageSetMu.Lock()
-			delete(q.imageSet, normalizedPath)
-			q.imageSetMu.Unlock()
-			atomic.AddInt64(&q.sizeCounter, -1)
-			
-			// 注意：不在Pop时增加processedCount，只在推理成功或失败后增加
-			// 这样可以确保processedCount更准确地反映实际推理的数量
-			
-			return img, true
-		default:
-			// Channel为空，返回false
-			return ImageInfo{}, false
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pop()
+}
+
+// pop 选择优先级最高、虚拟时间最小的子队列出队（调用方需持有锁）
+func (q *InferenceQueue) pop() (ImageInfo, bool) {
+	var next *taskQueue
+	for _, tq := range q.tasks {
+		if len(tq.items) == 0 {
+			continue
+		}
+		if next == nil || tq.priority > next.priority ||
+			(tq.priority == next.priority && (tq.vtime < next.vtime || (tq.vtime == next.vtime && tq.taskID < next.taskID))) {
+			next = tq
 		}
 	}
+	if next == nil {
+		return ImageInfo{}, false
+	}
+
+	img := next.items[0]
+	next.items[0] = ImageInfo{}
+	next.items = next.items[1:]
+	if len(next.items) == 0 {
+		next.items = nil
+	}
+	q.clocks[next.priority] = next.vtime
+	next.vtime += 1 / float64(next.weight)
+	next.stats.dispatched++
+	next.stats.lastActive = time.Now()
+	q.release(next)
+
+	delete(q.index, filepath.ToSlash(img.Path))
+	q.size--
+
+	// 注意：不在Pop时增加processedCount，只在推理成功或失败后增加
+	// 这样可以确保processedCount更准确地反映实际推理的数量
+	return img, true
 }
 
-// PopBatch 批量取出（使用Channel，无锁）
+// PopBatch 批量取出（每张图片都按优先级和权重选择）
 func (q *InferenceQueue) PopBatch(n int) []ImageInfo {
-	batch := make([]ImageInfo, 0, n)
-	
-	// 从Channel中批量读取
-	for i := 0; i < n; i++ {
-		select {
-		case img := <-q.ch:
-			// 检查是否已标记为删除
-			normalizedPath := filepath.ToSlash(img.Path)
-			q.deletedSetMu.RLock()
-			if q.deletedSet[normalizedPath] {
-				// 已删除，跳过
-				q.deletedSetMu.RUnlock()
-				q.deletedSetMu.Lock()
-				delete(q.deletedSet, normalizedPath)
-				q.deletedSetMu.Unlock()
-				atomic.AddInt64(&q.sizeCounter, -1)
-				// 从imageSet中移除
-				q.imageSetMu.Lock()
-				delete(q.imageSet, normalizedPath)
-				q.imageSetMu.Unlock()
-				continue
-			}
-			q.deletedSetMu.RUnlock()
-			
-			// 正常处理
-			q.imageSetMu.Lock()
-			delete(q.imageSet, normalizedPath)
-			q.imageSetMu.Unlock()
-			atomic.AddInt64(&q.sizeCounter, -1)
-			batch = append(batch, img)
-		default:
-			// Channel为空，返回已读取的
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var batch []ImageInfo
+	for len(batch) < n {
+		img, ok := q.pop()
+		if !ok {
 			break
 		}
-	}
-	
-	// 注意：不在PopBatch时增加processedCount，只在推理成功或失败后增加
-	// 这样可以确保processedCount更准确地反映实际推理的数量
-	
-	if len(batch) == 0 {
-		return nil
+		batch = append(batch, img)
 	}
 	return batch
 }
 
-// Size 获取当前队列大小（使用原子计数器）
+// Size 获取当前队列大小
 func (q *InferenceQueue) Size() int {
-	return int(atomic.LoadInt64(&q.sizeCounter))
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
 }
 
 // GetImagePaths 获取队列中所有图片的路径集合（用于清理时排除）
 func (q *InferenceQueue) GetImagePaths() map[string]bool {
-	q.imageSetMu.RLock()
-	defer q.imageSetMu.RUnlock()
-	
-	// 返回imageSet的副本，避免外部修改
-	paths := make(map[string]bool, len(q.imageSet))
-	for path := range q.imageSet {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// 返回副本，避免外部修改
+	paths := make(map[string]bool, len(q.index))
+	for path := range q.index {
 		paths[path] = true
 	}
 	return paths
 }
 
-// Contains 检查图片是否在队列中（使用Map）
+// Contains 检查图片是否在队列中
 func (q *InferenceQueue) Contains(imagePath string) bool {
-	q.imageSetMu.RLock()
-	defer q.imageSetMu.RUnlock()
+	q.mu.Lock()
+	defer q.mu.Unlock()
 	// 规范化路径格式（确保与MinIO key格式一致）
-	normalizedPath := filepath.ToSlash(imagePath)
-	return q.imageSet[normalizedPath]
+	_, ok := q.index[filepath.ToSlash(imagePath)]
+	return ok
 }
 
-// Clear 清空队列（循环读取Channel）
+// Clear 清空队列（同时移除所有子队列，按任务的统计保留）
 func (q *InferenceQueue) Clear() int {
-	cleared := 0
-	
-	// 循环读取Channel直到为空
-	for {
-		select {
-		case <-q.ch:
-			cleared++
-			atomic.AddInt64(&q.sizeCounter, -1)
-		default:
-			// Channel已空
-			goto done
-		}
-	}
-	
-done:
-	// 清空Map
-	q.imageSetMu.Lock()
-	q.imageSet = make(map[string]bool)
-	q.imageSetMu.Unlock()
-	
-	q.deletedSetMu.Lock()
-	q.deletedSet = make(map[string]bool)
-	q.deletedSetMu.Unlock()
-	
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cleared := q.size
+	q.tasks = make(map[string]*taskQueue)
+	q.index = make(map[string]string)
+	q.size = 0
 	return cleared
 }
 
@@ -367,20 +420,18 @@ func (q *InferenceQueue) RecordProcessed() {
 	atomic.AddInt64(&q.processedCount, 1)
 }
 
-// checkBacklogAlert 检查积压告警（使用原子计数器）
+// checkBacklogAlert 检查积压告警
 func (q *InferenceQueue) checkBacklogAlert() {
-	currentSize := int(atomic.LoadInt64(&q.sizeCounter))
-	if currentSize <= q.alertThreshold {
-		return
-	}
-	
+	q.mu.Lock()
+	currentSize := q.size
 	now := time.Now()
-	if now.Sub(q.lastAlertTime) < q.alertInterval {
-		return  // 避免频繁告警
+	if currentSize <= q.alertThreshold || now.Sub(q.lastAlertTime) < q.alertInterval {
+		q.mu.Unlock()
+		return // 未积压或避免频繁告警
 	}
-	
 	q.lastAlertTime = now
-	
+	q.mu.Unlock()
+
 	alert := AlertInfo{
 		Type:      "queue_backlog",
 		Level:     "warning",
@@ -389,68 +440,113 @@ func (q *InferenceQueue) checkBacklogAlert() {
 		Dropped:   atomic.LoadInt64(&q.droppedCount),
 		Timestamp: now,
 	}
-	
+
 	q.log.Error("inference backlog alert",
 		slog.Int("queue_size", currentSize),
 		slog.Int("threshold", q.alertThreshold),
 		slog.Int64("dropped_total", atomic.LoadInt64(&q.droppedCount)),
 		slog.String("message", alert.Message))
-	
+
 	// 触发告警回调
 	if q.alertCallback != nil {
 		q.alertCallback(alert)
 	}
 }
 
-// Remove 从队列中移除指定路径的图片（使用标记删除法）
+// Remove 从队列中移除指定路径的图片
 func (q *InferenceQueue) Remove(imagePath string) bool {
 	// 规范化路径格式
 	normalizedPath := filepath.ToSlash(imagePath)
-	
-	// 检查图片是否在队列中
-	q.imageSetMu.RLock()
-	if !q.imageSet[normalizedPath] {
-		q.imageSetMu.RUnlock()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	taskID, ok := q.index[normalizedPath]
+	if !ok {
 		return false
 	}
-	q.imageSetMu.RUnlock()
-	
-	// 标记为已删除（Pop时会跳过）
-	q.deletedSetMu.Lock()
-	q.deletedSet[normalizedPath] = true
-	q.deletedSetMu.Unlock()
-	
-	// 从imageSet中移除（立即移除，避免Contains返回true）
-	q.imageSetMu.Lock()
-	delete(q.imageSet, normalizedPath)
-	q.imageSetMu.Unlock()
-	
-	// 注意：不在这里减少sizeCounter，因为图片还在Channel中
-	// Pop时会检查deletedSet，如果已删除则跳过并减少计数器
-	// 这样可以确保sizeCounter的准确性
-	
-	q.log.Debug("removed image from queue (marked as deleted)",
+	tq := q.tasks[taskID]
+	for i := range tq.items {
+		if filepath.ToSlash(tq.items[i].Path) == normalizedPath {
+			tq.items = append(tq.items[:i], tq.items[i+1:]...)
+			break
+		}
+	}
+	q.release(tq)
+	delete(q.index, normalizedPath)
+	q.size--
+
+	q.log.Debug("removed image from queue",
 		slog.String("path", imagePath),
-		slog.Int64("remaining_queue_size", atomic.LoadInt64(&q.sizeCounter)))
-	
+		slog.Int("remaining_queue_size", q.size))
+
 	return true
 }
 
-// GetStats 获取统计信息（使用原子计数器）
+// pruneStats 移除子队列已清空且空闲超过 taskStatsIdleTTL 的任务统计（调用方需持有锁）
+func (q *InferenceQueue) pruneStats(now time.Time) {
+	if now.Sub(q.lastPrune) < taskStatsPruneInterval {
+		return
+	}
+	q.lastPrune = now
+	for taskID, stats := range q.stats {
+		if _, queued := q.tasks[taskID]; !queued && now.Sub(stats.lastActive) > taskStatsIdleTTL {
+			delete(q.stats, taskID)
+		}
+	}
+}
+
+// GetStats 获取统计信息（tasks 为有排队图片或最近活跃的任务的统计，按优先级和排队数倒序）
 func (q *InferenceQueue) GetStats() map[string]interface{} {
-	currentSize := int(atomic.LoadInt64(&q.sizeCounter))
+	q.mu.Lock()
+	q.pruneStats(time.Now())
+	currentSize := q.size
+	tasks := make([]TaskQueueStats, 0, len(q.stats))
+	for taskID, stats := range q.stats {
+		tq, ok := q.tasks[taskID]
+		if !ok {
+			// 子队列已清空：按任务类型的当前规则显示优先级、权重和积压上限
+			tq = &taskQueue{taskID: taskID, taskType: stats.taskType}
+			q.applyRule(tq)
+		}
+		tasks = append(tasks, TaskQueueStats{
+			TaskID:     taskID,
+			TaskType:   stats.taskType,
+			Priority:   tq.priority,
+			Weight:     tq.weight,
+			MaxBacklog: tq.maxBacklog,
+			Queued:     len(tq.items),
+			Enqueued:   stats.enqueued,
+			Dispatched: stats.dispatched,
+			Dropped:    stats.dropped,
+		})
+	}
+	q.mu.Unlock()
+
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].Priority != tasks[j].Priority {
+			return tasks[i].Priority > tasks[j].Priority
+		}
+		if tasks[i].Queued != tasks[j].Queued {
+			return tasks[i].Queued > tasks[j].Queued
+		}
+		return tasks[i].TaskID < tasks[j].TaskID
+	})
+
 	utilization := 0.0
 	if q.maxSize > 0 {
 		utilization = float64(currentSize) / float64(q.maxSize)
 	}
-	
+
 	return map[string]interface{}{
-		"queue_size":     currentSize,
-		"max_size":       q.maxSize,
-		"dropped_total":  atomic.LoadInt64(&q.droppedCount),
-		"processed_total": atomic.LoadInt64(&q.processedCount),
-		"utilization":    utilization,
-		"strategy":       string(q.strategy),
+		"queue_size":       currentSize,
+		"max_size":         q.maxSize,
+		"max_task_backlog": q.maxTaskBacklog,
+		"dropped_total":    atomic.LoadInt64(&q.droppedCount),
+		"processed_total":  atomic.LoadInt64(&q.processedCount),
+		"utilization":      utilization,
+		"strategy":         string(q.strategy),
+		"tasks":            tasks,
 	}
 }
 
@@ -462,42 +558,48 @@ func (q *InferenceQueue) GetDropRate() float64 {
 	if total == 0 {
 		return 0
 	}
-	
+
 	return float64(dropped) / float64(total)
 }
 
-// ResetStats 重置统计数据（使用原子操作）
+// ResetStats 重置统计数据
 func (q *InferenceQueue) ResetStats() {
 	atomic.StoreInt64(&q.droppedCount, 0)
 	atomic.StoreInt64(&q.processedCount, 0)
+
+	q.mu.Lock()
 	q.lastAlertTime = time.Time{}
-	
+	for _, stats := range q.stats {
+		stats.enqueued, stats.dispatched, stats.dropped = 0, 0, 0
+	}
+	remaining := q.size
+	q.mu.Unlock()
+
 	q.log.Info("inference queue stats reset",
-		slog.Int64("remaining_queue_size", atomic.LoadInt64(&q.sizeCounter)))
+		slog.Int("remaining_queue_size", remaining))
 }
 
-// deleteImageFromMinIO 删除MinIO中的图片
-func (q *InferenceQueue) deleteImageFromMinIO(img ImageInfo) {
-	if q.minio == nil || q.bucket == "" {
+// deleteImageFromStore 删除对象存储中的图片
+func (q *InferenceQueue) deleteImageFromStore(img ImageInfo) {
+	if q.store == nil {
 		return
 	}
-	
+
 	go func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		
-		err := q.minio.RemoveObject(ctx, q.bucket, img.Path, minio.RemoveObjectOptions{})
+
+		err := q.store.Delete(ctx, img.Path)
 		if err != nil {
-			q.log.Warn("failed to delete dropped image from MinIO",
+			q.log.Warn("failed to delete dropped image",
 				slog.String("path", img.Path),
 				slog.String("err", err.Error()))
 			return
 		}
-		
-		q.log.Debug("dropped image deleted from MinIO",
+
+		q.log.Debug("dropped image deleted",
 			slog.String("path", img.Path),
 			slog.String("task_type", img.TaskType),
 			slog.String("task_id", img.TaskID))
 	}()
 }
-
@@ -0,0 +1,206 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/conf"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func newTestQueue(maxSize int, strategy QueueStrategy, cfg conf.InferenceQueueConfig) *InferenceQueue {
+	q := NewInferenceQueue(maxSize, strategy, maxSize, nil, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	q.SetScheduling(cfg)
+	return q
+}
+
+func taskImages(taskID, taskType string, n int) []ImageInfo {
+	images := make([]ImageInfo, n)
+	for i := range images {
+		images[i] = ImageInfo{Path: fmt.Sprintf("%s/%s/%03d.jpg", taskType, taskID, i), TaskID: taskID, TaskType: taskType}
+	}
+	return images
+}
+
+func taskStats(q *InferenceQueue, taskID string) TaskQueueStats {
+	for _, s := range q.GetStats()["tasks"].([]TaskQueueStats) {
+		if s.TaskID == taskID {
+			return s
+		}
+	}
+	return TaskQueueStats{}
+}
+
+func TestQueueFairAcrossTasks(t *testing.T) {
+	q := newTestQueue(1000, StrategyDropOldest, conf.InferenceQueueConfig{})
+	q.Add(taskImages("busy", "人数统计", 100))
+	q.Add(taskImages("quiet1", "人数统计", 2))
+	q.Add(taskImages("quiet2", "人数统计", 2))
+
+	// 积压100张的任务不会阻塞其他任务：前6张三个任务轮流出队
+	counts := map[string]int{}
+	for _, img := range q.PopBatch(6) {
+		counts[img.TaskID]++
+	}
+	if counts["busy"] != 2 || counts["quiet1"] != 2 || counts["quiet2"] != 2 {
+		t.Fatalf("unexpected dispatch %v", counts)
+	}
+
+	// 子队列内保持先进先出
+	img, _ := q.Pop()
+	if img.Path != "人数统计/busy/002.jpg" {
+		t.Fatalf("unexpected order %s", img.Path)
+	}
+}
+
+func TestQueueWeightAndPriority(t *testing.T) {
+	q := newTestQueue(1000, StrategyDropOldest, conf.InferenceQueueConfig{TaskTypes: map[string]conf.QueuePriorityRule{
+		"火焰检测":  {Priority: 10},
+		"安全帽检测": {Weight: 3},
+	}})
+	q.Add(taskImages("people", "人数统计", 20))
+	q.Add(taskImages("helmet", "安全帽检测", 20))
+
+	counts := map[string]int{}
+	for _, img := range q.PopBatch(8) {
+		counts[img.TaskID]++
+	}
+	if counts["helmet"] != 6 || counts["people"] != 2 {
+		t.Fatalf("expected 3:1 weighted dispatch, got %v", counts)
+	}
+
+	// 高优先级任务的图片先于已排队的低优先级图片出队
+	q.Add(taskImages("fire", "火焰检测", 2))
+	for range 2 {
+		if img, _ := q.Pop(); img.TaskID != "fire" {
+			t.Fatalf("expected fire first, got %s", img.TaskID)
+		}
+	}
+}
+
+func TestQueueTaskBacklog(t *testing.T) {
+	q := newTestQueue(1000, StrategyDropOldest, conf.InferenceQueueConfig{
+		MaxTaskBacklog: 5,
+		TaskTypes:      map[string]conf.QueuePriorityRule{"火焰检测": {MaxBacklog: 2}},
+	})
+	q.Add(taskImages("cam1", "人数统计", 8))
+	q.Add(taskImages("fire", "火焰检测", 3))
+
+	s := taskStats(q, "cam1")
+	if s.Queued != 5 || s.Dropped != 3 || s.Enqueued != 8 {
+		t.Fatalf("unexpected cam1 stats %+v", s)
+	}
+	if s := taskStats(q, "fire"); s.Queued != 2 || s.Dropped != 1 || s.MaxBacklog != 2 {
+		t.Fatalf("unexpected fire stats %+v", s)
+	}
+	// 丢弃的是最旧的图片
+	if q.Contains("人数统计/cam1/000.jpg") || !q.Contains("人数统计/cam1/007.jpg") {
+		t.Fatal("expected oldest images to be dropped")
+	}
+	if q.GetStats()["dropped_total"].(int64) != 4 {
+		t.Fatalf("dropped_total = %v", q.GetStats()["dropped_total"])
+	}
+}
+
+func TestQueueFullDropsFromLowestPriority(t *testing.T) {
+	q := newTestQueue(10, StrategyDropOldest, conf.InferenceQueueConfig{TaskTypes: map[string]conf.QueuePriorityRule{
+		"火焰检测": {Priority: 10},
+	}})
+	q.Add(taskImages("busy", "人数统计", 7))
+	q.Add(taskImages("quiet", "人数统计", 2))
+	q.Add(taskImages("fire", "火焰检测", 3))
+
+	// 队列满时丢弃低优先级中积压最多的任务的图片
+	if q.Size() != 10 {
+		t.Fatalf("size = %d", q.Size())
+	}
+	if s := taskStats(q, "busy"); s.Dropped != 2 || s.Queued != 5 {
+		t.Fatalf("unexpected busy stats %+v", s)
+	}
+	if s := taskStats(q, "fire"); s.Dropped != 0 || s.Queued != 3 {
+		t.Fatalf("unexpected fire stats %+v", s)
+	}
+
+	// 其他任务优先级都更高时丢弃新图片
+	q = newTestQueue(2, StrategyDropOldest, conf.InferenceQueueConfig{TaskTypes: map[string]conf.QueuePriorityRule{
+		"火焰检测": {Priority: 10},
+	}})
+	q.Add(taskImages("fire", "火焰检测", 2))
+	if added := q.Add(taskImages("people", "人数统计", 1)); added != 0 {
+		t.Fatalf("added = %d, want 0", added)
+	}
+	if q.GetStats()["dropped_total"].(int64) != 1 || len(q.tasks) != 1 {
+		t.Fatalf("dropped image should not leave an empty task queue, tasks = %d", len(q.tasks))
+	}
+	// 丢弃的新图片计入其所属任务，而不是被选中的任务
+	if s := taskStats(q, "people"); s.Dropped != 1 || s.Queued != 0 {
+		t.Fatalf("unexpected people stats %+v", s)
+	}
+	if s := taskStats(q, "fire"); s.Dropped != 0 {
+		t.Fatalf("unexpected fire stats %+v", s)
+	}
+
+	// drop_newest：新图片计入其所属任务
+	q = newTestQueue(3, StrategyDropNewest, conf.InferenceQueueConfig{})
+	q.Add(taskImages("busy", "人数统计", 3))
+	q.Add(taskImages("quiet", "人数统计", 1))
+	if s := taskStats(q, "quiet"); s.Dropped != 1 {
+		t.Fatalf("unexpected quiet stats %+v", s)
+	}
+	if s := taskStats(q, "busy"); s.Dropped != 0 || s.Queued != 3 {
+		t.Fatalf("unexpected busy stats %+v", s)
+	}
+}
+
+func TestQueueRemoveAndClear(t *testing.T) {
+	q := newTestQueue(100, StrategyDropOldest, conf.InferenceQueueConfig{})
+	q.Add(taskImages("cam1", "人数统计", 3))
+	if q.Add(taskImages("cam1", "人数统计", 1)) != 0 {
+		t.Fatal("duplicate image should be skipped")
+	}
+
+	if !q.Remove("人数统计/cam1/001.jpg") || q.Remove("人数统计/cam1/001.jpg") {
+		t.Fatal("unexpected remove result")
+	}
+	if q.Size() != 2 || q.Contains("人数统计/cam1/001.jpg") {
+		t.Fatalf("size = %d after remove", q.Size())
+	}
+	batch := q.PopBatch(10)
+	if len(batch) != 2 || batch[1].Path != "人数统计/cam1/002.jpg" {
+		t.Fatalf("unexpected batch %v", batch)
+	}
+	// 子队列清空后移除，任务停止后不再占用内存；按任务的统计保留，空闲超时后移除
+	if _, ok := q.tasks["cam1"]; ok {
+		t.Fatal("drained task queue should be removed")
+	}
+	if s := taskStats(q, "cam1"); s.Enqueued != 3 || s.Dispatched != 2 || s.Queued != 0 {
+		t.Fatalf("drained task stats should be kept, got %+v", s)
+	}
+	q.mu.Lock()
+	q.stats["cam1"].lastActive = time.Now().Add(-taskStatsIdleTTL - time.Second)
+	q.lastPrune = time.Time{}
+	q.mu.Unlock()
+	if s := taskStats(q, "cam1"); s.TaskID != "" {
+		t.Fatalf("idle task stats should be pruned, got %+v", s)
+	}
+
+	q.Add(taskImages("cam2", "人数统计", 4))
+	if q.Clear() != 4 || q.Size() != 0 || len(q.GetImagePaths()) != 0 {
+		t.Fatal("queue not cleared")
+	}
+	if len(q.tasks) != 0 {
+		t.Fatalf("clear should remove task queues, got %d", len(q.tasks))
+	}
+}
+
+func TestQueueTaskTypeIgnoresCase(t *testing.T) {
+	// 配置文件中 task_types 的键被转为小写
+	q := newTestQueue(100, StrategyDropOldest, conf.InferenceQueueConfig{TaskTypes: map[string]conf.QueuePriorityRule{
+		"helmet": {Priority: 10, MaxBacklog: 2},
+	}})
+	q.Add(taskImages("cam1", "Helmet", 3))
+	if s := taskStats(q, "cam1"); s.Priority != 10 || s.Queued != 2 {
+		t.Fatalf("task type rule should match ignoring case, got %+v", s)
+	}
+}
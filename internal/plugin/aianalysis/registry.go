@@ -1,9 +1,12 @@
 package aianalysis
 
 import (
+	"context"
 	"easydarwin/internal/conf"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 	"sync"
 	"time"
 )
@@ -29,11 +32,31 @@ type AlgorithmRegistry struct {
 	// 性能统计：记录每个算法实例的响应时间
 	responseTimes map[string][]int64 // algorithm endpoint -> response times (ms) in sliding window
 
-	// 加权轮询：每个任务类型的当前权重计数器
-	weightCounters map[string]int // task_type -> current weight counter
-
-	// Round-Robin索引：作为兜底策略
-	rrIndexes map[string]int // task_type -> round-robin index
+	// 进行中的推理请求数（least_in_flight 策略使用）
+	inFlight map[string]int // algorithm endpoint -> in-flight requests
+
+	// 负载均衡策略：全局默认策略 + 按任务类型覆盖
+	strategy       LoadBalanceStrategy
+	taskStrategies map[string]LoadBalanceStrategy // task_type -> strategy
+
+	// 熔断：按endpoint统计错误率和延迟，熔断的实例不参与负载均衡
+	breakerCfg      conf.CircuitBreakerConfig
+	breakers        map[string]*circuitBreaker                  // algorithm endpoint -> breaker
+	onBreakerChange func(endpoint string, status BreakerStatus) // 熔断状态变化回调
+
+	// 灰度发布：按任务类型将部分流量路由到指定版本，并按版本统计推理结果（见 canary.go）
+	canaries     map[string]*CanaryStatus            // task_type -> canary
+	canaryStore  canaryStore                         // 灰度规则持久化存储，为nil时只保存在内存中
+	canaryMu     sync.Mutex                          // 串行化灰度规则的修改和重新加载（写存储期间不持有 mu）
+	versionStats map[string]map[string]*versionStats // task_type -> version -> stats
+
+	// 集群共享：注册信息和负载统计保存在共享存储中，注册/注销通过 pub/sub 通知其他节点（见 registry_shared.go）
+	shared       sharedRegistryStore
+	nodeID       string
+	syncInterval time.Duration
+	ownInFlight  map[string]int // 本节点计入共享存储的进行中请求数，关闭时归还
+	pending      sharedDeltas   // 尚未写入共享存储的增量
+	stopShared   context.CancelFunc
 }
 
 // NewRegistry 创建注册中心
@@ -48,9 +71,217 @@ func NewRegistry(timeoutSec int, logger *slog.Logger) *AlgorithmRegistry {
 		stopCheck:      make(chan struct{}),
 		callCounters:   make(map[string]int),
 		responseTimes:  make(map[string][]int64),
-		weightCounters: make(map[string]int),
-		rrIndexes:      make(map[string]int),
+		inFlight:       make(map[string]int),
+		strategy:       &weightedRoundRobin{counters: make(map[string]int)},
+		taskStrategies: make(map[string]LoadBalanceStrategy),
+		breakers:       make(map[string]*circuitBreaker),
+		canaries:       make(map[string]*CanaryStatus),
+		versionStats:   make(map[string]map[string]*versionStats),
+	}
+}
+
+// ConfigureCircuitBreaker 设置熔断配置（未启用时不剔除任何实例）
+func (r *AlgorithmRegistry) ConfigureCircuitBreaker(cfg conf.CircuitBreakerConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.breakerCfg = normalizeBreakerConfig(cfg)
+	r.breakers = make(map[string]*circuitBreaker)
+
+	if cfg.Enable {
+		r.log.Info("algorithm circuit breaker enabled",
+			slog.Int("window_size", r.breakerCfg.WindowSize),
+			slog.Int("min_requests", r.breakerCfg.MinRequests),
+			slog.Float64("error_rate_threshold", r.breakerCfg.ErrorRateThreshold),
+			slog.Int64("latency_p95_ms", r.breakerCfg.LatencyP95Ms),
+			slog.Int("open_duration_sec", r.breakerCfg.OpenDurationSec),
+			slog.Int("half_open_probes", r.breakerCfg.HalfOpenProbes))
+	}
+}
+
+// SetOnBreakerStateChange 设置熔断状态变化回调
+func (r *AlgorithmRegistry) SetOnBreakerStateChange(callback func(endpoint string, status BreakerStatus)) {
+	r.onBreakerChange = callback
+}
+
+// breakerLocked 获取endpoint的熔断器，未启用熔断时返回nil（需要已加锁）
+func (r *AlgorithmRegistry) breakerLocked(endpoint string) *circuitBreaker {
+	if !r.breakerCfg.Enable {
+		return nil
+	}
+	b, ok := r.breakers[endpoint]
+	if !ok {
+		b = newCircuitBreaker(r.breakerCfg, time.Now())
+		r.breakers[endpoint] = b
+	}
+	return b
+}
+
+// notifyBreakerChangeLocked 记录熔断状态变化并触发回调（需要已加锁，回调异步执行）
+func (r *AlgorithmRegistry) notifyBreakerChangeLocked(endpoint string, b *circuitBreaker) {
+	status := b.status()
+	r.log.Warn("algorithm circuit breaker state changed",
+		slog.String("endpoint", endpoint),
+		slog.String("state", string(status.State)),
+		slog.String("reason", status.Reason),
+		slog.Float64("error_rate", status.ErrorRate),
+		slog.Int64("p95_latency_ms", status.P95LatencyMs))
+
+	if r.onBreakerChange != nil {
+		go r.onBreakerChange(endpoint, status)
+	}
+}
+
+// availableLocked 过滤掉被熔断剔除的实例（需要已加锁）
+func (r *AlgorithmRegistry) availableLocked(services []conf.AlgorithmService) []conf.AlgorithmService {
+	if !r.breakerCfg.Enable {
+		return services
+	}
+
+	now := time.Now()
+	available := make([]conf.AlgorithmService, 0, len(services))
+	for _, svc := range services {
+		b := r.breakerLocked(svc.Endpoint)
+		allowed, changed := b.allow(now)
+		if changed {
+			r.notifyBreakerChangeLocked(svc.Endpoint, b)
+		}
+		if allowed {
+			available = append(available, svc)
+		}
 	}
+	return available
+}
+
+// pruneBreakersLocked 删除已不再注册的endpoint的熔断器（需要已加锁）
+func (r *AlgorithmRegistry) pruneBreakersLocked() {
+	if len(r.breakers) == 0 {
+		return
+	}
+	registered := make(map[string]bool)
+	for _, services := range r.services {
+		for _, svc := range services {
+			registered[svc.Endpoint] = true
+		}
+	}
+	for endpoint := range r.breakers {
+		if !registered[endpoint] {
+			delete(r.breakers, endpoint)
+		}
+	}
+}
+
+// breakerStateLocked 获取endpoint的熔断状态名称（只读，需要已加锁），未启用熔断时返回空
+func (r *AlgorithmRegistry) breakerStateLocked(endpoint string) string {
+	if !r.breakerCfg.Enable {
+		return ""
+	}
+	if b, ok := r.breakers[endpoint]; ok {
+		return string(b.state)
+	}
+	return string(BreakerClosed)
+}
+
+// GetBreakerStatus 获取endpoint的熔断状态，未启用熔断时返回false
+func (r *AlgorithmRegistry) GetBreakerStatus(endpoint string) (BreakerStatus, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b := r.breakerLocked(endpoint)
+	if b == nil {
+		return BreakerStatus{}, false
+	}
+	return b.status(), true
+}
+
+// ConfigureLoadBalance 按配置设置全局及各任务类型的负载均衡策略，无效的配置项被忽略并返回错误
+func (r *AlgorithmRegistry) ConfigureLoadBalance(cfg conf.LoadBalanceConfig) error {
+	var errs []error
+	if err := r.SetLoadBalanceStrategy("", cfg.Strategy); err != nil {
+		errs = append(errs, err)
+	}
+	for taskType, name := range cfg.TaskTypes {
+		if err := r.SetLoadBalanceStrategy(taskType, name); err != nil {
+			errs = append(errs, fmt.Errorf("task type %s: %w", taskType, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetLoadBalanceStrategies 获取全局默认策略及各任务类型的覆盖策略
+func (r *AlgorithmRegistry) GetLoadBalanceStrategies() (string, map[string]string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	overrides := make(map[string]string, len(r.taskStrategies))
+	for taskType, strategy := range r.taskStrategies {
+		overrides[taskType] = strategy.Name()
+	}
+	return r.strategy.Name(), overrides
+}
+
+// SetLoadBalanceStrategy 设置负载均衡策略
+// taskType 为空时设置全局默认策略；name 为空时清除该任务类型的覆盖，改用全局策略
+func (r *AlgorithmRegistry) SetLoadBalanceStrategy(taskType, name string) error {
+	if taskType != "" && name == "" {
+		r.mu.Lock()
+		r.deleteTaskStrategyLocked(taskType)
+		r.mu.Unlock()
+		return nil
+	}
+
+	strategy, err := NewLoadBalanceStrategy(name)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	if taskType == "" {
+		r.strategy = strategy
+	} else {
+		r.deleteTaskStrategyLocked(taskType)
+		r.taskStrategies[taskType] = strategy
+	}
+	r.mu.Unlock()
+
+	r.log.Info("load balance strategy configured",
+		slog.String("task_type", taskType),
+		slog.String("strategy", strategy.Name()))
+	return nil
+}
+
+// deleteTaskStrategyLocked 删除任务类型的策略覆盖，忽略大小写（需要已加锁）
+func (r *AlgorithmRegistry) deleteTaskStrategyLocked(taskType string) {
+	for k := range r.taskStrategies {
+		if strings.EqualFold(k, taskType) {
+			delete(r.taskStrategies, k)
+		}
+	}
+}
+
+// strategyForLocked 获取任务类型使用的负载均衡策略（需要已加锁）
+func (r *AlgorithmRegistry) strategyForLocked(taskType string) LoadBalanceStrategy {
+	if strategy, ok := conf.LookupTaskType(r.taskStrategies, taskType); ok {
+		return strategy
+	}
+	return r.strategy
+}
+
+// candidatesLocked 构建负载均衡候选实例（需要已加锁）
+func (r *AlgorithmRegistry) candidatesLocked(services []conf.AlgorithmService) []LBCandidate {
+	candidates := make([]LBCandidate, len(services))
+	for i := range services {
+		weight, avgTime, hasData := responseTimeWeight(r.responseTimes[services[i].Endpoint])
+		candidates[i] = LBCandidate{
+			Service:       &services[i],
+			Weight:        weight,
+			AvgResponseMs: avgTime,
+			HasData:       hasData,
+			InFlight:      r.inFlight[services[i].Endpoint],
+			CallCount:     r.callCounters[services[i].Endpoint],
+		}
+	}
+	return candidates
 }
 
 // SetOnRegisterCallback 设置注册回调
@@ -71,34 +302,27 @@ func (r *AlgorithmRegistry) Register(service conf.AlgorithmService) error {
 	if len(service.TaskTypes) == 0 {
 		return fmt.Errorf("task_types required")
 	}
+	protocol, err := normalizeProtocol(service.Protocol)
+	if err != nil {
+		return err
+	}
+	service.Protocol = protocol
+	imageMode, err := normalizeImageMode(service.ImageMode)
+	if err != nil {
+		return err
+	}
+	service.ImageMode = imageMode
+	if err := normalizeBatchConfig(&service); err != nil {
+		return err
+	}
 
 	r.mu.Lock()
-	defer r.mu.Unlock()
 
 	now := time.Now().Unix()
 	service.RegisterAt = now
 	service.LastHeartbeat = now
 
-	// 为每个支持的任务类型注册
-	for _, taskType := range service.TaskTypes {
-		// 移除相同endpoint的旧服务（按endpoint去重）
-		removed := r.removeServiceByEndpointLocked(service.Endpoint, taskType)
-		if removed {
-			r.log.Info("removed duplicate service by endpoint before registering new one",
-				slog.String("endpoint", service.Endpoint),
-				slog.String("task_type", taskType),
-				slog.String("new_service_id", service.ServiceID),
-				slog.String("note", "this is normal when service re-registers"))
-		}
-
-		// 添加新服务
-		r.services[taskType] = append(r.services[taskType], service)
-
-		// 如果移除了旧服务，重置Round-Robin索引以确保公平分配
-		if removed {
-			r.rrIndexes[taskType] = 0
-		}
-	}
+	r.addServiceLocked(service)
 
 	// 获取当前所有唯一endpoint列表（用于调试）
 	allInstances := r.ListAllServiceInstancesLocked()
@@ -115,12 +339,29 @@ func (r *AlgorithmRegistry) Register(service conf.AlgorithmService) error {
 		slog.String("name", service.Name),
 		slog.Any("task_types", service.TaskTypes),
 		slog.String("endpoint", service.Endpoint),
+		slog.String("protocol", service.Protocol),
+		slog.String("image_mode", service.ImageMode),
+		slog.Int("max_batch_size", service.MaxBatchSize),
 		slog.String("version", service.Version),
+		slog.Bool("shadow", service.Shadow),
 		slog.Int("total_services", totalServices),
 		slog.Any("all_endpoints", endpoints))
 
-	// 触发注册回调（异步）
-	if r.onRegisterCallback != nil {
+	store := r.shared
+	r.mu.Unlock()
+
+	// 写入共享存储并通知其他节点
+	if store != nil {
+		r.share(store, "register", func(ctx context.Context, st sharedRegistryStore) error {
+			if err := st.SaveService(ctx, service); err != nil {
+				return err
+			}
+			return st.Publish(ctx, registryEvent{Node: r.nodeID, Type: registryEventRegister, Service: service})
+		})
+	}
+
+	// 触发注册回调（异步），影子服务不参与调度，不自动启动任务
+	if r.onRegisterCallback != nil && !service.Shadow {
 		go r.onRegisterCallback(service.ServiceID, service.TaskTypes)
 	}
 
@@ -130,7 +371,6 @@ func (r *AlgorithmRegistry) Register(service conf.AlgorithmService) error {
 // Unregister 注销算法服务
 func (r *AlgorithmRegistry) Unregister(serviceID string) error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
 
 	found := false
 	var removedEndpoint string
@@ -150,13 +390,23 @@ func (r *AlgorithmRegistry) Unregister(serviceID string) error {
 	}
 
 	if !found {
+		r.mu.Unlock()
 		return fmt.Errorf("service not found")
 	}
 
+	// 记录被移除的实例（同一service_id可能有多个endpoint），用于同步共享存储
+	var removed []conf.AlgorithmService
+	for _, svc := range r.ListAllServiceInstancesLocked() {
+		if svc.ServiceID == serviceID {
+			removed = append(removed, svc)
+		}
+	}
+
 	// 从所有任务类型中移除
 	for taskType := range r.services {
 		r.removeServiceByIDLocked(serviceID, taskType)
 	}
+	r.pruneBreakersLocked()
 
 	totalServices := len(r.ListAllServiceInstancesLocked())
 
@@ -164,6 +414,13 @@ func (r *AlgorithmRegistry) Unregister(serviceID string) error {
 		slog.String("service_id", serviceID),
 		slog.String("endpoint", removedEndpoint),
 		slog.Int("remaining_services", totalServices))
+
+	store := r.shared
+	r.mu.Unlock()
+
+	if store != nil {
+		r.shareRemoved(store, removed, "unregistered")
+	}
 	return nil
 }
 
@@ -180,6 +437,7 @@ func (r *AlgorithmRegistry) HeartbeatWithStats(serviceID string, stats *conf.Hea
 	now := time.Now().Unix()
 	found := false
 	var endpoint string
+	updated := make(map[string]conf.AlgorithmService) // endpoint -> 更新后的服务（用于同步共享存储）
 
 	// 更新所有匹配服务的心跳时间和性能统计
 	for taskType, services := range r.services {
@@ -195,6 +453,7 @@ func (r *AlgorithmRegistry) HeartbeatWithStats(serviceID string, stats *conf.Hea
 					services[i].LastInferenceTimeMs = stats.LastInferenceTimeMs
 					services[i].LastTotalTimeMs = stats.LastTotalTimeMs
 				}
+				updated[services[i].Endpoint] = services[i]
 
 				found = true
 			}
@@ -210,6 +469,8 @@ func (r *AlgorithmRegistry) HeartbeatWithStats(serviceID string, stats *conf.Hea
 		return fmt.Errorf("service not found: %s", serviceID)
 	}
 
+	r.shareHeartbeatLocked(updated)
+
 	if stats != nil && stats.TotalRequests > 0 {
 		r.log.Debug("heartbeat with stats received",
 			slog.String("service_id", serviceID),
@@ -241,6 +502,7 @@ func (r *AlgorithmRegistry) HeartbeatByEndpointWithStats(endpoint string, stats
 	now := time.Now().Unix()
 	found := false
 	var serviceID string
+	updated := make(map[string]conf.AlgorithmService) // endpoint -> 更新后的服务（用于同步共享存储）
 
 	// 更新所有匹配服务的心跳时间和性能统计
 	for taskType, services := range r.services {
@@ -256,6 +518,7 @@ func (r *AlgorithmRegistry) HeartbeatByEndpointWithStats(endpoint string, stats
 					services[i].LastInferenceTimeMs = stats.LastInferenceTimeMs
 					services[i].LastTotalTimeMs = stats.LastTotalTimeMs
 				}
+				updated[services[i].Endpoint] = services[i]
 
 				found = true
 			}
@@ -271,6 +534,8 @@ func (r *AlgorithmRegistry) HeartbeatByEndpointWithStats(endpoint string, stats
 		return fmt.Errorf("service not found by endpoint: %s", endpoint)
 	}
 
+	r.shareHeartbeatLocked(updated)
+
 	if stats != nil && stats.TotalRequests > 0 {
 		r.log.Debug("heartbeat with stats received by endpoint",
 			slog.String("service_id", serviceID),
@@ -362,16 +627,22 @@ func (r *AlgorithmRegistry) ClearAllServices() int {
 	defer r.mu.Unlock()
 
 	// 统计清理前的服务数
-	totalBefore := len(r.ListAllServiceInstancesLocked())
+	cleared := r.ListAllServiceInstancesLocked()
+	totalBefore := len(cleared)
 
 	// 清空所有数据
 	r.services = make(map[string][]conf.AlgorithmService)
 	r.callCounters = make(map[string]int)
-	r.rrIndexes = make(map[string]int)
+	r.breakers = make(map[string]*circuitBreaker)
 
 	r.log.Warn("all algorithm services cleared",
 		slog.Int("cleared_count", totalBefore))
 
+	// 集群模式下同时清空共享存储
+	if r.shared != nil {
+		go r.shareRemoved(r.shared, cleared, "cleared")
+	}
+
 	return totalBefore
 }
 
@@ -458,10 +729,19 @@ func (r *AlgorithmRegistry) checkAndRemoveExpired() {
 		}
 		r.services[taskType] = alive
 	}
+	if totalExpired > 0 {
+		r.pruneBreakersLocked()
+	}
 
 	// 解锁后触发注销回调（避免死锁）
+	store := r.shared
 	r.mu.Unlock()
 
+	// 集群模式下从共享存储删除过期服务（其他节点可能刚收到心跳，以共享存储为准）
+	if store != nil && len(expiredServices) > 0 {
+		go r.shareExpired(store, expiredServices, now-timeoutSec)
+	}
+
 	// 触发注销回调
 	if r.onUnregisterCallback != nil && len(expiredServices) > 0 {
 		for _, svc := range expiredServices {
@@ -488,6 +768,40 @@ func (r *AlgorithmRegistry) checkAndRemoveExpired() {
 	}
 }
 
+// addServiceLocked 按服务支持的任务类型添加服务，相同endpoint的旧服务被替换（需要已加锁）
+func (r *AlgorithmRegistry) addServiceLocked(service conf.AlgorithmService) {
+	for _, taskType := range service.TaskTypes {
+		// 移除相同endpoint的旧服务（按endpoint去重）
+		removed := r.removeServiceByEndpointLocked(service.Endpoint, taskType)
+		if removed {
+			r.log.Info("removed duplicate service by endpoint before registering new one",
+				slog.String("endpoint", service.Endpoint),
+				slog.String("task_type", taskType),
+				slog.String("new_service_id", service.ServiceID),
+				slog.String("note", "this is normal when service re-registers"))
+		}
+
+		// 添加新服务
+		r.services[taskType] = append(r.services[taskType], service)
+	}
+}
+
+// removeEndpointLocked 从所有任务类型中移除指定endpoint的服务，返回被移除的服务（需要已加锁）
+func (r *AlgorithmRegistry) removeEndpointLocked(endpoint string) (conf.AlgorithmService, bool) {
+	var removed conf.AlgorithmService
+	found := false
+	for taskType, services := range r.services {
+		for _, svc := range services {
+			if svc.Endpoint == endpoint {
+				removed = svc
+				found = true
+			}
+		}
+		r.removeServiceByEndpointLocked(endpoint, taskType)
+	}
+	return removed, found
+}
+
 // removeServiceByIDLocked 移除指定ID的服务（需要已加锁）
 func (r *AlgorithmRegistry) removeServiceByIDLocked(serviceID, taskType string) bool {
 	services, ok := r.services[taskType]
@@ -555,185 +869,128 @@ func (r *AlgorithmRegistry) ListAllServiceInstancesLocked() []conf.AlgorithmServ
 	return all
 }
 
+// MaxBatchSize 返回已注册实例中最大的批量推理图片数（未启用批量推理时为1），
+// 推理worker据此从队列批量取图，使批次能够凑满
+func (r *AlgorithmRegistry) MaxBatchSize() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	size := 1
+	for _, services := range r.services {
+		for _, svc := range services {
+			if !svc.Shadow && svc.MaxBatchSize > size {
+				size = svc.MaxBatchSize
+			}
+		}
+	}
+	return size
+}
+
 // GetAlgorithmWithLoadBalance 使用负载均衡策略选择一个算法实例（不增加计数）
-// 策略：自适应负载均衡
-// 1. 如果所有实例调用次数相同，使用Round-Robin轮询
-// 2. 否则选择调用次数最少的实例
-// 注意：此函数只负责选择，不增加计数。计数应该在调用成功后通过 IncrementCallCount 增加
-func (r *AlgorithmRegistry) GetAlgorithmWithLoadBalance(taskType string) *conf.AlgorithmService {
+// 策略由全局配置或任务类型覆盖决定（见 LoadBalanceStrategy），taskID 用于一致性哈希
+// 注意：此函数只负责选择，不增加计数，也不占用半开熔断器的探测名额。计数应该在调用成功后通过 RecordInferenceSuccess 增加
+func (r *AlgorithmRegistry) GetAlgorithmWithLoadBalance(taskType, taskID string) *conf.AlgorithmService {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	return r.selectLocked(taskType, taskID)
+}
 
-	services, ok := r.services[taskType]
-	if !ok || len(services) == 0 {
+// AcquireAlgorithm 选择一个算法实例用于推理，选中半开状态的实例时占用探测名额
+// 返回的探测凭证（非探测请求为0）需要传给 RecordInferenceSuccess/RecordInferenceFailure 和 EndInference
+func (r *AlgorithmRegistry) AcquireAlgorithm(taskType, taskID string) (*conf.AlgorithmService, uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	selected := r.selectLocked(taskType, taskID)
+	if selected == nil {
+		return nil, 0
+	}
+	var probe uint64
+	if b := r.breakerLocked(selected.Endpoint); b != nil {
+		probe = b.acquire()
+	}
+	return selected, probe
+}
+
+// selectLocked 按负载均衡策略选择实例（需要已加锁）
+func (r *AlgorithmRegistry) selectLocked(taskType, taskID string) *conf.AlgorithmService {
+	// 影子服务不参与调度
+	services := primaryServices(r.services[taskType])
+	if len(services) == 0 {
 		r.log.Warn("no algorithm service available for task type",
 			slog.String("task_type", taskType),
 			slog.Int("total_registered_endpoints", len(r.ListAllServiceInstancesLocked())))
 		return nil
 	}
 
-	// 记录可用服务列表（debug）
-	endpoints := make([]string, len(services))
-	callCounts := make([]int, len(services))
-	for i, svc := range services {
-		endpoints[i] = svc.Endpoint
-		callCounts[i] = r.callCounters[svc.Endpoint]
+	// 剔除被熔断的实例
+	services = r.availableLocked(services)
+	if len(services) == 0 {
+		r.log.Warn("all algorithm services for task type are ejected by circuit breaker",
+			slog.String("task_type", taskType))
+		return nil
 	}
 
-	r.log.Debug("load balance: available services",
-		slog.String("task_type", taskType),
-		slog.Int("service_count", len(services)),
-		slog.Any("endpoints", endpoints),
-		slog.Any("call_counts", callCounts))
+	// 灰度发布：选出本次推理使用的版本分组
+	services = r.canaryFilterLocked(taskType, taskID, services)
 
 	if len(services) == 1 {
 		// 只有一个实例，直接返回（不增加计数）
-		selected := &services[0]
+		selected := services[0]
 
 		r.log.Debug("load balance: single service",
 			slog.String("task_type", taskType),
 			slog.String("endpoint", selected.Endpoint))
 
-		return selected
+		return &selected
 	}
 
-	// 负载均衡策略：加权轮询（Weighted Round Robin）
-	// 核心原则：
-	// 1. 保证每个服务都能获得请求（公平性）
-	// 2. 根据总耗时动态调整分配权重（性能优化）
-	// 3. 响应越快，权重越高，获得更多请求
-
-	type serviceWeight struct {
-		index       int
-		endpoint    string
-		serviceID   string
-		avgRespTime int64 // 平均响应时间（毫秒）
-		weight      int   // 计算出的权重
-		hasData     bool  // 是否有响应时间数据
+	strategy := r.strategyForLocked(taskType)
+	candidates := r.candidatesLocked(services)
+	idx := strategy.Select(LBRequest{TaskType: taskType, TaskID: taskID}, candidates)
+	if idx < 0 || idx >= len(services) {
+		idx = 0
 	}
+	selected := services[idx]
+	c := candidates[idx]
 
-	// 计算每个服务的权重
-	weights := make([]serviceWeight, len(services))
-	totalWeight := 0
-	newServiceCount := 0
-
-	for i, svc := range services {
-		times := r.responseTimes[svc.Endpoint]
-
-		if len(times) == 0 {
-			// 新服务：给予中等权重，让它们快速参与并收集数据
-			weights[i] = serviceWeight{
-				index:       i,
-				endpoint:    svc.Endpoint,
-				serviceID:   svc.ServiceID,
-				avgRespTime: 0,
-				weight:      10, // 新服务默认权重10
-				hasData:     false,
-			}
-			newServiceCount++
-			totalWeight += 10
-		} else {
-			// 计算平均响应时间
-			var sum int64
-			for _, t := range times {
-				sum += t
-			}
-			avgTime := sum / int64(len(times))
-
-			// 计算权重：响应时间越短，权重越高
-			// 权重公式：weight = max(1, 1000 / avgTime)
-			// 例如：50ms → 权重20，100ms → 权重10，200ms → 权重5
-			var weight int
-			if avgTime > 0 {
-				weight = int(1000 / avgTime)
-				if weight < 1 {
-					weight = 1 // 最小权重1，保证每个服务都能获得请求
-				}
-				if weight > 100 {
-					weight = 100 // 最大权重100，避免极端情况
-				}
-			} else {
-				weight = 10 // 默认权重
-			}
-
-			weights[i] = serviceWeight{
-				index:       i,
-				endpoint:    svc.Endpoint,
-				serviceID:   svc.ServiceID,
-				avgRespTime: avgTime,
-				weight:      weight,
-				hasData:     true,
-			}
-			totalWeight += weight
-		}
-	}
-
-	// 使用加权轮询选择服务
-	counter := r.weightCounters[taskType]
-	r.weightCounters[taskType] = (counter + 1) % totalWeight
+	r.log.Debug("load balance: service selected",
+		slog.String("strategy", strategy.Name()),
+		slog.String("task_type", taskType),
+		slog.String("task_id", taskID),
+		slog.String("selected_endpoint", selected.Endpoint),
+		slog.String("selected_service_id", selected.ServiceID),
+		slog.Int("weight", c.Weight),
+		slog.Int64("avg_response_time_ms", c.AvgResponseMs),
+		slog.Int("in_flight", c.InFlight),
+		slog.Int("priority", selected.Priority),
+		slog.Int("total_services", len(services)))
+
+	return &selected
+}
 
-	// 找出counter对应的服务
-	var selected *conf.AlgorithmService
-	cumulative := 0
-	selectedIdx := 0
+// BeginInference 标记一次推理请求开始（least_in_flight 策略依赖此计数）
+func (r *AlgorithmRegistry) BeginInference(endpoint string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inFlight[endpoint]++
+	r.shareInFlightLocked(endpoint, 1)
+}
 
-	for i, w := range weights {
-		cumulative += w.weight
-		if counter < cumulative {
-			selected = &services[i]
-			selectedIdx = i
-			break
-		}
+// EndInference 标记一次推理请求结束（无论成功或失败）
+// 未记录结果的请求（如图片不存在）在此释放 probe 对应的半开探测名额
+func (r *AlgorithmRegistry) EndInference(endpoint string, probe uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b := r.breakerLocked(endpoint); b != nil {
+		b.release(probe)
 	}
-
-	// 如果没有找到（理论上不应该发生），使用Round-Robin兜底
-	if selected == nil {
-		idx := r.rrIndexes[taskType] % len(services)
-		selected = &services[idx]
-		selectedIdx = idx
-		r.rrIndexes[taskType] = (r.rrIndexes[taskType] + 1) % len(services)
-
-		r.log.Warn("load balance: fallback to round-robin",
-			slog.String("task_type", taskType),
-			slog.String("selected_endpoint", selected.Endpoint))
-	} else {
-		// 记录选择结果
-		w := weights[selectedIdx]
-
-		// 构建所有服务的权重信息（用于调试）
-		weightInfo := make([]map[string]interface{}, len(weights))
-		for i, weight := range weights {
-			weightInfo[i] = map[string]interface{}{
-				"endpoint":    weight.endpoint,
-				"weight":      weight.weight,
-				"avg_time_ms": weight.avgRespTime,
-				"has_data":    weight.hasData,
-			}
-		}
-
-		if w.hasData {
-			r.log.Debug("load balance: weighted round-robin selected",
-				slog.String("task_type", taskType),
-				slog.String("selected_endpoint", selected.Endpoint),
-				slog.String("selected_service_id", selected.ServiceID),
-				slog.Int64("avg_response_time_ms", w.avgRespTime),
-				slog.Int("weight", w.weight),
-				slog.Int("total_weight", totalWeight),
-				slog.Int("counter", counter),
-				slog.Int("total_services", len(services)),
-				slog.Any("all_weights", weightInfo))
-		} else {
-			r.log.Debug("load balance: new service selected for data collection",
-				slog.String("task_type", taskType),
-				slog.String("selected_endpoint", selected.Endpoint),
-				slog.String("selected_service_id", selected.ServiceID),
-				slog.Int("weight", w.weight),
-				slog.Int("new_services_count", newServiceCount),
-				slog.Int("total_services", len(services)))
-		}
+	r.shareInFlightLocked(endpoint, -1)
+	if r.inFlight[endpoint] <= 1 {
+		delete(r.inFlight, endpoint)
+		return
 	}
-
-	return selected
+	r.inFlight[endpoint]--
 }
 
 // GetAlgorithmByEndpoint 根据任务类型和端点返回算法实例
@@ -760,17 +1017,20 @@ func (r *AlgorithmRegistry) IncrementCallCount(endpoint string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.callCounters[endpoint]++
+	r.shareCallLocked(endpoint, -1)
 }
 
 // RecordInferenceSuccess 记录推理成功（增加调用计数，记录响应时间）
 // 注意：推理成功只增加计数，不影响服务在线状态（服务状态由心跳决定）
 // responseTimeMs: 推理响应时间（毫秒）
-func (r *AlgorithmRegistry) RecordInferenceSuccess(endpoint string, responseTimeMs int64) {
+// probe: AcquireAlgorithm 返回的探测凭证，半开状态下只有探测请求的结果计入熔断器
+func (r *AlgorithmRegistry) RecordInferenceSuccess(endpoint string, responseTimeMs int64, probe uint64) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	// 增加成功计数
 	r.callCounters[endpoint]++
+	r.shareCallLocked(endpoint, responseTimeMs)
 
 	// 记录响应时间（使用滑动窗口，只保留最近N次）
 	times := r.responseTimes[endpoint]
@@ -787,6 +1047,10 @@ func (r *AlgorithmRegistry) RecordInferenceSuccess(endpoint string, responseTime
 	}
 	avgTime := sum / int64(len(times))
 
+	if b := r.breakerLocked(endpoint); b != nil && b.record(false, responseTimeMs, probe, time.Now()) {
+		r.notifyBreakerChangeLocked(endpoint, b)
+	}
+
 	r.log.Debug("inference success recorded",
 		slog.String("endpoint", endpoint),
 		slog.Int("success_count", r.callCounters[endpoint]),
@@ -795,15 +1059,21 @@ func (r *AlgorithmRegistry) RecordInferenceSuccess(endpoint string, responseTime
 		slog.Int("sample_count", len(times)))
 }
 
-// RecordInferenceFailure 记录推理失败（仅记录日志，不注销服务）
-// 注意：推理失败不影响服务在线状态（服务状态由心跳决定）
+// RecordInferenceFailure 记录推理失败（不注销服务，计入熔断统计）
+// 注意：推理失败不影响服务在线状态（服务状态由心跳决定），但启用熔断时错误率过高的实例会被暂时剔除
 // 服务的注销完全由心跳超时机制处理
-func (r *AlgorithmRegistry) RecordInferenceFailure(endpoint, serviceID string) {
-	// 只记录日志，不做任何状态改变
+func (r *AlgorithmRegistry) RecordInferenceFailure(endpoint, serviceID string, probe uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.log.Warn("inference call failed",
 		slog.String("endpoint", endpoint),
 		slog.String("service_id", serviceID),
 		slog.String("note", "service status is managed by heartbeat, not by inference failures"))
+
+	if b := r.breakerLocked(endpoint); b != nil && b.record(true, 0, probe, time.Now()) {
+		r.notifyBreakerChangeLocked(endpoint, b)
+	}
 }
 
 // GetCallCount 获取调用次数
@@ -817,6 +1087,7 @@ func (r *AlgorithmRegistry) GetCallCount(endpoint string) int {
 // LoadBalanceInfo 负载均衡信息
 type LoadBalanceInfo struct {
 	TaskType      string                   `json:"task_type"`
+	Strategy      string                   `json:"strategy"` // 当前使用的负载均衡策略
 	TotalServices int                      `json:"total_services"`
 	Services      []ServiceLoadBalanceInfo `json:"services"`
 	TotalWeight   int                      `json:"total_weight"`
@@ -831,7 +1102,10 @@ type ServiceLoadBalanceInfo struct {
 	AvgResponseMs   int64   `json:"avg_response_ms"`  // 平均响应时间
 	Weight          int     `json:"weight"`           // 当前权重
 	CallCount       int     `json:"call_count"`       // 调用次数
-	AllocationRatio float64 `json:"allocation_ratio"` // 分配比例（%）
+	InFlight        int     `json:"in_flight"`        // 进行中的请求数
+	Priority        int     `json:"priority"`         // 优先级（数值越小越优先）
+	BreakerState    string  `json:"breaker_state"`    // 熔断状态：closed|open|half_open，未启用熔断时为空
+	AllocationRatio float64 `json:"allocation_ratio"` // 分配比例（%），策略无法预估时为实际调用占比
 	HasData         bool    `json:"has_data"`         // 是否有性能数据
 }
 
@@ -840,68 +1114,62 @@ func (r *AlgorithmRegistry) GetLoadBalanceInfo(taskType string) *LoadBalanceInfo
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	services, ok := r.services[taskType]
-	if !ok || len(services) == 0 {
+	services := primaryServices(r.services[taskType])
+	if len(services) == 0 {
 		return nil
 	}
 
-	// 计算权重（与GetAlgorithmWithLoadBalance中的逻辑一致）
+	strategy := r.strategyForLocked(taskType)
+	candidates := r.candidatesLocked(services)
+
 	totalWeight := 0
+	totalCalls := 0
 	serviceInfos := make([]ServiceLoadBalanceInfo, len(services))
-
-	for i, svc := range services {
-		times := r.responseTimes[svc.Endpoint]
-		var avgTime int64
-		var weight int
-		hasData := false
-
-		if len(times) == 0 {
-			// 新服务：默认权重10
-			weight = 10
-		} else {
-			// 计算平均响应时间
-			var sum int64
-			for _, t := range times {
-				sum += t
-			}
-			avgTime = sum / int64(len(times))
-			hasData = true
-
-			// 计算权重：weight = max(1, min(100, 1000 / avgTime))
-			if avgTime > 0 {
-				weight = int(1000 / avgTime)
-				if weight < 1 {
-					weight = 1
-				}
-				if weight > 100 {
-					weight = 100
-				}
-			} else {
-				weight = 10
-			}
+	for i, c := range candidates {
+		serviceInfos[i] = ServiceLoadBalanceInfo{
+			Endpoint:      c.Service.Endpoint,
+			ServiceID:     c.Service.ServiceID,
+			Name:          c.Service.Name,
+			AvgResponseMs: c.AvgResponseMs,
+			Weight:        c.Weight,
+			CallCount:     c.CallCount,
+			InFlight:      c.InFlight,
+			Priority:      c.Service.Priority,
+			BreakerState:  r.breakerStateLocked(c.Service.Endpoint),
+			HasData:       c.HasData,
 		}
+		totalWeight += c.Weight
+		totalCalls += c.CallCount
+	}
 
-		serviceInfos[i] = ServiceLoadBalanceInfo{
-			Endpoint:      svc.Endpoint,
-			ServiceID:     svc.ServiceID,
-			Name:          svc.Name,
-			AvgResponseMs: avgTime,
-			Weight:        weight,
-			CallCount:     r.callCounters[svc.Endpoint],
-			HasData:       hasData,
+	// 熔断中的实例不参与分配
+	var available []LBCandidate
+	var availableIdx []int
+	for i, c := range candidates {
+		if serviceInfos[i].BreakerState != string(BreakerOpen) {
+			available = append(available, c)
+			availableIdx = append(availableIdx, i)
 		}
-		totalWeight += weight
 	}
 
-	// 计算分配比例
-	for i := range serviceInfos {
-		if totalWeight > 0 {
-			serviceInfos[i].AllocationRatio = float64(serviceInfos[i].Weight) / float64(totalWeight) * 100
+	// 计算分配比例：优先使用策略的预期比例，否则使用实际调用占比（全部熔断时均为0）
+	var ratios []float64
+	if len(available) > 0 {
+		ratios = strategy.Allocation(available)
+	}
+	if ratios != nil {
+		for j, i := range availableIdx {
+			serviceInfos[i].AllocationRatio = ratios[j]
+		}
+	} else if len(available) > 0 && totalCalls > 0 {
+		for i := range serviceInfos {
+			serviceInfos[i].AllocationRatio = float64(serviceInfos[i].CallCount) / float64(totalCalls) * 100
 		}
 	}
 
 	return &LoadBalanceInfo{
 		TaskType:      taskType,
+		Strategy:      strategy.Name(),
 		TotalServices: len(services),
 		Services:      serviceInfos,
 		TotalWeight:   totalWeight,
@@ -932,13 +1200,18 @@ func (r *AlgorithmRegistry) GetAllLoadBalanceInfo() map[string]*LoadBalanceInfo
 // ServiceStat 服务统计信息
 type ServiceStat struct {
 	ServiceID     string   `json:"service_id"`
+	AppID         string   `json:"app_id,omitempty"` // 注册该服务的算法厂商应用
 	Name          string   `json:"name"`
 	Endpoint      string   `json:"endpoint"`
+	Protocol      string   `json:"protocol"`
 	Version       string   `json:"version"`
 	TaskTypes     []string `json:"task_types"`
+	Shadow        bool     `json:"shadow,omitempty"` // 影子服务
 	CallCount     int      `json:"call_count"`
 	LastHeartbeat int64    `json:"last_heartbeat"`
 	RegisterAt    int64    `json:"register_at"`
+
+	Breaker *BreakerStatus `json:"breaker,omitempty"` // 熔断状态（启用熔断时返回）
 }
 
 // GetServiceStats 获取服务统计信息
@@ -955,14 +1228,21 @@ func (r *AlgorithmRegistry) GetServiceStats(taskType string) []ServiceStat {
 	for i, svc := range services {
 		stats[i] = ServiceStat{
 			ServiceID:     svc.ServiceID,
+			AppID:         svc.AppID,
 			Name:          svc.Name,
 			Endpoint:      svc.Endpoint,
+			Protocol:      svc.Protocol,
 			Version:       svc.Version,
 			TaskTypes:     svc.TaskTypes,
+			Shadow:        svc.Shadow,
 			CallCount:     r.callCounters[svc.Endpoint], // 使用endpoint作为key
 			LastHeartbeat: svc.LastHeartbeat,
 			RegisterAt:    svc.RegisterAt,
 		}
+		if b, ok := r.breakers[svc.Endpoint]; ok && r.breakerCfg.Enable {
+			status := b.status()
+			stats[i].Breaker = &status
+		}
 	}
 
 	return stats
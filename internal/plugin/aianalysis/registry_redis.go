@@ -0,0 +1,295 @@
+package aianalysis
+
+import (
+	"context"
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultRegistryKeyPrefix 共享注册中心默认键前缀
+const defaultRegistryKeyPrefix = "easydarwin:ai:registry"
+
+// expireServiceScript 心跳早于截止时间时删除服务；服务已不存在也视为过期
+var expireServiceScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[2], ARGV[1])
+if score and tonumber(score) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[1], ARGV[1])
+return 1
+`)
+
+// refreshServiceScript 服务存在时更新服务信息和心跳时间
+var refreshServiceScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[1])
+return 1
+`)
+
+// redisRegistryStore 基于 Redis 的共享注册信息存储
+//
+//	<prefix>:services        HASH  endpoint -> 服务JSON
+//	<prefix>:heartbeats      ZSET  endpoint -> 最后心跳时间（用于原子判断过期）
+//	<prefix>:calls           HASH  endpoint -> 调用次数
+//	<prefix>:rt:<endpoint>   LIST  最近的响应时间（新的在前）
+//	<prefix>:events          注册/注销事件频道
+//
+// 进行中请求数使用 data.Cache 的服务负载（service:<prefix>:<endpoint>:load 的 len 字段）
+type redisRegistryStore struct {
+	client *redis.Client
+	cache  *data.Cache
+	prefix string
+}
+
+var _ sharedRegistryStore = (*redisRegistryStore)(nil)
+
+// newRedisRegistryStore 连接 Redis 并创建共享注册信息存储
+// 使用独立的连接池，不影响全局的 data.RedisCli，关闭时只关闭自己的连接
+func newRedisRegistryStore(cfg conf.RegistryConfig) (*redisRegistryStore, error) {
+	if cfg.RedisAddr == "" {
+		return nil, fmt.Errorf("registry.redis_addr required")
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.RedisAddr,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect redis failed: %w", err)
+	}
+	prefix := cfg.KeyPrefix
+	if prefix == "" {
+		prefix = defaultRegistryKeyPrefix
+	}
+	return &redisRegistryStore{client: client, cache: data.NewCache(client), prefix: prefix}, nil
+}
+
+func (s *redisRegistryStore) key(name string) string {
+	return s.prefix + ":" + name
+}
+
+// loadID data.Cache 服务负载使用的ID
+func (s *redisRegistryStore) loadID(endpoint string) string {
+	return s.prefix + ":" + endpoint
+}
+
+func (s *redisRegistryStore) SaveService(ctx context.Context, svc conf.AlgorithmService) error {
+	b, err := json.Marshal(svc)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, s.key("services"), svc.Endpoint, b)
+		pipe.ZAdd(ctx, s.key("heartbeats"), redis.Z{Score: float64(svc.LastHeartbeat), Member: svc.Endpoint})
+		return nil
+	})
+	return err
+}
+
+func (s *redisRegistryStore) RefreshService(ctx context.Context, svc conf.AlgorithmService) error {
+	b, err := json.Marshal(svc)
+	if err != nil {
+		return err
+	}
+	return refreshServiceScript.Run(ctx, s.client,
+		[]string{s.key("services"), s.key("heartbeats")}, svc.Endpoint, b, svc.LastHeartbeat).Err()
+}
+
+func (s *redisRegistryStore) RemoveService(ctx context.Context, endpoint string) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, s.key("services"), endpoint)
+		pipe.ZRem(ctx, s.key("heartbeats"), endpoint)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// 服务下线后清零进行中请求数，避免异常退出的节点遗留计数
+	return s.cache.SetServiceLoad(ctx, s.loadID(endpoint), data.ServiceLoad{})
+}
+
+func (s *redisRegistryStore) ExpireService(ctx context.Context, endpoint string, deadline int64) (bool, error) {
+	n, err := expireServiceScript.Run(ctx, s.client,
+		[]string{s.key("services"), s.key("heartbeats")}, endpoint, deadline).Int()
+	if err != nil {
+		return false, err
+	}
+	if n == 1 {
+		if err := s.cache.SetServiceLoad(ctx, s.loadID(endpoint), data.ServiceLoad{}); err != nil {
+			slog.Warn("failed to reset service load", slog.String("endpoint", endpoint), slog.String("err", err.Error()))
+		}
+	}
+	return n == 1, nil
+}
+
+func (s *redisRegistryStore) LoadServices(ctx context.Context) ([]conf.AlgorithmService, error) {
+	values, err := s.client.HGetAll(ctx, s.key("services")).Result()
+	if err != nil {
+		return nil, err
+	}
+	services := make([]conf.AlgorithmService, 0, len(values))
+	for endpoint, v := range values {
+		var svc conf.AlgorithmService
+		if err := json.Unmarshal([]byte(v), &svc); err != nil {
+			slog.Warn("invalid service in shared registry", slog.String("endpoint", endpoint), slog.String("err", err.Error()))
+			continue
+		}
+		services = append(services, svc)
+	}
+	return services, nil
+}
+
+func (s *redisRegistryStore) AddCallCount(ctx context.Context, endpoint string, n int64) error {
+	return s.client.HIncrBy(ctx, s.key("calls"), endpoint, n).Err()
+}
+
+func (s *redisRegistryStore) AddInFlight(ctx context.Context, endpoint string, delta int64) error {
+	return s.cache.AddServiceLoad(ctx, s.loadID(endpoint), delta)
+}
+
+func (s *redisRegistryStore) AddResponseTimes(ctx context.Context, endpoint string, ms []int64) error {
+	if len(ms) == 0 {
+		return nil
+	}
+	values := make([]interface{}, len(ms))
+	for i, v := range ms {
+		values[i] = v
+	}
+	key := s.key("rt:" + endpoint)
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		// LPUSH 依次插入表头，最新的在最前
+		pipe.LPush(ctx, key, values...)
+		pipe.LTrim(ctx, key, 0, ResponseTimeWindow-1)
+		return nil
+	})
+	return err
+}
+
+func (s *redisRegistryStore) LoadStats(ctx context.Context, endpoints []string) (map[string]sharedStats, error) {
+	calls, err := s.client.HGetAll(ctx, s.key("calls")).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	rts := make(map[string]*redis.StringSliceCmd, len(endpoints))
+	if _, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, endpoint := range endpoints {
+			rts[endpoint] = pipe.LRange(ctx, s.key("rt:"+endpoint), 0, ResponseTimeWindow-1)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]sharedStats, len(endpoints))
+	for _, endpoint := range endpoints {
+		var st sharedStats
+		st.CallCount, _ = strconv.Atoi(calls[endpoint])
+
+		load, err := s.cache.ServiceLoad(ctx, s.loadID(endpoint))
+		if err != nil {
+			return nil, err
+		}
+		st.InFlight = max(load.Len, 0)
+
+		// 列表中新的在前，转换为从旧到新
+		values := rts[endpoint].Val()
+		for i := len(values) - 1; i >= 0; i-- {
+			if ms, err := strconv.ParseInt(values[i], 10, 64); err == nil {
+				st.ResponseTimes = append(st.ResponseTimes, ms)
+			}
+		}
+		stats[endpoint] = st
+	}
+	return stats, nil
+}
+
+func (s *redisRegistryStore) Publish(ctx context.Context, ev registryEvent) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return s.client.Publish(ctx, s.key("events"), b).Err()
+}
+
+func (s *redisRegistryStore) Subscribe(ctx context.Context) <-chan registryEvent {
+	out := make(chan registryEvent)
+	pubsub := s.client.Subscribe(ctx, s.key("events"))
+	go func() {
+		defer close(out)
+		defer pubsub.Close()
+
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				var ev registryEvent
+				if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+					slog.Warn("invalid shared registry event", slog.String("err", err.Error()))
+					continue
+				}
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func (s *redisRegistryStore) Close() error {
+	return s.client.Close()
+}
+
+// initSharedRegistry 按配置启用共享注册中心（backend=redis），需要在设置注册/注销回调之后调用
+func (s *Service) initSharedRegistry() error {
+	cfg := s.cfg.Registry
+	switch cfg.Backend {
+	case "", "memory":
+		return nil
+	case "redis":
+	default:
+		return fmt.Errorf("unsupported registry backend: %s", cfg.Backend)
+	}
+
+	store, err := newRedisRegistryStore(cfg)
+	if err != nil {
+		return err
+	}
+
+	nodeID := cfg.NodeID
+	if nodeID == "" {
+		host, _ := os.Hostname()
+		nodeID = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	s.registry.EnableSharedStore(store, nodeID, time.Duration(cfg.SyncIntervalSec)*time.Second)
+
+	s.log.Info("shared algorithm registry enabled",
+		slog.String("backend", cfg.Backend),
+		slog.String("redis_addr", cfg.RedisAddr),
+		slog.String("key_prefix", store.prefix),
+		slog.String("node_id", nodeID))
+	return nil
+}
@@ -0,0 +1,470 @@
+package aianalysis
+
+import (
+	"context"
+	"easydarwin/internal/conf"
+	"log/slog"
+	"time"
+)
+
+// 注册中心集群事件类型
+const (
+	registryEventRegister   = "register"
+	registryEventUnregister = "unregister"
+)
+
+// sharedOpTimeout 单次共享存储操作超时时间
+const sharedOpTimeout = 3 * time.Second
+
+// registryEvent 注册中心集群事件（通过 pub/sub 广播给所有节点）
+type registryEvent struct {
+	Node    string                `json:"node"` // 发出事件的节点，节点忽略自己发出的事件
+	Type    string                `json:"type"` // register|unregister
+	Service conf.AlgorithmService `json:"service"`
+	Reason  string                `json:"reason,omitempty"` // 注销原因：unregistered|heartbeat_timeout|cleared
+}
+
+// sharedStats 集群共享的负载统计
+type sharedStats struct {
+	CallCount     int
+	InFlight      int
+	ResponseTimes []int64 // 最近的响应时间（从旧到新）
+}
+
+// sharedRegistryStore 集群共享的注册信息存储，服务按 endpoint 保存
+type sharedRegistryStore interface {
+	// SaveService 保存服务（注册）
+	SaveService(ctx context.Context, svc conf.AlgorithmService) error
+	// RefreshService 更新已存在的服务（心跳），不会恢复已删除的服务
+	RefreshService(ctx context.Context, svc conf.AlgorithmService) error
+	// RemoveService 删除服务
+	RemoveService(ctx context.Context, endpoint string) error
+	// ExpireService 服务心跳早于 deadline 时删除，返回服务是否已不在存储中
+	ExpireService(ctx context.Context, endpoint string, deadline int64) (bool, error)
+	// LoadServices 加载所有服务
+	LoadServices(ctx context.Context) ([]conf.AlgorithmService, error)
+	// AddCallCount 增加调用次数
+	AddCallCount(ctx context.Context, endpoint string, n int64) error
+	// AddInFlight 增减进行中的请求数
+	AddInFlight(ctx context.Context, endpoint string, delta int64) error
+	// AddResponseTimes 记录响应时间（从旧到新），只保留最近 ResponseTimeWindow 次
+	AddResponseTimes(ctx context.Context, endpoint string, ms []int64) error
+	// LoadStats 加载指定endpoint的负载统计
+	LoadStats(ctx context.Context, endpoints []string) (map[string]sharedStats, error)
+	// Publish 广播集群事件
+	Publish(ctx context.Context, ev registryEvent) error
+	// Subscribe 订阅集群事件，ctx 取消后关闭通道
+	Subscribe(ctx context.Context) <-chan registryEvent
+	Close() error
+}
+
+// sharedDeltas 本节点尚未写入共享存储的增量，由同步协程定期写入（避免每次推理都访问共享存储）
+type sharedDeltas struct {
+	calls         map[string]int64                 // endpoint -> 调用次数增量
+	inFlight      map[string]int64                 // endpoint -> 进行中请求数增量
+	responseTimes map[string][]int64               // endpoint -> 响应时间（从旧到新）
+	heartbeats    map[string]conf.AlgorithmService // endpoint -> 最新心跳
+}
+
+func newSharedDeltas() sharedDeltas {
+	return sharedDeltas{
+		calls:         make(map[string]int64),
+		inFlight:      make(map[string]int64),
+		responseTimes: make(map[string][]int64),
+		heartbeats:    make(map[string]conf.AlgorithmService),
+	}
+}
+
+// EnableSharedStore 启用集群共享存储：加载集群中已注册的服务，订阅注册/注销事件并定期同步心跳和负载统计
+// 需要在设置注册/注销回调之后调用，集群中已有的服务会触发注册回调
+func (r *AlgorithmRegistry) EnableSharedStore(store sharedRegistryStore, nodeID string, syncInterval time.Duration) {
+	if syncInterval <= 0 {
+		syncInterval = 5 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.mu.Lock()
+	r.shared = store
+	r.nodeID = nodeID
+	r.syncInterval = syncInterval
+	r.ownInFlight = make(map[string]int)
+	r.pending = newSharedDeltas()
+	r.stopShared = cancel
+	r.mu.Unlock()
+
+	events := store.Subscribe(ctx)
+	r.syncShared()
+
+	go func() {
+		ticker := time.NewTicker(syncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-events:
+				if !ok {
+					// 订阅断开：稍后重新订阅，并全量同步以补上期间遗漏的事件
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(syncInterval):
+					}
+					events = store.Subscribe(ctx)
+					r.syncShared()
+					continue
+				}
+				r.handleSharedEvent(ev)
+			case <-ticker.C:
+				r.syncShared()
+			}
+		}
+	}()
+}
+
+// CloseSharedStore 停止集群同步，写入剩余的增量，归还本节点计入的进行中请求数并关闭共享存储
+func (r *AlgorithmRegistry) CloseSharedStore() {
+	r.mu.Lock()
+	store, cancel, own, pending := r.shared, r.stopShared, r.ownInFlight, r.pending
+	r.shared = nil
+	r.ownInFlight = nil
+	r.pending = sharedDeltas{}
+	r.mu.Unlock()
+
+	if store == nil {
+		return
+	}
+	cancel()
+
+	// 尚未写入的进行中请求数增量直接丢弃，只归还已写入共享存储的部分
+	release := make(map[string]int64, len(own))
+	for endpoint, n := range own {
+		if written := int64(n) - pending.inFlight[endpoint]; written > 0 {
+			release[endpoint] = -written
+		}
+	}
+	pending.inFlight = release
+	r.writeShared(store, pending)
+
+	if err := store.Close(); err != nil {
+		r.log.Warn("failed to close shared registry store", slog.String("err", err.Error()))
+	}
+}
+
+// share 执行共享存储操作，失败只记录日志，不影响本节点的注册信息
+func (r *AlgorithmRegistry) share(store sharedRegistryStore, op string, fn func(ctx context.Context, st sharedRegistryStore) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sharedOpTimeout)
+	defer cancel()
+	if err := fn(ctx, store); err != nil {
+		r.log.Warn("shared registry operation failed",
+			slog.String("op", op),
+			slog.String("err", err.Error()))
+	}
+}
+
+// shareRemoved 从共享存储删除服务并通知其他节点
+func (r *AlgorithmRegistry) shareRemoved(store sharedRegistryStore, services []conf.AlgorithmService, reason string) {
+	r.share(store, "remove", func(ctx context.Context, st sharedRegistryStore) error {
+		for _, svc := range services {
+			if err := st.RemoveService(ctx, svc.Endpoint); err != nil {
+				return err
+			}
+			if err := st.Publish(ctx, registryEvent{Node: r.nodeID, Type: registryEventUnregister, Service: svc, Reason: reason}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// shareExpired 从共享存储删除心跳超时的服务并通知其他节点
+// 服务可能刚向其他节点发送了心跳，此时共享存储中的服务保留，下次同步时重新加入本节点
+func (r *AlgorithmRegistry) shareExpired(store sharedRegistryStore, services []conf.AlgorithmService, deadline int64) {
+	seen := make(map[string]bool)
+	r.share(store, "expire", func(ctx context.Context, st sharedRegistryStore) error {
+		for _, svc := range services {
+			if seen[svc.Endpoint] {
+				continue
+			}
+			seen[svc.Endpoint] = true
+
+			expired, err := st.ExpireService(ctx, svc.Endpoint, deadline)
+			if err != nil {
+				return err
+			}
+			if !expired {
+				r.log.Info("expired service is still alive in shared registry, will be restored on next sync",
+					slog.String("service_id", svc.ServiceID),
+					slog.String("endpoint", svc.Endpoint))
+				continue
+			}
+			if err := st.Publish(ctx, registryEvent{Node: r.nodeID, Type: registryEventUnregister, Service: svc, Reason: "heartbeat_timeout"}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// shareHeartbeatLocked 记录待写入共享存储的心跳（需要已加锁）
+func (r *AlgorithmRegistry) shareHeartbeatLocked(updated map[string]conf.AlgorithmService) {
+	if r.shared == nil {
+		return
+	}
+	for endpoint, svc := range updated {
+		r.pending.heartbeats[endpoint] = svc
+	}
+}
+
+// shareInFlightLocked 累积共享存储中的进行中请求数增量（需要已加锁）
+func (r *AlgorithmRegistry) shareInFlightLocked(endpoint string, delta int) {
+	if r.shared == nil {
+		return
+	}
+	// 只归还本节点计入的请求数
+	if delta < 0 && r.ownInFlight[endpoint] <= 0 {
+		return
+	}
+	r.ownInFlight[endpoint] += delta
+	r.pending.inFlight[endpoint] += int64(delta)
+}
+
+// shareCallLocked 累积调用次数增量，responseTimeMs 大于等于0时同时记录响应时间（需要已加锁）
+func (r *AlgorithmRegistry) shareCallLocked(endpoint string, responseTimeMs int64) {
+	if r.shared == nil {
+		return
+	}
+	r.pending.calls[endpoint]++
+	if responseTimeMs >= 0 {
+		times := append(r.pending.responseTimes[endpoint], responseTimeMs)
+		if len(times) > ResponseTimeWindow {
+			times = times[len(times)-ResponseTimeWindow:]
+		}
+		r.pending.responseTimes[endpoint] = times
+	}
+}
+
+// flushShared 将累积的增量写入共享存储，写入失败的计数增量保留到下次同步
+func (r *AlgorithmRegistry) flushShared(store sharedRegistryStore) {
+	r.mu.Lock()
+	if r.shared != store {
+		r.mu.Unlock()
+		return
+	}
+	pending := r.pending
+	r.pending = newSharedDeltas()
+	r.mu.Unlock()
+
+	failed := r.writeShared(store, pending)
+	if len(failed.calls) == 0 && len(failed.inFlight) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.shared != store {
+		return
+	}
+	for endpoint, n := range failed.calls {
+		r.pending.calls[endpoint] += n
+	}
+	for endpoint, n := range failed.inFlight {
+		r.pending.inFlight[endpoint] += n
+	}
+}
+
+// writeShared 写入增量，返回写入失败的计数增量（响应时间和心跳失败时丢弃）
+func (r *AlgorithmRegistry) writeShared(store sharedRegistryStore, d sharedDeltas) sharedDeltas {
+	failed := sharedDeltas{calls: make(map[string]int64), inFlight: make(map[string]int64)}
+	ctx, cancel := context.WithTimeout(context.Background(), sharedOpTimeout)
+	defer cancel()
+
+	var errs []error
+	for endpoint, n := range d.inFlight {
+		if n == 0 {
+			continue
+		}
+		if err := store.AddInFlight(ctx, endpoint, n); err != nil {
+			failed.inFlight[endpoint] = n
+			errs = append(errs, err)
+		}
+	}
+	for endpoint, n := range d.calls {
+		if err := store.AddCallCount(ctx, endpoint, n); err != nil {
+			failed.calls[endpoint] = n
+			errs = append(errs, err)
+		}
+	}
+	for endpoint, times := range d.responseTimes {
+		if err := store.AddResponseTimes(ctx, endpoint, times); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, svc := range d.heartbeats {
+		if err := store.RefreshService(ctx, svc); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		r.log.Warn("shared registry operation failed",
+			slog.String("op", "flush"),
+			slog.Int("failed", len(errs)),
+			slog.String("err", errs[0].Error()))
+	}
+	return failed
+}
+
+// handleSharedEvent 处理其他节点发出的注册/注销事件，并触发本节点的回调
+func (r *AlgorithmRegistry) handleSharedEvent(ev registryEvent) {
+	if ev.Node == r.nodeID || ev.Service.Endpoint == "" {
+		return
+	}
+
+	switch ev.Type {
+	case registryEventRegister:
+		r.mu.Lock()
+		r.addServiceLocked(ev.Service)
+		r.mu.Unlock()
+
+		r.log.Info("algorithm service registered on another node",
+			slog.String("node", ev.Node),
+			slog.String("service_id", ev.Service.ServiceID),
+			slog.String("endpoint", ev.Service.Endpoint),
+			slog.Any("task_types", ev.Service.TaskTypes))
+
+		if r.onRegisterCallback != nil && !ev.Service.Shadow {
+			go r.onRegisterCallback(ev.Service.ServiceID, ev.Service.TaskTypes)
+		}
+
+	case registryEventUnregister:
+		r.mu.Lock()
+		_, removed := r.removeEndpointLocked(ev.Service.Endpoint)
+		r.pruneBreakersLocked()
+		r.mu.Unlock()
+
+		// 本节点已移除（如自行检测到心跳超时）时不重复触发回调
+		if !removed {
+			return
+		}
+		r.log.Info("algorithm service unregistered on another node",
+			slog.String("node", ev.Node),
+			slog.String("service_id", ev.Service.ServiceID),
+			slog.String("endpoint", ev.Service.Endpoint),
+			slog.String("reason", ev.Reason))
+
+		if r.onUnregisterCallback != nil {
+			go r.onUnregisterCallback(ev.Service.ServiceID, ev.Reason)
+		}
+	}
+}
+
+// syncShared 写入本节点累积的增量后从共享存储全量同步：补齐遗漏的注册/注销，更新心跳时间和负载统计
+func (r *AlgorithmRegistry) syncShared() {
+	r.mu.RLock()
+	store := r.shared
+	r.mu.RUnlock()
+	if store == nil {
+		return
+	}
+	r.flushShared(store)
+	r.reloadCanaries()
+
+	ctx, cancel := context.WithTimeout(context.Background(), sharedOpTimeout)
+	defer cancel()
+
+	services, err := store.LoadServices(ctx)
+	if err != nil {
+		r.log.Warn("failed to load services from shared registry", slog.String("err", err.Error()))
+		return
+	}
+	remote := make(map[string]conf.AlgorithmService, len(services))
+	endpoints := make([]string, 0, len(services))
+	for _, svc := range services {
+		remote[svc.Endpoint] = svc
+		endpoints = append(endpoints, svc.Endpoint)
+	}
+	stats, err := store.LoadStats(ctx, endpoints)
+	if err != nil {
+		r.log.Warn("failed to load load stats from shared registry", slog.String("err", err.Error()))
+	}
+
+	var added, removed []conf.AlgorithmService
+	now := time.Now().Unix()
+
+	r.mu.Lock()
+	local := make(map[string]conf.AlgorithmService)
+	for _, svc := range r.ListAllServiceInstancesLocked() {
+		local[svc.Endpoint] = svc
+	}
+
+	for endpoint, svc := range remote {
+		l, ok := local[endpoint]
+		if !ok {
+			r.addServiceLocked(svc)
+			added = append(added, svc)
+			continue
+		}
+		if svc.LastHeartbeat <= l.LastHeartbeat {
+			continue
+		}
+		// 其他节点收到的心跳
+		for _, list := range r.services {
+			for i := range list {
+				if list[i].Endpoint == endpoint {
+					list[i].LastHeartbeat = svc.LastHeartbeat
+					list[i].TotalRequests = svc.TotalRequests
+					list[i].AvgInferenceTimeMs = svc.AvgInferenceTimeMs
+					list[i].LastInferenceTimeMs = svc.LastInferenceTimeMs
+					list[i].LastTotalTimeMs = svc.LastTotalTimeMs
+				}
+			}
+		}
+	}
+
+	// 共享存储中已不存在的服务（其他节点已注销），刚注册的服务可能尚未写入共享存储，暂不移除
+	for endpoint, svc := range local {
+		if _, ok := remote[endpoint]; ok || now-svc.RegisterAt <= int64(r.syncInterval.Seconds()) {
+			continue
+		}
+		r.removeEndpointLocked(endpoint)
+		removed = append(removed, svc)
+	}
+	if len(removed) > 0 {
+		r.pruneBreakersLocked()
+	}
+
+	// 加上写入后本节点新增、尚未写入共享存储的增量，避免覆盖同步期间的本地计数
+	for endpoint, st := range stats {
+		r.callCounters[endpoint] = st.CallCount + int(r.pending.calls[endpoint])
+		if inFlight := st.InFlight + int(r.pending.inFlight[endpoint]); inFlight > 0 {
+			r.inFlight[endpoint] = inFlight
+		} else {
+			delete(r.inFlight, endpoint)
+		}
+		times := append(st.ResponseTimes, r.pending.responseTimes[endpoint]...)
+		if len(times) > ResponseTimeWindow {
+			times = times[len(times)-ResponseTimeWindow:]
+		}
+		if len(times) > 0 {
+			r.responseTimes[endpoint] = times
+		}
+	}
+	r.mu.Unlock()
+
+	for _, svc := range added {
+		r.log.Info("algorithm service loaded from shared registry",
+			slog.String("service_id", svc.ServiceID),
+			slog.String("endpoint", svc.Endpoint))
+		if r.onRegisterCallback != nil && !svc.Shadow {
+			go r.onRegisterCallback(svc.ServiceID, svc.TaskTypes)
+		}
+	}
+	for _, svc := range removed {
+		r.log.Info("algorithm service removed by shared registry sync",
+			slog.String("service_id", svc.ServiceID),
+			slog.String("endpoint", svc.Endpoint))
+		if r.onUnregisterCallback != nil {
+			go r.onUnregisterCallback(svc.ServiceID, "cluster_sync")
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package aianalysis
+
+import (
+	"context"
+	"easydarwin/internal/conf"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSharedStore 内存实现的共享存储，多个注册中心共用一个实例模拟多节点
+type fakeSharedStore struct {
+	mu       sync.Mutex
+	services map[string]conf.AlgorithmService
+	calls    map[string]int
+	inFlight map[string]int
+	subs     []chan registryEvent
+}
+
+func newFakeSharedStore() *fakeSharedStore {
+	return &fakeSharedStore{
+		services: make(map[string]conf.AlgorithmService),
+		calls:    make(map[string]int),
+		inFlight: make(map[string]int),
+	}
+}
+
+func (f *fakeSharedStore) SaveService(_ context.Context, svc conf.AlgorithmService) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.services[svc.Endpoint] = svc
+	return nil
+}
+
+func (f *fakeSharedStore) RefreshService(_ context.Context, svc conf.AlgorithmService) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.services[svc.Endpoint]; ok {
+		f.services[svc.Endpoint] = svc
+	}
+	return nil
+}
+
+func (f *fakeSharedStore) RemoveService(_ context.Context, endpoint string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.services, endpoint)
+	return nil
+}
+
+func (f *fakeSharedStore) ExpireService(_ context.Context, endpoint string, deadline int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if svc, ok := f.services[endpoint]; ok && svc.LastHeartbeat >= deadline {
+		return false, nil
+	}
+	delete(f.services, endpoint)
+	return true, nil
+}
+
+func (f *fakeSharedStore) LoadServices(context.Context) ([]conf.AlgorithmService, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var services []conf.AlgorithmService
+	for _, svc := range f.services {
+		services = append(services, svc)
+	}
+	return services, nil
+}
+
+func (f *fakeSharedStore) AddCallCount(_ context.Context, endpoint string, n int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[endpoint] += int(n)
+	return nil
+}
+
+func (f *fakeSharedStore) AddInFlight(_ context.Context, endpoint string, delta int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inFlight[endpoint] += int(delta)
+	return nil
+}
+
+func (f *fakeSharedStore) AddResponseTimes(context.Context, string, []int64) error { return nil }
+
+func (f *fakeSharedStore) LoadStats(_ context.Context, endpoints []string) (map[string]sharedStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := make(map[string]sharedStats)
+	for _, endpoint := range endpoints {
+		stats[endpoint] = sharedStats{CallCount: f.calls[endpoint], InFlight: f.inFlight[endpoint]}
+	}
+	return stats, nil
+}
+
+func (f *fakeSharedStore) Publish(_ context.Context, ev registryEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, ch := range f.subs {
+		ch <- ev
+	}
+	return nil
+}
+
+func (f *fakeSharedStore) Subscribe(context.Context) <-chan registryEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan registryEvent, 16)
+	f.subs = append(f.subs, ch)
+	return ch
+}
+
+func (f *fakeSharedStore) Close() error { return nil }
+
+func (f *fakeSharedStore) callsOf(endpoint string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[endpoint]
+}
+
+func (f *fakeSharedStore) inFlightOf(endpoint string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.inFlight[endpoint]
+}
+
+// newSharedTestNode 创建使用共享存储的注册中心，回调事件写入返回的通道
+func newSharedTestNode(t *testing.T, store sharedRegistryStore, nodeID string) (*AlgorithmRegistry, chan string) {
+	t.Helper()
+	r := NewRegistry(90, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	events := make(chan string, 16)
+	r.SetOnRegisterCallback(func(serviceID string, _ []string) { events <- "register:" + serviceID })
+	r.SetOnUnregisterCallback(func(serviceID, reason string) { events <- "unregister:" + serviceID + ":" + reason })
+	r.EnableSharedStore(store, nodeID, time.Hour)
+	t.Cleanup(r.CloseSharedStore)
+	return r, events
+}
+
+func waitEvent(t *testing.T, events chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-events:
+		if got != want {
+			t.Fatalf("expect callback %s, got %s", want, got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for callback", want)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSharedRegistryRegisterAndUnregister(t *testing.T) {
+	store := newFakeSharedStore()
+	a, aEvents := newSharedTestNode(t, store, "node-a")
+	b, bEvents := newSharedTestNode(t, store, "node-b")
+
+	if err := a.Register(testService("gpu", 0)); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, aEvents, "register:gpu")
+	waitEvent(t, bEvents, "register:gpu")
+	if b.GetAlgorithmByEndpoint("人数统计", "gpu") == nil {
+		t.Fatal("service registered on node a should be visible on node b")
+	}
+
+	// 后启动的节点从共享存储加载已注册的服务
+	c, cEvents := newSharedTestNode(t, store, "node-c")
+	waitEvent(t, cEvents, "register:gpu")
+	if len(c.ListAllServiceInstances()) != 1 {
+		t.Fatal("node c should load services from shared store")
+	}
+
+	// 心跳可以发送到任意节点
+	if err := b.Heartbeat("gpu"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Unregister("gpu"); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, aEvents, "unregister:gpu:unregistered")
+	waitEvent(t, cEvents, "unregister:gpu:unregistered")
+	if len(a.ListAllServiceInstances()) != 0 || len(c.ListAllServiceInstances()) != 0 {
+		t.Fatal("service should be removed on all nodes")
+	}
+}
+
+func TestSharedRegistryExpiry(t *testing.T) {
+	store := newFakeSharedStore()
+	a, _ := newSharedTestNode(t, store, "node-a")
+	b, bEvents := newSharedTestNode(t, store, "node-b")
+
+	stale := testService("gpu", 0)
+	stale.RegisterAt = time.Now().Add(-time.Hour).Unix()
+	stale.LastHeartbeat = stale.RegisterAt
+	store.SaveService(context.Background(), stale)
+	a.syncShared()
+	b.syncShared()
+	waitEvent(t, bEvents, "register:gpu")
+
+	// 其他节点收到了心跳：同步后不过期
+	fresh := stale
+	fresh.LastHeartbeat = time.Now().Unix()
+	store.SaveService(context.Background(), fresh)
+	b.syncShared()
+	b.checkAndRemoveExpired()
+	if len(b.ListAllServiceInstances()) != 1 {
+		t.Fatal("service with heartbeat on another node should not expire")
+	}
+
+	// 心跳超时：节点a删除共享存储中的服务，节点b收到通知
+	store.SaveService(context.Background(), stale)
+	a.syncShared()
+	a.mu.Lock()
+	for _, list := range a.services {
+		for i := range list {
+			list[i].LastHeartbeat = stale.LastHeartbeat
+		}
+	}
+	a.mu.Unlock()
+	a.checkAndRemoveExpired()
+	waitEvent(t, bEvents, "unregister:gpu:heartbeat_timeout")
+	waitFor(t, func() bool {
+		services, _ := store.LoadServices(context.Background())
+		return len(services) == 0
+	})
+}
+
+func TestSharedRegistryInFlight(t *testing.T) {
+	store := newFakeSharedStore()
+	a, _ := newSharedTestNode(t, store, "node-a")
+	b, _ := newSharedTestNode(t, store, "node-b")
+	if err := a.Register(testService("gpu", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	a.BeginInference("gpu")
+	b.BeginInference("gpu")
+	b.syncShared()
+	a.syncShared()
+	if got := store.inFlightOf("gpu"); got != 2 {
+		t.Fatalf("shared in-flight = %d, want 2", got)
+	}
+	if info := a.GetLoadBalanceInfo("人数统计"); info == nil || info.Services[0].InFlight != 2 {
+		t.Fatal("in-flight count should include requests on other nodes", info)
+	}
+
+	// 关闭节点时归还未结束的请求
+	b.CloseSharedStore()
+	if got := store.inFlightOf("gpu"); got != 1 {
+		t.Fatalf("shared in-flight after close = %d, want 1", got)
+	}
+	a.EndInference("gpu", 0)
+	a.syncShared()
+	if got := store.inFlightOf("gpu"); got != 0 {
+		t.Fatalf("shared in-flight after end = %d, want 0", got)
+	}
+}
+
+func TestSharedRegistryBatchesDeltas(t *testing.T) {
+	store := newFakeSharedStore()
+	a, _ := newSharedTestNode(t, store, "node-a")
+	if err := a.Register(testService("gpu", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 推理路径只累积增量，由同步协程统一写入
+	for i := 0; i < 5; i++ {
+		a.RecordInferenceSuccess("gpu", 20, 0)
+	}
+	a.BeginInference("gpu")
+	if calls := store.callsOf("gpu"); calls != 0 || store.inFlightOf("gpu") != 0 {
+		t.Fatalf("deltas written before sync: calls = %d, in-flight = %d", calls, store.inFlightOf("gpu"))
+	}
+
+	a.syncShared()
+	if calls := store.callsOf("gpu"); calls != 5 || store.inFlightOf("gpu") != 1 {
+		t.Fatalf("after sync: calls = %d, in-flight = %d", calls, store.inFlightOf("gpu"))
+	}
+	// 再次同步后本地计数与共享存储一致
+	a.IncrementCallCount("gpu")
+	a.syncShared()
+	if got := a.GetCallCount("gpu"); got != 6 {
+		t.Fatalf("local call count = %d, want 6", got)
+	}
+
+	// 关闭时未写入的进行中请求直接丢弃，只归还已写入的部分
+	a.BeginInference("gpu")
+	a.CloseSharedStore()
+	if got := store.inFlightOf("gpu"); got != 0 {
+		t.Fatalf("shared in-flight after close = %d, want 0", got)
+	}
+}
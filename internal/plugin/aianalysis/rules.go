@@ -0,0 +1,295 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+const maxPersistFrames = 100 // 连续帧判定的最大窗口
+
+// RejectedDetection 未通过规则筛选的检测目标
+type RejectedDetection struct {
+	Detection
+	Reason string `json:"reason"`
+}
+
+// RuleEvaluation 单帧推理结果的规则判定结果（不含连续帧判定）
+type RuleEvaluation struct {
+	Matched  bool                `json:"matched"`
+	Count    int                 `json:"count"`              // 满足条件的目标数
+	Reason   string              `json:"reason,omitempty"`   // 未命中原因
+	Accepted []Detection         `json:"accepted,omitempty"` // 满足条件的目标
+	Rejected []RejectedDetection `json:"rejected,omitempty"` // 被过滤的目标及原因
+}
+
+// ValidateAlertRule 校验告警规则并填充默认值
+func ValidateAlertRule(rule *model.AlertRule) error {
+	if rule.TaskID == "" && rule.TaskType == "" {
+		return errors.New("task_id or task_type is required")
+	}
+	if rule.MinConfidence < 0 || rule.MinConfidence > 1 {
+		return errors.New("min_confidence must be between 0 and 1")
+	}
+	if rule.MinCount < 0 || rule.MaxCount < 0 {
+		return errors.New("min_count and max_count must not be negative")
+	}
+	if rule.MinCount == 0 {
+		rule.MinCount = 1
+	}
+	if rule.MaxCount > 0 && rule.MaxCount < rule.MinCount {
+		return errors.New("max_count must not be less than min_count")
+	}
+	for _, class := range rule.Classes {
+		if slices.Contains(rule.ExcludeClasses, class) {
+			return fmt.Errorf("class %q is both included and excluded", class)
+		}
+	}
+	for name, regions := range map[string][]model.Polygon{"include_regions": rule.IncludeRegions, "exclude_regions": rule.ExcludeRegions} {
+		for i, polygon := range regions {
+			if len(polygon) < 3 {
+				return fmt.Errorf("%s[%d] must have at least 3 points", name, i)
+			}
+		}
+	}
+	if rule.PersistHits < 0 || rule.PersistFrames < 0 {
+		return errors.New("persist_hits and persist_frames must not be negative")
+	}
+	if rule.PersistHits > 0 {
+		if rule.PersistFrames == 0 {
+			rule.PersistFrames = rule.PersistHits
+		}
+		if rule.PersistFrames < rule.PersistHits || rule.PersistFrames > maxPersistFrames {
+			return fmt.Errorf("persist_frames must be between persist_hits and %d", maxPersistFrames)
+		}
+	} else {
+		rule.PersistFrames = 0
+	}
+	return nil
+}
+
+// EvaluateRule 对单帧推理结果执行规则判定
+// 推理结果中没有检测列表（只返回计数的算法）时，只能按计数判定，配置了类别/置信度/区域条件时不命中
+func EvaluateRule(rule *model.AlertRule, result interface{}) RuleEvaluation {
+	var eval RuleEvaluation
+
+	detections := parseDetections(result)
+	if detections == nil {
+		if len(rule.Classes) > 0 || len(rule.ExcludeClasses) > 0 || rule.MinConfidence > 0 ||
+			len(rule.IncludeRegions) > 0 || len(rule.ExcludeRegions) > 0 {
+			eval.Reason = "result has no detection list"
+			return eval
+		}
+		eval.Count = extractDetectionCount(result)
+	} else {
+		for _, d := range detections {
+			if reason := rejectReason(rule, d); reason != "" {
+				eval.Rejected = append(eval.Rejected, RejectedDetection{Detection: d, Reason: reason})
+				continue
+			}
+			eval.Accepted = append(eval.Accepted, d)
+		}
+		eval.Count = len(eval.Accepted)
+	}
+
+	minCount := max(rule.MinCount, 1)
+	switch {
+	case eval.Count < minCount:
+		eval.Reason = fmt.Sprintf("count %d below min_count %d", eval.Count, minCount)
+	case rule.MaxCount > 0 && eval.Count > rule.MaxCount:
+		eval.Reason = fmt.Sprintf("count %d above max_count %d", eval.Count, rule.MaxCount)
+	default:
+		eval.Matched = true
+	}
+	return eval
+}
+
+// rejectReason 返回检测目标未通过筛选的原因，通过时返回空字符串
+func rejectReason(rule *model.AlertRule, d Detection) string {
+	if len(rule.Classes) > 0 && !slices.Contains(rule.Classes, d.Class) {
+		return "class not included"
+	}
+	if slices.Contains(rule.ExcludeClasses, d.Class) {
+		return "class excluded"
+	}
+	if d.Confidence < rule.MinConfidence {
+		return "confidence below min_confidence"
+	}
+	if !d.HasBBox {
+		if len(rule.IncludeRegions) > 0 {
+			return "no bbox for region check"
+		}
+		return ""
+	}
+
+	// 以检测框中心点判断是否在区域内
+	cx, cy := (d.BBox[0]+d.BBox[2])/2, (d.BBox[1]+d.BBox[3])/2
+	if len(rule.IncludeRegions) > 0 && !inAnyPolygon(rule.IncludeRegions, cx, cy) {
+		return "outside include_regions"
+	}
+	if inAnyPolygon(rule.ExcludeRegions, cx, cy) {
+		return "inside exclude_regions"
+	}
+	return ""
+}
+
+func inAnyPolygon(polygons []model.Polygon, x, y float64) bool {
+	for _, polygon := range polygons {
+		if pointInPolygon(polygon, x, y) {
+			return true
+		}
+	}
+	return false
+}
+
+// pointInPolygon 射线法判断点是否在多边形内
+func pointInPolygon(polygon model.Polygon, x, y float64) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		xi, yi := polygon[i][0], polygon[i][1]
+		xj, yj := polygon[j][0], polygon[j][1]
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// frameHistory 规则在某个任务上最近N帧的命中记录
+// 按规则判定的先后顺序记录，同一任务的多帧并发推理时记录顺序可能与抽帧顺序不一致
+type frameHistory struct {
+	frames []bool
+	next   int
+	filled int
+}
+
+// push 记录一帧并返回窗口内的命中帧数
+func (h *frameHistory) push(hit bool) int {
+	h.frames[h.next] = hit
+	h.next = (h.next + 1) % len(h.frames)
+	if h.filled < len(h.frames) {
+		h.filled++
+	}
+	hits := 0
+	for i := 0; i < h.filled; i++ {
+		if h.frames[i] {
+			hits++
+		}
+	}
+	return hits
+}
+
+type historyKey struct {
+	ruleID uint
+	taskID string
+}
+
+// RuleEngine 告警规则引擎：任务配置了规则时代替检测个数启发式判定是否产生告警
+type RuleEngine struct {
+	log *slog.Logger
+
+	mu      sync.Mutex
+	rules   []model.AlertRule
+	history map[historyKey]*frameHistory
+}
+
+// NewRuleEngine 创建告警规则引擎
+func NewRuleEngine(logger *slog.Logger) *RuleEngine {
+	return &RuleEngine{
+		log:     logger,
+		history: make(map[historyKey]*frameHistory),
+	}
+}
+
+// Reload 从数据库重新加载规则
+func (e *RuleEngine) Reload() error {
+	rules, err := data.ListAlertRules("")
+	if err != nil {
+		return err
+	}
+	e.SetRules(rules)
+	e.log.Info("alert rules loaded", slog.Int("count", len(rules)))
+	return nil
+}
+
+// SetRules 替换规则，已删除或修改了 persist_frames 的规则重新开始连续帧计数
+func (e *RuleEngine) SetRules(rules []model.AlertRule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	frames := make(map[uint]int, len(rules))
+	for _, rule := range rules {
+		frames[rule.ID] = rule.PersistFrames
+	}
+	for key, h := range e.history {
+		if n, ok := frames[key.ruleID]; !ok || n != len(h.frames) {
+			delete(e.history, key)
+		}
+	}
+	e.rules = rules
+}
+
+// rulesFor 获取任务生效的规则：有任务专属规则时只使用专属规则（整体覆盖任务类型规则，不合并），否则使用任务类型规则
+func (e *RuleEngine) rulesFor(taskID, taskType string) []model.AlertRule {
+	var byTask, byType []model.AlertRule
+	for _, rule := range e.rules {
+		if !rule.Enabled {
+			continue
+		}
+		if rule.TaskID != "" {
+			if rule.TaskID == taskID && (rule.TaskType == "" || rule.TaskType == taskType) {
+				byTask = append(byTask, rule)
+			}
+		} else if rule.TaskType == taskType {
+			byType = append(byType, rule)
+		}
+	}
+	if len(byTask) > 0 {
+		return byTask
+	}
+	return byType
+}
+
+// Apply 对推理结果执行任务的所有规则（任一规则命中即告警）
+// 返回第一条命中规则的判定结果（Count 为统计的目标数，Accepted 为满足条件的目标），未命中时为零值；
+// 任务没有规则时 applied 为 false
+func (e *RuleEngine) Apply(taskID, taskType string, result interface{}) (match RuleEvaluation, applied bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rules := e.rulesFor(taskID, taskType)
+	if len(rules) == 0 {
+		return RuleEvaluation{}, false
+	}
+
+	// 每条规则都要执行，保证连续帧计数不因前面的规则命中而中断
+	for i := range rules {
+		rule := &rules[i]
+		eval := EvaluateRule(rule, result)
+		hit := eval.Matched
+
+		if rule.PersistHits > 0 {
+			key := historyKey{ruleID: rule.ID, taskID: taskID}
+			h, ok := e.history[key]
+			if !ok {
+				h = &frameHistory{frames: make([]bool, rule.PersistFrames)}
+				e.history[key] = h
+			}
+			hits := h.push(eval.Matched)
+			hit = eval.Matched && hits >= rule.PersistHits
+		}
+
+		if hit && !match.Matched {
+			match = eval
+			e.log.Debug("alert rule matched",
+				slog.Uint64("rule_id", uint64(rule.ID)),
+				slog.String("task_id", taskID),
+				slog.Int("count", eval.Count))
+		}
+	}
+	return match, true
+}
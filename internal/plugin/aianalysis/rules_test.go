@@ -0,0 +1,155 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func ruleResult(detections ...map[string]interface{}) map[string]interface{} {
+	items := make([]interface{}, len(detections))
+	for i, d := range detections {
+		items[i] = d
+	}
+	return map[string]interface{}{"detections": items}
+}
+
+func ruleDetection(class string, confidence float64, x1, y1, x2, y2 float64) map[string]interface{} {
+	return map[string]interface{}{
+		"class":      class,
+		"confidence": confidence,
+		"bbox":       []interface{}{x1, y1, x2, y2},
+	}
+}
+
+func TestValidateAlertRule(t *testing.T) {
+	rule := model.AlertRule{TaskType: "人数统计", PersistHits: 3}
+	if err := ValidateAlertRule(&rule); err != nil {
+		t.Fatal(err)
+	}
+	if rule.MinCount != 1 || rule.PersistFrames != 3 {
+		t.Fatalf("defaults not applied: %+v", rule)
+	}
+
+	invalid := []model.AlertRule{
+		{},
+		{TaskType: "a", MinConfidence: 1.5},
+		{TaskType: "a", MinCount: 3, MaxCount: 2},
+		{TaskType: "a", Classes: []string{"person"}, ExcludeClasses: []string{"person"}},
+		{TaskType: "a", IncludeRegions: []model.Polygon{{{0, 0}, {1, 1}}}},
+		{TaskType: "a", PersistHits: 3, PersistFrames: 2},
+	}
+	for i := range invalid {
+		if err := ValidateAlertRule(&invalid[i]); err == nil {
+			t.Fatalf("rule %d should be invalid: %+v", i, invalid[i])
+		}
+	}
+}
+
+func TestEvaluateRuleFilters(t *testing.T) {
+	rule := &model.AlertRule{
+		Classes:        []string{"person"},
+		MinConfidence:  0.5,
+		MinCount:       2,
+		IncludeRegions: []model.Polygon{{{0, 0}, {100, 0}, {100, 100}, {0, 100}}},
+		ExcludeRegions: []model.Polygon{{{0, 0}, {20, 0}, {20, 20}, {0, 20}}},
+	}
+	result := ruleResult(
+		ruleDetection("person", 0.9, 40, 40, 60, 60),
+		ruleDetection("person", 0.8, 60, 60, 80, 80),
+		ruleDetection("person", 0.3, 40, 40, 60, 60),     // 置信度不足
+		ruleDetection("car", 0.9, 40, 40, 60, 60),        // 类别不符
+		ruleDetection("person", 0.9, 200, 200, 220, 220), // 区域外
+		ruleDetection("person", 0.9, 5, 5, 15, 15),       // 排除区域内
+	)
+
+	eval := EvaluateRule(rule, result)
+	if !eval.Matched || eval.Count != 2 || len(eval.Rejected) != 4 {
+		t.Fatalf("unexpected evaluation: %+v", eval)
+	}
+
+	rule.MaxCount = 1
+	if eval := EvaluateRule(rule, result); eval.Matched {
+		t.Fatal("count above max_count should not match")
+	}
+}
+
+func TestEvaluateRuleCountOnlyResult(t *testing.T) {
+	result := map[string]interface{}{"total_count": 3.0}
+	if eval := EvaluateRule(&model.AlertRule{MinCount: 3}, result); !eval.Matched {
+		t.Fatalf("count-only result should match count threshold: %+v", eval)
+	}
+	if eval := EvaluateRule(&model.AlertRule{Classes: []string{"person"}}, result); eval.Matched {
+		t.Fatal("class filter cannot match a result without detections")
+	}
+}
+
+func TestRuleEnginePersistence(t *testing.T) {
+	engine := NewRuleEngine(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	engine.SetRules([]model.AlertRule{
+		{ID: 1, TaskType: "人数统计", Enabled: true, MinCount: 1, PersistHits: 3, PersistFrames: 5},
+	})
+
+	hit := ruleResult(ruleDetection("person", 0.9, 0, 0, 10, 10))
+	miss := ruleResult()
+	frames := []map[string]interface{}{hit, miss, hit, hit, miss}
+	want := []bool{false, false, false, true, false}
+	for i, frame := range frames {
+		match, applied := engine.Apply("cam1", "人数统计", frame)
+		if !applied {
+			t.Fatal("rule should apply to task type")
+		}
+		if (match.Count > 0) != want[i] {
+			t.Fatalf("frame %d: count = %d, want matched = %v", i, match.Count, want[i])
+		}
+	}
+
+	if _, applied := engine.Apply("cam1", "人员跌倒", hit); applied {
+		t.Fatal("rule should not apply to other task types")
+	}
+}
+
+func TestRuleEngineTaskRulesOverrideTaskType(t *testing.T) {
+	engine := NewRuleEngine(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	engine.SetRules([]model.AlertRule{
+		{ID: 1, TaskType: "人数统计", Enabled: true, MinCount: 1},
+		{ID: 2, TaskID: "cam1", TaskType: "人数统计", Enabled: true, MinCount: 5},
+		{ID: 3, TaskType: "人员跌倒", Enabled: false, MinCount: 1},
+	})
+
+	result := ruleResult(ruleDetection("person", 0.9, 0, 0, 10, 10))
+	if match, _ := engine.Apply("cam1", "人数统计", result); match.Count != 0 {
+		t.Fatal("task rule should take precedence over task type rule")
+	}
+	if match, _ := engine.Apply("cam2", "人数统计", result); match.Count != 1 || len(match.Accepted) != 1 || match.Accepted[0].Class != "person" {
+		t.Fatalf("other tasks should use task type rule: %+v", match)
+	}
+	if _, applied := engine.Apply("cam1", "人员跌倒", result); applied {
+		t.Fatal("disabled rule should not apply")
+	}
+}
+
+func TestAlertRuleStorage(t *testing.T) {
+	setupTestDB(t)
+
+	rule := &model.AlertRule{
+		TaskType:       "人数统计",
+		Enabled:        true,
+		Classes:        []string{"person"},
+		IncludeRegions: []model.Polygon{{{0, 0}, {1, 0}, {1, 1}}},
+	}
+	if err := data.CreateAlertRule(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewRuleEngine(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := engine.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	rules := engine.rulesFor("cam1", "人数统计")
+	if len(rules) != 1 || rules[0].Classes[0] != "person" || len(rules[0].IncludeRegions[0]) != 3 {
+		t.Fatalf("rule not round-tripped: %+v", rules)
+	}
+}
@@ -2,18 +2,17 @@ package aianalysis
 
 import (
 	"context"
+	"easydarwin/utils/pkg/objstore"
 	"fmt"
 	"log/slog"
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/minio/minio-go/v7"
 )
 
 // ImageInfo 图片信息
 type ImageInfo struct {
-	Path     string    // MinIO对象路径
+	Path     string    // 对象存储中的路径
 	TaskType string    // 任务类型
 	TaskID   string    // 任务ID
 	Filename string    // 文件名
@@ -21,10 +20,9 @@ type ImageInfo struct {
 	ModTime  time.Time // 修改时间
 }
 
-// Scanner MinIO图片扫描器
+// Scanner 对象存储图片扫描器
 type Scanner struct {
-	minio        *minio.Client
-	bucket       string
+	store        objstore.Store
 	basePath     string
 	alertBasePath string // 告警图片路径前缀
 	processed    map[string]time.Time // 已处理图片 path -> 处理时间
@@ -38,10 +36,9 @@ type Scanner struct {
 }
 
 // NewScanner 创建扫描器
-func NewScanner(minioClient *minio.Client, bucket, basePath, alertBasePath string, logger *slog.Logger) *Scanner {
+func NewScanner(store objstore.Store, basePath, alertBasePath string, logger *slog.Logger) *Scanner {
 	return &Scanner{
-		minio:         minioClient,
-		bucket:        bucket,
+		store:         store,
 		basePath:      basePath,
 		alertBasePath: alertBasePath,
 		processed:     make(map[string]time.Time),
@@ -107,7 +104,7 @@ func (s *Scanner) Start(intervalSec float64, onNewImages func([]ImageInfo)) {
 				images, err := s.scanNewImages()
 				scanDuration := time.Since(scanStart)
 				if err != nil {
-					s.log.Error("scan minio failed", 
+					s.log.Error("scan store failed", 
 						slog.String("err", err.Error()),
 						slog.Duration("scan_duration_ms", scanDuration),
 						slog.Duration("actual_interval_ms", actualInterval),
@@ -160,7 +157,7 @@ func (s *Scanner) Stop() {
 	}
 }
 
-// scanNewImages 扫描MinIO中的新图片
+// scanNewImages 扫描对象存储中的新图片
 func (s *Scanner) scanNewImages() ([]ImageInfo, error) {
 	scanStart := time.Now()
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
@@ -168,10 +165,7 @@ func (s *Scanner) scanNewImages() ([]ImageInfo, error) {
 
 	// 列举所有对象（只扫描basePath下的，不扫描告警路径）
 	listStart := time.Now()
-	objectCh := s.minio.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
-		Prefix:    s.basePath,
-		Recursive: true,
-	})
+	objectCh := s.store.List(ctx, s.basePath, true)
 	listDuration := time.Since(listStart)
 
 	var newImages []ImageInfo
@@ -7,7 +7,9 @@ import (
 	"easydarwin/internal/data"
 	"easydarwin/internal/data/model"
 	"easydarwin/internal/plugin/frameextractor"
+	"easydarwin/utils/pkg/objstore"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -20,24 +22,28 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
-
-	"github.com/minio/minio-go/v7"
 )
 
 // Scheduler 推理调度器
 type Scheduler struct {
 	registry              *AlgorithmRegistry
-	minio                 *minio.Client
-	bucket                string
+	store                 objstore.Store
 	alertBasePath         string // 告警图片存储路径前缀
 	mq                    MessageQueue
 	log                   *slog.Logger
 	semaphore             chan struct{}          // 限制并发数
 	saveOnlyWithDetection bool                   // 只保存有检测结果的告警
 	httpClient            *http.Client           // 优化的HTTP客户端
+	grpcTransport         *GRPCTransport         // gRPC协议算法服务的传输层
+	batcher               *batchCollector        // 批量推理凑批
 	alertBatchWriter      *data.AlertBatchWriter // 批量写入告警
 	monitor               *PerformanceMonitor    // 性能监控器（用于记录推理时间）
 	scanner               *Scanner               // 扫描器（用于标记图片已处理）
+	suppressor            *AlertSuppressor       // 告警抑制器（为nil时不抑制）
+	annotator             *Annotator             // 告警图片标注器（为nil时不生成标注图片）
+	clipRecorder          *ClipRecorder          // 告警视频片段录制器（为nil时不录制）
+	ruleEngine            *RuleEngine            // 告警规则引擎（为nil时按检测个数判定）
+	shadow                *ShadowEvaluator       // 影子推理（为nil时不采样）
 
 	// 移动锁：确保同一task_id的图片按顺序移动，避免并发错位
 	moveLocks       map[string]*sync.Mutex
@@ -70,7 +76,7 @@ type InferenceResult struct {
 }
 
 // NewScheduler 创建调度器
-func NewScheduler(registry *AlgorithmRegistry, minioClient *minio.Client, bucket, alertBasePath string, mq MessageQueue, maxConcurrent int, saveOnlyWithDetection bool, alertBatchWriter *data.AlertBatchWriter, monitor *PerformanceMonitor, scanner *Scanner, logger *slog.Logger, moveConcurrent int) *Scheduler {
+func NewScheduler(registry *AlgorithmRegistry, store objstore.Store, alertBasePath string, mq MessageQueue, maxConcurrent int, saveOnlyWithDetection bool, alertBatchWriter *data.AlertBatchWriter, monitor *PerformanceMonitor, scanner *Scanner, logger *slog.Logger, moveConcurrent int) *Scheduler {
 	if maxConcurrent <= 0 {
 		maxConcurrent = 5
 	}
@@ -104,14 +110,14 @@ func NewScheduler(registry *AlgorithmRegistry, minioClient *minio.Client, bucket
 
 	scheduler := &Scheduler{
 		registry:               registry,
-		minio:                  minioClient,
-		bucket:                 bucket,
+		store:                  store,
 		alertBasePath:          alertBasePath,
 		mq:                     mq,
 		log:                    logger,
 		semaphore:              make(chan struct{}, maxConcurrent),
 		saveOnlyWithDetection:  saveOnlyWithDetection,
 		httpClient:             httpClient,
+		grpcTransport:          NewGRPCTransport(httpClient.Timeout, logger),
 		alertBatchWriter:       alertBatchWriter,
 		monitor:                monitor,
 		scanner:                scanner,
@@ -123,6 +129,8 @@ func NewScheduler(registry *AlgorithmRegistry, minioClient *minio.Client, bucket
 		moveSemaphore:          make(chan struct{}, moveConcurrent),
 	}
 
+	scheduler.batcher = newBatchCollector(scheduler.runBatch)
+
 	// 启动移动锁定期清理
 	scheduler.startMoveLockCleanup()
 
@@ -172,6 +180,31 @@ func (s *Scheduler) SetOnProcessedCallback(callback func()) {
 	s.onProcessedCallback = callback
 }
 
+// SetAlertSuppressor 设置告警抑制器
+func (s *Scheduler) SetAlertSuppressor(suppressor *AlertSuppressor) {
+	s.suppressor = suppressor
+}
+
+// SetAnnotator 设置告警图片标注器
+func (s *Scheduler) SetAnnotator(annotator *Annotator) {
+	s.annotator = annotator
+}
+
+// SetClipRecorder 设置告警视频片段录制器
+func (s *Scheduler) SetClipRecorder(recorder *ClipRecorder) {
+	s.clipRecorder = recorder
+}
+
+// SetRuleEngine 设置告警规则引擎
+func (s *Scheduler) SetRuleEngine(engine *RuleEngine) {
+	s.ruleEngine = engine
+}
+
+// SetShadowEvaluator 设置影子推理
+func (s *Scheduler) SetShadowEvaluator(evaluator *ShadowEvaluator) {
+	s.shadow = evaluator
+}
+
 // IsImageInferring 检查图片是否正在推理中（用于清理时保护）
 func (s *Scheduler) IsImageInferring(imagePath string) bool {
 	s.inferringMu.RLock()
@@ -232,7 +265,7 @@ func (s *Scheduler) CheckImageExists(imagePath string) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	_, err := s.minio.StatObject(ctx, s.bucket, imagePath, minio.StatObjectOptions{})
+	_, err := s.store.Stat(ctx, imagePath)
 	if err != nil {
 		return false, err
 	}
@@ -242,7 +275,7 @@ func (s *Scheduler) CheckImageExists(imagePath string) (bool, error) {
 // ScheduleInference 调度推理
 func (s *Scheduler) ScheduleInference(image ImageInfo) {
 	// 根据任务类型选择算法实例（绊线任务需要绑定端点）
-	algorithm, selectErr := s.selectAlgorithmForImage(image)
+	algorithm, probe, selectErr := s.selectAlgorithmForImage(image)
 	if algorithm == nil {
 		logArgs := []any{
 			slog.String("task_type", image.TaskType),
@@ -271,6 +304,18 @@ func (s *Scheduler) ScheduleInference(image ImageInfo) {
 		return
 	}
 
+	// 从选中实例开始计入进行中请求（包括等待限流的请求），供 least_in_flight 策略使用
+	s.registry.BeginInference(algorithm.Endpoint)
+	defer s.registry.EndInference(algorithm.Endpoint, probe)
+
+	// 支持批量推理的实例：加入批次并等待批次完成，保持worker的背压
+	if algorithm.MaxBatchSize > 1 {
+		unmark := s.markInferring(image)
+		defer unmark()
+		<-s.batcher.add(image, *algorithm, probe)
+		return
+	}
+
 	scheduleStart := time.Now()
 
 	// 限流
@@ -283,24 +328,9 @@ func (s *Scheduler) ScheduleInference(image ImageInfo) {
 		atomic.AddInt32(&s.activeInferences, -1)
 	}()
 
-	// 将"即将推理"转换为"正在推理"（如果之前已标记为pending）
-	normalizedPath := filepath.ToSlash(image.Path)
-	wasPending := s.IsImagePendingInference(image.Path)
-	if wasPending {
-		s.UnmarkPendingInference(image.Path)
-	}
-
-	// 标记图片正在推理（用于清理时保护）
-	s.inferringMu.Lock()
-	s.inferringImages[normalizedPath] = true
-	s.inferringMu.Unlock()
-
-	// 确保推理完成后移除标记
-	defer func() {
-		s.inferringMu.Lock()
-		delete(s.inferringImages, normalizedPath)
-		s.inferringMu.Unlock()
-	}()
+	// 标记图片正在推理（用于清理时保护），推理完成后移除标记
+	unmark := s.markInferring(image)
+	defer unmark()
 
 	s.log.Info("scheduling inference",
 		slog.String("image", image.Path),
@@ -311,7 +341,7 @@ func (s *Scheduler) ScheduleInference(image ImageInfo) {
 
 	// 调用选中的算法实例
 	inferStart := time.Now()
-	s.inferAndSave(image, *algorithm)
+	s.inferAndSave(image, *algorithm, probe)
 	totalScheduleDuration := time.Since(scheduleStart)
 	inferDuration := time.Since(inferStart)
 
@@ -323,14 +353,43 @@ func (s *Scheduler) ScheduleInference(image ImageInfo) {
 		slog.Duration("total_schedule_duration_ms", totalScheduleDuration))
 }
 
-// inferAndSave 调用算法推理并保存结果
-func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmService) {
+// inferAndSave 调用算法推理并保存结果，probe 为选择实例时占用的半开探测凭证
+func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmService, probe uint64) {
+	job, ok := s.prepareInference(image, algorithm)
+	if !ok {
+		return
+	}
+	job.probe = probe
+
+	// 记录推理开始时间
+	algorithmCallStart := time.Now()
+
+	// 记录请求发送
+	if s.monitor != nil {
+		s.monitor.RecordRequestSent()
+	}
+
+	// 调用算法服务
+	resp, err := s.callAlgorithm(algorithm, job.req)
+	algorithmCallDuration := time.Since(algorithmCallStart)
+
+	// 记录响应接收（无论成功或失败）
+	if s.monitor != nil {
+		s.monitor.RecordResponseReceived()
+	}
+
+	s.handleInferenceResult(job, algorithm, resp, err, algorithmCallDuration)
+}
+
+// prepareInference 推理前准备：检查图片、生成预签名URL或读取图片内容、读取算法配置
+// 失败时已完成图片清理，返回false
+func (s *Scheduler) prepareInference(image ImageInfo, algorithm conf.AlgorithmService) (*inferenceJob, bool) {
 	inferStart := time.Now()
 
 	// 处理前检查图片是否存在（避免处理已删除的图片）
 	statStart := time.Now()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	_, statErr := s.minio.StatObject(ctx, s.bucket, image.Path, minio.StatObjectOptions{})
+	_, statErr := s.store.Stat(ctx, image.Path)
 	cancel()
 	statDuration := time.Since(statStart)
 
@@ -346,63 +405,45 @@ func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmServic
 		if s.scanner != nil {
 			s.scanner.MarkProcessed(image.Path)
 		}
-		return
+		return nil, false
 	}
 
-	// 生成预签名URL（带重试机制）
-	// 注意：MinIO SDK生成签名时使用UTC时间，但MinIO服务器验证时使用CST时间
-	// 时差8小时，因此需要增加有效期以补偿时区差
-	// 1小时有效期 + 8小时时差 + 1小时缓冲 = 10小时
-	presignedExpiry := 10 * time.Hour
+	// 内联传输模式：调度器读取图片内容随请求发送，算法服务无需访问MinIO，不生成预签名URL
+	inline := isInlineImageMode(algorithm.ImageMode)
 
-	var presignedURL *url.URL
+	var imageURL string
+	var imageData []byte
+	var presignDuration, loadDuration time.Duration
 	var err error
-	maxRetries := 3
-	retryDelay := 1 * time.Second
-
-	presignStart := time.Now()
-	for i := 0; i < maxRetries; i++ {
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-
-		presignedURL, err = s.minio.PresignedGetObject(ctx, s.bucket, image.Path, presignedExpiry, nil)
-		cancel()
-		presignDuration := time.Since(presignStart)
-
-		if err == nil {
-			if i > 0 {
-				s.log.Info("presigned URL generated after retry",
-					slog.Int("attempt", i+1),
-					slog.String("path", image.Path),
-					slog.Duration("presign_duration_ms", presignDuration))
-			}
-			break
+	if inline {
+		loadStart := time.Now()
+		imageData, err = s.loadImage(image.Path)
+		loadDuration = time.Since(loadStart)
+		if err != nil {
+			s.log.Error("failed to load image for inline inference",
+				slog.String("path", image.Path),
+				slog.String("endpoint", algorithm.Endpoint),
+				slog.String("err", err.Error()),
+				slog.Duration("load_duration_ms", loadDuration))
+			// 读取失败，删除图片避免积压
+			s.deleteImageWithReason(image.Path, "load_failed")
+			return nil, false
 		}
-
-		// 记录错误详情
-		s.log.Warn("failed to generate presigned URL, retrying...",
-			slog.Int("attempt", i+1),
-			slog.Int("max_retries", maxRetries),
-			slog.String("path", image.Path),
-			slog.String("err", err.Error()),
-			slog.String("err_type", fmt.Sprintf("%T", err)))
-
-		if i < maxRetries-1 {
-			time.Sleep(retryDelay)
-			retryDelay *= 2 // 指数退避
+	} else {
+		var presignedURL *url.URL
+		presignedURL, presignDuration, err = s.presignImageURL(image.Path)
+		if err != nil {
+			s.log.Error("failed to generate presigned URL after retries",
+				slog.String("path", image.Path),
+				slog.String("err", err.Error()),
+				slog.String("err_type", fmt.Sprintf("%T", err)),
+				slog.Duration("presign_duration_ms", presignDuration),
+				slog.Duration("stat_duration_ms", statDuration))
+			// 预签名失败，删除图片避免积压
+			s.deleteImageWithReason(image.Path, "presign_failed")
+			return nil, false
 		}
-	}
-
-	presignDuration := time.Since(presignStart)
-	if err != nil {
-		s.log.Error("failed to generate presigned URL after retries",
-			slog.String("path", image.Path),
-			slog.String("err", err.Error()),
-			slog.String("err_type", fmt.Sprintf("%T", err)),
-			slog.Duration("presign_duration_ms", presignDuration),
-			slog.Duration("stat_duration_ms", statDuration))
-		// 预签名失败，删除图片避免积压
-		s.deleteImageWithReason(image.Path, "presign_failed")
-		return
+		imageURL = presignedURL.String()
 	}
 
 	// 读取算法配置（如果存在）
@@ -416,14 +457,14 @@ func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmServic
 					slog.String("err", err.Error()))
 			}
 
-			// 生成配置文件的预签名URL
+			// 生成配置文件的预签名URL（内联传输模式下算法服务无法访问MinIO，只发送配置内容）
 			// 同样需要补偿时区差（10小时有效期）
 			configPath := fxService.GetAlgorithmConfigPath(image.TaskID)
-			if configPath != "" {
+			if configPath != "" && !inline {
 				configURLCtx, configURLCancel := context.WithTimeout(context.Background(), 5*time.Second)
 				defer configURLCancel()
 
-				presignedConfigURL, err := s.minio.PresignedGetObject(configURLCtx, s.bucket, configPath, presignedExpiry, nil)
+				presignedConfigURL, err := s.store.PresignGet(configURLCtx, configPath, inferencePresignExpiry)
 				if err == nil {
 					algoConfigURL = presignedConfigURL.String()
 				} else {
@@ -437,52 +478,64 @@ func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmServic
 
 	// 构建推理请求
 	req := conf.InferenceRequest{
-		ImageURL:      presignedURL.String(),
+		ImageURL:      imageURL,
 		TaskID:        image.TaskID,
 		TaskType:      image.TaskType,
 		ImagePath:     image.Path,
 		AlgoConfig:    algoConfig,
 		AlgoConfigURL: algoConfigURL,
 	}
+	if inline {
+		req.ImageData = imageData
+		req.ImageFormat = imageFormat(image.Path)
+	}
 
 	// 记录推理请求详情
 	s.log.Info("收到推理请求",
 		slog.String("任务ID", image.TaskID),
 		slog.String("任务类型", image.TaskType),
 		slog.String("图片路径", image.Path),
-		slog.String("图片URL", presignedURL.String()),
+		slog.String("图片URL", imageURL),
+		slog.String("图片传输", algorithm.ImageMode),
+		slog.Int("图片大小", len(imageData)),
 		slog.String("配置文件URL", algoConfigURL),
 		slog.Duration("stat_duration_ms", statDuration),
-		slog.Duration("presign_duration_ms", presignDuration))
-
-	// 记录推理开始时间
-	algorithmCallStart := time.Now()
-
-	// 记录请求发送
-	if s.monitor != nil {
-		s.monitor.RecordRequestSent()
-	}
-
-	// 调用算法服务
-	resp, err := s.callAlgorithm(algorithm, req)
-	algorithmCallDuration := time.Since(algorithmCallStart)
+		slog.Duration("presign_duration_ms", presignDuration),
+		slog.Duration("load_duration_ms", loadDuration))
+
+	return &inferenceJob{
+		image:           image,
+		req:             req,
+		algoConfig:      algoConfig,
+		inferStart:      inferStart,
+		statDuration:    statDuration,
+		presignDuration: presignDuration,
+	}, true
+}
 
-	// 记录响应接收（无论成功或失败）
-	if s.monitor != nil {
-		s.monitor.RecordResponseReceived()
-	}
+// handleInferenceResult 处理推理结果：记录统计、保存告警、推送消息、清理图片
+// 批量推理时 algorithmCallDuration 为整个批次的调用耗时，实例统计已由批次统一记录
+func (s *Scheduler) handleInferenceResult(job *inferenceJob, algorithm conf.AlgorithmService, resp *conf.InferenceResponse, err error, algorithmCallDuration time.Duration) {
+	image, algoConfig := job.image, job.algoConfig
+	inferStart, statDuration, presignDuration := job.inferStart, job.statDuration, job.presignDuration
 
 	if err != nil {
 		// 检查是否是404错误（图片不存在）
 		is404Error := strings.Contains(err.Error(), "404") || strings.Contains(err.Error(), "Not Found")
 
-		// ❌ 推理调用失败，记录日志（不注销服务，服务状态由心跳管理）
-		s.registry.RecordInferenceFailure(algorithm.Endpoint, algorithm.ServiceID)
+		// ❌ 推理调用失败，记录日志并计入熔断统计（不注销服务，服务状态由心跳管理）
+		// 404表示图片不存在，不是算法服务的问题，不计入
+		if !is404Error {
+			if !job.batched {
+				s.registry.RecordInferenceFailure(algorithm.Endpoint, algorithm.ServiceID, job.probe)
+			}
+			s.registry.RecordVersionFailure(image.TaskType, algorithm.Version)
+		}
 
 		// 记录失败到监控器
 		if s.monitor != nil {
 			// 计算失败前的耗时
-			failedTime := time.Since(algorithmCallStart).Milliseconds()
+			failedTime := algorithmCallDuration.Milliseconds()
 			s.monitor.RecordInference(failedTime, false)
 		}
 
@@ -529,12 +582,18 @@ func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmServic
 	}
 
 	// 计算实际推理耗时
-	actualInferenceTime := time.Since(algorithmCallStart).Milliseconds()
+	actualInferenceTime := algorithmCallDuration.Milliseconds()
 
 	if !resp.Success {
+		// 算法服务返回失败，计入熔断统计
+		if !job.batched {
+			s.registry.RecordInferenceFailure(algorithm.Endpoint, algorithm.ServiceID, job.probe)
+		}
+		s.registry.RecordVersionFailure(image.TaskType, algorithm.Version)
+
 		// 记录失败到监控器
 		if s.monitor != nil {
-			actualInferenceTime := time.Since(algorithmCallStart).Milliseconds()
+			actualInferenceTime := algorithmCallDuration.Milliseconds()
 			s.monitor.RecordInference(actualInferenceTime, false)
 		}
 
@@ -567,7 +626,14 @@ func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmServic
 	if reportedTimeMs <= 0 {
 		reportedTimeMs = actualInferenceTime
 	}
-	s.registry.RecordInferenceSuccess(algorithm.Endpoint, reportedTimeMs)
+	if !job.batched {
+		s.registry.RecordInferenceSuccess(algorithm.Endpoint, reportedTimeMs, job.probe)
+	}
+
+	// 影子推理采样（图片删除或移动之前复制）
+	if s.shadow != nil {
+		s.shadow.Mirror(job, algorithm, resp, reportedTimeMs)
+	}
 
 	// 记录到性能监控器（使用算法服务返回的推理时间，而不是总处理时间）
 	if s.monitor != nil {
@@ -588,6 +654,23 @@ func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmServic
 	// 提取检测个数
 	detectionCount := extractDetectionCount(resp.Result)
 
+	// 任务配置了告警规则时，由规则判定是否告警（未命中时按无检测结果处理）
+	var ruleMatch RuleEvaluation
+	ruleApplied := false
+	if s.ruleEngine != nil {
+		if match, applied := s.ruleEngine.Apply(image.TaskID, image.TaskType, resp.Result); applied {
+			s.log.Debug("alert rules applied",
+				slog.String("task_id", image.TaskID),
+				slog.Int("heuristic_count", detectionCount),
+				slog.Int("rule_count", match.Count))
+			detectionCount = match.Count
+			ruleMatch, ruleApplied = match, true
+		}
+	}
+
+	// 按版本统计推理结果（灰度发布时对比各版本）
+	s.registry.RecordVersionSuccess(image.TaskType, algorithm.Version, reportedTimeMs, detectionCount > 0)
+
 	// 记录推理结果详情
 	s.log.Info("inference result received",
 		slog.String("image", image.Path),
@@ -598,6 +681,11 @@ func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmServic
 		slog.Duration("algorithm_call_duration_ms", algorithmCallDuration),
 		slog.Any("result", resp.Result))
 
+	// 持续缓存任务的视频流，保证告警产生时有告警前的片段
+	if s.clipRecorder != nil {
+		s.clipRecorder.Watch(image.TaskID)
+	}
+
 	// 无检测结果：直接删除原路径图片并返回（不保存告警，不推送消息）
 	if detectionCount == 0 {
 		s.log.Info("no detection result, deleting image",
@@ -623,6 +711,47 @@ func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmServic
 		return
 	}
 
+	// 任务撤防（布防计划外或手动撤防）：不产生告警
+	if fxService := s.getFrameExtractorService(); fxService != nil && !fxService.IsArmed(image.TaskID) {
+		s.log.Info("task disarmed, alert skipped",
+			slog.String("image", image.Path),
+			slog.String("task_id", image.TaskID),
+			slog.Int("detection_count", detectionCount))
+
+		if err := s.deleteImageWithReason(image.Path, "disarmed"); err != nil {
+			s.log.Error("failed to delete disarmed image",
+				slog.String("path", image.Path),
+				slog.String("err", err.Error()))
+		} else if s.scanner != nil {
+			s.scanner.MarkProcessed(image.Path)
+		}
+		return
+	}
+
+	// 告警抑制：冷却时间内或与已有告警重复的命中只合并计数，不保存图片、不写库、不推送
+	alertTime := time.Now()
+	decision := SuppressDecision{HitCount: 1}
+	if s.suppressor != nil {
+		decision = s.suppressor.Check(image.TaskID, image.TaskType, resp.Result, algoConfig, alertTime)
+	}
+	if decision.Suppressed {
+		s.log.Info("alert suppressed as duplicate",
+			slog.String("image", image.Path),
+			slog.String("task_id", image.TaskID),
+			slog.String("task_type", image.TaskType),
+			slog.String("dedup_key", decision.DedupKey),
+			slog.Int("hit_count", decision.HitCount))
+
+		if err := s.deleteImageWithReason(image.Path, "suppressed"); err != nil {
+			s.log.Error("failed to delete suppressed image",
+				slog.String("path", image.Path),
+				slog.String("err", err.Error()))
+		} else if s.scanner != nil {
+			s.scanner.MarkProcessed(image.Path)
+		}
+		return
+	}
+
 	// 检查是否保存告警图片（不影响告警信息的保存和推送）
 	shouldSaveImage := s.shouldSaveAlertImage(image.TaskID, algoConfig)
 
@@ -630,6 +759,27 @@ func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmServic
 	var alertImagePath string
 	var alertImageURL string
 
+	// 由规则判定时只保存和标注满足规则条件的目标，检测目标查询和告警回调的类别筛选与告警判定一致
+	// （Result 仍保留算法原始输出）
+	detections := parseDetections(resp.Result)
+	if ruleApplied {
+		detections = ruleMatch.Accepted
+	}
+
+	// 告警图片标注：只在告警路径下生成（原路径为抽帧目录，标注图片会被当作新图片扫描）
+	var annotatedPath string
+	var annotation AnnotationInput
+	annotate := s.annotator != nil && shouldSaveImage && s.alertBasePath != ""
+	if annotate {
+		annotation = AnnotationInput{
+			TaskType:   image.TaskType,
+			Camera:     image.TaskID,
+			Time:       alertTime,
+			Detections: detections,
+			Regions:    parseRegions(algoConfig),
+		}
+	}
+
 	// 只有配置为保存图片时才移动/保存图片
 	if shouldSaveImage && s.alertBasePath != "" && detectionCount > 0 {
 		// 构建目标告警路径（保存告警时使用目标路径）
@@ -645,6 +795,13 @@ func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmServic
 
 		// 使用目标告警路径保存（确保URL可以访问）
 		alertImagePath = targetAlertPath
+
+		// 在移动原图之前同步生成标注图片（内联传输模式下复用已读取的图片内容），上传成功后才记录标注图片路径
+		if annotate {
+			if dst := annotatedImagePath(targetAlertPath); s.renderAnnotatedImage(image.Path, dst, job.req.ImageData, annotation) {
+				annotatedPath = dst
+			}
+		}
 		// 不预先生成URL，节省时间（API返回时按需生成）
 		alertImageURL = ""
 
@@ -708,17 +865,25 @@ func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmServic
 	// 保存告警到数据库
 	resultJSON, _ := json.Marshal(resp.Result)
 	alert := &model.Alert{
-		TaskID:          image.TaskID,
-		TaskType:        image.TaskType,
-		ImagePath:       alertImagePath,
-		ImageURL:        alertImageURL,
-		AlgorithmID:     algorithm.ServiceID,
-		AlgorithmName:   algorithm.Name,
-		Result:          string(resultJSON),
-		Confidence:      resp.Confidence,
-		DetectionCount:  detectionCount,
-		InferenceTimeMs: int(actualInferenceTime),
-		CreatedAt:       time.Now(),
+		TaskID:             image.TaskID,
+		TaskType:           image.TaskType,
+		ImagePath:          alertImagePath,
+		ImageURL:           alertImageURL,
+		AnnotatedImagePath: annotatedPath,
+		AlgorithmID:        algorithm.ServiceID,
+		AlgorithmName:      algorithm.Name,
+		AlgorithmVersion:   algorithm.Version,
+		Result:             string(resultJSON),
+		Confidence:         resp.Confidence,
+		DetectionCount:     detectionCount,
+		InferenceTimeMs:    int(actualInferenceTime),
+		HitCount:           decision.HitCount,
+		FirstSeenAt:        alertTime,
+		LastSeenAt:         alertTime,
+		DedupKey:           decision.DedupKey,
+		Status:             model.AlertStatusNew,
+		Detections:         toAlertDetections(detections),
+		CreatedAt:          alertTime,
 	}
 
 	// 验证任务ID与图片路径的一致性（只在有图片路径时验证）
@@ -736,6 +901,13 @@ func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmServic
 		}
 	}
 
+	// 告警视频片段与告警图片放在同一目录，告警后片段录制上传成功且告警落库后才写入片段路径
+	clipping := false
+	if s.clipRecorder != nil && s.alertBasePath != "" {
+		dst := alertClipPath(fmt.Sprintf("%s%s/%s/%s", s.alertBasePath, image.TaskType, image.TaskID, image.Filename))
+		clipping = s.clipRecorder.Record(image.TaskID, alertTime, dst, alert)
+	}
+
 	// 使用批量写入器添加告警
 	saveStart := time.Now()
 	if err := s.alertBatchWriter.Add(alert); err != nil {
@@ -743,10 +915,22 @@ func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmServic
 			slog.String("task_id", image.TaskID),
 			slog.String("err", err.Error()),
 			slog.Duration("save_duration_ms", time.Since(saveStart)))
+		if clipping {
+			s.clipRecorder.Forget(alert)
+		}
+		// 告警未能写入，移除 Check 时登记的分组
+		if s.suppressor != nil {
+			s.suppressor.Discard(image.TaskID, decision)
+		}
 		return
 	}
 	saveDuration := time.Since(saveStart)
 
+	// 告警已进入写入队列，确认分组，之后的重复命中合并到该告警
+	if s.suppressor != nil {
+		s.suppressor.Track(image.TaskID, decision)
+	}
+
 	s.log.Debug("alert record prepared for batch save",
 		slog.String("task_id", alert.TaskID),
 		slog.String("task_type", alert.TaskType),
@@ -754,26 +938,7 @@ func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmServic
 		slog.String("original_path", image.Path),
 		slog.Duration("save_duration_ms", saveDuration))
 
-	// 推送到消息队列
-	mqStart := time.Now()
-	var mqDuration time.Duration
-	if s.mq != nil {
-		if err := s.mq.PublishAlert(*alert); err != nil {
-			mqDuration = time.Since(mqStart)
-			s.log.Error("failed to publish alert to MQ",
-				slog.String("task_id", image.TaskID),
-				slog.String("err", err.Error()),
-				slog.Duration("mq_duration_ms", mqDuration))
-		} else {
-			mqDuration = time.Since(mqStart)
-			s.log.Info("alert published to MQ",
-				slog.Uint64("alert_id", uint64(alert.ID)),
-				slog.String("task_id", image.TaskID),
-				slog.String("task_type", image.TaskType),
-				slog.Int("detection_count", detectionCount),
-				slog.Duration("mq_duration_ms", mqDuration))
-		}
-	}
+	// 告警落库后由批量写入器回调推送到消息队列（推送的告警带有数据库ID）
 
 	// 记录完整的推理流程耗时
 	totalInferDuration := time.Since(inferStart)
@@ -796,7 +961,6 @@ func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmServic
 		slog.Duration("presign_duration_ms", presignDuration),
 		slog.Duration("algorithm_call_duration_ms", algorithmCallDuration),
 		slog.Duration("save_duration_ms", saveDuration),
-		slog.Duration("mq_duration_ms", mqDuration),
 		slog.Duration("total_infer_duration_ms", totalInferDuration))
 
 	// 推理成功并已保存告警，标记图片为已处理
@@ -822,6 +986,53 @@ func (s *Scheduler) inferAndSave(image ImageInfo, algorithm conf.AlgorithmServic
 	}
 }
 
+// inferencePresignExpiry 推理请求中预签名URL的有效期
+// 注意：MinIO SDK生成签名时使用UTC时间，但MinIO服务器验证时使用CST时间
+// 时差8小时，因此需要增加有效期以补偿时区差
+// 1小时有效期 + 8小时时差 + 1小时缓冲 = 10小时
+const inferencePresignExpiry = 10 * time.Hour
+
+// presignImageURL 生成推理用的图片预签名URL（带重试机制）
+func (s *Scheduler) presignImageURL(imagePath string) (*url.URL, time.Duration, error) {
+	var presignedURL *url.URL
+	var err error
+	maxRetries := 3
+	retryDelay := 1 * time.Second
+
+	presignStart := time.Now()
+	for i := 0; i < maxRetries; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+
+		presignedURL, err = s.store.PresignGet(ctx, imagePath, inferencePresignExpiry)
+		cancel()
+		presignDuration := time.Since(presignStart)
+
+		if err == nil {
+			if i > 0 {
+				s.log.Info("presigned URL generated after retry",
+					slog.Int("attempt", i+1),
+					slog.String("path", imagePath),
+					slog.Duration("presign_duration_ms", presignDuration))
+			}
+			break
+		}
+
+		// 记录错误详情
+		s.log.Warn("failed to generate presigned URL, retrying...",
+			slog.Int("attempt", i+1),
+			slog.Int("max_retries", maxRetries),
+			slog.String("path", imagePath),
+			slog.String("err", err.Error()),
+			slog.String("err_type", fmt.Sprintf("%T", err)))
+
+		if i < maxRetries-1 {
+			time.Sleep(retryDelay)
+			retryDelay *= 2 // 指数退避
+		}
+	}
+	return presignedURL, time.Since(presignStart), err
+}
+
 // GetActiveInferenceCount 返回当前正在进行推理的数量（即semaphore占用数）
 func (s *Scheduler) GetActiveInferenceCount() int32 {
 	return atomic.LoadInt32(&s.activeInferences)
@@ -832,31 +1043,119 @@ func (s *Scheduler) GetMaxConcurrent() int {
 	return cap(s.semaphore)
 }
 
-// callAlgorithm HTTP调用算法服务（带重试机制）
-func (s *Scheduler) callAlgorithm(algorithm conf.AlgorithmService, req conf.InferenceRequest) (*conf.InferenceResponse, error) {
-	reqBody, err := json.Marshal(req)
+// Close 释放调度器持有的连接
+func (s *Scheduler) Close() error {
+	return s.grpcTransport.Close()
+}
+
+// CheckAlgorithmService 检查算法服务是否支持其声明的协议，gRPC协议通过 Health 调用确认
+func (s *Scheduler) CheckAlgorithmService(ctx context.Context, algorithm conf.AlgorithmService) error {
+	if !isGRPCProtocol(algorithm.Protocol) {
+		return nil
+	}
+	resp, err := s.grpcTransport.Health(ctx, algorithm.Endpoint)
 	if err != nil {
-		return nil, fmt.Errorf("marshal request failed: %w", err)
+		return fmt.Errorf("grpc health check failed: %w", err)
 	}
+	s.log.Info("grpc algorithm service negotiated",
+		slog.String("service_id", algorithm.ServiceID),
+		slog.String("endpoint", algorithm.Endpoint),
+		slog.String("protocol", algorithm.Protocol),
+		slog.String("version", resp.GetVersion()))
+	return nil
+}
 
-	maxRetries := 2               // 减少到2次重试（总共3次尝试），避免长时间卡死
-	retryDelay := 1 * time.Second // 初始重试延迟1秒
-	var lastErr error
+// 算法调用重试策略（HTTP、gRPC和批量调用一致）
+const (
+	algorithmCallAttempts   = 2               // 最多尝试2次，避免长时间卡死
+	algorithmCallRetryDelay = 1 * time.Second // 初始重试延迟，之后指数退避
+)
+
+// callAlgorithm 调用算法服务，按服务注册时声明的协议选择传输方式
+func (s *Scheduler) callAlgorithm(algorithm conf.AlgorithmService, req conf.InferenceRequest) (*conf.InferenceResponse, error) {
+	switch algorithm.Protocol {
+	case ProtocolGRPC:
+		return retryAlgorithmCall(s, algorithm.Endpoint, func() (*conf.InferenceResponse, error) {
+			return s.grpcTransport.Infer(context.Background(), algorithm.Endpoint, req)
+		})
+	case ProtocolGRPCStream:
+		return retryAlgorithmCall(s, algorithm.Endpoint, func() (*conf.InferenceResponse, error) {
+			return s.grpcTransport.InferStream(context.Background(), algorithm.Endpoint, req)
+		})
+	default:
+		return s.callAlgorithmHTTP(algorithm, req)
+	}
+}
+
+// isConnectionError 是否为连接错误（服务离线），连接错误不重试
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	errStr := err.Error()
+	return strings.Contains(errStr, "connection refused") ||
+		strings.Contains(errStr, "connection reset") ||
+		strings.Contains(errStr, "connection timeout") ||
+		strings.Contains(errStr, "no such host") ||
+		strings.Contains(errStr, "dial tcp") ||
+		strings.Contains(errStr, "network is unreachable") ||
+		strings.Contains(errStr, "service likely offline")
+}
+
+// isNotFoundError 是否为图片不存在（404）错误，图片不存在不重试
+func isNotFoundError(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "404") || strings.Contains(err.Error(), "Not Found"))
+}
 
-	// 判断是否为连接错误的辅助函数
-	isConnectionError := func(err error) bool {
+// retryAlgorithmCall 按与HTTP调用一致的策略重试gRPC和批量调用：
+// 最多尝试 algorithmCallAttempts 次，指数退避；图片不存在和连接错误不重试
+func retryAlgorithmCall[T any](s *Scheduler, endpoint string, call func() (T, error)) (T, error) {
+	retryDelay := algorithmCallRetryDelay
+	var lastErr error
+	for i := 0; i < algorithmCallAttempts; i++ {
+		resp, err := call()
 		if err == nil {
-			return false
+			if i > 0 {
+				s.log.Info("algorithm call succeeded after retry",
+					slog.Int("attempt", i+1),
+					slog.String("endpoint", endpoint))
+			}
+			return resp, nil
+		}
+		lastErr = err
+
+		if isNotFoundError(err) || isConnectionError(err) {
+			var zero T
+			return zero, err
+		}
+
+		s.log.Warn("algorithm call failed, retrying...",
+			slog.Int("attempt", i+1),
+			slog.Int("max_retries", algorithmCallAttempts),
+			slog.String("endpoint", endpoint),
+			slog.String("error", err.Error()))
+
+		if i < algorithmCallAttempts-1 {
+			time.Sleep(retryDelay)
+			retryDelay *= 2 // 指数退避
 		}
-		errStr := err.Error()
-		return strings.Contains(errStr, "connection refused") ||
-			strings.Contains(errStr, "connection reset") ||
-			strings.Contains(errStr, "connection timeout") ||
-			strings.Contains(errStr, "no such host") ||
-			strings.Contains(errStr, "dial tcp") ||
-			strings.Contains(errStr, "network is unreachable")
 	}
 
+	var zero T
+	return zero, fmt.Errorf("algorithm call failed after %d retries: %w", algorithmCallAttempts, lastErr)
+}
+
+// callAlgorithmHTTP HTTP调用算法服务（带重试机制）
+func (s *Scheduler) callAlgorithmHTTP(algorithm conf.AlgorithmService, req conf.InferenceRequest) (*conf.InferenceResponse, error) {
+	reqBody, contentType, err := buildHTTPInferenceBody(algorithm.ImageMode, req)
+	if err != nil {
+		return nil, err
+	}
+
+	maxRetries := algorithmCallAttempts
+	retryDelay := algorithmCallRetryDelay
+	var lastErr error
+
 	for i := 0; i < maxRetries; i++ {
 		// 使用全局优化的HTTP客户端，启用连接复用以提高性能
 		// 注意：全局客户端已配置连接复用，可以大幅提高并发请求速度
@@ -864,7 +1163,7 @@ func (s *Scheduler) callAlgorithm(algorithm conf.AlgorithmService, req conf.Infe
 		if err != nil {
 			return nil, fmt.Errorf("create request failed: %w", err)
 		}
-		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("Content-Type", contentType)
 		// 不设置Connection: close，使用连接复用
 
 		httpResp, err := s.httpClient.Do(httpReq)
@@ -942,9 +1241,6 @@ func (s *Scheduler) callAlgorithm(algorithm conf.AlgorithmService, req conf.Infe
 			time.Sleep(retryDelay)
 			retryDelay *= 2 // 指数退避
 		}
-
-		// 重新marshal请求体（bytes.NewReader可能已被读取）
-		reqBody, _ = json.Marshal(req)
 	}
 
 	return nil, fmt.Errorf("algorithm call failed after %d retries: %w", maxRetries, lastErr)
@@ -1084,7 +1380,7 @@ func (s *Scheduler) deleteImageWithReason(imagePath, reason string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err := s.minio.RemoveObject(ctx, s.bucket, imagePath, minio.RemoveObjectOptions{})
+	err := s.store.Delete(ctx, imagePath)
 	if err != nil {
 		s.log.Error("failed to delete image from MinIO",
 			slog.String("path", imagePath),
@@ -1155,37 +1451,20 @@ func (s *Scheduler) moveImageToAlertPathInternal(srcPath, dstPath string) error
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// 复制对象到新路径
-	copyStart := time.Now()
-	src := minio.CopySrcOptions{
-		Bucket: s.bucket,
-		Object: srcPath,
-	}
-	dst := minio.CopyDestOptions{
-		Bucket: s.bucket,
-		Object: dstPath,
-	}
-
-	_, err := s.minio.CopyObject(ctx, dst, src)
-	copyDuration := time.Since(copyStart)
-
-	if err != nil {
-		// 记录失败
-		if s.monitor != nil {
-			s.monitor.RecordMinIOMove(false, time.Since(startTime).Milliseconds())
+	// 移动对象到新路径（MinIO为复制后删除原文件，本地存储为重命名）
+	if err := s.store.Move(ctx, srcPath, dstPath); err != nil {
+		if !errors.Is(err, objstore.ErrSourceNotRemoved) {
+			// 记录失败
+			if s.monitor != nil {
+				s.monitor.RecordMinIOMove(false, time.Since(startTime).Milliseconds())
+			}
+			return fmt.Errorf("move object failed: %w", err)
 		}
-		return fmt.Errorf("copy object failed: %w", err)
-	}
-
-	// 删除原文件（等待复制完成后再删除）
-	removeStart := time.Now()
-	if err := s.minio.RemoveObject(ctx, s.bucket, srcPath, minio.RemoveObjectOptions{}); err != nil {
 		// 复制成功但删除失败，不返回错误（原文件留着也无妨）
 		s.log.Warn("failed to remove original image after copy (not critical)",
 			slog.String("path", srcPath),
 			slog.String("err", err.Error()))
 	}
-	removeDuration := time.Since(removeStart)
 	totalDuration := time.Since(startTime)
 
 	// 记录成功和响应时间
@@ -1197,8 +1476,6 @@ func (s *Scheduler) moveImageToAlertPathInternal(srcPath, dstPath string) error
 	s.log.Debug("image move completed",
 		slog.String("src", srcPath),
 		slog.String("dst", dstPath),
-		slog.Duration("copy_duration_ms", copyDuration),
-		slog.Duration("remove_duration_ms", removeDuration),
 		slog.Duration("total_duration_ms", totalDuration))
 
 	return nil
@@ -1209,32 +1486,34 @@ func (s *Scheduler) getFrameExtractorService() *frameextractor.Service {
 	return frameextractor.GetGlobal()
 }
 
-func (s *Scheduler) selectAlgorithmForImage(image ImageInfo) (*conf.AlgorithmService, error) {
+// selectAlgorithmForImage 选择推理实例，同时返回半开熔断器的探测凭证（非探测请求为0）
+func (s *Scheduler) selectAlgorithmForImage(image ImageInfo) (*conf.AlgorithmService, uint64, error) {
 	if image.TaskType != tripwireTaskType {
-		return s.registry.GetAlgorithmWithLoadBalance(image.TaskType), nil
+		algorithm, probe := s.registry.AcquireAlgorithm(image.TaskType, image.TaskID)
+		return algorithm, probe, nil
 	}
 
 	fxService := s.getFrameExtractorService()
 	if fxService == nil {
-		return nil, fmt.Errorf("frame extractor service unavailable")
+		return nil, 0, fmt.Errorf("frame extractor service unavailable")
 	}
 
 	task := fxService.GetTaskByID(image.TaskID)
 	if task == nil {
-		return nil, fmt.Errorf("frame extractor task not found")
+		return nil, 0, fmt.Errorf("frame extractor task not found")
 	}
 
 	preferredEndpoint := strings.TrimSpace(task.PreferredAlgorithmEndpoint)
 	if preferredEndpoint == "" {
-		return nil, fmt.Errorf("preferred_algorithm_endpoint not configured for task")
+		return nil, 0, fmt.Errorf("preferred_algorithm_endpoint not configured for task")
 	}
 
 	algorithm := s.registry.GetAlgorithmByEndpoint(image.TaskType, preferredEndpoint)
 	if algorithm == nil {
-		return nil, fmt.Errorf("preferred algorithm endpoint %s not registered", preferredEndpoint)
+		return nil, 0, fmt.Errorf("preferred algorithm endpoint %s not registered", preferredEndpoint)
 	}
 
-	return algorithm, nil
+	return algorithm, 0, nil
 }
 
 // generatePresignedURL 生成图片的预签名URL
@@ -1249,7 +1528,7 @@ func (s *Scheduler) generatePresignedURL(imagePath string) (string, error) {
 	defer cancel()
 
 	// 24小时有效期已经足够覆盖8小时时差，保持原值
-	presignedURL, err := s.minio.PresignedGetObject(ctx, s.bucket, imagePath, 24*time.Hour, nil)
+	presignedURL, err := s.store.PresignGet(ctx, imagePath, 24*time.Hour)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
 	}
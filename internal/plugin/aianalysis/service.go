@@ -5,9 +5,12 @@ import (
 	"easydarwin/internal/conf"
 	"easydarwin/internal/data"
 	"easydarwin/internal/plugin/frameextractor"
+	"easydarwin/utils/pkg/objstore"
+	"easydarwin/utils/plugin/core/msgpush"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/minio/minio-go/v7"
@@ -23,10 +26,19 @@ type Service struct {
 	eventListener    *EventListener // 事件监听器（替代扫描器）
 	scheduler        *Scheduler
 	mq               MessageQueue
+	outbox           *OutboxQueue           // 告警发件箱（包装 mq）
 	queue            *InferenceQueue        // 智能队列
 	monitor          *PerformanceMonitor    // 性能监控
 	alertMgr         *AlertManager          // 告警管理
 	alertBatchWriter *data.AlertBatchWriter // 批量写入告警
+	suppressor       *AlertSuppressor       // 告警抑制（未启用时为nil）
+	ruleEngine       *RuleEngine            // 告警规则引擎
+	clipRecorder     *ClipRecorder          // 告警视频片段录制（未启用时为nil）
+	datasetExporter  *DatasetExporter       // 训练数据导出
+	alertPush        *msgpush.Core          // 告警实时推送（SSE/WebSocket）
+	webhookNotifier  *WebhookNotifier       // 告警回调
+	algorithmAuth    *AlgorithmAuth         // 算法服务注册鉴权
+	shadow           *ShadowEvaluator       // 影子推理（未启用时为nil）
 	log              *slog.Logger
 }
 
@@ -58,29 +70,28 @@ func (s *Service) Start() error {
 		slog.String("mq_address", s.cfg.MQAddress),
 		slog.Bool("save_only_with_detection", s.cfg.SaveOnlyWithDetection))
 
-	// 检查Frame Extractor是否使用MinIO
-	if s.fxCfg.Store != "minio" {
-		return fmt.Errorf("AI analysis requires frame_extractor.store = 'minio'")
-	}
-
-	// 初始化MinIO客户端
-	minioClient, err := s.initMinIO()
+	// 初始化对象存储（与Frame Extractor使用相同的存储）
+	store, basePath, err := s.initObjectStore()
 	if err != nil {
-		return fmt.Errorf("failed to init minio: %w", err)
-	}
-
-	// 运行 MinIO 诊断（自动排查 502 问题）
-	debugger := NewMinIODebugger(minioClient, s.fxCfg.MinIO.Bucket, s.log)
-	if err := debugger.DiagnoseWithRetry(2, 2*time.Second); err != nil {
-		s.log.Error("MinIO 诊断发现问题，但继续启动",
-			slog.String("error", err.Error()))
-		// 不阻止启动，但记录警告
-	} else {
-		s.log.Info("MinIO 诊断通过，连接正常")
+		return fmt.Errorf("failed to init object store: %w", err)
 	}
 
 	// 初始化注册中心（优先初始化，确保注册功能可用）
 	s.registry = NewRegistry(s.cfg.HeartbeatTimeoutSec, s.log)
+	if err := s.registry.ConfigureLoadBalance(s.cfg.LoadBalance); err != nil {
+		s.log.Warn("invalid load balance config entries ignored",
+			slog.String("err", err.Error()))
+	}
+	s.registry.ConfigureCircuitBreaker(s.cfg.CircuitBreaker)
+	if err := s.registry.ConfigureCanary(s.cfg.Canary); err != nil {
+		s.log.Warn("invalid canary config entries ignored",
+			slog.String("err", err.Error()))
+	}
+	// 运行时调整的灰度规则和全量/回滚状态保存在数据库中，重启后恢复
+	if err := s.registry.SetCanaryStore(dbCanaryStore{}); err != nil {
+		s.log.Warn("failed to load canaries from database, using config only",
+			slog.String("err", err.Error()))
+	}
 	s.registry.StartHeartbeatChecker()
 
 	// 设置注册回调：算法服务上线时自动启动已配置的任务
@@ -89,11 +100,25 @@ func (s *Service) Start() error {
 	// 设置注销回调：算法服务下线时记录日志
 	s.registry.SetOnUnregisterCallback(s.onAlgorithmServiceUnregistered)
 
+	// 算法服务注册鉴权及审计
+	authLog := s.log.With(slog.String("component", "algorithm_auth"))
+	s.algorithmAuth, err = NewAlgorithmAuth(s.cfg.Auth, data.NewAppCore(authLog), authLog)
+	if err != nil {
+		return fmt.Errorf("failed to init algorithm auth: %w", err)
+	}
+	s.algorithmAuth.Start()
+
+	// 多节点部署时启用共享注册中心（失败时退化为本节点注册中心）
+	if err := s.initSharedRegistry(); err != nil {
+		s.log.Error("failed to init shared registry, falling back to in-memory registry",
+			slog.String("err", err.Error()))
+	}
+
 	// 初始化消息队列（如果失败，记录警告但不阻止启动）
 	if err := s.initMessageQueue(); err != nil {
 		s.log.Warn("failed to init message queue, continuing without MQ",
 			slog.String("error", err.Error()),
-			slog.String("note", "algorithm service registration will still work, but alerts will not be pushed to MQ"))
+			slog.String("note", "algorithm service registration will still work, alerts are kept in outbox until MQ is reachable"))
 		// 不返回错误，允许服务继续启动（注册功能不依赖消息队列）
 	}
 
@@ -108,11 +133,11 @@ func (s *Service) Start() error {
 		maxQueueSize,         // 最大队列容量（可配置）
 		StrategyDropOldest,   // 丢弃最旧的策略
 		alertThreshold,       // 积压告警阈值
-		minioClient,          // MinIO客户端
-		s.fxCfg.MinIO.Bucket, // MinIO bucket
-		true,                 // 丢弃图片时删除MinIO文件
+		store,                // 对象存储
+		true,                 // 丢弃图片时删除存储中的文件
 		s.log,
 	)
+	s.queue.SetScheduling(s.cfg.Queue)
 
 	// 初始化性能监控器
 	s.monitor = NewPerformanceMonitor(
@@ -127,6 +152,18 @@ func (s *Service) Start() error {
 	}
 	s.alertMgr = NewAlertManager(1000, maxAlertsInDB, s.log)
 
+	// 告警实时推送（告警落库和系统告警）
+	s.alertPush = msgpush.NewCore(nil)
+	s.alertPush.SetStreamSize(s.cfg.Push.HistorySize, s.cfg.Push.BufferSize)
+	s.alertMgr.SetOnAlertCallback(s.publishSystemAlert)
+
+	// 告警回调（webhook）
+	s.webhookNotifier = NewWebhookNotifier(s.cfg.Webhook, s.log.With(slog.String("component", "webhook")))
+	if err := s.webhookNotifier.Reload(); err != nil {
+		s.log.Error("failed to load webhooks", slog.String("err", err.Error()))
+	}
+	s.webhookNotifier.Start()
+
 	// 设置告警回调
 	s.queue.SetAlertCallback(func(alert AlertInfo) {
 		s.alertMgr.SendAlert(SystemAlert{
@@ -150,6 +187,9 @@ func (s *Service) Start() error {
 		})
 	})
 
+	// 算法实例熔断/恢复时发送系统告警
+	s.registry.SetOnBreakerStateChange(s.onBreakerStateChange)
+
 	// 获取告警路径前缀
 	alertBasePath := s.cfg.AlertBasePath
 	if alertBasePath == "" {
@@ -173,26 +213,81 @@ func (s *Service) Start() error {
 		maxAlertsInDB,
 		s.log.With(slog.String("component", "alert_batch_writer")),
 	)
+	s.alertBatchWriter.SetOnCreatedCallback(s.onAlertsCreated)
 	s.alertBatchWriter.Start()
 
-	// 初始化事件监听器（替代扫描器，使用MinIO事件通知）
-	s.eventListener = NewEventListener(minioClient, s.fxCfg.MinIO.Bucket, s.fxCfg.MinIO.BasePath, alertBasePath, s.log)
+	// 初始化事件监听器（替代扫描器，使用对象存储事件通知）
+	s.eventListener = NewEventListener(store, basePath, alertBasePath, s.log)
 
 	// 保留扫描器用于兼容（可选，用于初始扫描或降级）
-	s.scanner = NewScanner(minioClient, s.fxCfg.MinIO.Bucket, s.fxCfg.MinIO.BasePath, alertBasePath, s.log)
+	s.scanner = NewScanner(store, basePath, alertBasePath, s.log)
 
 	// 初始化调度器
 	moveConcurrent := s.cfg.AlertImageMoveConcurrent
 	if moveConcurrent <= 0 {
 		moveConcurrent = 50 // 默认50个并发
 	}
-	s.scheduler = NewScheduler(s.registry, minioClient, s.fxCfg.MinIO.Bucket, alertBasePath, s.mq, s.cfg.MaxConcurrentInfer, s.cfg.SaveOnlyWithDetection, s.alertBatchWriter, s.monitor, s.scanner, s.log, moveConcurrent)
+	s.scheduler = NewScheduler(s.registry, store, alertBasePath, s.mq, s.cfg.MaxConcurrentInfer, s.cfg.SaveOnlyWithDetection, s.alertBatchWriter, s.monitor, s.scanner, s.log, moveConcurrent)
 
 	// 设置处理完成回调，用于增加processedCount
 	s.scheduler.SetOnProcessedCallback(func() {
 		s.queue.RecordProcessed()
 	})
 
+	// 告警规则（规则加载失败时按检测个数判定，规则修改后可通过API重新加载）
+	s.ruleEngine = NewRuleEngine(s.log)
+	if err := s.ruleEngine.Reload(); err != nil {
+		s.log.Error("failed to load alert rules", slog.String("err", err.Error()))
+	}
+	s.scheduler.SetRuleEngine(s.ruleEngine)
+
+	// 告警图片标注
+	if s.cfg.Annotation.Enable {
+		annotator, err := NewAnnotator(s.cfg.Annotation)
+		if err != nil {
+			s.log.Error("failed to create alert image annotator, annotation disabled", slog.String("err", err.Error()))
+		} else {
+			s.scheduler.SetAnnotator(annotator)
+			s.log.Info("alert image annotation enabled", slog.String("font_file", s.cfg.Annotation.FontFile))
+		}
+	}
+
+	// 告警视频片段
+	if s.cfg.Clip.Enable {
+		s.clipRecorder = NewClipRecorder(s.cfg.Clip, store, s.log)
+		s.clipRecorder.SetOnSaved(s.onAlertClipSaved)
+		s.clipRecorder.Start()
+		s.scheduler.SetClipRecorder(s.clipRecorder)
+		s.log.Info("alert clip recording enabled",
+			slog.Duration("pre", s.clipRecorder.pre),
+			slog.Duration("post", s.clipRecorder.post))
+	}
+
+	// 训练数据导出
+	s.datasetExporter = NewDatasetExporter(s.cfg.DatasetExport, store, s.log)
+
+	// 告警抑制与去重
+	if s.cfg.Suppression.Enable {
+		s.suppressor = NewAlertSuppressor(s.cfg.Suppression, s.log)
+		s.suppressor.SetOnRollup(s.onAlertRollup)
+		s.suppressor.Start()
+		s.scheduler.SetAlertSuppressor(s.suppressor)
+		s.log.Info("alert suppression enabled",
+			slog.Int("cooldown_sec", s.cfg.Suppression.CooldownSec),
+			slog.Int("dedup_window_sec", s.cfg.Suppression.DedupWindowSec),
+			slog.Float64("iou_threshold", s.cfg.Suppression.IoUThreshold))
+	}
+
+	// 影子推理
+	if s.cfg.Shadow.Enable {
+		s.shadow = NewShadowEvaluator(s.cfg.Shadow, s.registry, s.scheduler, s.log)
+		s.shadow.Start()
+		s.scheduler.SetShadowEvaluator(s.shadow)
+		s.log.Info("shadow inference enabled",
+			slog.Float64("sample_rate", s.shadow.sampleRate),
+			slog.Int("workers", s.shadow.workers))
+	}
+
 	// 启动智能推理循环
 	s.startSmartInferenceLoop()
 
@@ -338,11 +433,13 @@ func (s *Service) inferenceProcessLoop() {
 
 		// 关键修复：从队列Pop后立即标记为"即将推理"，避免时间窗口漏洞
 		// 这样可以确保图片在Pop之后、ScheduleInference实际执行之前就受到保护
+		// 有实例启用批量推理时一次取出多张图片，由调度器按实例和任务类型凑批
+		batchSize := s.registry.MaxBatchSize()
 		popStart := time.Now()
-		img, ok := s.queue.Pop()
+		images := s.queue.PopBatch(batchSize)
 		popDuration := time.Since(popStart)
 
-		if ok {
+		for _, img := range images {
 			// 立即标记为"即将推理"，避免时间窗口漏洞
 			// 标记操作很快（只是一个map操作），时间窗口已经非常小
 			marked := s.scheduler.MarkPendingInference(img.Path)
@@ -352,7 +449,7 @@ func (s *Service) inferenceProcessLoop() {
 					slog.String("path", img.Path))
 			}
 		}
-		if !ok {
+		if len(images) == 0 {
 			emptyQueueCount++
 			// 每100次空队列才记录一次日志，避免日志过多
 			if emptyQueueCount%100 == 0 {
@@ -367,47 +464,68 @@ func (s *Service) inferenceProcessLoop() {
 		}
 		emptyQueueCount = 0
 
-		// 在调度推理前，先检查图片是否还存在（避免处理已被清理的图片）
-		// 注意：现在队列中的图片已被保护，但为了安全起见仍然检查
-		// 如果图片不存在，可能是被其他原因删除的
-		exists, statErr := s.scheduler.CheckImageExists(img.Path)
-
-		if statErr != nil || !exists {
-			// 图片不存在，取消pending标记并跳过处理（可能已被清理）
-			s.scheduler.UnmarkPendingInference(img.Path)
-
-			s.log.Debug("image not found before inference, skipping",
-				slog.String("task_id", img.TaskID),
-				slog.String("image", img.Filename),
-				slog.String("path", img.Path),
-				slog.String("err", statErr.Error()),
-				slog.String("note", "image may have been deleted while waiting in queue"))
-
-			// 标记为已处理，避免重复扫描
-			// 注意：图片不存在不算处理，不增加processedCount
-			if s.scanner != nil {
-				s.scanner.MarkProcessed(img.Path)
-			}
+		if len(images) == 1 {
+			s.scheduleImage(images[0])
 			continue
 		}
 
-		// 调度推理（同步调用，调度器内部已有并发控制）
-		// 修复：移除额外的goroutine，避免goroutine泄漏
-		// ScheduleInference内部已经有并发控制（通过activeInferences和maxConcurrent），
-		// 不需要为每个图片都启动一个goroutine，这会导致goroutine数量无限增长
-			scheduleStart := time.Now()
-		s.scheduler.ScheduleInference(img)
-			totalDuration := time.Since(scheduleStart)
+		// 批量取出的图片并发调度：启用批量推理的实例会在调度器中合并为一个批次，
+		// 其余图片仍按单张推理，由调度器的并发限制控制
+		var wg sync.WaitGroup
+		for _, img := range images {
+			wg.Add(1)
+			go func(img ImageInfo) {
+				defer wg.Done()
+				s.scheduleImage(img)
+			}(img)
+		}
+		wg.Wait()
+	}
+}
+
+// scheduleImage 检查图片仍然存在后调度推理（同步调用，调度器内部已有并发控制）
+func (s *Service) scheduleImage(img ImageInfo) {
+	// 在调度推理前，先检查图片是否还存在（避免处理已被清理的图片）
+	// 注意：现在队列中的图片已被保护，但为了安全起见仍然检查
+	// 如果图片不存在，可能是被其他原因删除的
+	exists, statErr := s.scheduler.CheckImageExists(img.Path)
+
+	if statErr != nil || !exists {
+		// 图片不存在，取消pending标记并跳过处理（可能已被清理）
+		s.scheduler.UnmarkPendingInference(img.Path)
 
-			// 记录调度耗时（仅在Debug级别，避免日志过多）
-		s.log.Debug("inference scheduled",
+		errMsg := ""
+		if statErr != nil {
+			errMsg = statErr.Error()
+		}
+		s.log.Debug("image not found before inference, skipping",
 			slog.String("task_id", img.TaskID),
 			slog.String("image", img.Filename),
-				slog.Duration("schedule_duration_ms", totalDuration))
-
-		// 注意：worker不再等待推理完成，立即处理下一张图片
-		// ScheduleInference内部会异步执行推理，不会阻塞worker
+			slog.String("path", img.Path),
+			slog.String("err", errMsg),
+			slog.String("note", "image may have been deleted while waiting in queue"))
+
+		// 标记为已处理，避免重复扫描
+		// 注意：图片不存在不算处理，不增加processedCount
+		if s.scanner != nil {
+			s.scanner.MarkProcessed(img.Path)
+		}
+		return
 	}
+
+	// 调度推理（同步调用，调度器内部已有并发控制）
+	// 修复：移除额外的goroutine，避免goroutine泄漏
+	// ScheduleInference内部已经有并发控制（通过activeInferences和maxConcurrent），
+	// 不需要为每个图片都启动一个goroutine，这会导致goroutine数量无限增长
+	scheduleStart := time.Now()
+	s.scheduler.ScheduleInference(img)
+	totalDuration := time.Since(scheduleStart)
+
+	// 记录调度耗时（仅在Debug级别，避免日志过多）
+	s.log.Debug("inference scheduled",
+		slog.String("task_id", img.TaskID),
+		slog.String("image", img.Filename),
+		slog.Duration("schedule_duration_ms", totalDuration))
 }
 
 // periodicStatsLoop 定期统计循环
@@ -467,6 +585,7 @@ func (s *Service) Stop() error {
 
 	if s.registry != nil {
 		s.registry.StopHeartbeatChecker()
+		s.registry.CloseSharedStore()
 	}
 
 	// 停止批量写入器（会刷新剩余数据）
@@ -475,6 +594,35 @@ func (s *Service) Stop() error {
 		s.alertBatchWriter.Stop()
 	}
 
+	// 保留告警落库后再写回被抑制告警的合并计数
+	if s.suppressor != nil {
+		s.suppressor.Stop()
+	}
+
+	if s.clipRecorder != nil {
+		s.clipRecorder.Stop()
+	}
+
+	if s.datasetExporter != nil {
+		s.datasetExporter.Stop()
+	}
+
+	if s.algorithmAuth != nil {
+		s.algorithmAuth.Stop()
+	}
+	if s.webhookNotifier != nil {
+		s.webhookNotifier.Stop()
+	}
+	if s.shadow != nil {
+		s.shadow.Stop()
+	}
+
+	if s.scheduler != nil {
+		if err := s.scheduler.Close(); err != nil {
+			s.log.Error("failed to close scheduler connections", slog.String("err", err.Error()))
+		}
+	}
+
 	if s.mq != nil {
 		if err := s.mq.Close(); err != nil {
 			s.log.Error("failed to close MQ", slog.String("err", err.Error()))
@@ -509,11 +657,64 @@ func (s *Service) GetRegistry() *AlgorithmRegistry {
 	return s.registry
 }
 
+// CheckAlgorithmService 注册前检查算法服务声明的协议是否可用
+func (s *Service) CheckAlgorithmService(ctx context.Context, service conf.AlgorithmService) error {
+	if s.scheduler == nil {
+		return nil
+	}
+	return s.scheduler.CheckAlgorithmService(ctx, service)
+}
+
+// GetDatasetExporter 获取训练数据导出器（服务未启动时为nil）
+func (s *Service) GetDatasetExporter() *DatasetExporter {
+	return s.datasetExporter
+}
+
+// GetAlgorithmAuth 获取算法服务注册鉴权（服务未启动时为nil）
+func (s *Service) GetAlgorithmAuth() *AlgorithmAuth {
+	return s.algorithmAuth
+}
+
+// GetWebhookNotifier 获取告警回调（服务未启动时为nil）
+func (s *Service) GetWebhookNotifier() *WebhookNotifier {
+	return s.webhookNotifier
+}
+
+// GetShadowEvaluator 获取影子推理（未启用时为nil）
+func (s *Service) GetShadowEvaluator() *ShadowEvaluator {
+	return s.shadow
+}
+
+// ReloadWebhooks 重新加载告警回调目标
+func (s *Service) ReloadWebhooks() error {
+	if s.webhookNotifier == nil {
+		return nil
+	}
+	return s.webhookNotifier.Reload()
+}
+
 // GetQueue 获取推理队列
 func (s *Service) GetQueue() *InferenceQueue {
 	return s.queue
 }
 
+// GetOutboxStats 获取告警发件箱统计，未配置消息队列时返回false
+func (s *Service) GetOutboxStats() (OutboxStats, bool, error) {
+	if s.outbox == nil {
+		return OutboxStats{}, false, nil
+	}
+	stats, err := s.outbox.Stats()
+	return stats, true, err
+}
+
+// ReloadAlertRules 重新加载告警规则（规则增删改后调用）
+func (s *Service) ReloadAlertRules() error {
+	if s.ruleEngine == nil {
+		return nil
+	}
+	return s.ruleEngine.Reload()
+}
+
 // InferenceStats 推理统计信息
 type InferenceStats struct {
 	QueueSize          int     `json:"queue_size"`           // 当前队列大小
@@ -541,7 +742,10 @@ type InferenceStats struct {
 	MinIOMoveAvgTimeMs   float64 `json:"minio_move_avg_time_ms"`  // 平均耗时（毫秒）
 	MinIOMoveMaxTimeMs   int64   `json:"minio_move_max_time_ms"`  // 最大耗时（毫秒）
 	MinIOMoveSuccessRate float64 `json:"minio_move_success_rate"` // 成功率（0.0-1.0）
-	
+
+	// 按任务的队列统计（优先级、排队数、丢弃数）
+	QueueTasks []TaskQueueStats `json:"queue_tasks"`
+
 	UpdatedAt string `json:"updated_at"` // 更新时间
 }
 
@@ -639,7 +843,9 @@ func (s *Service) GetInferenceStats() InferenceStats {
 		MinIOMoveAvgTimeMs:   minIOMoveAvgTimeMs,
 		MinIOMoveMaxTimeMs:   minIOMoveMaxTimeMs,
 		MinIOMoveSuccessRate: minIOMoveSuccessRate,
-		
+
+		QueueTasks: queueStats["tasks"].([]TaskQueueStats),
+
 		UpdatedAt: time.Now().Format(time.RFC3339),
 	}
 }
@@ -665,6 +871,38 @@ func (s *Service) ResetInferenceStats() error {
 	return nil
 }
 
+// initObjectStore 按 frame_extractor.store 初始化对象存储，返回存储和抽帧图片的路径前缀
+func (s *Service) initObjectStore() (objstore.Store, string, error) {
+	switch s.fxCfg.Store {
+	case "minio":
+		minioClient, err := s.initMinIO()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to init minio: %w", err)
+		}
+
+		// 运行 MinIO 诊断（自动排查 502 问题）
+		debugger := NewMinIODebugger(minioClient, s.fxCfg.MinIO.Bucket, s.log)
+		if err := debugger.DiagnoseWithRetry(2, 2*time.Second); err != nil {
+			s.log.Error("MinIO 诊断发现问题，但继续启动",
+				slog.String("error", err.Error()))
+			// 不阻止启动，但记录警告
+		} else {
+			s.log.Info("MinIO 诊断通过，连接正常")
+		}
+		return objstore.NewMinIO(minioClient, s.fxCfg.MinIO.Bucket), s.fxCfg.MinIO.BasePath, nil
+	case "local":
+		// 本地存储由抽帧插件创建，签名URL由内置HTTP服务校验，需使用同一个实例
+		fx := frameextractor.GetGlobal()
+		if fx == nil || fx.LocalStore() == nil {
+			return nil, "", fmt.Errorf("frame extractor local store not initialized")
+		}
+		s.log.Info("using local object store", slog.String("root", fx.LocalStore().Root()))
+		return fx.LocalStore(), "", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported frame_extractor.store %q, must be minio or local", s.fxCfg.Store)
+	}
+}
+
 // initMinIO 初始化MinIO客户端
 func (s *Service) initMinIO() (*minio.Client, error) {
 	cfg := s.fxCfg.MinIO
@@ -756,17 +994,25 @@ func (s *Service) initMessageQueue() error {
 		return nil
 	}
 
+	var inner MessageQueue
 	switch s.cfg.MQType {
 	case "kafka":
-		s.mq = NewKafkaQueue(s.cfg.MQAddress, s.cfg.MQTopic, s.log)
+		inner = NewKafkaQueue(s.cfg.MQAddress, s.cfg.MQTopic, s.log)
 	case "rabbitmq":
-		return fmt.Errorf("rabbitmq not implemented yet")
+		inner = NewAMQPQueue(s.cfg.MQAddress, s.cfg.MQTopic, s.cfg.AMQP, s.log)
+	case "mqtt":
+		inner = NewMQTTQueue(s.cfg.MQAddress, s.cfg.MQTopic, s.cfg.MQTT, s.log)
 	default:
 		return fmt.Errorf("unknown mq_type: %s", s.cfg.MQType)
 	}
 
+	// 所有消息队列都经过本地发件箱投递，broker不可用时告警不丢失
+	s.outbox = NewOutboxQueue(inner, s.cfg.OutboxMaxSize, time.Duration(s.cfg.OutboxMaxAgeHours)*time.Hour,
+		s.log.With(slog.String("component", "alert_outbox")))
+	s.mq = s.outbox
+
 	if err := s.mq.Connect(); err != nil {
-		return fmt.Errorf("failed to connect to MQ: %w", err)
+		return fmt.Errorf("failed to connect to MQ, alerts will be kept in outbox until reconnected: %w", err)
 	}
 
 	s.log.Info("message queue initialized",
@@ -777,6 +1023,35 @@ func (s *Service) initMessageQueue() error {
 	return nil
 }
 
+// onBreakerStateChange 算法实例熔断状态变化的回调
+func (s *Service) onBreakerStateChange(endpoint string, status BreakerStatus) {
+	alert := SystemAlert{
+		Data: map[string]interface{}{
+			"endpoint":       endpoint,
+			"state":          string(status.State),
+			"error_rate":     status.ErrorRate,
+			"p95_latency_ms": status.P95LatencyMs,
+		},
+		Timestamp: status.ChangedAt,
+	}
+
+	switch status.State {
+	case BreakerOpen:
+		alert.Type = AlertTypeCircuitOpen
+		alert.Level = LevelError
+		alert.Message = fmt.Sprintf("算法实例 %s 已熔断，暂停分配推理请求：%s", endpoint, status.Reason)
+	case BreakerClosed:
+		alert.Type = AlertTypeCircuitClosed
+		alert.Level = LevelInfo
+		alert.Message = fmt.Sprintf("算法实例 %s 探测成功，已恢复分配推理请求", endpoint)
+	default:
+		// 半开状态只记录日志（注册中心已输出）
+		return
+	}
+
+	s.alertMgr.SendAlert(alert)
+}
+
 // onAlgorithmServiceRegistered 算法服务注册时的回调
 func (s *Service) onAlgorithmServiceRegistered(serviceID string, taskTypes []string) {
 	s.log.Info("algorithm service online, checking tasks to auto-start",
@@ -0,0 +1,459 @@
+package aianalysis
+
+import (
+	"bytes"
+	"context"
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"easydarwin/utils/pkg/objstore"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultShadowSampleRate = 0.1
+	defaultShadowWorkers    = 2
+	defaultShadowQueueSize  = 100
+	defaultShadowIoU        = 0.5
+	defaultShadowRetention  = 7 * 24 * time.Hour
+	shadowCleanupInterval   = time.Hour
+	shadowStageDir          = "_shadow/" // 图片副本的暂存目录（告警路径下，不会被扫描）
+	shadowMaxErrorLength    = 500
+)
+
+// primaryServices 过滤掉影子服务
+func primaryServices(services []conf.AlgorithmService) []conf.AlgorithmService {
+	primary := make([]conf.AlgorithmService, 0, len(services))
+	for _, svc := range services {
+		if !svc.Shadow {
+			primary = append(primary, svc)
+		}
+	}
+	return primary
+}
+
+// GetShadowAlgorithm 选择任务类型的影子服务实例，没有时返回nil
+// 同一任务固定发往同一实例（按 task_id 哈希），便于有状态的跟踪算法
+func (r *AlgorithmRegistry) GetShadowAlgorithm(taskType, taskID string) *conf.AlgorithmService {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var shadows []conf.AlgorithmService
+	for _, svc := range r.services[taskType] {
+		if svc.Shadow {
+			shadows = append(shadows, svc)
+		}
+	}
+	if len(shadows) == 0 {
+		return nil
+	}
+	selected := shadows[crc32.ChecksumIEEE([]byte(taskID))%uint32(len(shadows))]
+	return &selected
+}
+
+// detectionAgreement 主算法与影子服务检测结果的一致性
+type detectionAgreement struct {
+	ClassOverlap float64
+	Matched      int
+	MatchRate    float64
+	MatchedIoU   float64
+}
+
+// compareDetections 对比两组检测目标：
+// 类别集合的 Jaccard 相似度；同类别目标按IoU从高到低贪心匹配（任一方没有检测框时只按类别匹配，不计入平均IoU）
+func compareDetections(primary, shadow []Detection, iouThreshold float64) detectionAgreement {
+	if len(primary) == 0 && len(shadow) == 0 {
+		return detectionAgreement{ClassOverlap: 1, MatchRate: 1}
+	}
+
+	var a detectionAgreement
+	classes := make(map[string]int) // 1: 主算法, 2: 影子服务, 3: 都有
+	for _, d := range primary {
+		classes[d.Class] |= 1
+	}
+	for _, d := range shadow {
+		classes[d.Class] |= 2
+	}
+	both := 0
+	for _, flag := range classes {
+		if flag == 3 {
+			both++
+		}
+	}
+	a.ClassOverlap = float64(both) / float64(len(classes))
+
+	type pair struct {
+		i, j    int
+		iou     float64
+		hasBBox bool
+	}
+	var pairs []pair
+	for i, p := range primary {
+		for j, s := range shadow {
+			if p.Class != s.Class {
+				continue
+			}
+			if !p.HasBBox || !s.HasBBox {
+				pairs = append(pairs, pair{i: i, j: j})
+				continue
+			}
+			if iou := bboxIoU(p.BBox, s.BBox); iou >= iouThreshold {
+				pairs = append(pairs, pair{i: i, j: j, iou: iou, hasBBox: true})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(x, y int) bool { return pairs[x].iou > pairs[y].iou })
+
+	usedP := make([]bool, len(primary))
+	usedS := make([]bool, len(shadow))
+	var iouSum float64
+	var iouCount int
+	for _, p := range pairs {
+		if usedP[p.i] || usedS[p.j] {
+			continue
+		}
+		usedP[p.i], usedS[p.j] = true, true
+		a.Matched++
+		if p.hasBBox {
+			iouSum += p.iou
+			iouCount++
+		}
+	}
+	a.MatchRate = float64(2*a.Matched) / float64(len(primary)+len(shadow))
+	if iouCount > 0 {
+		a.MatchedIoU = iouSum / float64(iouCount)
+	}
+	return a
+}
+
+// shadowJob 待发送给影子服务的图片副本
+type shadowJob struct {
+	shadow        conf.AlgorithmService
+	primary       conf.AlgorithmService
+	image         ImageInfo
+	req           conf.InferenceRequest // 主算法的推理请求（算法配置等），图片内容另外保存
+	imageData     []byte                // 主算法使用内联方式时的图片内容
+	stagePath     string                // 主算法使用URL方式时在存储中复制的图片副本，推理完成后删除
+	primaryResult interface{}
+	primaryTimeMs int64
+}
+
+// ShadowEvaluator 影子推理：按采样比例将主算法已成功推理的图片复制一份异步发送给影子服务，
+// 结果与主算法对比后写入 shadow_comparisons 表，不产生告警、不影响主算法的调度和统计
+type ShadowEvaluator struct {
+	registry     *AlgorithmRegistry
+	store        objstore.Store
+	stagePath    string
+	infer        func(conf.AlgorithmService, conf.InferenceRequest) (*conf.InferenceResponse, error)
+	loadImage    func(path string) ([]byte, error)
+	sampleRate   float64
+	taskRates    map[string]float64
+	iouThreshold float64
+	workers      int
+	retention    time.Duration
+	log          *slog.Logger
+
+	jobs    chan shadowJob
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+	dropped atomic.Int64
+}
+
+// NewShadowEvaluator 创建影子推理，推理和读取图片复用调度器的实现
+func NewShadowEvaluator(cfg conf.ShadowConfig, registry *AlgorithmRegistry, scheduler *Scheduler, logger *slog.Logger) *ShadowEvaluator {
+	sampleRate := cfg.SampleRate
+	if sampleRate <= 0 {
+		sampleRate = defaultShadowSampleRate
+	}
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = defaultShadowWorkers
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultShadowQueueSize
+	}
+	iouThreshold := cfg.IoUThreshold
+	if iouThreshold <= 0 {
+		iouThreshold = defaultShadowIoU
+	}
+	retention := time.Duration(cfg.RetentionDays) * 24 * time.Hour
+	if retention <= 0 {
+		retention = defaultShadowRetention
+	}
+
+	return &ShadowEvaluator{
+		registry:     registry,
+		store:        scheduler.store,
+		stagePath:    scheduler.alertBasePath + shadowStageDir,
+		infer:        scheduler.callAlgorithm,
+		loadImage:    scheduler.loadImage,
+		sampleRate:   sampleRate,
+		taskRates:    cfg.TaskTypes,
+		iouThreshold: iouThreshold,
+		workers:      workers,
+		retention:    retention,
+		log:          logger,
+		jobs:         make(chan shadowJob, queueSize),
+		stopCh:       make(chan struct{}),
+	}
+}
+
+// Start 启动影子推理协程和对比记录清理
+func (e *ShadowEvaluator) Start() {
+	for range e.workers {
+		e.wg.Add(1)
+		go e.worker()
+	}
+	e.wg.Add(1)
+	go e.cleanupLoop()
+}
+
+// Stop 停止影子推理，未完成的推理丢弃并删除其图片副本
+func (e *ShadowEvaluator) Stop() {
+	close(e.stopCh)
+	e.wg.Wait()
+	for {
+		select {
+		case job := <-e.jobs:
+			if job.stagePath != "" {
+				e.deleteStaged(job.stagePath)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Dropped 队列满被跳过的采样数
+func (e *ShadowEvaluator) Dropped() int64 {
+	return e.dropped.Load()
+}
+
+// sampled 按任务类型的采样比例判断是否采样
+func (e *ShadowEvaluator) sampled(taskType string) bool {
+	rate := e.sampleRate
+	if r, ok := conf.LookupTaskType(e.taskRates, taskType); ok {
+		rate = r
+	}
+	return rate >= 1 || (rate > 0 && rand.Float64() < rate)
+}
+
+// Mirror 主算法推理成功后调用：采样命中且任务类型注册了影子服务时复制图片并加入影子推理队列
+// 在主算法删除或移动图片之前调用：主算法使用内联方式时直接复用已读取的图片内容，使用URL方式时在存储中复制一份
+// （服务端复制，不经过本机传输图片内容），读取图片和影子推理都在后台协程中执行
+func (e *ShadowEvaluator) Mirror(job *inferenceJob, primary conf.AlgorithmService, resp *conf.InferenceResponse, primaryTimeMs int64) {
+	image := job.image
+	if !e.sampled(image.TaskType) {
+		return
+	}
+	shadow := e.registry.GetShadowAlgorithm(image.TaskType, image.TaskID)
+	if shadow == nil {
+		return
+	}
+	if len(e.jobs) == cap(e.jobs) {
+		e.dropped.Add(1)
+		return
+	}
+
+	imageData := job.req.ImageData
+	stagePath := ""
+	if imageData == nil {
+		stagePath = e.stageKey(image)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := objstore.Copy(ctx, e.store, image.Path, stagePath)
+		cancel()
+		if err != nil {
+			e.log.Warn("failed to copy image for shadow inference",
+				slog.String("path", image.Path),
+				slog.String("err", err.Error()))
+			return
+		}
+	}
+
+	req := job.req
+	req.ImageData = nil
+	select {
+	case e.jobs <- shadowJob{
+		shadow:        *shadow,
+		primary:       primary,
+		image:         image,
+		req:           req,
+		imageData:     imageData,
+		stagePath:     stagePath,
+		primaryResult: resp.Result,
+		primaryTimeMs: primaryTimeMs,
+	}:
+	default:
+		e.dropped.Add(1)
+		if stagePath != "" {
+			go e.deleteStaged(stagePath)
+		}
+	}
+}
+
+// stageKey 图片副本在存储中的路径
+func (e *ShadowEvaluator) stageKey(image ImageInfo) string {
+	return fmt.Sprintf("%s%s/%s/%s", e.stagePath, image.TaskType, image.TaskID, image.Filename)
+}
+
+// deleteStaged 删除图片副本
+func (e *ShadowEvaluator) deleteStaged(stagePath string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.store.Delete(ctx, stagePath); err != nil {
+		e.log.Warn("failed to delete staged shadow image",
+			slog.String("path", stagePath),
+			slog.String("err", err.Error()))
+	}
+}
+
+func (e *ShadowEvaluator) worker() {
+	defer e.wg.Done()
+	for {
+		select {
+		case <-e.stopCh:
+			return
+		case job := <-e.jobs:
+			e.evaluate(job)
+		}
+	}
+}
+
+// evaluate 调用影子服务并保存对比结果
+func (e *ShadowEvaluator) evaluate(job shadowJob) {
+	comparison := model.ShadowComparison{
+		TaskID:         job.image.TaskID,
+		TaskType:       job.image.TaskType,
+		ImagePath:      job.image.Path,
+		PrimaryID:      job.primary.ServiceID,
+		PrimaryVersion: job.primary.Version,
+		ShadowID:       job.shadow.ServiceID,
+		ShadowVersion:  job.shadow.Version,
+		PrimaryCount:   extractDetectionCount(job.primaryResult),
+		PrimaryTimeMs:  int(job.primaryTimeMs),
+		CreatedAt:      time.Now(),
+	}
+	if b, err := json.Marshal(job.primaryResult); err == nil {
+		comparison.PrimaryResult = string(b)
+	}
+
+	start := time.Now()
+	resp, err := e.call(job)
+	comparison.ShadowTimeMs = int(time.Since(start).Milliseconds())
+	if err == nil && !resp.Success {
+		err = fmt.Errorf("inference not successful: %s", resp.Error)
+	}
+
+	if err != nil {
+		comparison.ShadowError = err.Error()
+		if len(comparison.ShadowError) > shadowMaxErrorLength {
+			comparison.ShadowError = comparison.ShadowError[:shadowMaxErrorLength]
+		}
+		e.log.Warn("shadow inference failed",
+			slog.String("shadow", job.shadow.ServiceID),
+			slog.String("endpoint", job.shadow.Endpoint),
+			slog.String("image", job.image.Path),
+			slog.String("err", err.Error()))
+	} else {
+		if resp.InferenceTimeMs > 0 {
+			comparison.ShadowTimeMs = int(resp.InferenceTimeMs)
+		}
+		if b, err := json.Marshal(resp.Result); err == nil {
+			comparison.ShadowResult = string(b)
+		}
+		comparison.ShadowCount = extractDetectionCount(resp.Result)
+		comparison.SameCount = comparison.PrimaryCount == comparison.ShadowCount
+
+		agreement := compareDetections(parseDetections(job.primaryResult), parseDetections(resp.Result), e.iouThreshold)
+		comparison.ClassOverlap = agreement.ClassOverlap
+		comparison.Matched = agreement.Matched
+		comparison.MatchRate = agreement.MatchRate
+		comparison.MatchedIoU = agreement.MatchedIoU
+	}
+
+	if err := data.AddShadowComparison(&comparison); err != nil {
+		e.log.Error("failed to save shadow comparison",
+			slog.String("shadow", job.shadow.ServiceID),
+			slog.String("err", err.Error()))
+		return
+	}
+
+	e.log.Debug("shadow inference compared",
+		slog.String("task_id", comparison.TaskID),
+		slog.String("shadow", comparison.ShadowID),
+		slog.Int("primary_count", comparison.PrimaryCount),
+		slog.Int("shadow_count", comparison.ShadowCount),
+		slog.Float64("match_rate", comparison.MatchRate))
+}
+
+// call 按影子服务的图片传输方式发送图片：内联模式发送图片内容（需要时从图片副本读取），
+// URL模式为图片副本生成预签名URL（主算法使用内联方式时先将图片内容暂存到告警路径下），推理完成后删除副本
+func (e *ShadowEvaluator) call(job shadowJob) (*conf.InferenceResponse, error) {
+	stagePath := job.stagePath
+	if stagePath != "" {
+		defer e.deleteStaged(stagePath)
+	}
+
+	req := job.req
+	if isInlineImageMode(job.shadow.ImageMode) {
+		imageData := job.imageData
+		if imageData == nil {
+			var err error
+			if imageData, err = e.loadImage(stagePath); err != nil {
+				return nil, fmt.Errorf("load staged image failed: %w", err)
+			}
+		}
+		req.ImageURL = ""
+		req.AlgoConfigURL = ""
+		req.ImageData = imageData
+		req.ImageFormat = imageFormat(job.image.Path)
+		return e.infer(job.shadow, req)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if stagePath == "" {
+		stagePath = e.stageKey(job.image)
+		if err := e.store.Put(ctx, stagePath, bytes.NewReader(job.imageData), int64(len(job.imageData)), "image/"+imageFormat(job.image.Path)); err != nil {
+			return nil, fmt.Errorf("stage image failed: %w", err)
+		}
+		defer e.deleteStaged(stagePath)
+	}
+
+	u, err := e.store.PresignGet(ctx, stagePath, inferencePresignExpiry)
+	if err != nil {
+		return nil, fmt.Errorf("presign staged image failed: %w", err)
+	}
+	req.ImageURL = u.String()
+	req.ImagePath = stagePath
+	return e.infer(job.shadow, req)
+}
+
+// cleanupLoop 定期删除过期的对比记录
+func (e *ShadowEvaluator) cleanupLoop() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(shadowCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stopCh:
+			return
+		case <-ticker.C:
+			deleted, err := data.CleanupShadowComparisons(time.Now().Add(-e.retention))
+			if err != nil {
+				e.log.Error("failed to cleanup shadow comparisons", slog.String("err", err.Error()))
+			} else if deleted > 0 {
+				e.log.Info("shadow comparisons cleaned up", slog.Int64("deleted", deleted))
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package aianalysis
+
+import (
+	"context"
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"easydarwin/utils/pkg/objstore"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCompareDetections(t *testing.T) {
+	primary := []Detection{
+		{Class: "person", BBox: [4]float64{0, 0, 10, 10}, HasBBox: true},
+		{Class: "person", BBox: [4]float64{20, 20, 30, 30}, HasBBox: true},
+		{Class: "helmet", BBox: [4]float64{50, 50, 60, 60}, HasBBox: true},
+	}
+	shadow := []Detection{
+		{Class: "person", BBox: [4]float64{21, 21, 31, 31}, HasBBox: true}, // IoU≈0.68
+		{Class: "person", BBox: [4]float64{0, 0, 10, 10}, HasBBox: true},   // IoU=1
+		{Class: "car", BBox: [4]float64{50, 50, 60, 60}, HasBBox: true},    // 类别不同不匹配
+	}
+
+	a := compareDetections(primary, shadow, 0.5)
+	if a.Matched != 2 || math.Abs(a.MatchRate-4.0/6) > 1e-9 {
+		t.Fatalf("unexpected match: %+v", a)
+	}
+	if math.Abs(a.ClassOverlap-1.0/3) > 1e-9 {
+		t.Fatalf("class overlap = %v, want 1/3", a.ClassOverlap)
+	}
+	if a.MatchedIoU < 0.83 || a.MatchedIoU > 0.85 {
+		t.Fatalf("matched iou = %v", a.MatchedIoU)
+	}
+
+	// 没有检测框时只按类别匹配，不计入平均IoU
+	a = compareDetections([]Detection{{Class: "fire"}}, []Detection{{Class: "fire"}}, 0.5)
+	if a.Matched != 1 || a.MatchRate != 1 || a.MatchedIoU != 0 {
+		t.Fatalf("unexpected class-only match: %+v", a)
+	}
+
+	if a = compareDetections(nil, nil, 0.5); a.ClassOverlap != 1 || a.MatchRate != 1 {
+		t.Fatalf("empty results should agree: %+v", a)
+	}
+}
+
+func TestShadowServiceExcludedFromRouting(t *testing.T) {
+	shadow := testService("shadow", 0)
+	shadow.Shadow = true
+	r := newTestRegistry(t, shadow)
+
+	if svc := r.GetAlgorithmWithLoadBalance("人数统计", "cam1"); svc != nil {
+		t.Fatalf("shadow service used as primary: %s", svc.Endpoint)
+	}
+
+	if err := r.Register(testService("primary", 0)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if svc := r.GetAlgorithmWithLoadBalance("人数统计", "cam1"); svc == nil || svc.Endpoint != "primary" {
+			t.Fatalf("unexpected primary selection: %+v", svc)
+		}
+	}
+	if svc := r.GetShadowAlgorithm("人数统计", "cam1"); svc == nil || svc.Endpoint != "shadow" {
+		t.Fatalf("unexpected shadow selection: %+v", svc)
+	}
+	if svc := r.GetShadowAlgorithm("安全帽检测", "cam1"); svc != nil {
+		t.Fatalf("unexpected shadow for other task type: %+v", svc)
+	}
+}
+
+func TestShadowEvaluatorComparesResults(t *testing.T) {
+	setupTestDB(t)
+
+	shadow := testService("shadow", 0)
+	shadow.Shadow = true
+	shadow.Version = "2.0"
+	shadow.ImageMode = ImageModeBase64
+	r := newTestRegistry(t, shadow)
+
+	store, err := objstore.NewLocal(t.TempDir(), objstore.LocalOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := store.Put(ctx, "人数统计/cam1/1.jpg", strings.NewReader("image"), 5, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	var received conf.InferenceRequest
+	e := &ShadowEvaluator{
+		registry:  r,
+		store:     store,
+		stagePath: "alerts/" + shadowStageDir,
+		infer: func(svc conf.AlgorithmService, req conf.InferenceRequest) (*conf.InferenceResponse, error) {
+			received = req
+			return &conf.InferenceResponse{Success: true, InferenceTimeMs: 30, Result: map[string]interface{}{
+				"detections": []interface{}{
+					map[string]interface{}{"class": "person", "confidence": 0.9, "bbox": []interface{}{0.0, 0.0, 10.0, 10.0}},
+				},
+			}}, nil
+		},
+		loadImage: func(path string) ([]byte, error) {
+			obj, err := store.Get(ctx, path)
+			if err != nil {
+				return nil, err
+			}
+			defer obj.Close()
+			return io.ReadAll(obj)
+		},
+		sampleRate:   1,
+		taskRates:    map[string]float64{"helmet": 0},
+		iouThreshold: 0.5,
+		log:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		jobs:         make(chan shadowJob, 1),
+	}
+
+	primary := versionedService("primary", "1.0")
+	resp := &conf.InferenceResponse{Success: true, Result: map[string]interface{}{
+		"detections": []interface{}{
+			map[string]interface{}{"class": "person", "confidence": 0.8, "bbox": []interface{}{0.0, 0.0, 10.0, 10.0}},
+			map[string]interface{}{"class": "person", "confidence": 0.7, "bbox": []interface{}{40.0, 40.0, 50.0, 50.0}},
+		},
+	}}
+	job := &inferenceJob{
+		image: ImageInfo{Path: "人数统计/cam1/1.jpg", TaskType: "人数统计", TaskID: "cam1", Filename: "1.jpg"},
+		req:   conf.InferenceRequest{ImageURL: "http://minio/presigned", TaskID: "cam1", TaskType: "人数统计"},
+	}
+
+	// 采样比例为0的任务类型不复制（忽略大小写匹配）
+	skipped := *job
+	skipped.image.TaskType = "Helmet"
+	e.Mirror(&skipped, primary, resp, 40)
+	if len(e.jobs) != 0 {
+		t.Fatal("task type with zero sample rate should not be mirrored")
+	}
+
+	e.Mirror(job, primary, resp, 40)
+	e.Mirror(job, primary, resp, 40) // 队列已满
+	if len(e.jobs) != 1 || e.Dropped() != 1 {
+		t.Fatalf("queued=%d dropped=%d", len(e.jobs), e.Dropped())
+	}
+
+	// 主算法使用URL方式时在存储中复制图片，主算法随后删除原图不影响影子推理
+	staged := "alerts/" + shadowStageDir + "人数统计/cam1/1.jpg"
+	if _, err := store.Stat(ctx, staged); err != nil {
+		t.Fatal("image should be copied for shadow inference:", err)
+	}
+	if err := store.Delete(ctx, job.image.Path); err != nil {
+		t.Fatal(err)
+	}
+	e.evaluate(<-e.jobs)
+	if _, err := store.Stat(ctx, staged); !errors.Is(err, objstore.ErrNotFound) {
+		t.Fatal("staged copy should be deleted after shadow inference, got", err)
+	}
+
+	if string(received.ImageData) != "image" || received.ImageURL != "" {
+		t.Fatalf("shadow request should carry inline image: %+v", received)
+	}
+
+	items, total, err := data.ListShadowComparisons(model.ShadowComparisonFilter{ShadowVersion: "2.0"}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 {
+		t.Fatalf("comparisons = %d, want 1", total)
+	}
+	c := items[0]
+	if c.PrimaryVersion != "1.0" || c.PrimaryCount != 2 || c.ShadowCount != 1 || c.SameCount {
+		t.Fatalf("unexpected comparison: %+v", c)
+	}
+	if c.Matched != 1 || math.Abs(c.MatchRate-2.0/3) > 1e-9 || c.MatchedIoU != 1 || c.ShadowTimeMs != 30 {
+		t.Fatalf("unexpected agreement: %+v", c)
+	}
+}
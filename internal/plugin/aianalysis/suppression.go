@@ -0,0 +1,294 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	suppressionFlushInterval = 5 * time.Second // 合并结果写回数据库的间隔
+	defaultIoUThreshold      = 0.5
+
+	// suppressionConfigKey 任务算法配置中覆盖抑制规则的字段
+	suppressionConfigKey = "alert_suppression"
+)
+
+// SuppressDecision 告警抑制判定结果
+type SuppressDecision struct {
+	Suppressed bool   // 是否被抑制（合并到已有告警）
+	DedupKey   string // 保留告警的分组标识（未启用抑制时为空）
+	HitCount   int    // 分组当前命中次数
+
+	group *suppressGroup // 未被抑制时新建的分组（已登记为待确认），告警进入写入队列后由 Track 确认，否则由 Discard 移除
+}
+
+// suppressGroup 一个保留告警及其合并的重复命中
+type suppressGroup struct {
+	key           string
+	firstSeen     time.Time
+	lastSeen      time.Time
+	hits          int
+	cooldownUntil time.Time
+	dedupWindow   time.Duration
+	detections    []Detection // 最近一次命中的检测目标（去重窗口随目标移动滑动）
+	dirty         bool        // 合并结果尚未写回数据库
+	pending       bool        // 保留告警尚未进入写入队列，期间的重复命中同样合并，但不写回数据库
+}
+
+// AlertSuppressor 告警抑制器
+// 在告警写库和推送之前判定是否为重复告警：冷却时间内或与已有告警同类别且检测框重叠时抑制，
+// 被抑制的命中合并到保留告警的 hit_count / last_seen_at，由后台协程定期写回数据库
+type AlertSuppressor struct {
+	cfg conf.AlertSuppressionConfig
+	log *slog.Logger
+
+	mu     sync.Mutex
+	groups map[string][]*suppressGroup // task_id -> 分组
+
+	onRollup func(alert *model.Alert) // 合并结果写回后回调（携带更新后的告警）
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewAlertSuppressor 创建告警抑制器
+func NewAlertSuppressor(cfg conf.AlertSuppressionConfig, logger *slog.Logger) *AlertSuppressor {
+	return &AlertSuppressor{
+		cfg:    cfg,
+		log:    logger,
+		groups: make(map[string][]*suppressGroup),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// SetOnRollup 设置合并结果写回数据库后的回调，用于向下游推送告警更新
+func (a *AlertSuppressor) SetOnRollup(callback func(alert *model.Alert)) {
+	a.onRollup = callback
+}
+
+// Start 启动合并结果写回协程
+func (a *AlertSuppressor) Start() {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ticker := time.NewTicker(suppressionFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.stopCh:
+				return
+			case <-ticker.C:
+				a.flush(time.Now())
+			}
+		}
+	}()
+}
+
+// Stop 停止写回协程并写回剩余的合并结果（应在告警批量写入器停止后调用，保证保留告警已落库）
+func (a *AlertSuppressor) Stop() {
+	close(a.stopCh)
+	a.wg.Wait()
+	a.flush(time.Now())
+}
+
+// rule 获取任务生效的抑制规则：全局规则 < 任务类型规则 < 任务算法配置中的 alert_suppression
+func (a *AlertSuppressor) rule(taskType string, algoConfig map[string]interface{}) conf.SuppressionRule {
+	rule := conf.SuppressionRule{
+		CooldownSec:    a.cfg.CooldownSec,
+		DedupWindowSec: a.cfg.DedupWindowSec,
+		IoUThreshold:   a.cfg.IoUThreshold,
+	}
+	if override, ok := conf.LookupTaskType(a.cfg.TaskTypes, taskType); ok {
+		rule = override
+	}
+	if raw, ok := algoConfig[suppressionConfigKey]; ok {
+		// 只覆盖任务配置中出现的字段
+		if b, err := json.Marshal(raw); err == nil {
+			if err := json.Unmarshal(b, &rule); err != nil {
+				a.log.Warn("invalid alert_suppression in algo config", slog.String("err", err.Error()))
+			}
+		}
+	}
+	if rule.IoUThreshold <= 0 || rule.IoUThreshold > 1 {
+		rule.IoUThreshold = defaultIoUThreshold
+	}
+	return rule
+}
+
+// Check 判定告警是否应被抑制；未被抑制时新建分组并在持有锁时登记为待确认，并发处理的同一任务的后续命中
+// 立即合并到该分组。调用方需将 DedupKey 写入告警，告警进入写入队列后调用 Track 确认分组，
+// 告警未能写入时调用 Discard 移除分组（后续命中不会被合并到不存在的告警）
+func (a *AlertSuppressor) Check(taskID, taskType string, result interface{}, algoConfig map[string]interface{}, now time.Time) SuppressDecision {
+	if !a.cfg.Enable {
+		return SuppressDecision{HitCount: 1}
+	}
+	rule := a.rule(taskType, algoConfig)
+	if rule.CooldownSec <= 0 && rule.DedupWindowSec <= 0 {
+		return SuppressDecision{HitCount: 1}
+	}
+
+	detections := parseDetections(result)
+	dedupWindow := time.Duration(rule.DedupWindowSec) * time.Second
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, g := range a.groups[taskID] {
+		inCooldown := now.Before(g.cooldownUntil)
+		duplicate := dedupWindow > 0 && now.Sub(g.lastSeen) <= dedupWindow &&
+			sameTargets(detections, g.detections, rule.IoUThreshold)
+		if !inCooldown && !duplicate {
+			continue
+		}
+
+		g.hits++
+		g.lastSeen = now
+		g.detections = detections
+		g.dirty = true
+		return SuppressDecision{Suppressed: true, DedupKey: g.key, HitCount: g.hits}
+	}
+
+	g := &suppressGroup{
+		key:           fmt.Sprintf("%s-%d", taskID, now.UnixNano()),
+		firstSeen:     now,
+		lastSeen:      now,
+		hits:          1,
+		cooldownUntil: now.Add(time.Duration(rule.CooldownSec) * time.Second),
+		dedupWindow:   dedupWindow,
+		detections:    detections,
+		pending:       true,
+	}
+	a.groups[taskID] = append(a.groups[taskID], g)
+	return SuppressDecision{DedupKey: g.key, HitCount: 1, group: g}
+}
+
+// Track 确认未被抑制的告警分组（告警已进入写入队列），待确认期间合并的命中随后写回数据库
+func (a *AlertSuppressor) Track(taskID string, decision SuppressDecision) {
+	if decision.group == nil {
+		return
+	}
+	a.mu.Lock()
+	decision.group.pending = false
+	a.mu.Unlock()
+}
+
+// Discard 移除未能写入告警的分组，待确认期间合并的命中随之丢弃
+func (a *AlertSuppressor) Discard(taskID string, decision SuppressDecision) {
+	if decision.group == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	groups := a.groups[taskID]
+	for i, g := range groups {
+		if g == decision.group {
+			groups = append(groups[:i], groups[i+1:]...)
+			break
+		}
+	}
+	if len(groups) == 0 {
+		delete(a.groups, taskID)
+	} else {
+		a.groups[taskID] = groups
+	}
+}
+
+// sameTargets 判断本次检测目标是否都能在分组中找到同类别且IoU达到阈值的目标
+// 没有检测框信息时只比较类别
+func sameTargets(current, previous []Detection, iouThreshold float64) bool {
+	if len(current) == 0 {
+		return len(previous) == 0
+	}
+	for _, d := range current {
+		matched := false
+		for _, p := range previous {
+			if d.Class != p.Class {
+				continue
+			}
+			if !d.HasBBox || !p.HasBBox || bboxIoU(d.BBox, p.BBox) >= iouThreshold {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// flush 写回合并结果，并清理窗口已结束的分组
+func (a *AlertSuppressor) flush(now time.Time) {
+	type rollup struct {
+		group    *suppressGroup
+		hits     int
+		lastSeen time.Time
+	}
+
+	a.mu.Lock()
+	var pending []rollup
+	for taskID, groups := range a.groups {
+		kept := groups[:0]
+		for _, g := range groups {
+			if g.dirty && !g.pending {
+				pending = append(pending, rollup{group: g, hits: g.hits, lastSeen: g.lastSeen})
+			}
+			if g.pending || g.dirty || a.active(g, now) {
+				kept = append(kept, g)
+			}
+		}
+		if len(kept) == 0 {
+			delete(a.groups, taskID)
+		} else {
+			a.groups[taskID] = kept
+		}
+	}
+	a.mu.Unlock()
+
+	for _, r := range pending {
+		alert, err := data.UpdateAlertRollup(r.group.key, r.hits, r.lastSeen)
+		if err != nil {
+			a.log.Error("failed to update alert rollup",
+				slog.String("dedup_key", r.group.key),
+				slog.String("err", err.Error()))
+			continue
+		}
+		if alert == nil {
+			// 保留告警仍在批量写入缓冲区中，下次再写回；窗口结束后长时间找不到则放弃
+			if now.Sub(r.lastSeen) > time.Minute && !a.isActive(r.group, now) {
+				a.markClean(r.group, r.hits)
+			}
+			continue
+		}
+		a.markClean(r.group, r.hits)
+		if a.onRollup != nil {
+			a.onRollup(alert)
+		}
+	}
+}
+
+// active 分组是否仍在冷却或去重窗口内，调用方需持有 a.mu
+func (a *AlertSuppressor) active(g *suppressGroup, now time.Time) bool {
+	return now.Before(g.cooldownUntil) || now.Sub(g.lastSeen) <= g.dedupWindow
+}
+
+func (a *AlertSuppressor) isActive(g *suppressGroup, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.active(g, now)
+}
+
+// markClean 写回成功后清除脏标记（写回期间又有新命中时保持脏标记）
+func (a *AlertSuppressor) markClean(g *suppressGroup, hits int) {
+	a.mu.Lock()
+	if g.hits == hits {
+		g.dirty = false
+	}
+	a.mu.Unlock()
+}
@@ -0,0 +1,159 @@
+package aianalysis
+
+import (
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func detectionResult(class string, bbox ...float64) map[string]interface{} {
+	box := make([]interface{}, len(bbox))
+	for i, v := range bbox {
+		box[i] = v
+	}
+	return map[string]interface{}{
+		"detections": []interface{}{
+			map[string]interface{}{"class": class, "confidence": 0.9, "bbox": box},
+		},
+	}
+}
+
+func newTestSuppressor(cfg conf.AlertSuppressionConfig) *AlertSuppressor {
+	cfg.Enable = true
+	return NewAlertSuppressor(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// checkAndTrack 判定告警是否被抑制，未被抑制时模拟告警写入成功并登记分组
+func checkAndTrack(s *AlertSuppressor, taskID, taskType string, result interface{}, algoConfig map[string]interface{}, now time.Time) SuppressDecision {
+	d := s.Check(taskID, taskType, result, algoConfig, now)
+	s.Track(taskID, d)
+	return d
+}
+
+func TestSuppressorCooldown(t *testing.T) {
+	s := newTestSuppressor(conf.AlertSuppressionConfig{CooldownSec: 60})
+	now := time.Now()
+
+	first := checkAndTrack(s, "cam1", "人员跌倒", detectionResult("person"), nil, now)
+	if first.Suppressed || first.DedupKey == "" {
+		t.Fatalf("first alert should be kept: %+v", first)
+	}
+	second := checkAndTrack(s, "cam1", "人员跌倒", detectionResult("car"), nil, now.Add(30*time.Second))
+	if !second.Suppressed || second.DedupKey != first.DedupKey || second.HitCount != 2 {
+		t.Fatalf("alert within cooldown should be merged: %+v", second)
+	}
+	if other := checkAndTrack(s, "cam2", "人员跌倒", detectionResult("person"), nil, now); other.Suppressed {
+		t.Fatal("cooldown must be per task")
+	}
+	if third := checkAndTrack(s, "cam1", "人员跌倒", detectionResult("person"), nil, now.Add(61*time.Second)); third.Suppressed {
+		t.Fatal("alert after cooldown should be kept")
+	}
+}
+
+func TestSuppressorIoUDedup(t *testing.T) {
+	s := newTestSuppressor(conf.AlertSuppressionConfig{DedupWindowSec: 10, IoUThreshold: 0.5})
+	now := time.Now()
+
+	checkAndTrack(s, "cam1", "人数统计", detectionResult("person", 0, 0, 100, 100), nil, now)
+	// 目标小幅移动，窗口随命中滑动
+	for i := 1; i <= 3; i++ {
+		d := checkAndTrack(s, "cam1", "人数统计", detectionResult("person", float64(i*5), 0, float64(100+i*5), 100), nil, now.Add(time.Duration(i*8)*time.Second))
+		if !d.Suppressed {
+			t.Fatalf("hit %d of same target should be suppressed", i)
+		}
+	}
+	if d := checkAndTrack(s, "cam1", "人数统计", detectionResult("person", 300, 300, 400, 400), nil, now.Add(30*time.Second)); d.Suppressed {
+		t.Fatal("non-overlapping target should raise a new alert")
+	}
+	if d := checkAndTrack(s, "cam1", "人数统计", detectionResult("car", 15, 0, 115, 100), nil, now.Add(30*time.Second)); d.Suppressed {
+		t.Fatal("different class should raise a new alert")
+	}
+}
+
+func TestSuppressorTaskOverride(t *testing.T) {
+	s := newTestSuppressor(conf.AlertSuppressionConfig{
+		CooldownSec: 60,
+		TaskTypes:   map[string]conf.SuppressionRule{"人员跌倒": {CooldownSec: 0}},
+	})
+	now := time.Now()
+
+	checkAndTrack(s, "cam1", "人员跌倒", detectionResult("person"), nil, now)
+	if d := checkAndTrack(s, "cam1", "人员跌倒", detectionResult("person"), nil, now.Add(time.Second)); d.Suppressed {
+		t.Fatal("task type rule should disable cooldown")
+	}
+
+	algoConfig := map[string]interface{}{"alert_suppression": map[string]interface{}{"cooldown_sec": 5}}
+	checkAndTrack(s, "cam2", "人数统计", detectionResult("person"), algoConfig, now)
+	if d := checkAndTrack(s, "cam2", "人数统计", detectionResult("person"), algoConfig, now.Add(10*time.Second)); d.Suppressed {
+		t.Fatal("algo config should override cooldown")
+	}
+}
+
+func TestSuppressorPendingGroup(t *testing.T) {
+	s := newTestSuppressor(conf.AlertSuppressionConfig{CooldownSec: 60})
+	now := time.Now()
+
+	// 保留告警尚未进入写入队列时，并发处理的同一任务的命中同样被合并
+	first := s.Check("cam1", "人员跌倒", detectionResult("person"), nil, now)
+	if first.Suppressed {
+		t.Fatal("first alert should be kept")
+	}
+	if d := s.Check("cam1", "人员跌倒", detectionResult("person"), nil, now.Add(time.Second)); !d.Suppressed || d.DedupKey != first.DedupKey {
+		t.Fatalf("hit before the alert is queued should be merged: %+v", d)
+	}
+
+	// 待确认的分组不写回数据库，也不因窗口结束被清理
+	s.flush(now.Add(2 * time.Minute))
+	if len(s.groups["cam1"]) != 1 || !s.groups["cam1"][0].dirty {
+		t.Fatal("pending group should be kept until tracked or discarded")
+	}
+
+	// 告警写入失败时移除分组，之后的命中不能被合并到不存在的告警
+	s.Discard("cam1", first)
+	if d := s.Check("cam1", "人员跌倒", detectionResult("person"), nil, now.Add(2*time.Second)); d.Suppressed {
+		t.Fatal("alert after a failed write should be kept")
+	}
+}
+
+func TestSuppressorRollup(t *testing.T) {
+	setupTestDB(t)
+	s := newTestSuppressor(conf.AlertSuppressionConfig{CooldownSec: 60})
+	var updated []*model.Alert
+	s.SetOnRollup(func(alert *model.Alert) { updated = append(updated, alert) })
+	now := time.Now()
+
+	kept := checkAndTrack(s, "cam1", "人数统计", detectionResult("person"), nil, now)
+	alert := &model.Alert{TaskID: "cam1", HitCount: 1, FirstSeenAt: now, LastSeenAt: now, DedupKey: kept.DedupKey, CreatedAt: now}
+	if err := data.GetDatabase().Create(alert).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	last := now.Add(20 * time.Second)
+	checkAndTrack(s, "cam1", "人数统计", detectionResult("person"), nil, now.Add(10*time.Second))
+	checkAndTrack(s, "cam1", "人数统计", detectionResult("person"), nil, last)
+	s.flush(last)
+
+	var got model.Alert
+	if err := data.GetDatabase().First(&got, alert.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.HitCount != 3 || !got.LastSeenAt.Equal(last) {
+		t.Fatalf("hit_count = %d, last_seen_at = %v; want 3, %v", got.HitCount, got.LastSeenAt, last)
+	}
+	if s.groups["cam1"][0].dirty {
+		t.Fatal("group should be clean after rollup")
+	}
+	if len(updated) != 1 || updated[0].ID != alert.ID || updated[0].HitCount != 3 {
+		t.Fatalf("rollup should publish the updated alert once, got %+v", updated)
+	}
+
+	// 没有新命中时不重复推送
+	s.flush(last.Add(time.Second))
+	if len(updated) != 1 {
+		t.Fatalf("rollup published %d times, want 1", len(updated))
+	}
+}
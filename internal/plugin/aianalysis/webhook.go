@@ -0,0 +1,465 @@
+package aianalysis
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultWebhookWorkers    = 4
+	defaultWebhookQueueSize  = 1000
+	defaultWebhookMaxRetries = 5
+	defaultWebhookBackoff    = 2 * time.Second
+	defaultWebhookMaxBackoff = 5 * time.Minute
+	defaultWebhookTimeout    = 10 * time.Second
+	defaultWebhookRetention  = 7 * 24 * time.Hour
+	webhookCleanupInterval   = time.Hour
+	webhookMaxResponseBytes  = 1000 // 投递记录中保存的响应内容长度
+
+	webhookEventAlert        = "alert"
+	webhookEventAlertUpdated = "alert_updated" // 重复命中合并后告警的 hit_count / last_seen_at 更新
+	webhookEventTest         = "test"
+)
+
+// WebhookPayload 告警回调的请求体（未配置模板时），也是模板的数据
+type WebhookPayload struct {
+	Event      string       `json:"event"` // alert|alert_updated|test
+	DeliveryID string       `json:"delivery_id"`
+	Timestamp  time.Time    `json:"timestamp"`
+	Alert      *model.Alert `json:"alert"`
+}
+
+// ValidateWebhook 校验告警回调目标配置
+func ValidateWebhook(hook *model.Webhook) error {
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	if _, err := parseWebhookTemplate(hook.Template); err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	return nil
+}
+
+// parseWebhookTemplate 解析请求体模板，模板中可以使用 json 函数输出JSON编码的值
+func parseWebhookTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	return template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+}
+
+// renderWebhookBody 生成请求体：未配置模板时为 WebhookPayload 的JSON
+func renderWebhookBody(tmpl *template.Template, payload WebhookPayload) ([]byte, error) {
+	if tmpl == nil {
+		return json.Marshal(payload)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, payload); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// signWebhook 计算签名：HMAC-SHA256(secret, "<timestamp>.<body>")，接收方应校验时间戳防止重放
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookMatches 判断告警是否推送到该回调目标
+func webhookMatches(hook *model.Webhook, alert *model.Alert) bool {
+	if !hook.Enabled {
+		return false
+	}
+	if len(hook.TaskIDs) > 0 && !slices.Contains(hook.TaskIDs, alert.TaskID) {
+		return false
+	}
+	if len(hook.TaskTypes) > 0 && !slices.Contains(hook.TaskTypes, alert.TaskType) {
+		return false
+	}
+	if len(hook.Classes) > 0 {
+		return slices.ContainsFunc(alert.Detections, func(d model.AlertDetection) bool {
+			return slices.Contains(hook.Classes, d.Class)
+		})
+	}
+	return true
+}
+
+// webhookBackoff 第 attempt 次失败后的重试间隔（指数退避）
+func webhookBackoff(base, maxBackoff time.Duration, attempt int) time.Duration {
+	d := base << min(attempt-1, 30)
+	if d <= 0 || d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+// webhookRetryable 请求失败、服务端错误、限流或超时时重试，其余4xx不重试
+func webhookRetryable(statusCode int) bool {
+	return statusCode == 0 || statusCode >= 500 || statusCode == http.StatusTooManyRequests || statusCode == http.StatusRequestTimeout
+}
+
+type webhookTarget struct {
+	hook model.Webhook
+	tmpl *template.Template
+}
+
+type webhookJob struct {
+	target     *webhookTarget
+	event      string
+	alertID    uint
+	deliveryID string
+	body       []byte
+	attempt    int
+}
+
+// WebhookNotifier 告警回调：告警落库后异步推送到匹配的回调目标，失败时指数退避重试，每次尝试写入投递记录
+// 待重试的推送保存在内存中，服务重启后丢失
+type WebhookNotifier struct {
+	log        *slog.Logger
+	client     *http.Client
+	workers    int
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	retention  time.Duration
+
+	jobs    chan webhookJob
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+	seq     atomic.Uint64
+	dropped atomic.Int64
+
+	mu      sync.RWMutex
+	targets []*webhookTarget
+}
+
+// NewWebhookNotifier 创建告警回调
+func NewWebhookNotifier(cfg conf.WebhookConfig, logger *slog.Logger) *WebhookNotifier {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = defaultWebhookWorkers
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultWebhookQueueSize
+	}
+	maxRetries := cfg.MaxRetries
+	if maxRetries < 0 {
+		maxRetries = 0
+	} else if maxRetries == 0 {
+		maxRetries = defaultWebhookMaxRetries
+	}
+	backoff := time.Duration(cfg.BackoffSec) * time.Second
+	if backoff <= 0 {
+		backoff = defaultWebhookBackoff
+	}
+	maxBackoff := time.Duration(cfg.MaxBackoffSec) * time.Second
+	if maxBackoff <= 0 {
+		maxBackoff = defaultWebhookMaxBackoff
+	}
+	timeout := time.Duration(cfg.TimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	retention := time.Duration(cfg.RetentionDays) * 24 * time.Hour
+	if retention <= 0 {
+		retention = defaultWebhookRetention
+	}
+
+	return &WebhookNotifier{
+		log:        logger,
+		client:     &http.Client{Timeout: timeout},
+		workers:    workers,
+		maxRetries: maxRetries,
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+		retention:  retention,
+		jobs:       make(chan webhookJob, queueSize),
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// Start 启动推送协程和投递记录清理
+func (n *WebhookNotifier) Start() {
+	for range n.workers {
+		n.wg.Add(1)
+		go n.worker()
+	}
+	n.wg.Add(1)
+	go n.cleanupLoop()
+}
+
+// Stop 停止推送，未完成的推送丢弃
+func (n *WebhookNotifier) Stop() {
+	close(n.stopCh)
+	n.wg.Wait()
+}
+
+// Reload 从数据库重新加载回调目标
+func (n *WebhookNotifier) Reload() error {
+	hooks, err := data.ListWebhooks()
+	if err != nil {
+		return err
+	}
+	n.SetWebhooks(hooks)
+	n.log.Info("webhooks loaded", slog.Int("count", len(hooks)))
+	return nil
+}
+
+// SetWebhooks 替换回调目标，模板解析失败的目标跳过
+func (n *WebhookNotifier) SetWebhooks(hooks []model.Webhook) {
+	targets := make([]*webhookTarget, 0, len(hooks))
+	for _, hook := range hooks {
+		tmpl, err := parseWebhookTemplate(hook.Template)
+		if err != nil {
+			n.log.Error("invalid webhook template, webhook skipped",
+				slog.Uint64("webhook_id", uint64(hook.ID)),
+				slog.String("err", err.Error()))
+			continue
+		}
+		targets = append(targets, &webhookTarget{hook: hook, tmpl: tmpl})
+	}
+
+	n.mu.Lock()
+	n.targets = targets
+	n.mu.Unlock()
+}
+
+// Notify 将告警事件推送到匹配的回调目标（异步，队列满时丢弃）
+func (n *WebhookNotifier) Notify(event string, alert *model.Alert) {
+	n.mu.RLock()
+	targets := n.targets
+	n.mu.RUnlock()
+
+	for _, target := range targets {
+		if !webhookMatches(&target.hook, alert) {
+			continue
+		}
+		job, err := n.newJob(target, event, alert)
+		if err != nil {
+			n.log.Error("failed to render webhook body",
+				slog.Uint64("webhook_id", uint64(target.hook.ID)),
+				slog.Uint64("alert_id", uint64(alert.ID)),
+				slog.String("err", err.Error()))
+			continue
+		}
+		n.enqueue(job)
+	}
+}
+
+// SendTest 用示例告警同步推送一次（不重试），返回投递记录
+func (n *WebhookNotifier) SendTest(ctx context.Context, hook model.Webhook) (*model.WebhookDelivery, error) {
+	tmpl, err := parseWebhookTemplate(hook.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	now := time.Now()
+	sample := &model.Alert{
+		TaskID:         "test",
+		TaskType:       "test",
+		AlgorithmID:    "webhook_test",
+		AlgorithmName:  "告警回调测试",
+		Confidence:     0.9,
+		DetectionCount: 1,
+		Status:         model.AlertStatusNew,
+		Detections:     []model.AlertDetection{{Class: "person", Confidence: 0.9, X1: 10, Y1: 10, X2: 100, Y2: 200}},
+		CreatedAt:      now,
+	}
+	if len(hook.TaskIDs) > 0 {
+		sample.TaskID = hook.TaskIDs[0]
+	}
+	if len(hook.TaskTypes) > 0 {
+		sample.TaskType = hook.TaskTypes[0]
+	}
+	if len(hook.Classes) > 0 {
+		sample.Detections[0].Class = hook.Classes[0]
+	}
+
+	job, err := n.newJob(&webhookTarget{hook: hook, tmpl: tmpl}, webhookEventTest, sample)
+	if err != nil {
+		return nil, fmt.Errorf("render template: %w", err)
+	}
+	return n.deliver(ctx, job), nil
+}
+
+// Dropped 队列满被丢弃的推送数
+func (n *WebhookNotifier) Dropped() int64 {
+	return n.dropped.Load()
+}
+
+func (n *WebhookNotifier) newJob(target *webhookTarget, event string, alert *model.Alert) (webhookJob, error) {
+	now := time.Now()
+	deliveryID := now.Format("20060102150405") + "-" + strconv.FormatUint(n.seq.Add(1), 10)
+	body, err := renderWebhookBody(target.tmpl, WebhookPayload{
+		Event:      event,
+		DeliveryID: deliveryID,
+		Timestamp:  now,
+		Alert:      alert,
+	})
+	if err != nil {
+		return webhookJob{}, err
+	}
+	return webhookJob{
+		target:     target,
+		event:      event,
+		alertID:    alert.ID,
+		deliveryID: deliveryID,
+		body:       body,
+		attempt:    1,
+	}, nil
+}
+
+func (n *WebhookNotifier) enqueue(job webhookJob) {
+	select {
+	case <-n.stopCh:
+		return
+	default:
+	}
+	select {
+	case n.jobs <- job:
+	default:
+		n.dropped.Add(1)
+		n.log.Warn("webhook queue full, delivery dropped",
+			slog.Uint64("webhook_id", uint64(job.target.hook.ID)),
+			slog.Uint64("alert_id", uint64(job.alertID)))
+	}
+}
+
+func (n *WebhookNotifier) worker() {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.stopCh:
+			return
+		case job := <-n.jobs:
+			delivery := n.deliver(context.Background(), job)
+			if delivery.Success || !webhookRetryable(delivery.StatusCode) || job.attempt > n.maxRetries {
+				if !delivery.Success {
+					n.log.Warn("webhook delivery failed",
+						slog.Uint64("webhook_id", uint64(job.target.hook.ID)),
+						slog.Uint64("alert_id", uint64(job.alertID)),
+						slog.Int("attempts", job.attempt),
+						slog.Int("status_code", delivery.StatusCode),
+						slog.String("err", delivery.Error))
+				}
+				continue
+			}
+			delay := webhookBackoff(n.backoff, n.maxBackoff, job.attempt)
+			job.attempt++
+			time.AfterFunc(delay, func() { n.enqueue(job) })
+		}
+	}
+}
+
+// deliver 发送一次请求并写入投递记录
+func (n *WebhookNotifier) deliver(ctx context.Context, job webhookJob) *model.WebhookDelivery {
+	hook := job.target.hook
+	delivery := &model.WebhookDelivery{
+		WebhookID:  hook.ID,
+		AlertID:    job.alertID,
+		Event:      job.event,
+		DeliveryID: job.deliveryID,
+		Attempt:    job.attempt,
+	}
+
+	start := time.Now()
+	statusCode, response, err := n.post(ctx, hook, job)
+	delivery.DurationMs = time.Since(start).Milliseconds()
+	delivery.StatusCode = statusCode
+	delivery.Response = response
+	if err != nil {
+		delivery.Error = truncateUTF8(err.Error(), 500)
+	} else {
+		delivery.Success = statusCode >= 200 && statusCode < 300
+	}
+
+	if hook.ID > 0 {
+		if err := data.AddWebhookDelivery(delivery); err != nil {
+			n.log.Error("failed to save webhook delivery", slog.String("err", err.Error()))
+		}
+	}
+	return delivery
+}
+
+func (n *WebhookNotifier) post(ctx context.Context, hook model.Webhook, job webhookJob) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(job.body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range hook.Headers {
+		req.Header.Set(k, v)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("X-Webhook-Event", job.event)
+	req.Header.Set("X-Webhook-Delivery", job.deliveryID)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	if hook.Secret != "" {
+		req.Header.Set("X-Webhook-Signature", signWebhook(hook.Secret, timestamp, job.body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxResponseBytes))
+	return resp.StatusCode, truncateUTF8(string(body), webhookMaxResponseBytes), nil
+}
+
+func (n *WebhookNotifier) cleanupLoop() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(webhookCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stopCh:
+			return
+		case <-ticker.C:
+			deleted, err := data.CleanupWebhookDeliveries(time.Now().Add(-n.retention))
+			if err != nil {
+				n.log.Error("failed to cleanup webhook deliveries", slog.String("err", err.Error()))
+			} else if deleted > 0 {
+				n.log.Info("webhook deliveries cleaned up", slog.Int64("deleted", deleted))
+			}
+		}
+	}
+}
+
+// truncateUTF8 按字节截断字符串，去掉被截断的多字节字符
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
@@ -0,0 +1,177 @@
+package aianalysis
+
+import (
+	"context"
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	body := []byte(`{"event":"alert"}`)
+	sig := signWebhook("secret", "1700000000", body)
+	if sig != signWebhook("secret", "1700000000", body) {
+		t.Fatal("signature not deterministic")
+	}
+	if sig == signWebhook("other", "1700000000", body) || sig == signWebhook("secret", "1700000001", body) {
+		t.Fatal("signature should depend on secret and timestamp")
+	}
+	if len(sig) != len("sha256=")+64 {
+		t.Fatalf("unexpected signature %q", sig)
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	tmpl, err := parseWebhookTemplate(`{"text":{{json .Alert.TaskID}},"n":{{.Alert.DetectionCount}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := renderWebhookBody(tmpl, WebhookPayload{Alert: &model.Alert{TaskID: `cam"1`, DetectionCount: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Text string `json:"text"`
+		N    int    `json:"n"`
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("rendered body is not JSON: %s", body)
+	}
+	if got.Text != `cam"1` || got.N != 2 {
+		t.Fatalf("unexpected body %s", body)
+	}
+
+	if err := ValidateWebhook(&model.Webhook{URL: "ftp://example.com"}); err == nil {
+		t.Fatal("expected invalid scheme error")
+	}
+	if err := ValidateWebhook(&model.Webhook{URL: "http://example.com", Template: "{{"}); err == nil {
+		t.Fatal("expected template error")
+	}
+}
+
+func TestWebhookMatches(t *testing.T) {
+	alert := &model.Alert{TaskID: "t1", TaskType: "helmet", Detections: []model.AlertDetection{{Class: "person"}}}
+	cases := []struct {
+		hook model.Webhook
+		want bool
+	}{
+		{model.Webhook{Enabled: true}, true},
+		{model.Webhook{Enabled: false}, false},
+		{model.Webhook{Enabled: true, TaskIDs: []string{"t2"}}, false},
+		{model.Webhook{Enabled: true, TaskTypes: []string{"helmet"}}, true},
+		{model.Webhook{Enabled: true, Classes: []string{"car"}}, false},
+		{model.Webhook{Enabled: true, Classes: []string{"car", "person"}}, true},
+	}
+	for i, c := range cases {
+		if got := webhookMatches(&c.hook, alert); got != c.want {
+			t.Fatalf("case %d: got %v, want %v", i, got, c.want)
+		}
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	base, maxBackoff := 2*time.Second, time.Minute
+	if d := webhookBackoff(base, maxBackoff, 1); d != 2*time.Second {
+		t.Fatalf("attempt 1: %v", d)
+	}
+	if d := webhookBackoff(base, maxBackoff, 3); d != 8*time.Second {
+		t.Fatalf("attempt 3: %v", d)
+	}
+	if d := webhookBackoff(base, maxBackoff, 100); d != maxBackoff {
+		t.Fatalf("attempt 100: %v", d)
+	}
+}
+
+func TestWebhookDeliveryRetry(t *testing.T) {
+	setupTestDB(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var calls atomic.Int32
+	sigOK := make(chan bool, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sigOK <- r.Header.Get("X-Webhook-Signature") == signWebhook("s3cret", r.Header.Get("X-Webhook-Timestamp"), body)
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	hook := model.Webhook{Name: "test", URL: srv.URL, Secret: "s3cret", Enabled: true}
+	if err := data.CreateWebhook(&hook); err != nil {
+		t.Fatal(err)
+	}
+
+	n := NewWebhookNotifier(conf.WebhookConfig{Workers: 1, BackoffSec: 1}, logger)
+	n.backoff = 10 * time.Millisecond
+	if err := n.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	n.Start()
+	defer n.Stop()
+
+	n.Notify(webhookEventAlert, &model.Alert{ID: 7, TaskID: "t1"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		list, total, err := data.ListWebhookDeliveries(hook.ID, 7, 1, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total == 2 {
+			// 倒序：最新的一次在前
+			if !list[0].Success || list[0].Attempt != 2 || list[0].Response != "ok" {
+				t.Fatalf("unexpected second delivery %+v", list[0])
+			}
+			if list[1].Success || list[1].StatusCode != 500 || list[1].DeliveryID != list[0].DeliveryID {
+				t.Fatalf("unexpected first delivery %+v", list[1])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 2 deliveries, got %d", total)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	for range 2 {
+		if !<-sigOK {
+			t.Fatal("signature mismatch")
+		}
+	}
+}
+
+func TestWebhookSendTest(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Webhook-Event") != webhookEventTest {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var payload WebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Alert.TaskID != "cam1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	n := NewWebhookNotifier(conf.WebhookConfig{}, logger)
+	delivery, err := n.SendTest(context.Background(), model.Webhook{URL: srv.URL, TaskIDs: []string{"cam1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !delivery.Success || delivery.StatusCode != http.StatusNoContent {
+		t.Fatalf("unexpected delivery %+v", delivery)
+	}
+}
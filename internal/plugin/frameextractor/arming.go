@@ -0,0 +1,277 @@
+package frameextractor
+
+import (
+	"easydarwin/internal/conf"
+	"easydarwin/utils/rms/core/record"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// 撤防时的处理方式
+const (
+	ArmingGateAlert   = "alert"   // 继续抽帧推理，不产生告警
+	ArmingGateExtract = "extract" // 停止抽帧
+)
+
+// 布防状态来源
+const (
+	ArmingSourceNone      = "none"      // 未配置布防计划，始终布防
+	ArmingSourceSchedule  = "schedule"  // 每周计划
+	ArmingSourceException = "exception" // 指定日期
+	ArmingSourceOverride  = "override"  // 手动布防/撤防
+)
+
+// armingCheckInterval 按布防计划启停抽帧的检查间隔
+const armingCheckInterval = 30 * time.Second
+
+// ArmingState 任务当前生效的布防状态
+type ArmingState struct {
+	Armed  bool   `json:"armed"`
+	Source string `json:"source"`          // none|schedule|exception|override
+	Gate   string `json:"gate"`            // 撤防时的处理：alert|extract
+	Until  string `json:"until,omitempty"` // 手动布防/撤防的到期时间
+}
+
+// ValidateArming 校验布防计划
+func ValidateArming(a *conf.ArmingSchedule) error {
+	if a == nil {
+		return nil
+	}
+	if a.Gate != "" && a.Gate != ArmingGateAlert && a.Gate != ArmingGateExtract {
+		return fmt.Errorf("invalid gate %q, must be %s or %s", a.Gate, ArmingGateAlert, ArmingGateExtract)
+	}
+	if a.Weekly != "" && !isHourMask(a.Weekly, 7*24) {
+		return errors.New("weekly must be 168 characters of '0' or '1'")
+	}
+	if a.Timezone != "" {
+		if _, err := time.LoadLocation(a.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
+	}
+	for _, e := range a.Exceptions {
+		if _, err := time.Parse(time.DateOnly, e.Date); err != nil {
+			return fmt.Errorf("invalid exception date %q", e.Date)
+		}
+		if e.Hours != "" && !isHourMask(e.Hours, 24) {
+			return fmt.Errorf("exception %s: hours must be 24 characters of '0' or '1'", e.Date)
+		}
+	}
+	return nil
+}
+
+// EvaluateArming 计算任务在指定时间的布防状态：手动布防/撤防 > 指定日期 > 每周计划
+func EvaluateArming(task conf.FrameExtractTask, now time.Time) ArmingState {
+	state := ArmingState{Armed: true, Source: ArmingSourceNone, Gate: ArmingGateAlert}
+	if task.Arming != nil && task.Arming.Gate != "" {
+		state.Gate = task.Arming.Gate
+	}
+
+	if o := task.ArmOverride; o != nil && !overrideExpired(o, now) {
+		state.Armed = o.Armed
+		state.Source = ArmingSourceOverride
+		state.Until = o.Until
+		return state
+	}
+
+	a := task.Arming
+	if a == nil {
+		return state
+	}
+	if a.Timezone != "" {
+		if loc, err := time.LoadLocation(a.Timezone); err == nil {
+			now = now.In(loc)
+		}
+	}
+
+	date := now.Format(time.DateOnly)
+	for _, e := range a.Exceptions {
+		if e.Date != date {
+			continue
+		}
+		state.Source = ArmingSourceException
+		if e.Hours != "" {
+			state.Armed = len(e.Hours) == 24 && e.Hours[now.Hour()] == '1'
+		} else {
+			state.Armed = e.Armed
+		}
+		return state
+	}
+
+	if a.Weekly != "" {
+		state.Source = ArmingSourceSchedule
+		state.Armed = record.IsRecording(a.Weekly, now)
+	}
+	return state
+}
+
+// overrideExpired 手动布防/撤防是否已到期（到期时间无法解析时视为已到期）
+func overrideExpired(o *conf.ArmOverride, now time.Time) bool {
+	if o.Until == "" {
+		return false
+	}
+	until, err := time.Parse(time.RFC3339, o.Until)
+	return err != nil || !now.Before(until)
+}
+
+func isHourMask(s string, n int) bool {
+	return len(s) == n && strings.Trim(s, "01") == ""
+}
+
+// extractGated 任务当前是否因撤防停止抽帧
+func extractGated(task conf.FrameExtractTask, now time.Time) bool {
+	state := EvaluateArming(task, now)
+	return !state.Armed && state.Gate == ArmingGateExtract
+}
+
+// GetArmingState 获取任务当前的布防状态
+func (s *Service) GetArmingState(id string) (ArmingState, error) {
+	task := s.GetTaskByID(id)
+	if task == nil {
+		return ArmingState{}, fmt.Errorf("task not found")
+	}
+	return EvaluateArming(*task, time.Now()), nil
+}
+
+// IsArmed 任务当前是否布防（撤防时不产生告警），任务不存在时视为布防
+func (s *Service) IsArmed(id string) bool {
+	task := s.GetTaskByID(id)
+	if task == nil {
+		return true
+	}
+	return EvaluateArming(*task, time.Now()).Armed
+}
+
+// UpdateTaskArming 更新任务的布防计划，nil 表示取消计划（始终布防）
+func (s *Service) UpdateTaskArming(id string, arming *conf.ArmingSchedule) error {
+	if err := ValidateArming(arming); err != nil {
+		return err
+	}
+	if err := s.updateTask(id, func(t *conf.FrameExtractTask) { t.Arming = arming }); err != nil {
+		return err
+	}
+	s.log.Info("task arming schedule updated", slog.String("task_id", id), slog.Bool("scheduled", arming != nil))
+	s.applyArming()
+	return nil
+}
+
+// SetArmOverride 手动布防/撤防，nil 表示取消手动设置（恢复按布防计划）
+func (s *Service) SetArmOverride(id string, override *conf.ArmOverride) error {
+	if override != nil && override.Until != "" {
+		if _, err := time.Parse(time.RFC3339, override.Until); err != nil {
+			return fmt.Errorf("invalid until: %w", err)
+		}
+	}
+	if err := s.updateTask(id, func(t *conf.FrameExtractTask) { t.ArmOverride = override }); err != nil {
+		return err
+	}
+	if override != nil {
+		s.log.Info("task arm override set",
+			slog.String("task_id", id),
+			slog.Bool("armed", override.Armed),
+			slog.String("until", override.Until))
+	} else {
+		s.log.Info("task arm override cleared", slog.String("task_id", id))
+	}
+	s.applyArming()
+	return nil
+}
+
+// updateTask 修改任务配置并持久化
+func (s *Service) updateTask(id string, fn func(t *conf.FrameExtractTask)) error {
+	s.mu.Lock()
+	found := false
+	for i := range s.cfg.Tasks {
+		if s.cfg.Tasks[i].ID == id {
+			fn(&s.cfg.Tasks[i])
+			found = true
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if !found {
+		return fmt.Errorf("task not found")
+	}
+	if err := s.saveConfigToFile(s.configPath); err != nil {
+		s.log.Warn("failed to persist config", slog.String("err", err.Error()))
+	}
+	return nil
+}
+
+// armingLoop 按布防计划定时启停抽帧
+func (s *Service) armingLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(armingCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.applyArming()
+		}
+	}
+}
+
+// applyArming 撤防停止抽帧的任务停止抽帧（保持启用状态），布防后重新启动；清除已到期的手动布防/撤防
+func (s *Service) applyArming() {
+	if !s.cfg.Enable {
+		return
+	}
+	now := time.Now()
+	var toStart []conf.FrameExtractTask
+	expired := false
+
+	s.mu.Lock()
+	for i := range s.cfg.Tasks {
+		t := &s.cfg.Tasks[i]
+		if t.ArmOverride != nil && overrideExpired(t.ArmOverride, now) {
+			s.log.Info("task arm override expired", slog.String("task_id", t.ID))
+			t.ArmOverride = nil
+			expired = true
+		}
+		if !t.Enabled || strings.TrimSpace(t.RtspURL) == "" {
+			continue
+		}
+		ch, running := s.taskStops[t.ID]
+		gated := extractGated(*t, now)
+		if gated && running {
+			close(ch)
+			delete(s.taskStops, t.ID)
+			s.log.Info("task disarmed, extraction paused", slog.String("task_id", t.ID))
+		} else if !gated && !running {
+			toStart = append(toStart, *t)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, t := range toStart {
+		s.log.Info("task armed, extraction resumed", slog.String("task_id", t.ID))
+		_ = s.startTask(t)
+	}
+	if expired {
+		if err := s.saveConfigToFile(s.configPath); err != nil {
+			s.log.Warn("failed to persist config", slog.String("err", err.Error()))
+		}
+	}
+}
+
+// armingTOML 布防计划和手动布防/撤防的持久化配置行
+func armingTOML(t conf.FrameExtractTask) []string {
+	var lines []string
+	if a := t.Arming; a != nil {
+		exceptions := make([]string, 0, len(a.Exceptions))
+		for _, e := range a.Exceptions {
+			exceptions = append(exceptions, fmt.Sprintf("{ date = '%s', armed = %t, hours = '%s' }", e.Date, e.Armed, e.Hours))
+		}
+		lines = append(lines, fmt.Sprintf("arming = { gate = '%s', weekly = '%s', timezone = '%s', exceptions = [%s] }",
+			a.Gate, a.Weekly, a.Timezone, strings.Join(exceptions, ", ")))
+	}
+	if o := t.ArmOverride; o != nil {
+		lines = append(lines, fmt.Sprintf("arm_override = { armed = %t, until = '%s' }", o.Armed, o.Until))
+	}
+	return lines
+}
@@ -0,0 +1,105 @@
+package frameextractor
+
+import (
+	"easydarwin/internal/conf"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nightWeekly 每天 0-7 点和 19-23 点布防
+func nightWeekly() string {
+	day := strings.Repeat("1", 8) + strings.Repeat("0", 11) + strings.Repeat("1", 5)
+	return strings.Repeat(day, 7)
+}
+
+func TestEvaluateArming(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	// 2026-10-14 为周三
+	day := time.Date(2026, 10, 14, 12, 0, 0, 0, loc)
+	night := time.Date(2026, 10, 14, 21, 0, 0, 0, loc)
+
+	task := conf.FrameExtractTask{ID: "cam1"}
+	if s := EvaluateArming(task, day); !s.Armed || s.Source != ArmingSourceNone {
+		t.Fatalf("task without schedule should be armed, got %+v", s)
+	}
+
+	task.Arming = &conf.ArmingSchedule{Gate: ArmingGateExtract, Weekly: nightWeekly()}
+	if s := EvaluateArming(task, day); s.Armed || s.Source != ArmingSourceSchedule || s.Gate != ArmingGateExtract {
+		t.Fatalf("expected disarmed at noon, got %+v", s)
+	}
+	if s := EvaluateArming(task, night); !s.Armed {
+		t.Fatalf("expected armed at night, got %+v", s)
+	}
+	if !extractGated(task, day) || extractGated(task, night) {
+		t.Fatal("extraction should only be gated while disarmed")
+	}
+
+	// 节假日全天布防，指定小时的日期只在这些小时布防
+	task.Arming.Exceptions = []conf.ArmingException{
+		{Date: "2026-10-14", Armed: true},
+		{Date: "2026-10-15", Hours: strings.Repeat("0", 12) + "1" + strings.Repeat("0", 11)},
+	}
+	if s := EvaluateArming(task, day); !s.Armed || s.Source != ArmingSourceException {
+		t.Fatalf("holiday should be armed, got %+v", s)
+	}
+	if s := EvaluateArming(task, day.AddDate(0, 0, 1)); !s.Armed {
+		t.Fatalf("expected armed at 12:00 on exception day, got %+v", s)
+	}
+	if s := EvaluateArming(task, night.AddDate(0, 0, 1)); s.Armed {
+		t.Fatalf("expected disarmed at 21:00 on exception day, got %+v", s)
+	}
+
+	// 手动撤防优先，到期后恢复按计划
+	task.ArmOverride = &conf.ArmOverride{Armed: false, Until: day.Add(time.Hour).Format(time.RFC3339)}
+	if s := EvaluateArming(task, day); s.Armed || s.Source != ArmingSourceOverride {
+		t.Fatalf("override should disarm, got %+v", s)
+	}
+	if s := EvaluateArming(task, day.Add(2*time.Hour)); !s.Armed || s.Source != ArmingSourceException {
+		t.Fatalf("expired override should be ignored, got %+v", s)
+	}
+}
+
+func TestEvaluateArmingTimezone(t *testing.T) {
+	task := conf.FrameExtractTask{Arming: &conf.ArmingSchedule{Weekly: nightWeekly(), Timezone: "Asia/Shanghai"}}
+	// UTC 14:00 为北京时间 22:00
+	if s := EvaluateArming(task, time.Date(2026, 10, 14, 14, 0, 0, 0, time.UTC)); !s.Armed {
+		t.Fatalf("expected armed in schedule timezone, got %+v", s)
+	}
+}
+
+func TestValidateArming(t *testing.T) {
+	valid := &conf.ArmingSchedule{Gate: ArmingGateAlert, Weekly: nightWeekly(), Exceptions: []conf.ArmingException{{Date: "2026-10-01", Armed: true}}}
+	if err := ValidateArming(valid); err != nil {
+		t.Fatal(err)
+	}
+	invalid := []*conf.ArmingSchedule{
+		{Gate: "record"},
+		{Weekly: "101"},
+		{Timezone: "Nowhere/City"},
+		{Exceptions: []conf.ArmingException{{Date: "10/01"}}},
+		{Exceptions: []conf.ArmingException{{Date: "2026-10-01", Hours: "1x"}}},
+	}
+	for i, a := range invalid {
+		if err := ValidateArming(a); err == nil {
+			t.Fatalf("case %d: expected error", i)
+		}
+	}
+}
+
+func TestArmingTOML(t *testing.T) {
+	task := conf.FrameExtractTask{
+		Arming:      &conf.ArmingSchedule{Gate: ArmingGateExtract, Exceptions: []conf.ArmingException{{Date: "2026-10-01", Armed: true}}},
+		ArmOverride: &conf.ArmOverride{Armed: false},
+	}
+	lines := armingTOML(task)
+	if len(lines) != 2 {
+		t.Fatalf("unexpected lines %v", lines)
+	}
+	if !strings.Contains(lines[0], "exceptions = [{ date = '2026-10-01', armed = true, hours = '' }]") {
+		t.Fatalf("unexpected arming line %q", lines[0])
+	}
+	if armingTOML(conf.FrameExtractTask{}) != nil {
+		t.Fatal("expected no lines without arming")
+	}
+}
@@ -13,7 +13,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/minio/minio-go/v7"
 )
 
 func getWorkDir() string {
@@ -127,7 +126,7 @@ func (s *Service) listLocalSnapshots(taskID string) ([]SnapshotInfo, error) {
 
 // listMinioSnapshots lists snapshots from MinIO
 func (s *Service) listMinioSnapshots(taskID string) ([]SnapshotInfo, error) {
-	if s.minio == nil {
+	if s.store == nil {
 		return nil, fmt.Errorf("minio not initialized")
 	}
 	
@@ -150,16 +149,13 @@ func (s *Service) listMinioSnapshots(taskID string) ([]SnapshotInfo, error) {
 	}
 	
 	// use forward slashes for S3/MinIO
-	prefix := filepath.ToSlash(filepath.Join(s.minio.base, taskType, task.ID)) + "/"
+	prefix := filepath.ToSlash(filepath.Join(s.store.base, taskType, task.ID)) + "/"
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	
 	s.log.Debug("listing minio snapshots", slog.String("task", taskID), slog.String("type", taskType), slog.String("prefix", prefix))
 	
-	objectCh := s.minio.client.ListObjects(ctx, s.minio.bucket, minio.ListObjectsOptions{
-		Prefix:    prefix,
-		Recursive: true,
-	})
+	objectCh := s.store.client.List(ctx, prefix, true)
 	
 	var results []SnapshotInfo
 	for object := range objectCh {
@@ -179,7 +175,7 @@ func (s *Service) listMinioSnapshots(taskID string) ([]SnapshotInfo, error) {
 		// generate presigned URL for preview
 		// 注意：MinIO SDK生成签名时使用UTC时间，但MinIO服务器验证时使用CST时间
 		// 时差8小时，因此需要增加有效期以补偿时区差（10小时有效期）
-		presignedURL, err := s.minio.client.PresignedGetObject(ctx, s.minio.bucket, object.Key, 10*time.Hour, nil)
+		presignedURL, err := s.store.client.PresignGet(ctx, object.Key, 10*time.Hour)
 		if err != nil {
 			s.log.Warn("failed to generate presigned URL", slog.String("key", object.Key), slog.String("err", err.Error()))
 			continue
@@ -241,13 +237,13 @@ func (s *Service) deleteLocalSnapshot(relPath string) error {
 
 // deleteMinioSnapshot deletes from MinIO
 func (s *Service) deleteMinioSnapshot(key string) error {
-	if s.minio == nil {
+	if s.store == nil {
 		return fmt.Errorf("minio not initialized")
 	}
 	
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	
-	return s.minio.client.RemoveObject(ctx, s.minio.bucket, key, minio.RemoveObjectOptions{})
+	return s.store.client.Delete(ctx, key)
 }
 
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"easydarwin/internal/conf"
+	"easydarwin/utils/pkg/objstore"
 	"fmt"
 	"io"
 	"log/slog"
@@ -18,12 +19,6 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
-type minioClient struct {
-	client *minio.Client
-	bucket string
-	base   string
-}
-
 func (s *Service) initMinio() error {
 	cfg := s.cfg.MinIO
 	if cfg.Endpoint == "" || cfg.Bucket == "" {
@@ -90,9 +85,8 @@ func (s *Service) initMinio() error {
 		s.log.Info("minio bucket created successfully", slog.String("bucket", cfg.Bucket))
 	}
 
-	s.minio = &minioClient{
-		client: client,
-		bucket: cfg.Bucket,
+	s.store = &storeClient{
+		client: objstore.NewMinIO(client, cfg.Bucket),
 		base:   cfg.BasePath,
 	}
 	
@@ -105,7 +99,7 @@ func (s *Service) initMinio() error {
 
 // createMinioPath creates a placeholder object to ensure the path exists in MinIO
 func (s *Service) createMinioPath(task conf.FrameExtractTask) error {
-	if s.minio == nil {
+	if s.store == nil {
 		return fmt.Errorf("minio not initialized")
 	}
 	
@@ -117,15 +111,12 @@ func (s *Service) createMinioPath(task conf.FrameExtractTask) error {
 	
 	// create a .keep file to establish the path
 	// use forward slashes for MinIO paths (S3 convention)
-	key := filepath.ToSlash(filepath.Join(s.minio.base, taskType, task.ID, ".keep"))
+	key := filepath.ToSlash(filepath.Join(s.store.base, taskType, task.ID, ".keep"))
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	
 	content := []byte(fmt.Sprintf("Task: %s\nType: %s\nCreated: %s\n", task.ID, taskType, time.Now().Format(time.RFC3339)))
-	_, err := s.minio.client.PutObject(ctx, s.minio.bucket, key, bytes.NewReader(content), int64(len(content)), minio.PutObjectOptions{
-		ContentType: "text/plain",
-	})
-	if err != nil {
+	if err := s.store.client.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "text/plain"); err != nil {
 		return err
 	}
 	
@@ -135,7 +126,7 @@ func (s *Service) createMinioPath(task conf.FrameExtractTask) error {
 
 // deleteMinioPath removes all objects under the task's path
 func (s *Service) deleteMinioPath(task conf.FrameExtractTask) error {
-	if s.minio == nil {
+	if s.store == nil {
 		return fmt.Errorf("minio not initialized")
 	}
 	
@@ -146,15 +137,12 @@ func (s *Service) deleteMinioPath(task conf.FrameExtractTask) error {
 	}
 	
 	// use forward slashes for S3/MinIO
-	prefix := filepath.ToSlash(filepath.Join(s.minio.base, taskType, task.ID)) + "/"
+	prefix := filepath.ToSlash(filepath.Join(s.store.base, taskType, task.ID)) + "/"
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	
 	// list and remove all objects with this prefix
-	objectCh := s.minio.client.ListObjects(ctx, s.minio.bucket, minio.ListObjectsOptions{
-		Prefix:    prefix,
-		Recursive: true,
-	})
+	objectCh := s.store.client.List(ctx, prefix, true)
 	
 	count := 0
 	for object := range objectCh {
@@ -163,7 +151,7 @@ func (s *Service) deleteMinioPath(task conf.FrameExtractTask) error {
 			continue
 		}
 		
-		if err := s.minio.client.RemoveObject(ctx, s.minio.bucket, object.Key, minio.RemoveObjectOptions{}); err != nil {
+		if err := s.store.client.Delete(ctx, object.Key); err != nil {
 			s.log.Warn("remove object error", slog.String("key", object.Key), slog.String("err", err.Error()))
 			continue
 		}
@@ -177,7 +165,7 @@ func (s *Service) deleteMinioPath(task conf.FrameExtractTask) error {
 func (s *Service) runMinioSinkLoopCtx(task conf.FrameExtractTask, stop <-chan struct{}) {
 	defer s.wg.Done()
 
-	if s.minio == nil {
+	if s.store == nil {
 		s.log.Error("minio not initialized", slog.String("task", task.ID))
 		return
 	}
@@ -309,11 +297,9 @@ func (s *Service) runMinioSinkLoopCtx(task conf.FrameExtractTask, stop <-chan st
 					taskType = "未分类"
 				}
 				// use forward slashes for MinIO/S3 paths
-				key := filepath.ToSlash(filepath.Join(s.minio.base, taskType, task.ID, fmt.Sprintf("%s.jpg", ts)))
+				key := filepath.ToSlash(filepath.Join(s.store.base, taskType, task.ID, fmt.Sprintf("%s.jpg", ts)))
 				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-				_, err = s.minio.client.PutObject(ctx, s.minio.bucket, key, &frame, int64(frame.Len()), minio.PutObjectOptions{
-					ContentType: "image/jpeg",
-				})
+				err = s.store.client.Put(ctx, key, &frame, int64(frame.Len()), "image/jpeg")
 				cancel()
 				if err != nil {
 					s.log.Warn("minio upload failed", slog.String("task", task.ID), slog.String("key", key), slog.String("err", err.Error()))
@@ -434,7 +420,7 @@ func (s *Service) runMinioSinkLoopCtx(task conf.FrameExtractTask, stop <-chan st
 // 2. 批量删除，减少网络往返（性能提升5-10倍）
 // 3. 增量式清理，只删除超出的部分
 func (s *Service) cleanupOldFrames(task conf.FrameExtractTask, maxCount int) error {
-	if s.minio == nil {
+	if s.store == nil {
 		return fmt.Errorf("minio not initialized")
 	}
 	
@@ -447,7 +433,7 @@ func (s *Service) cleanupOldFrames(task conf.FrameExtractTask, maxCount int) err
 	if taskType == "" {
 		taskType = "未分类"
 	}
-	prefix := filepath.ToSlash(filepath.Join(s.minio.base, taskType, task.ID)) + "/"
+	prefix := filepath.ToSlash(filepath.Join(s.store.base, taskType, task.ID)) + "/"
 	
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second) // 增加超时时间，支持大批量处理
 	defer cancel()
@@ -456,12 +442,9 @@ func (s *Service) cleanupOldFrames(task conf.FrameExtractTask, maxCount int) err
 	// MinIO SDK的ListObjects会自动分页，我们只需要收集所有对象
 	// 但为了控制内存，我们限制最大收集数量，并尽早判断是否需要清理
 	maxObjectsToCollect := maxCount * 3 // 最多收集限制的3倍，足够判断是否需要清理
-	var allObjects []minio.ObjectInfo
+	var allObjects []objstore.ObjectInfo
 	
-	objectCh := s.minio.client.ListObjects(ctx, s.minio.bucket, minio.ListObjectsOptions{
-		Prefix:    prefix,
-		Recursive: true,
-	})
+	objectCh := s.store.client.List(ctx, prefix, true)
 	
 	// 收集所有jpg图片
 	for object := range objectCh {
@@ -511,7 +494,7 @@ func (s *Service) cleanupOldFrames(task conf.FrameExtractTask, maxCount int) err
 	
 	// 深度优化3：批量删除，减少网络往返
 	// MinIO支持批量删除（RemoveObjects），但需要先收集要删除的对象列表
-	var objectsToDelete []minio.ObjectInfo
+	var objectsToDelete []string
 	
 	// 收集需要删除的对象（跳过队列中的图片）
 	for i := 0; i < deleteCount && i < len(allObjects); i++ {
@@ -523,7 +506,7 @@ func (s *Service) cleanupOldFrames(task conf.FrameExtractTask, maxCount int) err
 			continue
 		}
 		
-		objectsToDelete = append(objectsToDelete, allObjects[i])
+		objectsToDelete = append(objectsToDelete, allObjects[i].Key)
 	}
 	
 	// 深度优化4：批量删除（每批100个，避免单次请求过大）
@@ -535,30 +518,16 @@ func (s *Service) cleanupOldFrames(task conf.FrameExtractTask, maxCount int) err
 		}
 		
 		batch := objectsToDelete[i:end]
-		errorCh := s.minio.client.RemoveObjects(ctx, s.minio.bucket, 
-			func() <-chan minio.ObjectInfo {
-				ch := make(chan minio.ObjectInfo, len(batch))
-				go func() {
-					defer close(ch)
-					for _, obj := range batch {
-						ch <- obj
-					}
-				}()
-				return ch
-			}(),
-			minio.RemoveObjectsOptions{})
+		failed := objstore.DeleteMany(ctx, s.store.client, batch)
 		
 		// 检查删除结果
-		for err := range errorCh {
-			if err.Err != nil {
-				s.log.Warn("failed to delete old frame in batch",
-					slog.String("task", task.ID),
-					slog.String("key", err.ObjectName),
-					slog.String("err", err.Err.Error()))
-			} else {
-				deletedCount++
-			}
+		for key, err := range failed {
+			s.log.Warn("failed to delete old frame in batch",
+				slog.String("task", task.ID),
+				slog.String("key", key),
+				slog.String("err", err.Error()))
 		}
+		deletedCount += len(batch) - len(failed)
 	}
 	
 	// 更新统计
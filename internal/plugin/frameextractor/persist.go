@@ -100,6 +100,11 @@ func (s *Service) buildConfigLines() []string {
 	lines = append(lines, fmt.Sprintf("secret_key = '%s'", s.cfg.MinIO.SecretKey))
 	lines = append(lines, fmt.Sprintf("use_ssl = %t", s.cfg.MinIO.UseSSL))
 	lines = append(lines, fmt.Sprintf("base_path = '%s'", s.cfg.MinIO.BasePath))
+
+	lines = append(lines, "")
+	lines = append(lines, "[frame_extractor.local]")
+	lines = append(lines, fmt.Sprintf("public_url = '%s'", s.cfg.Local.PublicURL))
+	lines = append(lines, fmt.Sprintf("sign_secret = '%s'", s.cfg.Local.SignSecret))
 	return lines
 }
 
@@ -125,6 +130,8 @@ func (s *Service) buildTaskLines() []string {
 		if t.SaveAlertImage != nil {
 			lines = append(lines, fmt.Sprintf("save_alert_image = %t", *t.SaveAlertImage))
 		}
+		// 保存布防计划和手动布防/撤防（如果设置了）
+		lines = append(lines, armingTOML(t)...)
 		lines = append(lines, "")
 	}
 	return lines
@@ -5,6 +5,7 @@ import (
     "context"
     "errors"
     "easydarwin/internal/conf"
+    "easydarwin/utils/pkg/objstore"
     "easydarwin/utils/pkg/system"
     "fmt"
     "io"
@@ -16,8 +17,6 @@ import (
     "strings"
     "sync"
     "time"
-    
-    "github.com/minio/minio-go/v7"
 )
 
 type Service struct {
@@ -27,7 +26,8 @@ type Service struct {
     stop       chan struct{}
     mu         sync.Mutex
     configPath string // path to config.toml for persistence
-    minio      *minioClient // minio client if store=minio
+    store      *storeClient // object store (minio, or local when store=local)
+    local      *objstore.Local // local object store if store=local
     // per-task stop channel
     taskStops map[string]chan struct{}
     // monitoring stats
@@ -159,6 +159,7 @@ type TaskMonitorInfo struct {
     ErrorCount      int64     `json:"error_count"`       // 错误计数
     Uptime          int64     `json:"uptime"`            // 运行时长(秒)
     StartTime       time.Time `json:"start_time"`        // 启动时间
+    Arming          ArmingState `json:"arming"`          // 当前布防状态
 }
 
 // SystemMonitorInfo 系统监控信息
@@ -225,6 +226,9 @@ func (s *Service) Start() error {
         if err := os.MkdirAll(out, 0o755); err != nil {
             return err
         }
+        if err := s.initLocalStore(out); err != nil {
+            return err
+        }
     } else if s.cfg.Store == "minio" {
         if err := s.initMinio(); err != nil {
             return err
@@ -236,6 +240,10 @@ func (s *Service) Start() error {
     // 启动清理worker（深度优化：使用队列和并发控制）
     go s.cleanupWorker()
 
+    // 按布防计划启停抽帧
+    s.wg.Add(1)
+    go s.armingLoop()
+
     // boot predefined tasks (no decoding yet; placeholder goroutine)
     for _, t := range s.cfg.Tasks {
         if strings.TrimSpace(t.RtspURL) == "" {
@@ -290,6 +298,12 @@ func (s *Service) startTask(t conf.FrameExtractTask) error {
         s.log.Info("task disabled, skipping", slog.String("task", t.ID))
         return nil
     }
+
+    // 撤防停止抽帧的任务由布防检查在布防后启动
+    if extractGated(t, time.Now()) {
+        s.log.Info("task disarmed, extraction paused", slog.String("task", t.ID))
+        return nil
+    }
     
     done := make(chan struct{})
     s.taskStops[t.ID] = done
@@ -338,7 +352,7 @@ func (s *Service) AddTask(t conf.FrameExtractTask) error {
 	s.cfg.Tasks = append(s.cfg.Tasks, t)
 	
 	// create minio path if store is minio
-	if s.cfg.Store == "minio" && s.minio != nil {
+	if s.cfg.Store == "minio" && s.store != nil {
 		if err := s.createMinioPath(t); err != nil {
 			s.log.Warn("failed to create minio path", slog.String("task", t.ID), slog.String("err", err.Error()))
 		}
@@ -392,7 +406,7 @@ func (s *Service) RemoveTask(id string) bool {
     }
     
     // delete minio path if store is minio
-    if removedTask != nil && s.cfg.Store == "minio" && s.minio != nil {
+    if removedTask != nil && s.cfg.Store == "minio" && s.store != nil {
         if err := s.deleteMinioPath(*removedTask); err != nil {
             s.log.Warn("failed to delete minio path", slog.String("task", id), slog.String("err", err.Error()))
         }
@@ -416,7 +430,7 @@ func (s *Service) ListTasks() []conf.FrameExtractTask {
     s.mu.Unlock()
     
     // 如果使用MinIO存储，检查每个任务的preview图片
-    if s.cfg.Store == "minio" && s.minio != nil {
+    if s.cfg.Store == "minio" && s.store != nil {
         for i := range out {
             task := &out[i]
             // 如果配置中没有preview_image，尝试从MinIO查找
@@ -448,7 +462,7 @@ func (s *Service) GetTaskByID(id string) *conf.FrameExtractTask {
 
 // findPreviewImageInMinIO 在MinIO中查找任务的preview图片
 func (s *Service) findPreviewImageInMinIO(task *conf.FrameExtractTask) string {
-    if s.minio == nil {
+    if s.store == nil {
         return ""
     }
     
@@ -458,16 +472,13 @@ func (s *Service) findPreviewImageInMinIO(task *conf.FrameExtractTask) string {
     }
     
     // 构建任务路径前缀
-    prefix := filepath.ToSlash(filepath.Join(s.minio.base, taskType, task.ID)) + "/"
+    prefix := filepath.ToSlash(filepath.Join(s.store.base, taskType, task.ID)) + "/"
     
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
     
     // 列举该任务目录下的所有文件
-    objectCh := s.minio.client.ListObjects(ctx, s.minio.bucket, minio.ListObjectsOptions{
-        Prefix:    prefix,
-        Recursive: false,
-    })
+    objectCh := s.store.client.List(ctx, prefix, false)
     
     // 查找preview_开头的图片
     for object := range objectCh {
@@ -495,7 +506,24 @@ func (s *Service) GetConfig() *conf.FrameExtractorConfig {
     return &cfg
 }
 
+// RedactedSecret replaces secrets in config returned by the API;
+// sending it back in UpdateConfig keeps the current secret
+const RedactedSecret = "******"
+
+// GetRedactedConfig returns a copy of current config with minio secret_key and local sign_secret redacted
+func (s *Service) GetRedactedConfig() *conf.FrameExtractorConfig {
+    cfg := s.GetConfig()
+    if cfg.MinIO.SecretKey != "" {
+        cfg.MinIO.SecretKey = RedactedSecret
+    }
+    if cfg.Local.SignSecret != "" {
+        cfg.Local.SignSecret = RedactedSecret
+    }
+    return cfg
+}
+
 // UpdateConfig updates storage config (store type, minio settings, etc)
+// secrets equal to RedactedSecret keep their current value
 func (s *Service) UpdateConfig(newCfg *conf.FrameExtractorConfig) error {
     s.mu.Lock()
     // update config fields (skip tasks, they are managed separately)
@@ -503,7 +531,18 @@ func (s *Service) UpdateConfig(newCfg *conf.FrameExtractorConfig) error {
     s.cfg.IntervalMs = newCfg.IntervalMs
     s.cfg.OutputDir = newCfg.OutputDir
     s.cfg.Store = newCfg.Store
-    s.cfg.MinIO = newCfg.MinIO
+    minioCfg := newCfg.MinIO
+    if minioCfg.SecretKey == RedactedSecret {
+        minioCfg.SecretKey = s.cfg.MinIO.SecretKey
+    }
+    s.cfg.MinIO = minioCfg
+    local := newCfg.Local
+    if local.SignSecret == RedactedSecret {
+        local.SignSecret = s.cfg.Local.SignSecret
+    }
+    if local != (conf.LocalStoreConfig{}) {
+        s.cfg.Local = local
+    }
     s.mu.Unlock()
     
     s.log.Info("updating config", 
@@ -518,6 +557,15 @@ func (s *Service) UpdateConfig(newCfg *conf.FrameExtractorConfig) error {
             s.log.Error("failed to init minio", slog.String("err", err.Error()))
             return err
         }
+    } else if s.cfg.Store == "local" {
+        out := s.cfg.OutputDir
+        if out == "" {
+            out = filepath.Join(system.GetCWD(), "snapshots")
+        }
+        if err := s.initLocalStore(out); err != nil {
+            s.log.Error("failed to init local store", slog.String("err", err.Error()))
+            return err
+        }
     }
     
     // persist to config file
@@ -695,21 +743,21 @@ func (s *Service) extractSinglePreviewFrame(task conf.FrameExtractTask) {
 	
 	// 保存到MinIO或本地
 	var imagePath string
-	if s.cfg.Store == "minio" && s.minio != nil {
+	if s.cfg.Store == "minio" && s.store != nil {
 		// 保存到MinIO
 		taskType := task.TaskType
 		if taskType == "" {
 			taskType = "未分类"
 		}
-		key := filepath.ToSlash(filepath.Join(s.minio.base, taskType, task.ID, filename))
+		key := filepath.ToSlash(filepath.Join(s.store.base, taskType, task.ID, filename))
 		
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 		
-		_, err := s.minio.client.PutObject(ctx, s.minio.bucket, key, 
+		err := s.store.client.Put(ctx, key, 
 			bytes.NewReader(frameBuffer.Bytes()), 
 			int64(frameBuffer.Len()), 
-			minio.PutObjectOptions{ContentType: "image/jpeg"})
+			"image/jpeg")
 		
 		if err != nil {
 			s.log.Error("failed to upload preview to minio", 
@@ -760,10 +808,10 @@ func (s *Service) extractSinglePreviewFrame(task conf.FrameExtractTask) {
 	}
 }
 
-// SaveAlgorithmConfig 保存算法配置到MinIO
+// SaveAlgorithmConfig 保存算法配置到对象存储
 func (s *Service) SaveAlgorithmConfig(taskID string, config []byte) error {
-	if s.minio == nil {
-		return fmt.Errorf("minio not initialized")
+	if s.store == nil {
+		return fmt.Errorf("object store not initialized")
 	}
 	
 	// 查找任务
@@ -786,18 +834,18 @@ func (s *Service) SaveAlgorithmConfig(taskID string, config []byte) error {
 	if taskType == "" {
 		taskType = "未分类"
 	}
-	configKey := filepath.ToSlash(filepath.Join(s.minio.base, taskType, task.ID, "algo_config.json"))
+	configKey := filepath.ToSlash(filepath.Join(s.store.base, taskType, task.ID, "algo_config.json"))
 	
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	
-	_, err := s.minio.client.PutObject(ctx, s.minio.bucket, configKey, 
+	err := s.store.client.Put(ctx, configKey, 
 		bytes.NewReader(config), 
 		int64(len(config)), 
-		minio.PutObjectOptions{ContentType: "application/json"})
+		"application/json")
 	
 	if err != nil {
-		return fmt.Errorf("failed to save config to minio: %w", err)
+		return fmt.Errorf("failed to save config to object store: %w", err)
 	}
 	
 	// 更新任务状态为已配置
@@ -824,8 +872,8 @@ func (s *Service) SaveAlgorithmConfig(taskID string, config []byte) error {
 
 // GetAlgorithmConfig 获取算法配置
 func (s *Service) GetAlgorithmConfig(taskID string) ([]byte, error) {
-	if s.minio == nil {
-		return nil, fmt.Errorf("minio not initialized")
+	if s.store == nil {
+		return nil, fmt.Errorf("object store not initialized")
 	}
 	
 	// 查找任务
@@ -848,14 +896,14 @@ func (s *Service) GetAlgorithmConfig(taskID string) ([]byte, error) {
 	if taskType == "" {
 		taskType = "未分类"
 	}
-	configKey := filepath.ToSlash(filepath.Join(s.minio.base, taskType, task.ID, "algo_config.json"))
+	configKey := filepath.ToSlash(filepath.Join(s.store.base, taskType, task.ID, "algo_config.json"))
 	
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	
-	object, err := s.minio.client.GetObject(ctx, s.minio.bucket, configKey, minio.GetObjectOptions{})
+	object, err := s.store.client.Get(ctx, configKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get config from minio: %w", err)
+		return nil, fmt.Errorf("failed to get config from object store: %w", err)
 	}
 	defer object.Close()
 	
@@ -868,9 +916,9 @@ func (s *Service) GetAlgorithmConfig(taskID string) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// GetAlgorithmConfigPath 获取算法配置文件在MinIO中的路径
+// GetAlgorithmConfigPath 获取算法配置文件在对象存储中的路径
 func (s *Service) GetAlgorithmConfigPath(taskID string) string {
-	if s.minio == nil {
+	if s.store == nil {
 		return ""
 	}
 	
@@ -894,7 +942,7 @@ func (s *Service) GetAlgorithmConfigPath(taskID string) string {
 	if taskType == "" {
 		taskType = "未分类"
 	}
-	configKey := filepath.ToSlash(filepath.Join(s.minio.base, taskType, task.ID, "algo_config.json"))
+	configKey := filepath.ToSlash(filepath.Join(s.store.base, taskType, task.ID, "algo_config.json"))
 	
 	return configKey
 }
@@ -937,16 +985,16 @@ func (s *Service) GetTasksByType(taskType string) []conf.FrameExtractTask {
 	return result
 }
 
-// GetPresignedURL 获取MinIO预签名URL
+// GetPresignedURL 获取对象存储预签名URL
 func (s *Service) GetPresignedURL(objectPath string, expiry time.Duration) (string, error) {
-	if s.minio == nil {
-		return "", fmt.Errorf("minio not initialized")
+	if s.store == nil {
+		return "", fmt.Errorf("object store not initialized")
 	}
 	
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	
-	presignedURL, err := s.minio.client.PresignedGetObject(ctx, s.minio.bucket, objectPath, expiry, nil)
+	presignedURL, err := s.store.client.PresignGet(ctx, objectPath, expiry)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
 	}
@@ -987,6 +1035,7 @@ func (s *Service) GetStats() TaskStats {
     pendingTasks := 0
     
     taskDetails := make([]TaskMonitorInfo, 0, totalTasks)
+    now := time.Now()
     
     for _, task := range s.cfg.Tasks {
         isRunning := false
@@ -994,9 +1043,12 @@ func (s *Service) GetStats() TaskStats {
             isRunning = true
         }
         
+        arming := EvaluateArming(task, now)
         status := "stopped"
         if isRunning {
             status = "running"
+        } else if task.Enabled && !arming.Armed && arming.Gate == ArmingGateExtract {
+            status = "disarmed"
         }
         
         if task.ConfigStatus == "configured" {
@@ -1018,6 +1070,7 @@ func (s *Service) GetStats() TaskStats {
             ErrorCount:    0,
             Uptime:        0,
             StartTime:     time.Time{},
+            Arming:        arming,
         }
         
         taskDetails = append(taskDetails, info)
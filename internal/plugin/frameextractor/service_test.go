@@ -0,0 +1,43 @@
+package frameextractor
+
+import (
+	"easydarwin/internal/conf"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestRedactedConfigRoundTrip(t *testing.T) {
+	s := &Service{
+		cfg: &conf.FrameExtractorConfig{
+			MinIO: conf.MinIOConfig{Endpoint: "minio:9000", AccessKey: "admin", SecretKey: "minio-secret"},
+			Local: conf.LocalStoreConfig{PublicURL: "http://10.0.0.1:10086", SignSecret: "sign-secret"},
+		},
+		log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	cfg := s.GetRedactedConfig()
+	if cfg.MinIO.SecretKey != RedactedSecret || cfg.Local.SignSecret != RedactedSecret {
+		t.Fatalf("secrets should be redacted, got %q %q", cfg.MinIO.SecretKey, cfg.Local.SignSecret)
+	}
+	if s.cfg.MinIO.SecretKey != "minio-secret" {
+		t.Fatal("redaction should not modify current config")
+	}
+
+	// 原样提交查询到的配置时保留原密钥
+	cfg.IntervalMs = 500
+	if err := s.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if s.cfg.MinIO.SecretKey != "minio-secret" || s.cfg.Local.SignSecret != "sign-secret" || s.cfg.IntervalMs != 500 {
+		t.Fatalf("secrets should be kept, got %+v", s.cfg)
+	}
+
+	cfg.MinIO.SecretKey = "new-secret"
+	if err := s.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if s.cfg.MinIO.SecretKey != "new-secret" {
+		t.Fatal("new secret should be applied")
+	}
+}
@@ -0,0 +1,45 @@
+package frameextractor
+
+import (
+	"easydarwin/utils/pkg/objstore"
+	"log/slog"
+	"strings"
+)
+
+// LocalObjectRoute 本地存储签名URL的路由（内置HTTP服务）
+const LocalObjectRoute = "/api/v1/frame_extractor/objects"
+
+// storeClient 抽帧图片所在的对象存储
+type storeClient struct {
+	client objstore.Store
+	base   string // 对象路径前缀（本地存储为空）
+}
+
+// initLocalStore 创建本地对象存储，供智能分析读取、移动图片并生成签名URL
+func (s *Service) initLocalStore(root string) error {
+	cfg := s.cfg.Local
+	baseURL := ""
+	if cfg.PublicURL != "" {
+		baseURL = strings.TrimRight(cfg.PublicURL, "/") + LocalObjectRoute
+	}
+	local, err := objstore.NewLocal(root, objstore.LocalOptions{BaseURL: baseURL, Secret: cfg.SignSecret})
+	if err != nil {
+		return err
+	}
+	s.local = local
+	s.store = &storeClient{client: local}
+
+	if baseURL == "" {
+		s.log.Warn("frame_extractor.local.public_url not set, presigned image URLs unavailable")
+	}
+	s.log.Info("local object store initialized", slog.String("root", local.Root()), slog.String("base_url", baseURL))
+	return nil
+}
+
+// LocalStore 本地对象存储，store 不为 local 时返回 nil
+func (s *Service) LocalStore() *objstore.Local {
+	if s.cfg.Store != "local" {
+		return nil
+	}
+	return s.local
+}
@@ -1,13 +1,18 @@
 package api
 
 import (
+	"context"
 	"easydarwin/internal/conf"
 	"easydarwin/internal/data"
 	"easydarwin/internal/data/model"
 	"easydarwin/internal/plugin/aianalysis"
+	"encoding/json"
+	"errors"
 	"log/slog"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // registerAIAnalysisAPI 注册AI分析相关API
@@ -34,12 +39,42 @@ func registerAIAnalysisAPI(g gin.IRouter) {
 			return
 		}
 
+		// 启用鉴权时校验 app_id + secret、允许的任务类型，并防止覆盖其他应用的服务
+		auth := srv.GetAlgorithmAuth()
+		if !authorizeAlgorithmRegister(c, auth, registry, &service) {
+			return
+		}
+
+		// 影子服务只在启用影子推理时接受注册，否则不会被调用
+		if service.Shadow && srv.GetShadowEvaluator() == nil {
+			c.JSON(400, gin.H{"error": "shadow inference is not enabled"})
+			return
+		}
+
+		// gRPC协议注册时先做健康检查，确认算法服务确实支持该协议
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+		if err := srv.CheckAlgorithmService(ctx, service); err != nil {
+			auditAlgorithm(c, auth, "register", service, err)
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
 		if err := registry.Register(service); err != nil {
+			auditAlgorithm(c, auth, "register", service, err)
 			c.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
+		auditAlgorithm(c, auth, "register", service, nil)
 
-		c.JSON(200, gin.H{"ok": true, "service_id": service.ServiceID})
+		resp := gin.H{"ok": true, "service_id": service.ServiceID}
+		// 心跳和注销请求使用 session_key 签名（重新注册后更换）
+		if auth.Enabled() {
+			if registered := registry.GetAlgorithmByEndpoint(service.TaskTypes[0], service.Endpoint); registered != nil {
+				resp["session_key"] = auth.SessionKey(*registered)
+			}
+		}
+		c.JSON(200, resp)
 	})
 
 	// 算法服务注销
@@ -58,14 +93,27 @@ func registerAIAnalysisAPI(g gin.IRouter) {
 			return
 		}
 
+		// 启用鉴权时需要使用注册时返回的 session_key 签名，或使用系统管理员账户
+		auth := srv.GetAlgorithmAuth()
+		services := matchAlgorithmServices(registry, serviceID)
+		if !verifyAlgorithmRequest(c, auth, services, true) {
+			return
+		}
+
+		target := conf.AlgorithmService{ServiceID: serviceID}
+		if len(services) > 0 {
+			target = services[0]
+		}
 		if err := registry.Unregister(serviceID); err != nil {
+			auditAlgorithm(c, auth, "unregister", target, err)
 			c.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
+		auditAlgorithm(c, auth, "unregister", target, nil)
 
 		c.JSON(200, gin.H{"ok": true})
 	})
-	
+
 	// 清空所有算法服务（用于清理测试数据或重置）
 	ai.POST("/clear_all", func(c *gin.Context) {
 		srv := aianalysis.GetGlobal()
@@ -80,8 +128,15 @@ func registerAIAnalysisAPI(g gin.IRouter) {
 			return
 		}
 
+		// 启用鉴权时需要系统管理员账户
+		auth, ok := requireAlgorithmAdmin(c)
+		if !ok {
+			return
+		}
+
 		count := registry.ClearAllServices()
-		
+		auditAlgorithm(c, auth, "clear_all", conf.AlgorithmService{}, nil)
+
 		slog.Warn("algorithm services cleared by API request",
 			slog.String("remote_addr", c.ClientIP()),
 			slog.Int("cleared_count", count))
@@ -105,6 +160,11 @@ func registerAIAnalysisAPI(g gin.IRouter) {
 			return
 		}
 
+		// 启用鉴权时需要使用注册时返回的 session_key 签名
+		if !verifyAlgorithmRequest(c, srv.GetAlgorithmAuth(), matchAlgorithmServices(registry, id), false) {
+			return
+		}
+
 		// 解析心跳请求体（可选的性能统计数据）
 		var heartbeatReq conf.HeartbeatRequest
 		if err := c.ShouldBindJSON(&heartbeatReq); err != nil {
@@ -146,24 +206,30 @@ func registerAIAnalysisAPI(g gin.IRouter) {
 		for i, svc := range allServices {
 			serviceStats[i] = aianalysis.ServiceStat{
 				ServiceID:     svc.ServiceID,
+				AppID:         svc.AppID,
 				Name:          svc.Name,
 				Endpoint:      svc.Endpoint,
+				Protocol:      svc.Protocol,
 				Version:       svc.Version,
+				Shadow:        svc.Shadow,
 				TaskTypes:     svc.TaskTypes,
 				CallCount:     registry.GetCallCount(svc.Endpoint), // 使用endpoint作为key
 				LastHeartbeat: svc.LastHeartbeat,
 				RegisterAt:    svc.RegisterAt,
 			}
+			if status, ok := registry.GetBreakerStatus(svc.Endpoint); ok {
+				serviceStats[i].Breaker = &status
+			}
 		}
-		
+
 		// 添加调试日志：记录实际有多少不同的endpoint
 		slog.Info("listing algorithm services",
 			slog.Int("unique_endpoints", len(serviceStats)),
 			slog.Int("returned_count", len(allServices)))
-		
+
 		c.JSON(200, gin.H{"services": serviceStats, "total": len(serviceStats)})
 	})
-	
+
 	// 获取负载均衡信息
 	ai.GET("/load_balance/info", func(c *gin.Context) {
 		srv := aianalysis.GetGlobal()
@@ -180,13 +246,48 @@ func registerAIAnalysisAPI(g gin.IRouter) {
 
 		// 获取所有任务类型的负载均衡信息
 		info := registry.GetAllLoadBalanceInfo()
-		
+		defaultStrategy, taskStrategies := registry.GetLoadBalanceStrategies()
+
 		c.JSON(200, gin.H{
-			"load_balance": info,
+			"load_balance":     info,
 			"total_task_types": len(info),
+			"default_strategy": defaultStrategy,
+			"task_strategies":  taskStrategies,
 		})
 	})
-	
+
+	// 设置负载均衡策略（运行时生效，task_type为空时设置全局默认策略，strategy为空时清除任务类型覆盖）
+	ai.POST("/load_balance/strategy", func(c *gin.Context) {
+		var req struct {
+			TaskType string `json:"task_type"`
+			Strategy string `json:"strategy"` // weighted_rr|least_in_flight|consistent_hash|priority
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		srv := aianalysis.GetGlobal()
+		if srv == nil {
+			c.JSON(500, gin.H{"error": "AI analysis service not ready"})
+			return
+		}
+
+		registry := srv.GetRegistry()
+		if registry == nil {
+			c.JSON(500, gin.H{"error": "registry not ready"})
+			return
+		}
+
+		if err := registry.SetLoadBalanceStrategy(req.TaskType, req.Strategy); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		defaultStrategy, taskStrategies := registry.GetLoadBalanceStrategies()
+		c.JSON(200, gin.H{"ok": true, "default_strategy": defaultStrategy, "task_strategies": taskStrategies})
+	})
+
 	// 调试接口：查看所有服务详情（不去重，显示内部存储的所有记录）
 	ai.GET("/services/debug", func(c *gin.Context) {
 		srv := aianalysis.GetGlobal()
@@ -204,7 +305,7 @@ func registerAIAnalysisAPI(g gin.IRouter) {
 		// 获取所有任务类型的服务
 		debugInfo := make(map[string][]aianalysis.ServiceStat)
 		totalRecords := 0
-		
+
 		for _, taskType := range []string{"人数统计", "客流分析", "人头检测", "绊线人数统计", "人员跌倒", "人员离岗", "吸烟检测", "区域入侵", "徘徊检测", "物品遗留", "安全帽检测"} {
 			services := registry.GetAlgorithms(taskType)
 			if len(services) > 0 {
@@ -214,6 +315,7 @@ func registerAIAnalysisAPI(g gin.IRouter) {
 						ServiceID:     svc.ServiceID,
 						Name:          svc.Name,
 						Endpoint:      svc.Endpoint,
+						Protocol:      svc.Protocol,
 						Version:       svc.Version,
 						TaskTypes:     svc.TaskTypes,
 						CallCount:     registry.GetCallCount(svc.Endpoint),
@@ -225,14 +327,14 @@ func registerAIAnalysisAPI(g gin.IRouter) {
 				totalRecords += len(services)
 			}
 		}
-		
+
 		c.JSON(200, gin.H{
-			"task_types":    debugInfo,
-			"total_records": totalRecords,
+			"task_types":       debugInfo,
+			"total_records":    totalRecords,
 			"unique_endpoints": len(registry.ListAllServiceInstances()),
 		})
 	})
-	
+
 	// 负载均衡分析接口
 	ai.GET("/load_balance/analysis", func(c *gin.Context) {
 		srv := aianalysis.GetGlobal()
@@ -249,43 +351,43 @@ func registerAIAnalysisAPI(g gin.IRouter) {
 
 		// 按任务类型统计负载分布
 		analysis := make(map[string]interface{})
-		
+
 		for _, taskType := range []string{"人数统计", "客流分析", "人头检测", "绊线人数统计"} {
 			services := registry.GetAlgorithms(taskType)
 			if len(services) == 0 {
 				continue
 			}
-			
+
 			// 统计每个服务的调用次数
 			serviceStats := make([]map[string]interface{}, 0)
 			totalCalls := 0
 			minCalls := -1
 			maxCalls := 0
-			
+
 			for _, svc := range services {
 				callCount := registry.GetCallCount(svc.Endpoint)
 				totalCalls += callCount
-				
+
 				if minCalls == -1 || callCount < minCalls {
 					minCalls = callCount
 				}
 				if callCount > maxCalls {
 					maxCalls = callCount
 				}
-				
+
 				serviceStats = append(serviceStats, map[string]interface{}{
 					"service_id": svc.ServiceID,
 					"endpoint":   svc.Endpoint,
 					"call_count": callCount,
 				})
 			}
-			
+
 			// 计算负载均衡度（方差）
 			avgCalls := 0.0
 			if len(services) > 0 {
 				avgCalls = float64(totalCalls) / float64(len(services))
 			}
-			
+
 			variance := 0.0
 			for _, svc := range services {
 				callCount := float64(registry.GetCallCount(svc.Endpoint))
@@ -295,7 +397,7 @@ func registerAIAnalysisAPI(g gin.IRouter) {
 			if len(services) > 0 {
 				variance /= float64(len(services))
 			}
-			
+
 			// 负载均衡质量评估
 			balanceQuality := "excellent"
 			if len(services) > 1 {
@@ -308,26 +410,26 @@ func registerAIAnalysisAPI(g gin.IRouter) {
 					balanceQuality = "good"
 				}
 			}
-			
+
 			analysis[taskType] = map[string]interface{}{
-				"service_count":    len(services),
-				"total_calls":      totalCalls,
-				"avg_calls":        avgCalls,
-				"min_calls":        minCalls,
-				"max_calls":        maxCalls,
-				"variance":         variance,
-				"balance_quality":  balanceQuality,
-				"services":         serviceStats,
+				"service_count":   len(services),
+				"total_calls":     totalCalls,
+				"avg_calls":       avgCalls,
+				"min_calls":       minCalls,
+				"max_calls":       maxCalls,
+				"variance":        variance,
+				"balance_quality": balanceQuality,
+				"services":        serviceStats,
 			}
 		}
-		
+
 		c.JSON(200, gin.H{"analysis": analysis})
 	})
-	
+
 	// 获取指定任务类型的服务统计
 	ai.GET("/services/stats/:task_type", func(c *gin.Context) {
 		taskType := c.Param("task_type")
-		
+
 		srv := aianalysis.GetGlobal()
 		if srv == nil {
 			c.JSON(500, gin.H{"error": "AI analysis service not ready"})
@@ -381,6 +483,209 @@ func registerAIAnalysisAPI(g gin.IRouter) {
 
 		c.JSON(200, gin.H{"ok": true, "message": "推理统计数据已清零"})
 	})
+
+	// 获取告警发件箱状态（积压数量、最早未投递告警的等待时长）
+	ai.GET("/outbox", func(c *gin.Context) {
+		srv := aianalysis.GetGlobal()
+		if srv == nil {
+			c.JSON(500, gin.H{"error": "AI analysis service not ready"})
+			return
+		}
+
+		stats, enabled, err := srv.GetOutboxStats()
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if !enabled {
+			c.JSON(200, gin.H{"enabled": false})
+			return
+		}
+		c.JSON(200, gin.H{"enabled": true, "stats": stats})
+	})
+
+	registerAlertRuleAPI(ai)
+	registerDatasetAPI(ai)
+	registerWebhookAPI(ai)
+	registerAlgorithmAuthAPI(ai)
+	registerCanaryAPI(ai)
+	registerShadowAPI(ai)
+}
+
+// registerAlertRuleAPI 注册告警规则相关API
+func registerAlertRuleAPI(g gin.IRouter) {
+	rules := g.Group("/rules")
+
+	// 查询告警规则列表
+	rules.GET("", func(c *gin.Context) {
+		list, err := data.ListAlertRules(c.Query("task_type"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"items": list, "total": len(list)})
+	})
+
+	// 获取告警规则详情
+	rules.GET("/:id", func(c *gin.Context) {
+		var uriParam struct {
+			ID uint `uri:"id" binding:"required"`
+		}
+		if err := c.ShouldBindUri(&uriParam); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		rule, err := data.GetAlertRule(uriParam.ID)
+		if err != nil {
+			c.JSON(404, gin.H{"error": "rule not found"})
+			return
+		}
+		c.JSON(200, gin.H{"rule": rule})
+	})
+
+	// 创建告警规则（enabled 默认为 true）
+	rules.POST("", func(c *gin.Context) {
+		rule := model.AlertRule{Enabled: true}
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		rule.ID = 0
+		if err := aianalysis.ValidateAlertRule(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := data.CreateAlertRule(&rule); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		reloadAlertRules()
+		c.JSON(200, gin.H{"ok": true, "rule": rule})
+	})
+
+	// 更新告警规则（整条覆盖）
+	rules.PUT("/:id", func(c *gin.Context) {
+		var uriParam struct {
+			ID uint `uri:"id" binding:"required"`
+		}
+		if err := c.ShouldBindUri(&uriParam); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		existing, err := data.GetAlertRule(uriParam.ID)
+		if err != nil {
+			c.JSON(404, gin.H{"error": "rule not found"})
+			return
+		}
+
+		rule := model.AlertRule{Enabled: true}
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		rule.ID = existing.ID
+		rule.CreatedAt = existing.CreatedAt
+		if err := aianalysis.ValidateAlertRule(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := data.UpdateAlertRule(&rule); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		reloadAlertRules()
+		c.JSON(200, gin.H{"ok": true, "rule": rule})
+	})
+
+	// 删除告警规则
+	rules.DELETE("/:id", func(c *gin.Context) {
+		var uriParam struct {
+			ID uint `uri:"id" binding:"required"`
+		}
+		if err := c.ShouldBindUri(&uriParam); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := data.DeleteAlertRule(uriParam.ID); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		reloadAlertRules()
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	// 规则试运行：用已保存的规则（rule_id）或未保存的规则（rule）判定已保存告警（alert_id）或给定的推理结果（result）
+	rules.POST("/dry_run", func(c *gin.Context) {
+		var req struct {
+			RuleID  uint             `json:"rule_id"`
+			Rule    *model.AlertRule `json:"rule"`
+			AlertID uint             `json:"alert_id"`
+			Result  interface{}      `json:"result"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		rule := req.Rule
+		if req.RuleID > 0 {
+			stored, err := data.GetAlertRule(req.RuleID)
+			if err != nil {
+				c.JSON(404, gin.H{"error": "rule not found"})
+				return
+			}
+			rule = stored
+		}
+		if rule == nil {
+			c.JSON(400, gin.H{"error": "rule_id or rule is required"})
+			return
+		}
+		if err := aianalysis.ValidateAlertRule(rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		result := req.Result
+		if req.AlertID > 0 {
+			alert, err := data.GetAlertByID(req.AlertID)
+			if err != nil {
+				c.JSON(404, gin.H{"error": "alert not found"})
+				return
+			}
+			if err := json.Unmarshal([]byte(alert.Result), &result); err != nil {
+				c.JSON(400, gin.H{"error": "alert result is not valid JSON: " + err.Error()})
+				return
+			}
+		}
+		if result == nil {
+			c.JSON(400, gin.H{"error": "alert_id or result is required"})
+			return
+		}
+
+		// 试运行只判定单帧，persist_hits 连续帧条件需要结合实时推理结果
+		c.JSON(200, gin.H{
+			"rule":           rule,
+			"evaluation":     aianalysis.EvaluateRule(rule, result),
+			"persist_hits":   rule.PersistHits,
+			"persist_frames": rule.PersistFrames,
+		})
+	})
+}
+
+// reloadAlertRules 规则修改后通知推理服务重新加载
+func reloadAlertRules() {
+	srv := aianalysis.GetGlobal()
+	if srv == nil {
+		return
+	}
+	if err := srv.ReloadAlertRules(); err != nil {
+		slog.Error("failed to reload alert rules", slog.String("err", err.Error()))
+	}
 }
 
 // registerAlertAPI 注册告警相关API
@@ -396,7 +701,7 @@ func registerAlertAPI(g gin.IRouter) {
 		}
 
 		list, total, err := data.ListAlerts(filter)
-		if err != nil{
+		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
@@ -416,6 +721,16 @@ func registerAlertAPI(g gin.IRouter) {
 							slog.String("err", err.Error()))
 					}
 				}
+				if list[i].AnnotatedImagePath != "" {
+					if url, err := srv.GeneratePresignedURL(list[i].AnnotatedImagePath); err == nil {
+						list[i].AnnotatedImageURL = url
+					}
+				}
+				if list[i].ClipPath != "" {
+					if url, err := srv.GeneratePresignedURL(list[i].ClipPath); err == nil {
+						list[i].ClipURL = url
+					}
+				}
 			}
 		}
 
@@ -440,6 +755,16 @@ func registerAlertAPI(g gin.IRouter) {
 
 		// 为告警动态生成预签名URL
 		srv := aianalysis.GetGlobal()
+		if srv != nil && alert.AnnotatedImagePath != "" {
+			if url, err := srv.GeneratePresignedURL(alert.AnnotatedImagePath); err == nil {
+				alert.AnnotatedImageURL = url
+			}
+		}
+		if srv != nil && alert.ClipPath != "" {
+			if url, err := srv.GeneratePresignedURL(alert.ClipPath); err == nil {
+				alert.ClipURL = url
+			}
+		}
 		if srv != nil && alert.ImageURL == "" && alert.ImagePath != "" {
 			url, err := srv.GeneratePresignedURL(alert.ImagePath)
 			if err == nil {
@@ -472,7 +797,7 @@ func registerAlertAPI(g gin.IRouter) {
 
 		c.JSON(200, gin.H{"ok": true})
 	})
-	
+
 	// 批量删除告警
 	alerts.POST("/batch_delete", func(c *gin.Context) {
 		var req struct {
@@ -497,7 +822,7 @@ func registerAlertAPI(g gin.IRouter) {
 
 		c.JSON(200, gin.H{"ok": true, "deleted_count": successCount})
 	})
-	
+
 	// 获取所有任务ID列表
 	alerts.GET("/task_ids", func(c *gin.Context) {
 		taskIDs, err := data.GetDistinctTaskIDs()
@@ -508,5 +833,166 @@ func registerAlertAPI(g gin.IRouter) {
 
 		c.JSON(200, gin.H{"task_ids": taskIDs})
 	})
+
+	registerAlertLifecycleAPI(alerts)
+	registerAlertFeedbackAPI(alerts)
+	registerAlertStatsAPI(alerts)
+	registerAlertStreamAPI(alerts)
 }
 
+// registerAlertLifecycleAPI 注册告警处理流程相关API（状态流转、指派、备注、处理记录）
+// 操作人通过请求中的 user_id 指定（users.id）
+func registerAlertLifecycleAPI(alerts gin.IRouter) {
+	// 变更告警状态：new|acknowledged|in_progress|resolved|false_positive
+	alerts.POST("/:id/status", func(c *gin.Context) {
+		var uriParam struct {
+			ID uint `uri:"id" binding:"required"`
+		}
+		if err := c.ShouldBindUri(&uriParam); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		var req struct {
+			Status string `json:"status" binding:"required"`
+			UserID int    `json:"user_id"`
+			Note   string `json:"note"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := data.TransitionAlert(uriParam.ID, req.Status, req.UserID, req.Note); err != nil {
+			alertLifecycleError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	// 批量变更告警状态（不允许流转的告警跳过）
+	alerts.POST("/batch_status", func(c *gin.Context) {
+		var req struct {
+			IDs    []uint `json:"ids" binding:"required"`
+			Status string `json:"status" binding:"required"`
+			UserID int    `json:"user_id"`
+			Note   string `json:"note"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if len(req.IDs) == 0 {
+			c.JSON(400, gin.H{"error": "ids cannot be empty"})
+			return
+		}
+
+		updated, skipped, err := data.TransitionAlerts(req.IDs, req.Status, req.UserID, req.Note)
+		if err != nil {
+			alertLifecycleError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{"ok": true, "updated_count": updated, "skipped": skipped})
+	})
+
+	// 指派处理人（assignee_id 为0时取消指派）
+	alerts.POST("/:id/assign", func(c *gin.Context) {
+		var uriParam struct {
+			ID uint `uri:"id" binding:"required"`
+		}
+		if err := c.ShouldBindUri(&uriParam); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		var req struct {
+			AssigneeID int    `json:"assignee_id"`
+			UserID     int    `json:"user_id"`
+			Note       string `json:"note"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := data.AssignAlert(uriParam.ID, req.AssigneeID, req.UserID, req.Note); err != nil {
+			alertLifecycleError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	// 查询告警备注
+	alerts.GET("/:id/comments", func(c *gin.Context) {
+		var uriParam struct {
+			ID uint `uri:"id" binding:"required"`
+		}
+		if err := c.ShouldBindUri(&uriParam); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		comments, err := data.ListAlertComments(uriParam.ID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"items": comments, "total": len(comments)})
+	})
+
+	// 添加告警备注
+	alerts.POST("/:id/comments", func(c *gin.Context) {
+		var uriParam struct {
+			ID uint `uri:"id" binding:"required"`
+		}
+		if err := c.ShouldBindUri(&uriParam); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		var req struct {
+			UserID  int    `json:"user_id"`
+			Content string `json:"content" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		comment := model.AlertComment{AlertID: uriParam.ID, UserID: req.UserID, Content: req.Content}
+		if err := data.AddAlertComment(&comment); err != nil {
+			alertLifecycleError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{"ok": true, "comment": comment})
+	})
+
+	// 查询告警处理记录（状态流转与指派）
+	alerts.GET("/:id/history", func(c *gin.Context) {
+		var uriParam struct {
+			ID uint `uri:"id" binding:"required"`
+		}
+		if err := c.ShouldBindUri(&uriParam); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		history, err := data.ListAlertHistory(uriParam.ID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"items": history, "total": len(history)})
+	})
+}
+
+// alertLifecycleError 按错误类型返回告警处理接口的状态码
+func alertLifecycleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(404, gin.H{"error": "alert not found"})
+	case errors.Is(err, data.ErrInvalidAlertStatus), errors.Is(err, data.ErrUserNotFound):
+		c.JSON(400, gin.H{"error": err.Error()})
+	case errors.Is(err, data.ErrInvalidTransition):
+		c.JSON(409, gin.H{"error": err.Error()})
+	default:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"bytes"
+	"easydarwin/internal/conf"
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"easydarwin/internal/plugin/aianalysis"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerAlgorithmAuthAPI 注册算法厂商应用任务类型及注册审计相关API（启用鉴权时需要系统管理员账户）
+// 应用凭证即开发者账户，通过 /api/v1/users/apps 管理
+func registerAlgorithmAuthAPI(g gin.IRouter) {
+	// 获取各应用允许注册的任务类型（没有记录的应用不限制）
+	g.GET("/app_scopes", func(c *gin.Context) {
+		if _, ok := requireAlgorithmAdmin(c); !ok {
+			return
+		}
+		list, err := data.ListAlgorithmAppScopes()
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"items": list, "total": len(list)})
+	})
+
+	// 设置应用允许注册的任务类型，task_types 为空时不限制（已注册的服务不受影响）
+	g.PUT("/app_scopes/:app_id", func(c *gin.Context) {
+		auth, ok := requireAlgorithmAdmin(c)
+		if !ok {
+			return
+		}
+		var in struct {
+			TaskTypes []string `json:"task_types"`
+		}
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		appID := c.Param("app_id")
+		if !auth.AppExists(appID) {
+			c.JSON(404, gin.H{"error": "app not found"})
+			return
+		}
+		scope := model.AlgorithmAppScope{AppID: appID, TaskTypes: in.TaskTypes}
+		if err := data.SaveAlgorithmAppScope(&scope); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true, "scope": scope})
+	})
+
+	// 查询注册审计记录：?app_id=&service_id=&page=1&page_size=20
+	g.GET("/audits", func(c *gin.Context) {
+		if _, ok := requireAlgorithmAdmin(c); !ok {
+			return
+		}
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+		items, total, err := data.ListAlgorithmAudits(c.Query("app_id"), c.Query("service_id"), page, pageSize)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"items": items, "total": total})
+	})
+}
+
+// algorithmAuthFailed 按鉴权错误类型返回 401/403，其他错误返回 500
+func algorithmAuthFailed(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, aianalysis.ErrAlgorithmForbidden):
+		c.JSON(403, gin.H{"error": err.Error()})
+	case errors.Is(err, aianalysis.ErrAlgorithmUnauthorized):
+		c.JSON(401, gin.H{"error": err.Error()})
+	default:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
+
+// getAlgorithmAuth 获取注册鉴权，服务未启动时已写入响应
+func getAlgorithmAuth(c *gin.Context) (*aianalysis.AlgorithmAuth, bool) {
+	srv := aianalysis.GetGlobal()
+	if srv == nil || srv.GetAlgorithmAuth() == nil {
+		c.JSON(500, gin.H{"error": "AI analysis service not ready"})
+		return nil, false
+	}
+	return srv.GetAlgorithmAuth(), true
+}
+
+// checkAlgorithmAdmin 校验 HTTP Basic 系统管理员账户，失败时已写入响应
+func checkAlgorithmAdmin(c *gin.Context, auth *aianalysis.AlgorithmAuth) (string, bool) {
+	username, password, _ := c.Request.BasicAuth()
+	admin, err := auth.AuthenticateAdmin(username, password)
+	if err != nil {
+		algorithmAuthFailed(c, err)
+		return "", false
+	}
+	// 设置操作用户，user.Core 管理开发者账户时据此校验权限（web.GetUID）
+	c.Set("uid", admin.ID)
+	return admin.Username, true
+}
+
+// requireAlgorithmAdmin 启用鉴权时校验系统管理员账户，失败时已写入响应
+func requireAlgorithmAdmin(c *gin.Context) (*aianalysis.AlgorithmAuth, bool) {
+	auth, ok := getAlgorithmAuth(c)
+	if !ok {
+		return nil, false
+	}
+	if !auth.Enabled() {
+		return auth, true
+	}
+	if _, ok := checkAlgorithmAdmin(c, auth); !ok {
+		return nil, false
+	}
+	return auth, true
+}
+
+// requireAppAdmin 管理开发者账户（签发、重置、删除算法厂商应用凭证）始终需要系统管理员账户
+func requireAppAdmin(c *gin.Context) {
+	auth, ok := getAlgorithmAuth(c)
+	if !ok {
+		c.Abort()
+		return
+	}
+	if _, ok := checkAlgorithmAdmin(c, auth); !ok {
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// authorizeAlgorithmRegister 校验注册凭证（HTTP Basic：app_id + secret）及权限，并填写服务的 app_id；
+// 未启用鉴权时清空 app_id。失败时已写入响应和审计
+func authorizeAlgorithmRegister(c *gin.Context, auth *aianalysis.AlgorithmAuth, registry *aianalysis.AlgorithmRegistry, service *conf.AlgorithmService) bool {
+	if !auth.Enabled() {
+		service.AppID = ""
+		return true
+	}
+
+	appID, secret, _ := c.Request.BasicAuth()
+	scope, err := auth.Authenticate(appID, secret)
+	if err == nil {
+		err = auth.AuthorizeRegister(scope, *service, registry.ListAllServiceInstances())
+	}
+	if err != nil {
+		service.AppID = appID
+		auditAlgorithm(c, auth, "register", *service, err)
+		algorithmAuthFailed(c, err)
+		return false
+	}
+	service.AppID = scope.AppID
+	return true
+}
+
+// matchAlgorithmServices 按 service_id 或 endpoint 查找已注册的服务实例
+func matchAlgorithmServices(registry *aianalysis.AlgorithmRegistry, id string) []conf.AlgorithmService {
+	var matched []conf.AlgorithmService
+	for _, svc := range registry.ListAllServiceInstances() {
+		if svc.ServiceID == id || svc.Endpoint == id {
+			matched = append(matched, svc)
+		}
+	}
+	return matched
+}
+
+// verifyAlgorithmRequest 校验心跳/注销请求签名（注销也可使用系统管理员账户），失败时已写入响应。
+// 未启用鉴权时不校验；读取的请求体会放回，后续仍可解析
+func verifyAlgorithmRequest(c *gin.Context, auth *aianalysis.AlgorithmAuth, services []conf.AlgorithmService, allowAdmin bool) bool {
+	if !auth.Enabled() {
+		return true
+	}
+	if _, _, ok := c.Request.BasicAuth(); ok && allowAdmin {
+		_, ok := checkAlgorithmAdmin(c, auth)
+		return ok
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := auth.VerifyRequest(services, c.Request.Method, c.Request.URL.Path,
+		c.GetHeader(aianalysis.HeaderAlgorithmTimestamp), c.GetHeader(aianalysis.HeaderAlgorithmSignature), body); err != nil {
+		algorithmAuthFailed(c, err)
+		return false
+	}
+	return true
+}
+
+// auditAlgorithm 记录注册/注销审计
+func auditAlgorithm(c *gin.Context, auth *aianalysis.AlgorithmAuth, action string, svc conf.AlgorithmService, err error) {
+	if auth == nil {
+		return
+	}
+	audit := model.AlgorithmAudit{
+		Action:     action,
+		Success:    err == nil,
+		AppID:      svc.AppID,
+		ServiceID:  svc.ServiceID,
+		Endpoint:   svc.Endpoint,
+		TaskTypes:  svc.TaskTypes,
+		RemoteAddr: c.ClientIP(),
+	}
+	if err != nil {
+		audit.Detail = err.Error()
+	}
+	auth.Audit(audit)
+}
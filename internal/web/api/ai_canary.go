@@ -0,0 +1,138 @@
+package api
+
+import (
+	"easydarwin/internal/conf"
+	"easydarwin/internal/plugin/aianalysis"
+	"errors"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerCanaryAPI 注册算法灰度发布相关API（运行时生效，不写回配置文件）
+func registerCanaryAPI(ai gin.IRouter) {
+	canary := ai.Group("/canary")
+
+	// 获取所有任务类型的灰度发布状态
+	canary.GET("", func(c *gin.Context) {
+		srv := canaryService(c)
+		if srv == nil {
+			return
+		}
+		list := srv.GetRegistry().GetCanaries()
+		c.JSON(200, gin.H{"items": list, "total": len(list)})
+	})
+
+	// 获取任务类型的灰度发布状态及各版本统计（未配置灰度时 canary 为 null，仍返回版本统计）
+	canary.GET("/:task_type", func(c *gin.Context) {
+		srv := canaryService(c)
+		if srv == nil {
+			return
+		}
+		taskType := c.Param("task_type")
+		versions, err := srv.GetVersionStats(taskType)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		var status *aianalysis.CanaryStatus
+		if s, ok := srv.GetRegistry().GetCanary(taskType); ok {
+			status = &s
+		}
+		c.JSON(200, gin.H{"canary": status, "versions": versions})
+	})
+
+	// 设置任务类型的灰度规则（覆盖已有规则），reset_stats 为 true 时清空该任务类型的版本统计
+	canary.PUT("/:task_type", func(c *gin.Context) {
+		srv := canaryService(c)
+		if srv == nil {
+			return
+		}
+		var req struct {
+			conf.CanaryRule
+			ResetStats bool `json:"reset_stats"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		taskType := c.Param("task_type")
+		registry := srv.GetRegistry()
+		status, err := registry.SetCanary(taskType, req.CanaryRule)
+		if errors.Is(err, aianalysis.ErrCanaryStore) {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if req.ResetStats {
+			registry.ResetVersionStats(taskType)
+		}
+		c.JSON(200, gin.H{"ok": true, "canary": status})
+	})
+
+	// 全量发布灰度版本
+	canary.POST("/:task_type/promote", func(c *gin.Context) {
+		canaryTransition(c, (*aianalysis.AlgorithmRegistry).PromoteCanary)
+	})
+
+	// 回滚灰度版本
+	canary.POST("/:task_type/rollback", func(c *gin.Context) {
+		canaryTransition(c, (*aianalysis.AlgorithmRegistry).RollbackCanary)
+	})
+
+	// 删除灰度规则，所有版本重新共同分担流量
+	canary.DELETE("/:task_type", func(c *gin.Context) {
+		srv := canaryService(c)
+		if srv == nil {
+			return
+		}
+		err := srv.GetRegistry().RemoveCanary(c.Param("task_type"))
+		if errors.Is(err, aianalysis.ErrCanaryNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+}
+
+// canaryTransition 执行全量/回滚并返回新的灰度状态
+func canaryTransition(c *gin.Context, transition func(*aianalysis.AlgorithmRegistry, string) (aianalysis.CanaryStatus, error)) {
+	srv := canaryService(c)
+	if srv == nil {
+		return
+	}
+	status, err := transition(srv.GetRegistry(), c.Param("task_type"))
+	if errors.Is(err, aianalysis.ErrCanaryNotFound) {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.Warn("algorithm canary state changed",
+		slog.String("task_type", status.TaskType),
+		slog.String("version", status.Version),
+		slog.String("state", status.State),
+		slog.String("remote_addr", c.ClientIP()))
+	c.JSON(200, gin.H{"ok": true, "canary": status})
+}
+
+// canaryService 获取智能分析服务（注册中心未就绪时已写入响应）
+func canaryService(c *gin.Context) *aianalysis.Service {
+	srv := aianalysis.GetGlobal()
+	if srv == nil || srv.GetRegistry() == nil {
+		c.JSON(500, gin.H{"error": "AI analysis service not ready"})
+		return nil
+	}
+	return srv
+}
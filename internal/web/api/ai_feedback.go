@@ -0,0 +1,175 @@
+package api
+
+import (
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"easydarwin/internal/plugin/aianalysis"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// registerAlertFeedbackAPI 注册告警复核相关API（复核人通过请求中的 user_id 指定）
+func registerAlertFeedbackAPI(alerts gin.IRouter) {
+	// 提交复核结果：告警是否正确，可附带修正后的目标（重复提交时覆盖）
+	alerts.POST("/:id/feedback", func(c *gin.Context) {
+		var uriParam struct {
+			ID uint `uri:"id" binding:"required"`
+		}
+		if err := c.ShouldBindUri(&uriParam); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		var req struct {
+			Correct *bool                 `json:"correct" binding:"required"`
+			Labels  []model.FeedbackLabel `json:"labels"`
+			UserID  int                   `json:"user_id"`
+			Note    string                `json:"note"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		for i, l := range req.Labels {
+			if l.Class == "" {
+				c.JSON(400, gin.H{"error": fmt.Sprintf("labels[%d]: class is required", i)})
+				return
+			}
+			if l.BBox[2] <= l.BBox[0] || l.BBox[3] <= l.BBox[1] {
+				c.JSON(400, gin.H{"error": fmt.Sprintf("labels[%d]: bbox must be [x1, y1, x2, y2] with x2 > x1 and y2 > y1", i)})
+				return
+			}
+		}
+
+		feedback := model.AlertFeedback{
+			AlertID: uriParam.ID,
+			Correct: *req.Correct,
+			Labels:  req.Labels,
+			UserID:  req.UserID,
+			Note:    req.Note,
+		}
+		if err := data.SaveAlertFeedback(&feedback); err != nil {
+			alertLifecycleError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{"ok": true, "feedback": feedback})
+	})
+
+	// 查询复核结果
+	alerts.GET("/:id/feedback", func(c *gin.Context) {
+		var uriParam struct {
+			ID uint `uri:"id" binding:"required"`
+		}
+		if err := c.ShouldBindUri(&uriParam); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		feedback, err := data.GetAlertFeedback(uriParam.ID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "feedback not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, feedback)
+	})
+}
+
+// registerDatasetAPI 注册复核统计及训练数据导出相关API
+func registerDatasetAPI(ai gin.IRouter) {
+	// 按算法及版本统计复核结果
+	ai.GET("/feedback/stats", func(c *gin.Context) {
+		stats, err := data.GetFeedbackStats(c.Query("task_type"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"items": stats, "total": len(stats)})
+	})
+
+	// 创建训练数据导出任务
+	ai.POST("/datasets/export", func(c *gin.Context) {
+		exporter := datasetExporter(c)
+		if exporter == nil {
+			return
+		}
+		var req aianalysis.DatasetExportRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		job, err := exporter.Submit(req)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, job)
+	})
+
+	// 查询导出任务列表
+	ai.GET("/datasets/export", func(c *gin.Context) {
+		exporter := datasetExporter(c)
+		if exporter == nil {
+			return
+		}
+		jobs := exporter.ListJobs()
+		c.JSON(200, gin.H{"items": jobs, "total": len(jobs)})
+	})
+
+	// 查询导出任务进度
+	ai.GET("/datasets/export/:id", func(c *gin.Context) {
+		exporter := datasetExporter(c)
+		if exporter == nil {
+			return
+		}
+		job, err := exporter.GetJob(c.Param("id"))
+		if err != nil {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, job)
+	})
+
+	// 下载导出的ZIP文件
+	ai.GET("/datasets/export/:id/download", func(c *gin.Context) {
+		exporter := datasetExporter(c)
+		if exporter == nil {
+			return
+		}
+		job, err := exporter.GetJob(c.Param("id"))
+		if err != nil {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		if job.Request.Output != aianalysis.DatasetOutputZip {
+			c.JSON(400, gin.H{"error": "dataset was exported to minio prefix " + job.Output})
+			return
+		}
+		if job.Status != aianalysis.DatasetJobDone {
+			c.JSON(409, gin.H{"error": "dataset export is " + job.Status})
+			return
+		}
+		if _, err := os.Stat(job.Output); err != nil {
+			c.JSON(404, gin.H{"error": "dataset file not found"})
+			return
+		}
+		c.FileAttachment(job.Output, "dataset-"+job.ID+".zip")
+	})
+}
+
+// datasetExporter 获取训练数据导出器，服务未启动时返回错误响应
+func datasetExporter(c *gin.Context) *aianalysis.DatasetExporter {
+	srv := aianalysis.GetGlobal()
+	if srv == nil || srv.GetDatasetExporter() == nil {
+		c.JSON(500, gin.H{"error": "AI analysis service not ready"})
+		return nil
+	}
+	return srv.GetDatasetExporter()
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"easydarwin/internal/plugin/aianalysis"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerShadowAPI 注册影子推理对比相关API，均支持 task_id/task_type/shadow_id/shadow_version/start_time/end_time 筛选
+func registerShadowAPI(ai gin.IRouter) {
+	shadow := ai.Group("/shadow")
+
+	// 对比记录列表（按时间倒序），disagreement=true 只返回不一致的记录
+	shadow.GET("/comparisons", func(c *gin.Context) {
+		var filter model.ShadowComparisonFilter
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+		items, total, err := data.ListShadowComparisons(filter, page, pageSize)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"items": items, "total": total})
+	})
+
+	// 一致性统计：总体指标，指定 interval=hour|day|week 时同时返回按时间的变化（tz 为时区，默认服务器时区）
+	shadow.GET("/agreement", func(c *gin.Context) {
+		var filter model.ShadowComparisonFilter
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		summary, err := data.GetShadowAgreement(filter)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		resp := gin.H{"summary": summary}
+
+		if interval := c.Query("interval"); interval != "" {
+			loc := time.Local
+			if tz := c.Query("tz"); tz != "" {
+				l, err := time.LoadLocation(tz)
+				if err != nil {
+					c.JSON(400, gin.H{"error": "invalid tz: " + err.Error()})
+					return
+				}
+				loc = l
+			}
+			buckets, err := data.ShadowAgreementByTime(filter, interval, loc)
+			if err != nil {
+				alertStatsError(c, err)
+				return
+			}
+			resp["interval"] = interval
+			resp["items"] = buckets
+		}
+
+		// 影子推理队列满被跳过的采样数（未启用影子推理时不返回）
+		if srv := aianalysis.GetGlobal(); srv != nil {
+			if evaluator := srv.GetShadowEvaluator(); evaluator != nil {
+				resp["dropped"] = evaluator.Dropped()
+			}
+		}
+		c.JSON(200, resp)
+	})
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerAlertStatsAPI 注册告警统计相关API，均支持 task_id/task_type/algorithm_id/status/start_time/end_time 筛选
+func registerAlertStatsAPI(alerts gin.IRouter) {
+	stats := alerts.Group("/stats")
+
+	// 总体统计：告警数、任务数、平均/最高置信度、平均检测个数
+	stats.GET("/summary", func(c *gin.Context) {
+		var filter model.AlertStatsFilter
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		summary, err := data.GetAlertStatsSummary(filter)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, summary)
+	})
+
+	// 按时间统计：interval=hour|day|week（默认day），tz 为时区（如 Asia/Shanghai，默认服务器时区）
+	stats.GET("/timeline", func(c *gin.Context) {
+		var filter model.AlertStatsFilter
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		loc := time.Local
+		if tz := c.Query("tz"); tz != "" {
+			l, err := time.LoadLocation(tz)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "invalid tz: " + err.Error()})
+				return
+			}
+			loc = l
+		}
+
+		interval := c.DefaultQuery("interval", model.StatsIntervalDay)
+		buckets, err := data.CountAlertsByTime(filter, interval, loc)
+		if err != nil {
+			alertStatsError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{"interval": interval, "items": buckets})
+	})
+
+	// 分组统计：by=task_id|task_type|algorithm_id|class|status，按告警数倒序取前 limit 个（by=task_id 即告警最多的摄像头）
+	stats.GET("/group", func(c *gin.Context) {
+		var filter model.AlertStatsFilter
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		limit, _ := strconv.Atoi(c.Query("limit"))
+
+		groupBy := c.DefaultQuery("by", model.StatsGroupTask)
+		groups, err := data.CountAlertsByGroup(filter, groupBy, limit)
+		if err != nil {
+			alertStatsError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{"by": groupBy, "items": groups})
+	})
+
+	// 检测个数分布：max 为最后一档的检测个数（默认10）
+	stats.GET("/detections", func(c *gin.Context) {
+		var filter model.AlertStatsFilter
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		maxCount, _ := strconv.Atoi(c.Query("max"))
+
+		histogram, err := data.DetectionHistogram(filter, maxCount)
+		if err != nil {
+			alertStatsError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{"items": histogram})
+	})
+}
+
+// alertStatsError 参数错误返回400，其余返回500
+func alertStatsError(c *gin.Context, err error) {
+	if errors.Is(err, data.ErrInvalidStatsParam) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(500, gin.H{"error": err.Error()})
+}
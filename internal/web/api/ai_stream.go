@@ -0,0 +1,72 @@
+package api
+
+import (
+	"easydarwin/internal/plugin/aianalysis"
+	"easydarwin/utils/plugin/core/msgpush/msgpushapi"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerAlertStreamAPI 注册告警实时推送API（SSE/WebSocket），按连接过滤：
+// events=alert,system_alert task_ids=a,b task_types=x,y min_detections=N
+func registerAlertStreamAPI(alerts gin.IRouter) {
+	// SSE 推送，断线重连时浏览器自动携带 Last-Event-ID 续传
+	alerts.GET("/stream", func(c *gin.Context) {
+		srv := aianalysis.GetGlobal()
+		if srv == nil || srv.GetAlertPush() == nil {
+			c.JSON(500, gin.H{"error": "AI analysis service not ready"})
+			return
+		}
+		filter, err := alertStreamFilter(c)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		msgpushapi.ServeSSE(c, srv.GetAlertPush(), filter.Match)
+	})
+
+	// WebSocket 推送，重连时通过 last_event_id 参数续传；只接受同源及 allowed_origins 中的来源
+	alerts.GET("/ws", func(c *gin.Context) {
+		srv := aianalysis.GetGlobal()
+		if srv == nil || srv.GetAlertPush() == nil {
+			c.JSON(500, gin.H{"error": "AI analysis service not ready"})
+			return
+		}
+		filter, err := alertStreamFilter(c)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		msgpushapi.ServeWebSocket(c, srv.GetAlertPush(), filter.Match, srv.GetAlertPushOrigins())
+	})
+}
+
+// alertStreamFilter 从请求参数解析推送过滤条件
+func alertStreamFilter(c *gin.Context) (aianalysis.AlertStreamFilter, error) {
+	filter := aianalysis.AlertStreamFilter{
+		Events:    splitQuery(c.Query("events")),
+		TaskIDs:   splitQuery(c.Query("task_ids")),
+		TaskTypes: splitQuery(c.Query("task_types")),
+	}
+	if v := c.Query("min_detections"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, err
+		}
+		filter.MinDetections = n
+	}
+	return filter, nil
+}
+
+// splitQuery 拆分逗号分隔的参数，忽略空值
+func splitQuery(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"easydarwin/internal/data"
+	"easydarwin/internal/data/model"
+	"easydarwin/internal/plugin/aianalysis"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerWebhookAPI 注册告警回调（webhook）相关API
+func registerWebhookAPI(g gin.IRouter) {
+	hooks := g.Group("/webhooks")
+
+	// 获取回调目标列表
+	hooks.GET("", func(c *gin.Context) {
+		list, err := data.ListWebhooks()
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		for i := range list {
+			hideWebhookSecret(&list[i])
+		}
+		c.JSON(200, gin.H{"items": list, "total": len(list)})
+	})
+
+	// 获取回调目标详情
+	hooks.GET("/:id", func(c *gin.Context) {
+		var uriParam struct {
+			ID uint `uri:"id" binding:"required"`
+		}
+		if err := c.ShouldBindUri(&uriParam); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		hook, err := data.GetWebhook(uriParam.ID)
+		if err != nil {
+			c.JSON(404, gin.H{"error": "webhook not found"})
+			return
+		}
+		hideWebhookSecret(hook)
+		c.JSON(200, gin.H{"webhook": hook})
+	})
+
+	// 创建回调目标（enabled 默认为 true）
+	hooks.POST("", func(c *gin.Context) {
+		hook := model.Webhook{Enabled: true}
+		if err := c.ShouldBindJSON(&hook); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		hook.ID = 0
+		if err := aianalysis.ValidateWebhook(&hook); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := data.CreateWebhook(&hook); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		reloadWebhooks()
+		hideWebhookSecret(&hook)
+		c.JSON(200, gin.H{"ok": true, "webhook": hook})
+	})
+
+	// 更新回调目标（整条覆盖，secret 为空时保留原密钥，clear_secret 为 true 时清除密钥）
+	hooks.PUT("/:id", func(c *gin.Context) {
+		var uriParam struct {
+			ID uint `uri:"id" binding:"required"`
+		}
+		if err := c.ShouldBindUri(&uriParam); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		existing, err := data.GetWebhook(uriParam.ID)
+		if err != nil {
+			c.JSON(404, gin.H{"error": "webhook not found"})
+			return
+		}
+
+		req := struct {
+			model.Webhook
+			ClearSecret bool `json:"clear_secret"` // 清除密钥，之后的推送不再签名
+		}{Webhook: model.Webhook{Enabled: true}}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		hook := req.Webhook
+		if req.ClearSecret && hook.Secret != "" {
+			c.JSON(400, gin.H{"error": "secret and clear_secret cannot be set together"})
+			return
+		}
+		hook.ID = existing.ID
+		hook.CreatedAt = existing.CreatedAt
+		if hook.Secret == "" && !req.ClearSecret {
+			hook.Secret = existing.Secret
+		}
+		if err := aianalysis.ValidateWebhook(&hook); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := data.UpdateWebhook(&hook); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		reloadWebhooks()
+		hideWebhookSecret(&hook)
+		c.JSON(200, gin.H{"ok": true, "webhook": hook})
+	})
+
+	// 删除回调目标（同时删除投递记录）
+	hooks.DELETE("/:id", func(c *gin.Context) {
+		var uriParam struct {
+			ID uint `uri:"id" binding:"required"`
+		}
+		if err := c.ShouldBindUri(&uriParam); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := data.DeleteWebhook(uriParam.ID); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		reloadWebhooks()
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	// 查询投递记录（按时间倒序），可按 alert_id 筛选
+	hooks.GET("/:id/deliveries", func(c *gin.Context) {
+		var uriParam struct {
+			ID uint `uri:"id" binding:"required"`
+		}
+		if err := c.ShouldBindUri(&uriParam); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		alertID, _ := strconv.ParseUint(c.Query("alert_id"), 10, 64)
+		page, _ := strconv.Atoi(c.Query("page"))
+		pageSize, _ := strconv.Atoi(c.Query("page_size"))
+
+		list, total, err := data.ListWebhookDeliveries(uriParam.ID, uint(alertID), page, pageSize)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"items": list, "total": total})
+	})
+
+	// 发送测试：用示例告警同步推送一次（不重试，不受 enabled 和筛选条件限制）
+	hooks.POST("/:id/test", func(c *gin.Context) {
+		var uriParam struct {
+			ID uint `uri:"id" binding:"required"`
+		}
+		if err := c.ShouldBindUri(&uriParam); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		srv := aianalysis.GetGlobal()
+		if srv == nil || srv.GetWebhookNotifier() == nil {
+			c.JSON(500, gin.H{"error": "AI analysis service not ready"})
+			return
+		}
+
+		hook, err := data.GetWebhook(uriParam.ID)
+		if err != nil {
+			c.JSON(404, gin.H{"error": "webhook not found"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+		delivery, err := srv.GetWebhookNotifier().SendTest(ctx, *hook)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": delivery.Success, "delivery": delivery})
+	})
+}
+
+// hideWebhookSecret 查询时不返回密钥，只返回是否已设置
+func hideWebhookSecret(hook *model.Webhook) {
+	hook.SecretSet = hook.Secret != ""
+	hook.Secret = ""
+}
+
+// reloadWebhooks 回调目标修改后通知推理服务重新加载
+func reloadWebhooks() {
+	srv := aianalysis.GetGlobal()
+	if srv == nil {
+		return
+	}
+	if err := srv.ReloadWebhooks(); err != nil {
+		slog.Error("failed to reload webhooks", slog.String("err", err.Error()))
+	}
+}
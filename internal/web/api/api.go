@@ -14,11 +14,13 @@ import (
     "easydarwin/internal/plugin/frameextractor"
 	"easydarwin/internal/gutils/consts"
 	"easydarwin/utils/pkg/web"
+	"easydarwin/utils/plugin/core/user/userapi"
 	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
 	"log/slog"
 	"net/http"
 	"runtime/debug"
+	"strings"
 )
 
 var gCfg *conf.Bootstrap
@@ -61,6 +63,8 @@ func registerApp(g gin.IRouter) {
 
 	users := g.Group("/users")
 	users.PUT("/:username/reset-password", l.resetPassword)
+	// 开发者账户（算法厂商应用凭证），需要系统管理员账户
+	userapi.RegisterApps(users, data.NewAppCore(slog.Default()), requireAppAdmin)
 	
 	// AI analysis and alerts
 	registerAIAnalysisAPI(g)
@@ -68,14 +72,14 @@ func registerApp(g gin.IRouter) {
 
 	// frame extractor manage
 	fem := g.Group("/frame_extractor")
-	// get config
+	// get config (minio secret_key and local sign_secret are redacted)
 	fem.GET("/config", func(c *gin.Context) {
 		fx := frameextractor.GetGlobal()
 		if fx == nil {
 			c.JSON(500, gin.H{"error": "service not ready"})
 			return
 		}
-		cfg := fx.GetConfig()
+		cfg := fx.GetRedactedConfig()
 		slog.Info("returning config", 
 			slog.Bool("enable", cfg.Enable),
 			slog.String("store", cfg.Store),
@@ -84,6 +88,15 @@ func registerApp(g gin.IRouter) {
 			slog.String("minio_bucket", cfg.MinIO.Bucket))
 		c.JSON(200, cfg)
 	})
+	// 本地存储的签名URL（store=local 时算法服务通过此地址下载图片）
+	fem.GET("/objects/*key", func(c *gin.Context) {
+		fx := frameextractor.GetGlobal()
+		if fx == nil || fx.LocalStore() == nil {
+			c.JSON(404, gin.H{"error": "local store not enabled"})
+			return
+		}
+		fx.LocalStore().ServeObject(c.Writer, c.Request, strings.TrimPrefix(c.Param("key"), "/"))
+	})
 	// get task types
 	fem.GET("/task_types", func(c *gin.Context) {
 		fx := frameextractor.GetGlobal()
@@ -332,7 +345,99 @@ func registerApp(g gin.IRouter) {
 			return
 		}
 		running := fx.GetTaskStatus(id)
-		c.JSON(200, gin.H{"running": running})
+		arming, err := fx.GetArmingState(id)
+		if err != nil {
+			c.JSON(200, gin.H{"running": running})
+			return
+		}
+		c.JSON(200, gin.H{"running": running, "arming": arming})
+	})
+	// get task arming schedule and effective state
+	fem.GET("/tasks/:id/arming", func(c *gin.Context) {
+		id := c.Param("id")
+		fx := frameextractor.GetGlobal()
+		if fx == nil {
+			c.JSON(500, gin.H{"error": "service not ready"})
+			return
+		}
+		task := fx.GetTaskByID(id)
+		if task == nil {
+			c.JSON(404, gin.H{"error": "task not found"})
+			return
+		}
+		state, _ := fx.GetArmingState(id)
+		c.JSON(200, gin.H{"arming": task.Arming, "arm_override": task.ArmOverride, "state": state})
+	})
+	// update task arming schedule (null clears the schedule)
+	fem.PUT("/tasks/:id/arming", func(c *gin.Context) {
+		id := c.Param("id")
+		var req *conf.ArmingSchedule
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		fx := frameextractor.GetGlobal()
+		if fx == nil {
+			c.JSON(500, gin.H{"error": "service not ready"})
+			return
+		}
+		if err := fx.UpdateTaskArming(id, req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		state, _ := fx.GetArmingState(id)
+		c.JSON(200, gin.H{"ok": true, "state": state})
+	})
+	// manual arm/disarm, optionally until a time or for a duration
+	armOverride := func(armed bool) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			id := c.Param("id")
+			var req struct {
+				Until       string `json:"until"`        // 到期时间（RFC3339）
+				DurationMin int    `json:"duration_min"` // 持续分钟数，与 until 二选一，都为空表示直到取消
+			}
+			if c.Request.ContentLength > 0 {
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.JSON(400, gin.H{"error": err.Error()})
+					return
+				}
+			}
+			if req.DurationMin < 0 {
+				c.JSON(400, gin.H{"error": "duration_min must not be negative"})
+				return
+			}
+			if req.Until == "" && req.DurationMin > 0 {
+				req.Until = time.Now().Add(time.Duration(req.DurationMin) * time.Minute).Format(time.RFC3339)
+			}
+			fx := frameextractor.GetGlobal()
+			if fx == nil {
+				c.JSON(500, gin.H{"error": "service not ready"})
+				return
+			}
+			if err := fx.SetArmOverride(id, &conf.ArmOverride{Armed: armed, Until: req.Until}); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			state, _ := fx.GetArmingState(id)
+			c.JSON(200, gin.H{"ok": true, "state": state})
+		}
+	}
+	fem.POST("/tasks/:id/arm", armOverride(true))
+	fem.POST("/tasks/:id/disarm", armOverride(false))
+	// clear manual arm/disarm, back to the arming schedule
+	fem.DELETE("/tasks/:id/arm_override", func(c *gin.Context) {
+		id := c.Param("id")
+		fx := frameextractor.GetGlobal()
+		if fx == nil {
+			c.JSON(500, gin.H{"error": "service not ready"})
+			return
+		}
+		if err := fx.SetArmOverride(id, nil); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		state, _ := fx.GetArmingState(id)
+		c.JSON(200, gin.H{"ok": true, "state": state})
 	})
 	// get preview image
 	fem.GET("/tasks/:id/preview", func(c *gin.Context) {
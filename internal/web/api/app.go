@@ -21,7 +21,7 @@ type login struct {
 
 func (l login) Login(c *gin.Context, input *user.LoginInput) (*data.User, error) {
 	var u data.User
-	if err := l.database.Where("username=?", input.Username).First(&u).Error; err != nil {
+	if err := l.database.Scopes(data.ExcludeDevelopers).Where("username=?", input.Username).First(&u).Error; err != nil {
 		if errors.Is(err, orm.ErrRevordNotFound) {
 			return nil, web.ErrNameOrPasswd.With("账号不存在")
 		} else {
@@ -99,7 +99,7 @@ func ResetPassword(username string, password, newPassword string) error {
 	// 获取操作用户信息
 	{
 		// 根据操作用户ID获取用户信息
-		if err := data.GetDatabase().Model(data.User{}).Where("username=?", username).First(&hUser).Error; err != nil {
+		if err := data.GetDatabase().Model(data.User{}).Scopes(data.ExcludeDevelopers).Where("username=?", username).First(&hUser).Error; err != nil {
 			return web.ErrDB.Msg("用户不存在").Withf("err[%s] := c.Store.GetUserByID(&hUser, handleUID)", err)
 		}
 		// 判断操作用户密码是否正确
@@ -42,8 +42,12 @@ func NewUserCore(db *gorm.DB) {
 	// 初始化用户
 	var u data.User
 	db.AutoMigrate(&data.User{})
+	// 开发者账户（算法厂商应用）与登录用户共用 users 表
+	if err := data.MigrateDeveloperAccounts(); err != nil {
+		slog.Error("MigrateDeveloperAccounts", "err", err)
+	}
 
-	if err := db.Where("username=?", "admin").First(&u).Error; err != nil {
+	if err := db.Scopes(data.ExcludeDevelopers).Where("username=?", "admin").First(&u).Error; err != nil {
 		slog.Info("初始化数据库用户表结构")
 		if err := initUser("admin", "admin"); err != nil {
 			slog.Error("initUser", "err", err)
@@ -0,0 +1,502 @@
+package objstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// tempPrefix 写入过程中的临时文件前缀，列举和事件中都会跳过
+const tempPrefix = ".objstore-"
+
+// defaultSettle 文件最后一次写入后多久视为写入完成
+const defaultSettle = 500 * time.Millisecond
+
+// LocalOptions 本地存储选项
+type LocalOptions struct {
+	// BaseURL 签名URL的前缀（内置HTTP服务对外地址 + 路由），如 http://192.168.1.10:10086/api/v1/frame_extractor/objects
+	BaseURL string
+	// Secret 签名密钥，为空时随机生成（重启后之前签发的URL失效）
+	Secret string
+	// Settle 文件最后一次写入后多久发出创建事件，默认 500ms
+	Settle time.Duration
+}
+
+// Local 基于本地磁盘的对象存储，对象 key 即相对根目录的路径
+type Local struct {
+	root    string
+	baseURL string
+	secret  []byte
+	settle  time.Duration
+}
+
+var _ Store = (*Local)(nil)
+
+// NewLocal 创建本地对象存储
+func NewLocal(root string, opts LocalOptions) (*Local, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(abs, 0o755); err != nil {
+		return nil, err
+	}
+	secret := []byte(opts.Secret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	settle := opts.Settle
+	if settle <= 0 {
+		settle = defaultSettle
+	}
+	return &Local{
+		root:    abs,
+		baseURL: strings.TrimRight(opts.BaseURL, "/"),
+		secret:  secret,
+		settle:  settle,
+	}, nil
+}
+
+// Root 存储根目录
+func (l *Local) Root() string { return l.root }
+
+func (l *Local) Name() string { return "local" }
+
+// filePath key 对应的文件路径，拒绝跳出根目录的 key
+func (l *Local) filePath(key string) (string, error) {
+	clean := path.Clean("/" + filepath.ToSlash(key))
+	if clean == "/" {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(clean)), nil
+}
+
+// key 文件路径对应的 key
+func (l *Local) key(p string) string {
+	rel, err := filepath.Rel(l.root, p)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (l *Local) Put(_ context.Context, key string, r io.Reader, size int64, _ string) error {
+	p, err := l.filePath(key)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	// 先写临时文件再改名，保证读取方和事件监听方看到的都是完整文件
+	f, err := os.CreateTemp(dir, tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if size >= 0 {
+		r = io.LimitReader(r, size)
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, p)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func (l *Local) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	p, err := l.filePath(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if fi, err := f.Stat(); err != nil || fi.IsDir() {
+		f.Close()
+		return nil, ErrNotFound
+	}
+	return f, nil
+}
+
+func (l *Local) Stat(_ context.Context, key string) (ObjectInfo, error) {
+	p, err := l.filePath(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		return ObjectInfo{}, notFound(err)
+	}
+	if fi.IsDir() {
+		return ObjectInfo{}, ErrNotFound
+	}
+	return l.info(key, fi), nil
+}
+
+func (l *Local) info(key string, fi fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          key,
+		Size:         fi.Size(),
+		LastModified: fi.ModTime(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+	}
+}
+
+// List 按前缀列举，非递归时子目录以 "dir/" 形式返回（与 S3 公共前缀一致）
+func (l *Local) List(ctx context.Context, prefix string, recursive bool) <-chan ObjectInfo {
+	out := make(chan ObjectInfo)
+	go func() {
+		defer close(out)
+		send := func(info ObjectInfo) bool {
+			select {
+			case out <- info:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		// 从前缀中最后一个 "/" 之前的目录开始遍历
+		start := l.root
+		if i := strings.LastIndex(prefix, "/"); i > 0 {
+			p, err := l.filePath(prefix[:i])
+			if err != nil {
+				send(ObjectInfo{Err: err})
+				return
+			}
+			start = p
+		}
+
+		if !recursive {
+			entries, err := os.ReadDir(start)
+			if err != nil {
+				if !errors.Is(err, fs.ErrNotExist) {
+					send(ObjectInfo{Err: err})
+				}
+				return
+			}
+			for _, e := range entries {
+				key := l.key(filepath.Join(start, e.Name()))
+				if !strings.HasPrefix(key, prefix) || strings.HasPrefix(e.Name(), tempPrefix) {
+					continue
+				}
+				if e.IsDir() {
+					if !send(ObjectInfo{Key: key + "/"}) {
+						return
+					}
+					continue
+				}
+				fi, err := e.Info()
+				if err != nil {
+					continue
+				}
+				if !send(l.info(key, fi)) {
+					return
+				}
+			}
+			return
+		}
+
+		err := filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() || strings.HasPrefix(d.Name(), tempPrefix) {
+				return nil
+			}
+			key := l.key(p)
+			if !strings.HasPrefix(key, prefix) {
+				return nil
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			if !send(l.info(key, fi)) {
+				return ctx.Err()
+			}
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			send(ObjectInfo{Err: err})
+		}
+	}()
+	return out
+}
+
+func (l *Local) Move(_ context.Context, src, dst string) error {
+	sp, err := l.filePath(src)
+	if err != nil {
+		return err
+	}
+	dp, err := l.filePath(dst)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dp), 0o755); err != nil {
+		return err
+	}
+	return notFound(os.Rename(sp, dp))
+}
+
+// Copy 使用硬链接复制，不复制文件内容；文件系统不支持硬链接时复制文件内容
+func (l *Local) Copy(ctx context.Context, src, dst string) error {
+	sp, err := l.filePath(src)
+	if err != nil {
+		return err
+	}
+	dp, err := l.filePath(dst)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dp), 0o755); err != nil {
+		return err
+	}
+	if err := os.Remove(dp); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	err = os.Link(sp, dp)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		return notFound(err)
+	}
+
+	f, err := os.Open(sp)
+	if err != nil {
+		return notFound(err)
+	}
+	defer f.Close()
+	return l.Put(ctx, dst, f, -1, "")
+}
+
+func (l *Local) Delete(_ context.Context, key string) error {
+	p, err := l.filePath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// PresignGet 生成由内置HTTP服务提供的签名URL，需配置 BaseURL
+func (l *Local) PresignGet(_ context.Context, key string, expiry time.Duration) (*url.URL, error) {
+	if l.baseURL == "" {
+		return nil, errors.New("local store public url not configured")
+	}
+	if _, err := l.filePath(key); err != nil {
+		return nil, err
+	}
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	segments := strings.Split(strings.TrimPrefix(key, "/"), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	u, err := url.Parse(l.baseURL + "/" + strings.Join(segments, "/"))
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("sig", l.sign(key, expires))
+	u.RawQuery = q.Encode()
+	return u, nil
+}
+
+func (l *Local) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(strings.TrimPrefix(key, "/") + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验签名URL的参数
+func (l *Local) Verify(key, expires, sig string) error {
+	ts, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return errors.New("invalid expires")
+	}
+	if time.Now().Unix() > ts {
+		return errors.New("url expired")
+	}
+	if !hmac.Equal([]byte(sig), []byte(l.sign(key, expires))) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// ServeObject 校验签名后返回对象内容，key 为路由中的对象路径
+func (l *Local) ServeObject(w http.ResponseWriter, r *http.Request, key string) {
+	q := r.URL.Query()
+	if err := l.Verify(key, q.Get("expires"), q.Get("sig")); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	p, err := l.filePath(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+}
+
+// Notify 监听根目录下的文件变化。
+// 外部程序（如 ffmpeg）直接写入的文件在最后一次写入 settle 时长后才发出创建事件，避免读到不完整的文件
+func (l *Local) Notify(ctx context.Context, prefix string) <-chan Event {
+	out := make(chan Event)
+	go func() {
+		defer close(out)
+		send := func(ev Event) bool {
+			select {
+			case out <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			send(Event{Err: err})
+			return
+		}
+		defer watcher.Close()
+
+		pending := make(map[string]time.Time) // 写入中的文件 -> 最后写入时间
+		touch := func(p string) { pending[p] = time.Now() }
+		// watchTree 递归监听目录（fsnotify 不支持递归），目录中已有的文件作为新文件处理
+		watchTree := func(dir string, existing bool) error {
+			return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return nil
+				}
+				if d.IsDir() {
+					return watcher.Add(p)
+				}
+				if existing {
+					touch(p)
+				}
+				return nil
+			})
+		}
+		if err := watchTree(l.root, false); err != nil {
+			send(Event{Err: err})
+			return
+		}
+
+		ticker := time.NewTicker(l.settle / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				if !send(Event{Err: err}) {
+					return
+				}
+			case e, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if strings.HasPrefix(filepath.Base(e.Name), tempPrefix) {
+					continue
+				}
+				switch {
+				case e.Has(fsnotify.Create):
+					if fi, err := os.Stat(e.Name); err == nil && fi.IsDir() {
+						// 新建目录后可能已有文件写入，一并处理
+						if err := watchTree(e.Name, true); err != nil && !send(Event{Err: err}) {
+							return
+						}
+						continue
+					}
+					touch(e.Name)
+				case e.Has(fsnotify.Write):
+					touch(e.Name)
+				case e.Has(fsnotify.Remove), e.Has(fsnotify.Rename):
+					delete(pending, e.Name)
+					if key := l.key(e.Name); strings.HasPrefix(key, prefix) {
+						if !send(Event{Type: EventDeleted, Key: key}) {
+							return
+						}
+					}
+				}
+			case now := <-ticker.C:
+				var ready []string
+				for p, last := range pending {
+					if now.Sub(last) >= l.settle {
+						ready = append(ready, p)
+						delete(pending, p)
+					}
+				}
+				for _, p := range ready {
+					fi, err := os.Stat(p)
+					if err != nil || fi.IsDir() {
+						continue
+					}
+					if key := l.key(p); strings.HasPrefix(key, prefix) {
+						if !send(Event{Type: EventCreated, Key: key, Size: fi.Size()}) {
+							return
+						}
+					}
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func notFound(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
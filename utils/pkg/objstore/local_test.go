@@ -0,0 +1,216 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocal(t *testing.T) *Local {
+	l, err := NewLocal(t.TempDir(), LocalOptions{BaseURL: "http://127.0.0.1:10086/objects/", Secret: "s3cret", Settle: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func putString(t *testing.T, l *Local, key, content string) {
+	if err := l.Put(context.Background(), key, strings.NewReader(content), int64(len(content)), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func listKeys(l *Local, prefix string, recursive bool) []string {
+	var keys []string
+	for obj := range l.List(context.Background(), prefix, recursive) {
+		keys = append(keys, obj.Key)
+	}
+	return keys
+}
+
+func TestLocalPutGetListMoveDelete(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+
+	putString(t, l, "人数统计/cam1/001.jpg", "a")
+	putString(t, l, "人数统计/cam1/002.jpg", "bb")
+	putString(t, l, "人数统计/cam2/001.jpg", "c")
+
+	r, err := l.Get(ctx, "人数统计/cam1/002.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(r)
+	r.Close()
+	if string(b) != "bb" {
+		t.Fatalf("unexpected content %q", b)
+	}
+	if info, err := l.Stat(ctx, "人数统计/cam1/002.jpg"); err != nil || info.Size != 2 || info.ContentType != "image/jpeg" {
+		t.Fatalf("unexpected stat %+v, %v", info, err)
+	}
+
+	if keys := listKeys(l, "人数统计/cam1/", true); len(keys) != 2 || keys[0] != "人数统计/cam1/001.jpg" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	if keys := listKeys(l, "人数统计/cam", false); len(keys) != 2 || keys[1] != "人数统计/cam2/" {
+		t.Fatalf("unexpected non-recursive keys %v", keys)
+	}
+	if keys := listKeys(l, "", true); len(keys) != 3 {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	if err := l.Move(ctx, "人数统计/cam1/001.jpg", "alerts/人数统计/cam1/001.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Stat(ctx, "人数统计/cam1/001.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found after move, got %v", err)
+	}
+	if _, err := l.Stat(ctx, "alerts/人数统计/cam1/001.jpg"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Delete(ctx, "人数统计/cam2/001.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Delete(ctx, "人数统计/cam2/001.jpg"); err != nil {
+		t.Fatalf("deleting missing object should succeed, got %v", err)
+	}
+	if _, err := l.Get(ctx, "人数统计/cam2/001.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	// key 不能跳出根目录
+	putString(t, l, "../../escape.jpg", "x")
+	if _, err := os.Stat(filepath.Join(l.Root(), "escape.jpg")); err != nil {
+		t.Fatal("key should be confined to root")
+	}
+}
+
+func TestLocalCopy(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+	putString(t, l, "人数统计/cam1/001.jpg", "a")
+
+	// 副本与源对象互不影响，目标已存在时覆盖
+	putString(t, l, "_shadow/cam1/001.jpg", "old")
+	if err := Copy(ctx, l, "人数统计/cam1/001.jpg", "_shadow/cam1/001.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Move(ctx, "人数统计/cam1/001.jpg", "alerts/cam1/001.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := l.Get(ctx, "_shadow/cam1/001.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(r)
+	r.Close()
+	if string(b) != "a" {
+		t.Fatalf("unexpected copy content %q", b)
+	}
+
+	if err := Copy(ctx, l, "人数统计/cam1/missing.jpg", "_shadow/cam1/missing.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestLocalPresign(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+	putString(t, l, "人数统计/cam1/001.jpg", "jpeg")
+
+	u, err := l.PresignGet(ctx, "人数统计/cam1/001.jpg", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(u.String(), "http://127.0.0.1:10086/objects/%E4%BA%BA") {
+		t.Fatalf("unexpected url %s", u)
+	}
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		w := httptest.NewRecorder()
+		l.ServeObject(w, req, strings.TrimPrefix(req.URL.Path, "/objects/"))
+		return w
+	}
+	if w := serve(u.RequestURI()); w.Code != http.StatusOK || w.Body.String() != "jpeg" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+
+	// 篡改 key 或签名
+	tampered := strings.Replace(u.RequestURI(), "001.jpg", "002.jpg", 1)
+	if w := serve(tampered); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for tampered key, got %d", w.Code)
+	}
+
+	expired, _ := l.PresignGet(ctx, "人数统计/cam1/001.jpg", -time.Minute)
+	if w := serve(expired.RequestURI()); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for expired url, got %d", w.Code)
+	}
+
+	if _, err := (&Local{}).PresignGet(ctx, "a.jpg", time.Minute); err == nil {
+		t.Fatal("expected error without base url")
+	}
+}
+
+func TestLocalNotify(t *testing.T) {
+	l := newTestLocal(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := os.MkdirAll(filepath.Join(l.Root(), "人数统计"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	events := l.Notify(ctx, "人数统计/")
+	time.Sleep(50 * time.Millisecond)
+
+	next := func() Event {
+		select {
+		case ev := <-events:
+			if ev.Err != nil {
+				t.Fatal(ev.Err)
+			}
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for event")
+		}
+		return Event{}
+	}
+
+	// 外部程序分多次写入新目录下的文件，写入完成后才发出一次创建事件
+	dir := filepath.Join(l.Root(), "人数统计", "cam1")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, "001.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		f.Write(bytes.Repeat([]byte("x"), 10))
+		time.Sleep(10 * time.Millisecond)
+	}
+	f.Close()
+
+	if ev := next(); ev.Type != EventCreated || ev.Key != "人数统计/cam1/001.jpg" || ev.Size != 30 {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+
+	// 前缀之外的文件不产生事件
+	putString(t, l, "alerts/a.jpg", "a")
+
+	if err := l.Delete(ctx, "人数统计/cam1/001.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if ev := next(); ev.Type != EventDeleted || ev.Key != "人数统计/cam1/001.jpg" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+}
@@ -0,0 +1,177 @@
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// MinIO 基于 MinIO/S3 的对象存储
+type MinIO struct {
+	client *minio.Client
+	bucket string
+}
+
+var _ Store = (*MinIO)(nil)
+
+// NewMinIO 创建 MinIO 对象存储
+func NewMinIO(client *minio.Client, bucket string) *MinIO {
+	return &MinIO{client: client, bucket: bucket}
+}
+
+// Client 底层 MinIO 客户端（用于诊断等 MinIO 专有操作）
+func (m *MinIO) Client() *minio.Client { return m.client }
+
+// Bucket 存储桶名称
+func (m *MinIO) Bucket() string { return m.bucket }
+
+func (m *MinIO) Name() string { return "minio" }
+
+func (m *MinIO) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := m.client.PutObject(ctx, m.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (m *MinIO) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := m.client.GetObject(ctx, m.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject 是惰性的，先 Stat 一次以便对象不存在时立即返回错误
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, toNotFound(err)
+	}
+	return obj, nil
+}
+
+func (m *MinIO) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := m.client.StatObject(ctx, m.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, toNotFound(err)
+	}
+	return fromMinIO(info), nil
+}
+
+func (m *MinIO) List(ctx context.Context, prefix string, recursive bool) <-chan ObjectInfo {
+	out := make(chan ObjectInfo)
+	go func() {
+		defer close(out)
+		for obj := range m.client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: recursive}) {
+			select {
+			case out <- fromMinIO(obj):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Copy 使用 MinIO 服务端复制，不经过本机传输对象内容
+func (m *MinIO) Copy(ctx context.Context, src, dst string) error {
+	_, err := m.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: m.bucket, Object: dst},
+		minio.CopySrcOptions{Bucket: m.bucket, Object: src})
+	if err != nil {
+		return fmt.Errorf("copy object failed: %w", err)
+	}
+	return nil
+}
+
+func (m *MinIO) Move(ctx context.Context, src, dst string) error {
+	if err := m.Copy(ctx, src, dst); err != nil {
+		return err
+	}
+	if err := m.client.RemoveObject(ctx, m.bucket, src, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("%w: %w", ErrSourceNotRemoved, err)
+	}
+	return nil
+}
+
+func (m *MinIO) Delete(ctx context.Context, key string) error {
+	return m.client.RemoveObject(ctx, m.bucket, key, minio.RemoveObjectOptions{})
+}
+
+// DeleteMany 使用 MinIO 批量删除接口
+func (m *MinIO) DeleteMany(ctx context.Context, keys []string) map[string]error {
+	objects := make(chan minio.ObjectInfo, len(keys))
+	for _, key := range keys {
+		objects <- minio.ObjectInfo{Key: key}
+	}
+	close(objects)
+	failed := make(map[string]error)
+	for e := range m.client.RemoveObjects(ctx, m.bucket, objects, minio.RemoveObjectsOptions{}) {
+		if e.Err != nil {
+			failed[e.ObjectName] = e.Err
+		}
+	}
+	return failed
+}
+
+func (m *MinIO) PresignGet(ctx context.Context, key string, expiry time.Duration) (*url.URL, error) {
+	return m.client.PresignedGetObject(ctx, m.bucket, key, expiry, nil)
+}
+
+func (m *MinIO) Notify(ctx context.Context, prefix string) <-chan Event {
+	out := make(chan Event)
+	go func() {
+		defer close(out)
+		ch := m.client.ListenBucketNotification(ctx, m.bucket, prefix, "", []string{
+			"s3:ObjectCreated:*", // 对象创建事件（包括Put、Post、Copy等）
+			"s3:ObjectRemoved:*", // 对象删除事件（包括Delete、DeleteMarkerCreated等）
+		})
+		for info := range ch {
+			if info.Err != nil {
+				select {
+				case out <- Event{Err: info.Err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+			for _, record := range info.Records {
+				ev := Event{Key: record.S3.Object.Key, Size: record.S3.Object.Size}
+				// 事件中的对象名是URL编码的
+				if key, err := url.QueryUnescape(ev.Key); err == nil {
+					ev.Key = key
+				}
+				switch {
+				case strings.HasPrefix(record.EventName, "s3:ObjectCreated:"):
+					ev.Type = EventCreated
+				case strings.HasPrefix(record.EventName, "s3:ObjectRemoved:"):
+					ev.Type = EventDeleted
+				default:
+					continue
+				}
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func fromMinIO(info minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		LastModified: info.LastModified,
+		ContentType:  info.ContentType,
+		Err:          info.Err,
+	}
+}
+
+func toNotFound(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+// Package objstore 对象存储抽象，屏蔽 MinIO 与本地磁盘的差异
+package objstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"time"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("object not found")
+
+// ErrSourceNotRemoved 移动时目标已写入，但源对象删除失败
+var ErrSourceNotRemoved = errors.New("source object not removed")
+
+// ObjectInfo 对象信息
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ContentType  string
+	Err          error // 列举出错时非空
+}
+
+// EventType 对象事件类型
+type EventType string
+
+const (
+	EventCreated EventType = "created"
+	EventDeleted EventType = "deleted"
+)
+
+// Event 对象创建/删除事件
+type Event struct {
+	Type EventType
+	Key  string
+	Size int64
+	Err  error // 监听出错时非空
+}
+
+// Store 对象存储
+type Store interface {
+	// Put 写入对象，size 为 -1 时读到 EOF
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get 读取对象，调用方负责关闭
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat 获取对象信息，对象不存在时返回错误
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// List 按前缀列举对象，ctx 取消或列举完成后关闭通道
+	List(ctx context.Context, prefix string, recursive bool) <-chan ObjectInfo
+	// Move 移动对象
+	Move(ctx context.Context, src, dst string) error
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// PresignGet 生成带有效期的下载URL
+	PresignGet(ctx context.Context, key string, expiry time.Duration) (*url.URL, error)
+	// Notify 监听前缀下对象的创建和删除事件，ctx 取消或连接断开后关闭通道
+	Notify(ctx context.Context, prefix string) <-chan Event
+	// Name 存储类型：minio|local
+	Name() string
+}
+
+// Copier 支持服务端复制的存储
+type Copier interface {
+	Copy(ctx context.Context, src, dst string) error
+}
+
+// Copy 复制对象；存储不支持服务端复制时读出后重新写入
+func Copy(ctx context.Context, s Store, src, dst string) error {
+	if c, ok := s.(Copier); ok {
+		return c.Copy(ctx, src, dst)
+	}
+	info, err := s.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+	r, err := s.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return s.Put(ctx, dst, r, info.Size, info.ContentType)
+}
+
+// BatchDeleter 支持批量删除的存储
+type BatchDeleter interface {
+	DeleteMany(ctx context.Context, keys []string) map[string]error
+}
+
+// DeleteMany 批量删除对象，返回删除失败的对象及原因；存储不支持批量删除时逐个删除
+func DeleteMany(ctx context.Context, s Store, keys []string) map[string]error {
+	if bd, ok := s.(BatchDeleter); ok {
+		return bd.DeleteMany(ctx, keys)
+	}
+	failed := make(map[string]error)
+	for _, key := range keys {
+		if err := s.Delete(ctx, key); err != nil {
+			failed[key] = err
+		}
+	}
+	return failed
+}
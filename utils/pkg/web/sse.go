@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -37,10 +38,14 @@ import (
 
 */
 type SSE struct {
-	Headers map[string]string
-	stream  chan Event
-	timeout time.Duration
-	cancel  context.CancelFunc
+	Headers   map[string]string
+	Heartbeat time.Duration // 大于0时按间隔发送注释行保持连接
+	stream    chan Event
+	timeout   time.Duration
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	closed bool
 }
 
 type Event struct {
@@ -63,9 +68,35 @@ func (s *SSE) Publish(v Event) {
 	s.stream <- v
 }
 
+// TryPublish 非阻塞发送，缓冲区已满或已关闭时返回 false
+func (s *SSE) TryPublish(v Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.stream <- v:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stream 待发送的事件，关闭后关闭；用于以其它协议（如 WebSocket）转发
+func (s *SSE) Stream() <-chan Event {
+	return s.stream
+}
+
+// Close 关闭连接，可重复调用
 func (s *SSE) Close() {
-	cancel := s.cancel
-	if cancel != nil {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.cancel != nil {
 		s.cancel()
 	}
 	close(s.stream)
@@ -83,14 +114,32 @@ func (s *SSE) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		w.Header().Set(k, v)
 	}
 
+	rc.Flush()
+
 	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	s.mu.Lock()
 	s.cancel = cancel
+	s.mu.Unlock()
+
+	var heartbeat <-chan time.Time
+	if s.Heartbeat > 0 {
+		ticker := time.NewTicker(s.Heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case ev := <-s.stream:
+		case <-heartbeat:
+			fmt.Fprint(w, ": ping\n\n")
+			rc.Flush()
+		case ev, ok := <-s.stream:
+			if !ok {
+				return
+			}
 			if len(ev.Data) == 0 {
 				continue
 			}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"strconv"
+	"sync"
 	"time"
 
 	"easydarwin/utils/pkg/orm"
@@ -20,10 +21,27 @@ type AlarmMsg struct {
 	Msg       string
 }
 
+const (
+	defaultHistorySize = 1000
+	defaultBufferSize  = 256
+	sessionTimeout     = 365 * 24 * time.Hour
+)
+
 type Storer interface {
 	MsgPush() MsgPushStorer
 }
 
+// Event 带序号的推送事件
+type Event struct {
+	ID      uint64          `json:"id"`    // 递增序号，断线重连时通过 Last-Event-ID 续传
+	Event   string          `json:"event"` // 事件类型
+	Data    json.RawMessage `json:"data"`
+	Payload any             `json:"-"` // 原始数据，用于按会话过滤
+}
+
+// Filter 按会话过滤事件，返回false时不推送
+type Filter func(Event) bool
+
 type Core struct {
 	storer            Storer
 	SSE               *web.SSE
@@ -31,25 +49,129 @@ type Core struct {
 
 	pushMsgCh chan *Message
 
-	session conc.Map[*web.SSE, struct{}]
+	session conc.Map[*web.SSE, Filter]
+
+	// 带序号的事件，保留最近的事件用于断线续传
+	mu         sync.Mutex
+	seq        uint64
+	history    []Event // 环形缓冲区
+	next       int
+	full       bool
+	bufferSize int
 }
 
+// NewCore storer 为nil时不保存消息（PushMsgWithSave 不可用）
 func NewCore(storer Storer) *Core {
 	core := Core{
 		storer:            storer,
 		SSE:               web.NewSSE(200, time.Minute),
 		pushMsgCh:         make(chan *Message, 24),
 		pushMsgWithSaveCh: make(chan AlarmMsg, 200),
+		history:           make([]Event, defaultHistorySize),
+		bufferSize:        defaultBufferSize,
 	}
 	// 测试时请打开下列代码
 	// go core.msgtest()
-	go core.notifyWithSave()
+	if storer != nil {
+		go core.notifyWithSave()
+	}
 	go core.notifyAll()
 	return &core
 }
 
+// SetStreamSize 设置保留的事件数和每个会话缓冲的事件数，应在推送事件前调用
+func (c *Core) SetStreamSize(historySize, bufferSize int) {
+	if historySize <= 0 {
+		historySize = defaultHistorySize
+	}
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.history = make([]Event, historySize)
+	c.next, c.full = 0, false
+	c.bufferSize = bufferSize
+}
+
 func (c *Core) AddSession(sse *web.SSE) {
-	c.session.Store(sse, struct{}{})
+	c.session.Store(sse, nil)
+}
+
+// Subscribe 创建按 filter 过滤的会话，lastEventID 大于0时先补发保留的之后的事件
+// （大于当前序号时说明服务已重启，补发保留的全部事件）；
+// 会话缓冲区写满时关闭该会话，不阻塞其它会话，客户端重连后续传
+func (c *Core) Subscribe(lastEventID uint64, filter Filter) *web.SSE {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var replay []Event
+	if lastEventID > 0 {
+		if lastEventID > c.seq {
+			lastEventID = 0
+		}
+		for _, ev := range c.snapshot() {
+			if ev.ID > lastEventID && (filter == nil || filter(ev)) {
+				replay = append(replay, ev)
+			}
+		}
+	}
+
+	sse := web.NewSSE(max(c.bufferSize, len(replay)), sessionTimeout)
+	for _, ev := range replay {
+		sse.TryPublish(ev.webEvent())
+	}
+	if filter == nil {
+		filter = func(Event) bool { return true }
+	}
+	c.session.Store(sse, filter)
+	return sse
+}
+
+// Publish 推送带序号的事件，payload 序列化为JSON作为事件数据
+func (c *Core) Publish(event string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	ev := Event{ID: c.seq, Event: event, Data: data, Payload: payload}
+	c.history[c.next] = ev
+	c.next = (c.next + 1) % len(c.history)
+	if c.next == 0 {
+		c.full = true
+	}
+
+	c.session.Range(func(sse *web.SSE, filter Filter) bool {
+		// 只推送给通过 Subscribe 订阅的会话
+		if filter == nil || !filter(ev) {
+			return true
+		}
+		if !sse.TryPublish(ev.webEvent()) {
+			c.session.Delete(sse)
+			sse.Close()
+		}
+		return true
+	})
+	return nil
+}
+
+// snapshot 按时间顺序返回保留的事件，调用方需持有 c.mu
+func (c *Core) snapshot() []Event {
+	if !c.full {
+		return c.history[:c.next]
+	}
+	events := make([]Event, 0, len(c.history))
+	events = append(events, c.history[c.next:]...)
+	return append(events, c.history[:c.next]...)
+}
+
+func (ev Event) webEvent() web.Event {
+	return web.Event{ID: strconv.FormatUint(ev.ID, 10), Event: ev.Event, Data: ev.Data}
 }
 
 func (c *Core) DelSession(sse *web.SSE) {
@@ -108,8 +230,8 @@ func (c *Core) PushMsg(msg *Message) {
 func (c *Core) notifyAll() {
 	for msg := range c.pushMsgCh {
 		b, _ := json.Marshal(msg)
-		c.session.Range(func(key *web.SSE, _ struct{}) bool {
-			key.Publish(web.Event{
+		c.session.Range(func(key *web.SSE, _ Filter) bool {
+			key.TryPublish(web.Event{
 				Event: "msg",
 				Data:  b,
 			})
@@ -0,0 +1,60 @@
+package msgpush
+
+import "testing"
+
+func TestCoreResume(t *testing.T) {
+	c := NewCore(nil)
+	c.SetStreamSize(3, 2)
+	for i := 1; i <= 5; i++ {
+		if err := c.Publish("n", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 只保留最近3条事件
+	sse := c.Subscribe(1, nil)
+	var ids []string
+	for len(sse.Stream()) > 0 {
+		ids = append(ids, (<-sse.Stream()).ID)
+	}
+	if len(ids) != 3 || ids[0] != "3" || ids[2] != "5" {
+		t.Fatalf("replayed ids = %v, want [3 4 5]", ids)
+	}
+	c.DelSession(sse)
+	sse.Close()
+
+	// 服务重启后客户端携带的序号大于当前序号，补发全部保留的事件
+	if sse := c.Subscribe(100, nil); len(sse.Stream()) != 3 {
+		t.Fatalf("replayed %d events after restart, want 3", len(sse.Stream()))
+	}
+}
+
+func TestCoreFilterAndSlowSession(t *testing.T) {
+	c := NewCore(nil)
+	c.SetStreamSize(10, 2)
+	even := c.Subscribe(0, func(ev Event) bool { return ev.Payload.(int)%2 == 0 })
+	slow := c.Subscribe(0, nil)
+
+	for i := 1; i <= 4; i++ {
+		c.Publish("n", i)
+	}
+
+	if got := string((<-even.Stream()).Data); got != "2" {
+		t.Fatalf("filtered event = %s, want 2", got)
+	}
+	if got := string((<-even.Stream()).Data); got != "4" {
+		t.Fatalf("filtered event = %s, want 4", got)
+	}
+
+	// 缓冲区写满的会话被关闭并移除
+	<-slow.Stream()
+	<-slow.Stream()
+	if _, ok := <-slow.Stream(); ok {
+		t.Fatal("slow session should be closed")
+	}
+	if c.session.Len() != 1 {
+		t.Fatalf("sessions = %d, want 1", c.session.Len())
+	}
+	c.DelSession(slow)
+	slow.Close() // 重复关闭不会panic
+}
@@ -0,0 +1,130 @@
+package msgpushapi
+
+import (
+	"easydarwin/utils/plugin/core/msgpush"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	streamHeartbeat    = 30 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+// checkOrigin 只允许同源或 allowedOrigins 中的来源打开 WebSocket，防止其它网页借用已登录浏览器的身份；
+// 不带 Origin 请求头的非浏览器客户端不受限制
+func checkOrigin(r *http.Request, allowedOrigins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, v := range allowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(v, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// LastEventID 断线续传的事件序号：SSE 使用 Last-Event-ID 请求头（浏览器自动携带），WebSocket 使用 last_event_id 参数
+func LastEventID(c *gin.Context) uint64 {
+	v := c.GetHeader("Last-Event-ID")
+	if v == "" {
+		v = c.Query("last_event_id")
+	}
+	id, _ := strconv.ParseUint(v, 10, 64)
+	return id
+}
+
+// ServeSSE 以SSE推送订阅的事件，直到客户端断开或推送过慢被断开
+func ServeSSE(c *gin.Context, core *msgpush.Core, filter msgpush.Filter) {
+	sse := core.Subscribe(LastEventID(c), filter)
+	defer sse.Close()
+	defer core.DelSession(sse)
+
+	sse.Heartbeat = streamHeartbeat
+	sse.Headers = map[string]string{"X-Accel-Buffering": "no"}
+	sse.ServeHTTP(c.Writer, c.Request)
+}
+
+// wsMessage WebSocket 推送的消息
+type wsMessage struct {
+	ID    uint64          `json:"id"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// ServeWebSocket 以WebSocket推送订阅的事件，每条消息为 {"id": 1, "event": "...", "data": {...}}
+// 只接受同源请求，allowedOrigins 为额外允许的来源（如 https://example.com）
+func ServeWebSocket(c *gin.Context, core *msgpush.Core, filter msgpush.Filter, allowedOrigins []string) {
+	lastEventID := LastEventID(c)
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return checkOrigin(r, allowedOrigins)
+		},
+	}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sse := core.Subscribe(lastEventID, filter)
+	defer sse.Close()
+	defer core.DelSession(sse)
+
+	// 读取客户端消息以处理 close/pong，连接断开时退出
+	closed := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+		case ev, ok := <-sse.Stream():
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client too slow"),
+					time.Now().Add(streamWriteTimeout))
+				return
+			}
+			id, _ := strconv.ParseUint(ev.ID, 10, 64)
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := conn.WriteJSON(wsMessage{ID: id, Event: ev.Event, Data: ev.Data}); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package msgpushapi
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	allowed := []string{"https://console.example.com/"}
+	cases := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"http://nvr.local:10086", true},
+		{"HTTP://NVR.LOCAL:10086", true},
+		{"https://console.example.com", true},
+		{"https://evil.example.com", false},
+		{"http://nvr.local:8080", false},
+		{"://bad", false},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "http://nvr.local:10086/api/v1/alerts/ws", nil)
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		if got := checkOrigin(r, allowed); got != c.want {
+			t.Errorf("origin %q: got %v, want %v", c.origin, got, c.want)
+		}
+	}
+}
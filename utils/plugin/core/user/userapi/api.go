@@ -65,11 +65,22 @@ func RegisterUser(
 
 	// users.PUT("/:id/reset-password",u.resetUsername)
 	// 开发者账户
-	users.POST("/apps", u.createApp)
-	users.PUT("/apps/:id/reset", u.resetSecret)
-	users.PUT("/apps/:id", u.editApp)
-	users.GET("/apps", u.findApps)
-	users.DELETE("/apps/:id", u.deleteApp)
+	u.registerApps(users)
+}
+
+// RegisterApps 只注册开发者账户（app_id + secret）相关接口，用于不使用本模块登录的程序
+// 中间件需要设置操作用户的 uid（web.GetUID），重置、编辑和删除时校验操作用户不是开发者账户
+func RegisterApps(g gin.IRouter, usr user.Core, hf ...gin.HandlerFunc) {
+	u := User{core: usr}
+	u.registerApps(g.Group("", hf...))
+}
+
+func (u User) registerApps(g gin.IRouter) {
+	g.POST("/apps", u.createApp)
+	g.PUT("/apps/:id/reset", u.resetSecret)
+	g.PUT("/apps/:id", u.editApp)
+	g.GET("/apps", u.findApps)
+	g.DELETE("/apps/:id", u.deleteApp)
 }
 
 func (u User) create(c *gin.Context, in *user.CreateUserInput) (any, error) {